@@ -0,0 +1,62 @@
+// Command reconciliar-archivos finds uploaded files that no group, resolution or
+// attachment references, and rows whose file is missing from storage.
+//
+// It uses the same environment as the server (DB_*, STORAGE_DRIVER, ...):
+//
+//	go run ./cmd/reconciliar-archivos -dry-run            # report only
+//	go run ./cmd/reconciliar-archivos                     # report and flag rows with archivoFaltante
+//	go run ./cmd/reconciliar-archivos -eliminar           # also delete orphan files
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/database"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/jobs"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/storage"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "only report, do not flag rows or delete files")
+	eliminar := flag.Bool("eliminar", false, "delete orphan files")
+	antiguedad := flag.Duration("antiguedad-minima", time.Hour, "skip files younger than this (uploads in progress)")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: Error loading .env file: %v", err)
+	}
+
+	db, err := database.InitDB()
+	if err != nil {
+		log.Fatal("Failed to initialize database:", err)
+	}
+	defer db.Close()
+
+	store, err := storage.NewFromEnv()
+	if err != nil {
+		log.Fatal("Failed to initialize file storage:", err)
+	}
+
+	reporte, err := jobs.ReconciliarArchivos(context.Background(), db, store, jobs.OpcionesReconciliacion{
+		DryRun:           *dryRun,
+		Eliminar:         *eliminar,
+		AntiguedadMinima: *antiguedad,
+	})
+	if err != nil {
+		log.Fatal("Reconciliation failed:", err)
+	}
+
+	log.Printf("%d files checked, %d orphan files (%d bytes), %d rows with missing file",
+		reporte.ArchivosRevisados, len(reporte.Huerfanos), reporte.BytesHuerfanos, len(reporte.Faltantes))
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(reporte); err != nil {
+		log.Fatal(err)
+	}
+}
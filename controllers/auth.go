@@ -9,9 +9,11 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/middleware"
 	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
 	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/repository"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
 )
 
 // RegisterHandler handles user registration.
@@ -42,10 +44,11 @@ func RegisterHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Create user model
+		// Create user model. Self-registered users always get the default role.
 		user := &models.Usuario{
 			Email:    creds.Email,
 			Password: creds.Password, // Pass plaintext password to repository
+			Rol:      models.RolUsuario,
 		}
 
 		// Create user in repository (handles hashing)
@@ -104,11 +107,14 @@ func LoginHandler(db *sql.DB) http.HandlerFunc {
 		// --- Generate JWT Token ---
 		// Set token claims
 		expirationTime := time.Now().Add(24 * time.Hour) // Token valid for 24 hours
-		claims := &jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Subject:   strconv.Itoa(user.ID), // Use user ID as subject
-			// Issuer:    "your-app-name", // Optional: Add issuer
+		claims := &middleware.Claims{
+			Rol: user.Rol, // Application role, checked by middleware.RequireRole
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(expirationTime),
+				IssuedAt:  jwt.NewNumericDate(time.Now()),
+				Subject:   strconv.Itoa(user.ID), // Use user ID as subject
+				// Issuer:    "your-app-name", // Optional: Add issuer
+			},
 		}
 
 		// Create token with claims
@@ -129,3 +135,49 @@ func LoginHandler(db *sql.DB) http.HandlerFunc {
 		})
 	}
 }
+
+// UpdateUsuarioRolHandler lets an administrator change a user's application role.
+// Expects a JSON body: {"rol": "revisor"}
+func UpdateUsuarioRolHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		var body struct {
+			Rol string `json:"rol"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if body.Rol != models.RolUsuario && body.Rol != models.RolRevisor && body.Rol != models.RolAdmin {
+			http.Error(w, "Invalid role. Use 'usuario', 'revisor' or 'admin'", http.StatusBadRequest)
+			return
+		}
+
+		user, err := repository.GetUsuarioByID(db, id)
+		if err != nil {
+			log.Printf("Error getting user by ID: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if user == nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		if err := repository.UpdateUsuarioRol(db, id, body.Rol); err != nil {
+			log.Printf("Error updating user role: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		user.Rol = body.Rol
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(user)
+	}
+}
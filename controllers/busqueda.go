@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/repository"
+)
+
+// Limits of BuscarHandler's per-type result counts.
+const (
+	defaultResultadosPorTipo = 5
+	maxResultadosPorTipo     = 20
+)
+
+// parametrosLimite maps each result type to the query parameter overriding its limit.
+var parametrosLimite = map[string]string{
+	models.TipoResultadoGrupo:        "limitGrupos",
+	models.TipoResultadoInvestigador: "limitInvestigadores",
+	models.TipoResultadoDocumento:    "limitDocumentos",
+}
+
+// limitesBusqueda reads the per-type limits of a global search: ?tipos= restricts the types
+// searched (all by default), ?limit= sets the limit of every type and ?limitGrupos=,
+// ?limitInvestigadores=, ?limitDocumentos= override it per type.
+func limitesBusqueda(r *http.Request) (map[string]int, error) {
+	tipos := listParam(r, "tipos")
+	if len(tipos) == 0 {
+		tipos = models.TiposResultado
+	}
+
+	parseLimite := func(key string, porDefecto int) (int, error) {
+		value := r.URL.Query().Get(key)
+		if value == "" {
+			return porDefecto, nil
+		}
+		limite, err := strconv.Atoi(value)
+		if err != nil || limite <= 0 {
+			return 0, fmt.Errorf("invalid %s", key)
+		}
+		return min(limite, maxResultadosPorTipo), nil
+	}
+	general, err := parseLimite("limit", defaultResultadosPorTipo)
+	if err != nil {
+		return nil, err
+	}
+
+	limites := map[string]int{}
+	for _, tipo := range tipos {
+		param, ok := parametrosLimite[tipo]
+		if !ok {
+			return nil, fmt.Errorf("invalid tipo '%s' (allowed: %s)", tipo, strings.Join(models.TiposResultado, ", "))
+		}
+		if limites[tipo], err = parseLimite(param, general); err != nil {
+			return nil, err
+		}
+	}
+	return limites, nil
+}
+
+// mezclarResultados merges the hits of each type, listed in models.TiposResultado order, by
+// relevance. Each type ranks on its own scale (ts_rank over different documents, or name
+// similarity), so every relevance is first divided by the best one of its type; ties keep
+// the order of the types.
+func mezclarResultados(porTipo [][]models.ResultadoBusqueda) []models.ResultadoBusqueda {
+	resultados := []models.ResultadoBusqueda{}
+	for _, lista := range porTipo {
+		var maxima float64
+		for _, res := range lista {
+			maxima = max(maxima, res.Relevancia)
+		}
+		for _, res := range lista {
+			if maxima > 0 {
+				res.Relevancia /= maxima
+			}
+			resultados = append(resultados, res)
+		}
+	}
+	sort.SliceStable(resultados, func(i, j int) bool {
+		return resultados[i].Relevancia > resultados[j].Relevancia
+	})
+	return resultados
+}
+
+// BuscarHandler searches groups, investigators and the text of group documents for ?q=
+// (websearch syntax) at once, and returns the hits merged by relevance (see
+// mezclarResultados), each tagged with its type, along with the total number of matches
+// per type. Groups and documents follow the
+// same visibility rules as GetGruposHandler.
+//
+// Projects are not a result type because the schema has no project entity: a group's
+// research is recorded in its lineaInvestigacion and tipoInvestigacion, which the group
+// search covers, and in its documents (work plans, annual reports), which the document
+// search covers. A project type belongs in models.TiposResultado once projects are stored.
+func BuscarHandler(db *sql.DB) http.HandlerFunc {
+	umbral := umbralSimilitud()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := strings.TrimSpace(r.URL.Query().Get("q"))
+		if q == "" {
+			http.Error(w, "Missing required parameter: q", http.StatusBadRequest)
+			return
+		}
+		limites, err := limitesBusqueda(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		vis := visibilidadGrupos(r)
+
+		// Each search fills its own slot, so the goroutines share nothing
+		type parcial struct {
+			resultados []models.ResultadoBusqueda
+			total      int
+			err        error
+		}
+		busquedas := map[string]func(limite int) parcial{
+			models.TipoResultadoGrupo: func(limite int) parcial {
+				filter := repository.GrupoFilter{Q: q, Visibilidad: vis}
+				grupos, total, _, err := repository.SearchGrupos(db, filter, repository.Pagina{Limit: limite})
+				p := parcial{total: total, err: err}
+				for _, g := range grupos {
+					p.resultados = append(p.resultados, models.ResultadoBusqueda{
+						Tipo: models.TipoResultadoGrupo, Titulo: g.Grupo.Nombre, Relevancia: g.Relevancia, Datos: g,
+					})
+				}
+				return p
+			},
+			models.TipoResultadoInvestigador: func(limite int) parcial {
+				filter := repository.InvestigadorFilter{Q: q, Umbral: umbral}
+				investigadores, total, _, err := repository.SearchInvestigadores(db, filter, repository.Pagina{Limit: limite})
+				p := parcial{total: total, err: err}
+				for _, inv := range investigadores {
+					p.resultados = append(p.resultados, models.ResultadoBusqueda{
+						Tipo: models.TipoResultadoInvestigador, Titulo: inv.Nombre + " " + inv.Apellido, Relevancia: inv.Relevancia, Datos: inv,
+					})
+				}
+				return p
+			},
+			models.TipoResultadoDocumento: func(limite int) parcial {
+				documentos, total, err := repository.SearchDocumentos(db, q, vis, limite)
+				p := parcial{total: total, err: err}
+				for _, d := range documentos {
+					p.resultados = append(p.resultados, models.ResultadoBusqueda{
+						Tipo: models.TipoResultadoDocumento, Titulo: d.Nombre, Relevancia: d.Relevancia, Datos: d,
+					})
+				}
+				return p
+			},
+		}
+
+		parciales := make(map[string]*parcial, len(limites))
+		var wg sync.WaitGroup
+		for tipo, limite := range limites {
+			p := &parcial{}
+			parciales[tipo] = p
+			wg.Add(1)
+			go func(buscar func(int) parcial) {
+				defer wg.Done()
+				*p = buscar(limite)
+			}(busquedas[tipo])
+		}
+		wg.Wait()
+
+		respuesta := models.BusquedaGlobal{Q: q, Totales: map[string]int{}}
+		var porTipo [][]models.ResultadoBusqueda
+		for _, tipo := range models.TiposResultado {
+			p, ok := parciales[tipo]
+			if !ok {
+				continue
+			}
+			if p.err != nil {
+				log.Printf("Error in global search of %s: %v", tipo, p.err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			porTipo = append(porTipo, p.resultados)
+			respuesta.Totales[tipo] = p.total
+		}
+		respuesta.Resultados = mezclarResultados(porTipo)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(respuesta)
+	}
+}
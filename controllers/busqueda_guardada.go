@@ -0,0 +1,271 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/middleware"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/repository"
+	"github.com/gorilla/mux"
+)
+
+// parametrosPagina are the GET /grupos parameters that select a page rather than the
+// results, so they are not saved with a search.
+var parametrosPagina = []string{"page", "limit", "after", "before"}
+
+// busquedaGuardadaRequest is the body of the saved search create and update endpoints.
+type busquedaGuardadaRequest struct {
+	Nombre     string `json:"nombre"`
+	Parametros string `json:"parametros"` // Query string of GET /grupos, with or without the leading '?'
+	Alertas    bool   `json:"alertas"`
+}
+
+// parametrosBusqueda validates the GET /grupos query string of a saved search and returns
+// it normalized, without pagination parameters. Errors are meant for a 400 response.
+func parametrosBusqueda(raw string) (string, error) {
+	parametros, err := url.ParseQuery(strings.TrimPrefix(strings.TrimSpace(raw), "?"))
+	if err != nil {
+		return "", err
+	}
+	for _, key := range parametrosPagina {
+		parametros.Del(key)
+	}
+	if _, err := repository.ParseGrupoFilter(parametros); err != nil {
+		return "", err
+	}
+	return parametros.Encode(), nil
+}
+
+// decodeBusquedaGuardada reads and validates a saved search from the request body into b,
+// writing the error response itself when it is invalid.
+func decodeBusquedaGuardada(w http.ResponseWriter, r *http.Request, b *models.BusquedaGuardada) bool {
+	var req busquedaGuardadaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body format", http.StatusBadRequest)
+		return false
+	}
+	req.Nombre = strings.TrimSpace(req.Nombre)
+	if req.Nombre == "" {
+		http.Error(w, "Missing required field: nombre", http.StatusBadRequest)
+		return false
+	}
+	parametros, err := parametrosBusqueda(req.Parametros)
+	if err != nil {
+		http.Error(w, "Invalid parametros: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	b.Nombre, b.Parametros, b.Alertas = req.Nombre, parametros, req.Alertas
+	return true
+}
+
+// getBusquedaFromRequest loads the saved search addressed by {id}, writing the error
+// response itself when it cannot be returned. Searches of other users are reported as not found.
+func getBusquedaFromRequest(db *sql.DB, w http.ResponseWriter, r *http.Request) *models.BusquedaGuardada {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid saved search ID", http.StatusBadRequest)
+		return nil
+	}
+	b, err := repository.GetBusquedaGuardadaByID(db, id)
+	if err != nil {
+		log.Printf("Error getting saved search by ID: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil
+	}
+	userID, _ := middleware.GetUserID(r.Context())
+	if b == nil || b.IDUsuario != userID {
+		http.Error(w, "Saved search not found", http.StatusNotFound)
+		return nil
+	}
+	return b
+}
+
+// CreateBusquedaGuardadaHandler saves a named group search for the current user.
+// Expects JSON with nombre, parametros (the GET /grupos query string, e.g.
+// "tipoInvestigacion=Aplicada&facultad=Ingeniería") and alertas.
+func CreateBusquedaGuardadaHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := middleware.GetUserID(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		b := models.BusquedaGuardada{IDUsuario: userID}
+		if !decodeBusquedaGuardada(w, r, &b) {
+			return
+		}
+		if err := repository.CreateBusquedaGuardada(db, &b); err != nil {
+			log.Printf("Error creating saved search: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(b)
+	}
+}
+
+// GetBusquedasGuardadasHandler lists the saved searches of the current user.
+func GetBusquedasGuardadasHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := middleware.GetUserID(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		busquedas, err := repository.GetBusquedasGuardadasByUsuario(db, userID)
+		if err != nil {
+			log.Printf("Error getting saved searches: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": busquedas})
+	}
+}
+
+// GetBusquedaGuardadaHandler returns one of the current user's saved searches.
+func GetBusquedaGuardadaHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		b := getBusquedaFromRequest(db, w, r)
+		if b == nil {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(b)
+	}
+}
+
+// UpdateBusquedaGuardadaHandler replaces the name, parameters and alert opt-in of one of
+// the current user's saved searches. Changing the parameters restarts its alerts from the
+// current matches.
+func UpdateBusquedaGuardadaHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		b := getBusquedaFromRequest(db, w, r)
+		if b == nil || !decodeBusquedaGuardada(w, r, b) {
+			return
+		}
+		if err := repository.UpdateBusquedaGuardada(db, b); err != nil {
+			log.Printf("Error updating saved search: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(b)
+	}
+}
+
+// DeleteBusquedaGuardadaHandler deletes one of the current user's saved searches and its alerts.
+func DeleteBusquedaGuardadaHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		b := getBusquedaFromRequest(db, w, r)
+		if b == nil {
+			return
+		}
+		if err := repository.DeleteBusquedaGuardada(db, b.ID); err != nil {
+			log.Printf("Error deleting saved search: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GetResultadosBusquedaGuardadaHandler runs a saved search through GET /grupos and returns
+// its response. Parameters of the request (page, limit, after, before, sort, facetas...)
+// are added to the saved ones, replacing those with the same name.
+func GetResultadosBusquedaGuardadaHandler(db *sql.DB) http.HandlerFunc {
+	listarGrupos := GetGruposHandler(db)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		b := getBusquedaFromRequest(db, w, r)
+		if b == nil {
+			return
+		}
+		parametros, err := url.ParseQuery(b.Parametros)
+		if err != nil {
+			log.Printf("Error parsing parameters of saved search %d: %v", b.ID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		for key, values := range r.URL.Query() {
+			parametros[key] = values
+		}
+
+		busqueda := r.Clone(r.Context())
+		busqueda.URL.RawQuery = parametros.Encode()
+		listarGrupos(w, busqueda)
+	}
+}
+
+// GetAlertasHandler lists the alerts of the current user's saved searches with pagination,
+// newest first. ?noLeidas=true returns only unread ones.
+func GetAlertasHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := middleware.GetUserID(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		pag, page, err := paginaFromRequest(r)
+		if err != nil || pag.PorCursor() {
+			http.Error(w, "Alerts are paginated with page and limit", http.StatusBadRequest)
+			return
+		}
+
+		alertas, totalItems, err := repository.GetAlertasByUsuario(db, userID, r.URL.Query().Get("noLeidas") == "true", pag.Limit, pag.Offset)
+		if err != nil {
+			log.Printf("Error getting saved search alerts: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.PaginatedResponse{
+			Data:       alertas,
+			Pagination: paginationMetadata(pag, page, totalItems, repository.Cursores{}),
+		})
+	}
+}
+
+// MarcarAlertasLeidasHandler marks alerts of the current user as read. Expects JSON with
+// ids, the alerts to mark; an empty list marks all of them.
+func MarcarAlertasLeidasHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := middleware.GetUserID(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var req struct {
+			IDs []int `json:"ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body format", http.StatusBadRequest)
+			return
+		}
+
+		marcadas, err := repository.MarcarAlertasLeidas(db, userID, req.IDs)
+		if err != nil {
+			log.Printf("Error marking alerts as read: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"marcadas": marcadas})
+	}
+}
@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+)
+
+func TestMezclarResultados(t *testing.T) {
+	hit := func(tipo, titulo string, relevancia float64) models.ResultadoBusqueda {
+		return models.ResultadoBusqueda{Tipo: tipo, Titulo: titulo, Relevancia: relevancia}
+	}
+	grupo, investigador, documento := models.TipoResultadoGrupo, models.TipoResultadoInvestigador, models.TipoResultadoDocumento
+
+	tests := []struct {
+		name    string
+		porTipo [][]models.ResultadoBusqueda
+		want    []models.ResultadoBusqueda
+	}{
+		{name: "no hits", want: []models.ResultadoBusqueda{}},
+		{
+			// Raw ts_rank of documents is far below the others; it must not bury their best hits
+			name: "each type on its own scale",
+			porTipo: [][]models.ResultadoBusqueda{
+				{hit(grupo, "g1", 0.6), hit(grupo, "g2", 0.3)},
+				{hit(investigador, "i1", 0.1)},
+				{hit(documento, "d1", 0.0625), hit(documento, "d2", 0.046875)},
+			},
+			want: []models.ResultadoBusqueda{
+				hit(grupo, "g1", 1), hit(investigador, "i1", 1), hit(documento, "d1", 1),
+				hit(documento, "d2", 0.75), hit(grupo, "g2", 0.5),
+			},
+		},
+		{
+			name: "type without rank goes last",
+			porTipo: [][]models.ResultadoBusqueda{
+				{hit(investigador, "i1", 0), hit(investigador, "i2", 0)},
+				{hit(documento, "d1", 0.2)},
+			},
+			want: []models.ResultadoBusqueda{hit(documento, "d1", 1), hit(investigador, "i1", 0), hit(investigador, "i2", 0)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mezclarResultados(tt.porTipo)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mezclarResultados =\n%v\nwant\n%v", got, tt.want)
+			}
+		})
+	}
+}
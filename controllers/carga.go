@@ -0,0 +1,633 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/middleware"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/repository"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/scanner"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/storage"
+	"github.com/gorilla/mux"
+)
+
+// Resumable uploads follow the tus 1.0.0 protocol (https://tus.io/protocols/resumable-upload)
+// with the creation, expiration, termination and checksum extensions. Each PATCH is stored
+// as one chunk under cargas/<idCarga>/; when the last byte arrives the chunks are
+// validated, scanned and stored as a group attachment like a regular upload. A chunk is
+// first written under cargas/<idCarga>/tmp/ and only moved to its offset once the offset
+// has been advanced, so a PATCH that loses a race never overwrites the winner's chunk.
+const (
+	tusVersion             = "1.0.0"
+	tusExtensions          = "creation,expiration,termination,checksum"
+	cargaDir               = "cargas"
+	defaultCargaTTL        = 24 * time.Hour
+	defaultCargaMaxMB      = 500
+	statusChecksumMismatch = 460 // tus checksum extension
+)
+
+// cargaConfig returns how long an idle resumable upload is kept (CARGA_TTL) and the
+// largest file accepted through it (CARGA_MAX_MB). Resumable uploads exist for large
+// scanned documents, so they are not bound by the per-category limits.
+func cargaConfig() (time.Duration, int64) {
+	ttl := defaultCargaTTL
+	if ttlStr := os.Getenv("CARGA_TTL"); ttlStr != "" {
+		parsed, err := time.ParseDuration(ttlStr)
+		if err != nil || parsed <= 0 {
+			log.Printf("Warning: invalid CARGA_TTL %q, using %s", ttlStr, defaultCargaTTL)
+		} else {
+			ttl = parsed
+		}
+	}
+	maxMB := int64(defaultCargaMaxMB)
+	if maxStr := os.Getenv("CARGA_MAX_MB"); maxStr != "" {
+		parsed, err := strconv.ParseInt(maxStr, 10, 64)
+		if err != nil || parsed <= 0 {
+			log.Printf("Warning: invalid CARGA_MAX_MB %q ignored", maxStr)
+		} else {
+			maxMB = parsed
+		}
+	}
+	return ttl, maxMB * 1024 * 1024
+}
+
+// cargaPrefix is the storage prefix holding the chunks of an upload.
+func cargaPrefix(idCarga string) string {
+	return cargaDir + "/" + idCarga + "/"
+}
+
+// chunkKey names a chunk by its zero-padded offset, so keys sort in upload order.
+func chunkKey(idCarga string, offset int64) string {
+	return path.Join(cargaDir, idCarga, fmt.Sprintf("%020d", offset))
+}
+
+// tmpChunkPrefix is the storage prefix holding the chunks of an upload not yet accepted.
+func tmpChunkPrefix(idCarga string) string {
+	return cargaPrefix(idCarga) + "tmp/"
+}
+
+// tmpChunkKey returns a new unique key to receive a chunk of an upload before it is accepted.
+func tmpChunkKey(idCarga string) (string, error) {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("error generating chunk key: %w", err)
+	}
+	return tmpChunkPrefix(idCarga) + hex.EncodeToString(suffix), nil
+}
+
+// promoverChunk moves an accepted chunk from its temporary key to key.
+func promoverChunk(ctx context.Context, store storage.Storage, tmpKey, key string) error {
+	reader, info, err := store.Open(ctx, tmpKey)
+	if err != nil {
+		return fmt.Errorf("error opening received chunk: %w", err)
+	}
+	err = store.Save(ctx, key, reader, info.Size, "application/octet-stream")
+	reader.Close()
+	if err != nil {
+		return fmt.Errorf("error storing accepted chunk: %w", err)
+	}
+	return removeFile(store, &tmpKey)
+}
+
+// checkTusResumable rejects requests for another protocol version, as tus requires.
+func checkTusResumable(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		http.Error(w, "Unsupported Tus-Resumable version", http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// parseUploadMetadata decodes the Upload-Metadata header: comma-separated "key base64value" pairs.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for metadata key '%s'", key)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+func setUploadExpires(w http.ResponseWriter, c *models.Carga) {
+	w.Header().Set("Upload-Expires", c.ExpiraEn.UTC().Format(http.TimeFormat))
+}
+
+// OpcionesCargaHandler answers tus discovery requests (OPTIONS /cargas).
+func OpcionesCargaHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, maxSize := cargaConfig()
+		w.Header().Set("Tus-Resumable", tusVersion)
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", tusExtensions)
+		w.Header().Set("Tus-Max-Size", strconv.FormatInt(maxSize, 10))
+		w.Header().Set("Tus-Checksum-Algorithm", "sha256")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// CreateCargaHandler starts a resumable upload of a group attachment (tus creation).
+// Upload-Length is the file size; Upload-Metadata carries filename, idGrupo, categoria and
+// optionally descripcion, visibilidad and checksum (hex SHA-256 of the whole file).
+func CreateCargaHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkTusResumable(w, r) {
+			return
+		}
+		userID, ok := middleware.GetUserID(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("Upload-Defer-Length") != "" {
+			http.Error(w, "Upload-Defer-Length is not supported", http.StatusBadRequest)
+			return
+		}
+		tamano, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+		if err != nil || tamano <= 0 {
+			http.Error(w, "Invalid or missing Upload-Length", http.StatusBadRequest)
+			return
+		}
+		ttl, maxSize := cargaConfig()
+		if tamano > maxSize {
+			w.Header().Set("Tus-Max-Size", strconv.FormatInt(maxSize, 10))
+			writeUploadError(w, &uploadError{
+				Status:  http.StatusRequestEntityTooLarge,
+				Code:    "file_too_large",
+				Message: fmt.Sprintf("File exceeds the %d MB limit for resumable uploads", maxSize/(1024*1024)),
+				Details: map[string]interface{}{"maxBytes": maxSize},
+			})
+			return
+		}
+
+		metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid Upload-Metadata: %v", err), http.StatusBadRequest)
+			return
+		}
+		carga := models.Carga{
+			Categoria:      metadata["categoria"],
+			Descripcion:    strings.TrimSpace(metadata["descripcion"]),
+			Visibilidad:    metadata["visibilidad"],
+			NombreOriginal: path.Base(strings.ReplaceAll(metadata["filename"], "\\", "/")),
+			Tamano:         tamano,
+			Checksum:       strings.ToLower(metadata["checksum"]),
+			IDUsuario:      userID,
+			ExpiraEn:       time.Now().Add(ttl),
+		}
+		if metadata["filename"] == "" {
+			http.Error(w, "Missing required metadata: filename", http.StatusBadRequest)
+			return
+		}
+		carga.IDGrupo, err = strconv.Atoi(metadata["idGrupo"])
+		if err != nil {
+			http.Error(w, "Invalid or missing metadata: idGrupo", http.StatusBadRequest)
+			return
+		}
+		if !categoriaValida(carga.Categoria) {
+			http.Error(w, fmt.Sprintf("Invalid categoria. Use one of: %s", strings.Join(models.CategoriasArchivo, ", ")), http.StatusBadRequest)
+			return
+		}
+		if carga.Visibilidad == "" {
+			carga.Visibilidad = models.VisibilidadInterno
+		}
+		if carga.Visibilidad != models.VisibilidadPublico && carga.Visibilidad != models.VisibilidadInterno {
+			http.Error(w, "Invalid visibilidad. Use 'publico' or 'interno'", http.StatusBadRequest)
+			return
+		}
+		if carga.Checksum != "" {
+			if decoded, err := hex.DecodeString(carga.Checksum); err != nil || len(decoded) != sha256.Size {
+				http.Error(w, "Invalid checksum: expected a hex-encoded SHA-256", http.StatusBadRequest)
+				return
+			}
+		}
+
+		grupo, err := repository.GetGrupoByID(db, carga.IDGrupo)
+		if err != nil {
+			log.Printf("Error getting group by ID for new upload: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if grupo == nil {
+			http.Error(w, "Grupo not found", http.StatusNotFound)
+			return
+		}
+
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			log.Printf("Error generating upload ID: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		carga.ID = hex.EncodeToString(id)
+
+		if err := repository.CreateCarga(db, &carga); err != nil {
+			log.Printf("Error creating upload in repository: %v", err)
+			http.Error(w, "Internal server error creating upload", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Location", "/cargas/"+carga.ID)
+		setUploadExpires(w, &carga)
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+// getCargaFromRequest loads the upload addressed by {idCarga}, writing the error response
+// itself when it cannot be returned. Uploads of other users are reported as not found.
+func getCargaFromRequest(db *sql.DB, w http.ResponseWriter, r *http.Request) *models.Carga {
+	carga, err := repository.GetCargaByID(db, mux.Vars(r)["idCarga"])
+	if err != nil {
+		log.Printf("Error getting upload by ID: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil
+	}
+	userID, _ := middleware.GetUserID(r.Context())
+	if carga == nil || carga.IDUsuario != userID {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return nil
+	}
+	if time.Now().After(carga.ExpiraEn) {
+		http.Error(w, "Upload expired", http.StatusGone)
+		return nil
+	}
+	return carga
+}
+
+// HeadCargaHandler reports how many bytes of an upload have been stored, so the client
+// knows where to resume.
+func HeadCargaHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Resumable", tusVersion)
+		w.Header().Set("Cache-Control", "no-store")
+		carga := getCargaFromRequest(db, w, r)
+		if carga == nil {
+			return
+		}
+		w.Header().Set("Upload-Offset", strconv.FormatInt(carga.Recibido, 10))
+		w.Header().Set("Upload-Length", strconv.FormatInt(carga.Tamano, 10))
+		setUploadExpires(w, carga)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// GetCargaHandler returns an upload as JSON, including idArchivo once it is complete.
+func GetCargaHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		carga := getCargaFromRequest(db, w, r)
+		if carga == nil {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(carga)
+	}
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// PatchCargaHandler stores the next chunk of an upload at Upload-Offset. An optional
+// Upload-Checksum ("sha256 <base64>") is verified for the chunk. The request that
+// completes the upload also assembles it into a group attachment; if that fails with a
+// server error, an empty PATCH at the final offset retries it.
+func PatchCargaHandler(db *sql.DB, store storage.Storage, sc scanner.Scanner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkTusResumable(w, r) {
+			return
+		}
+		if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+			http.Error(w, "Content-Type must be application/offset+octet-stream", http.StatusUnsupportedMediaType)
+			return
+		}
+		carga := getCargaFromRequest(db, w, r)
+		if carga == nil {
+			return
+		}
+		offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+		if err != nil || offset != carga.Recibido {
+			w.Header().Set("Upload-Offset", strconv.FormatInt(carga.Recibido, 10))
+			http.Error(w, "Upload-Offset does not match the stored offset", http.StatusConflict)
+			return
+		}
+		if carga.IDArchivo != nil {
+			// Already complete; nothing left to send
+			w.Header().Set("Upload-Offset", strconv.FormatInt(carga.Recibido, 10))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		var checksum []byte
+		if header := r.Header.Get("Upload-Checksum"); header != "" {
+			algoritmo, encoded, _ := strings.Cut(header, " ")
+			if algoritmo != "sha256" {
+				http.Error(w, "Unsupported checksum algorithm, use sha256", http.StatusBadRequest)
+				return
+			}
+			checksum, err = base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				http.Error(w, "Invalid Upload-Checksum", http.StatusBadRequest)
+				return
+			}
+		}
+
+		restante := carga.Tamano - carga.Recibido
+		if r.ContentLength > restante {
+			http.Error(w, "Chunk exceeds Upload-Length", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if restante > 0 && r.ContentLength != 0 {
+			var body io.Reader = http.MaxBytesReader(w, r.Body, restante)
+			if carga.Recibido == 0 {
+				// Reject files of the wrong type before the rest of the upload is sent
+				head := make([]byte, 512)
+				n, err := io.ReadFull(body, head)
+				if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+					log.Printf("Error reading first chunk of upload %s: %v", carga.ID, err)
+					http.Error(w, "Error reading request body", http.StatusBadRequest)
+					return
+				}
+				if _, err := validateUploadType(carga.NombreOriginal, head[:n]); err != nil {
+					descartarCarga(store, db, carga.ID)
+					writeUploadError(w, err)
+					return
+				}
+				body = io.MultiReader(bytes.NewReader(head[:n]), body)
+			}
+
+			tmpKey, err := tmpChunkKey(carga.ID)
+			if err != nil {
+				log.Printf("Error storing chunk of upload %s: %v", carga.ID, err)
+				http.Error(w, "Internal server error storing chunk", http.StatusInternalServerError)
+				return
+			}
+			hash := sha256.New()
+			counter := &countingReader{r: io.TeeReader(body, hash)}
+			if err := store.Save(r.Context(), tmpKey, counter, r.ContentLength, "application/octet-stream"); err != nil {
+				_ = removeFile(store, &tmpKey)
+				log.Printf("Error storing chunk of upload %s: %v", carga.ID, err)
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					writeUploadError(w, err)
+				} else {
+					http.Error(w, "Internal server error storing chunk", http.StatusInternalServerError)
+				}
+				return
+			}
+			if checksum != nil && !bytes.Equal(hash.Sum(nil), checksum) {
+				_ = removeFile(store, &tmpKey)
+				http.Error(w, "Checksum mismatch", statusChecksumMismatch)
+				return
+			}
+
+			ttl, _ := cargaConfig()
+			expiraEn := time.Now().Add(ttl)
+			nuevoRecibido := carga.Recibido + counter.n
+			if err := repository.AvanzarCarga(db, carga.ID, carga.Recibido, nuevoRecibido, expiraEn); err != nil {
+				_ = removeFile(store, &tmpKey)
+				if errors.Is(err, repository.ErrCargaDesactualizada) {
+					http.Error(w, "Upload was modified by another request", http.StatusConflict)
+					return
+				}
+				log.Printf("Error updating offset of upload %s: %v", carga.ID, err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if err := promoverChunk(r.Context(), store, tmpKey, chunkKey(carga.ID, carga.Recibido)); err != nil {
+				log.Printf("Error accepting chunk of upload %s: %v", carga.ID, err)
+				_ = removeFile(store, &tmpKey)
+				// Give the offset back so the client resends the chunk
+				if err := repository.AvanzarCarga(db, carga.ID, nuevoRecibido, carga.Recibido, expiraEn); err != nil {
+					log.Printf("Error restoring offset of upload %s: %v", carga.ID, err)
+				}
+				http.Error(w, "Internal server error storing chunk", http.StatusInternalServerError)
+				return
+			}
+			carga.Recibido = nuevoRecibido
+			carga.ExpiraEn = expiraEn
+		}
+
+		if carga.Completa() {
+			if _, err := finalizarCarga(r.Context(), db, store, sc, carga); err != nil {
+				log.Printf("Error completing upload %s: %v", carga.ID, err)
+				var uerr *uploadError
+				if errors.As(err, &uerr) {
+					// The content itself was rejected; the upload cannot be resumed
+					descartarCarga(store, db, carga.ID)
+				}
+				writeUploadError(w, err)
+				return
+			}
+		}
+
+		w.Header().Set("Upload-Offset", strconv.FormatInt(carga.Recibido, 10))
+		setUploadExpires(w, carga)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// DeleteCargaHandler cancels an upload and removes its chunks (tus termination). An
+// attachment already created from it is kept.
+func DeleteCargaHandler(db *sql.DB, store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkTusResumable(w, r) {
+			return
+		}
+		carga := getCargaFromRequest(db, w, r)
+		if carga == nil {
+			return
+		}
+		if err := storage.DeletePrefix(r.Context(), store, cargaPrefix(carga.ID)); err != nil {
+			log.Printf("Error deleting chunks of upload %s: %v", carga.ID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if err := repository.DeleteCarga(db, carga.ID); err != nil {
+			log.Printf("Error deleting upload %s: %v", carga.ID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// descartarCarga removes an upload whose content was rejected.
+func descartarCarga(store storage.Storage, db *sql.DB, idCarga string) {
+	if err := storage.DeletePrefix(context.Background(), store, cargaPrefix(idCarga)); err != nil {
+		log.Printf("Error deleting chunks of rejected upload %s: %v", idCarga, err)
+	}
+	if err := repository.DeleteCarga(db, idCarga); err != nil {
+		log.Printf("Error deleting rejected upload %s: %v", idCarga, err)
+	}
+}
+
+// listChunks returns the chunk keys of a complete upload in order, checking that they
+// are contiguous and add up to its size. Chunks not yet accepted are ignored.
+func listChunks(ctx context.Context, store storage.Storage, carga *models.Carga) ([]string, error) {
+	objects, err := store.List(ctx, cargaPrefix(carga.ID))
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+
+	keys := make([]string, 0, len(objects))
+	var total int64
+	for _, obj := range objects {
+		if strings.HasPrefix(obj.Key, tmpChunkPrefix(carga.ID)) {
+			continue
+		}
+		offset, err := strconv.ParseInt(path.Base(obj.Key), 10, 64)
+		if err != nil || offset != total {
+			return nil, fmt.Errorf("upload %s has an unexpected chunk '%s'", carga.ID, obj.Key)
+		}
+		keys = append(keys, obj.Key)
+		total += obj.Size
+	}
+	if total != carga.Tamano {
+		return nil, fmt.Errorf("upload %s has %d bytes in chunks, expected %d", carga.ID, total, carga.Tamano)
+	}
+	return keys, nil
+}
+
+// chunkReader reads the chunks of an upload one after another, opening each only when
+// it is reached.
+type chunkReader struct {
+	ctx   context.Context
+	store storage.Storage
+	keys  []string
+	cur   io.ReadCloser
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if c.cur == nil {
+			if len(c.keys) == 0 {
+				return 0, io.EOF
+			}
+			reader, _, err := c.store.Open(c.ctx, c.keys[0])
+			if err != nil {
+				return 0, fmt.Errorf("error opening chunk '%s': %w", c.keys[0], err)
+			}
+			c.cur = reader
+			c.keys = c.keys[1:]
+		}
+		n, err := c.cur.Read(p)
+		if err == io.EOF {
+			c.cur.Close()
+			c.cur = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (c *chunkReader) Close() error {
+	if c.cur != nil {
+		return c.cur.Close()
+	}
+	return nil
+}
+
+// finalizarCarga assembles a complete upload: it validates the content type and the
+// expected checksum, scans and stores the file, and creates the group attachment.
+func finalizarCarga(ctx context.Context, db *sql.DB, store storage.Storage, sc scanner.Scanner, carga *models.Carga) (*models.GrupoArchivo, error) {
+	keys, err := listChunks(ctx, store, carga)
+	if err != nil {
+		return nil, err
+	}
+	open := func() (io.ReadCloser, error) {
+		return &chunkReader{ctx: ctx, store: store, keys: keys}, nil
+	}
+
+	content, _ := open()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(content, head)
+	content.Close()
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("error reading upload: %w", err)
+	}
+	tipo, err := validateUploadType(carga.NombreOriginal, head[:n])
+	if err != nil {
+		return nil, err
+	}
+	if err := validateContainerContent(tipo, open); err != nil {
+		return nil, err
+	}
+
+	info, err := storeUpload(ctx, db, store, sc, carga.NombreOriginal, carga.Tamano, tipo.MimeType, open)
+	if err != nil {
+		return nil, err
+	}
+	if carga.Checksum != "" && info.Checksum != carga.Checksum {
+		_ = removeFile(store, &info.Path)
+		return nil, &uploadError{
+			Status:  statusChecksumMismatch,
+			Code:    "checksum_mismatch",
+			Message: "The SHA-256 of the uploaded file does not match the announced checksum",
+			Details: map[string]interface{}{"expected": carga.Checksum, "actual": info.Checksum},
+		}
+	}
+
+	archivo := models.GrupoArchivo{
+		IDGrupo:        carga.IDGrupo,
+		Categoria:      carga.Categoria,
+		Descripcion:    carga.Descripcion,
+		NombreOriginal: info.NombreOriginal,
+		Ruta:           info.Path,
+		Tamano:         info.Tamano,
+		MimeType:       info.MimeType,
+		Checksum:       info.Checksum,
+		EstadoEscaneo:  info.EstadoEscaneo,
+		Visibilidad:    carga.Visibilidad,
+		IDUsuario:      &carga.IDUsuario,
+	}
+	if err := repository.CompletarCarga(db, carga.ID, &archivo); err != nil {
+		_ = removeFile(store, &info.Path)
+		return nil, err
+	}
+	carga.IDArchivo = &archivo.ID
+
+	if err := storage.DeletePrefix(ctx, store, cargaPrefix(carga.ID)); err != nil {
+		// Harmless: the expiry job removes them with the upload
+		log.Printf("Error deleting chunks of completed upload %s: %v", carga.ID, err)
+	}
+	return &archivo, nil
+}
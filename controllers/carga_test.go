@@ -0,0 +1,481 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/middleware"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/storage"
+	"github.com/gorilla/mux"
+)
+
+func TestParseUploadMetadata(t *testing.T) {
+	b64 := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name    string
+		header  string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "empty", header: "", want: map[string]string{}},
+		{
+			name:   "pairs",
+			header: "filename " + b64("plan de trabajo.pdf") + ",idGrupo " + b64("12") + ", categoria " + b64("plan"),
+			want:   map[string]string{"filename": "plan de trabajo.pdf", "idGrupo": "12", "categoria": "plan"},
+		},
+		{name: "key without value", header: "descripcion", want: map[string]string{"descripcion": ""}},
+		{name: "trailing comma", header: "idGrupo " + b64("3") + ",", want: map[string]string{"idGrupo": "3"}},
+		{name: "invalid base64", header: "filename no-es-base64!", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseUploadMetadata(tt.header)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseUploadMetadata error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseUploadMetadata = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChunkKeyOrder(t *testing.T) {
+	offsets := []int64{0, 9, 10, 100, 65536, 1 << 40}
+	keys := make([]string, len(offsets))
+	for i, offset := range offsets {
+		keys[i] = chunkKey("abc", offset)
+	}
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	if !reflect.DeepEqual(sorted, keys) {
+		t.Errorf("chunk keys sort as %v, want offset order %v", sorted, keys)
+	}
+	if !strings.HasPrefix(keys[0], cargaPrefix("abc")) {
+		t.Errorf("chunkKey = %q, want it under %q", keys[0], cargaPrefix("abc"))
+	}
+}
+
+// saveChunks stores the given chunks of upload idCarga at consecutive offsets.
+func saveChunks(t *testing.T, store storage.Storage, idCarga string, chunks ...string) {
+	t.Helper()
+	var offset int64
+	for _, chunk := range chunks {
+		if err := store.Save(context.Background(), chunkKey(idCarga, offset), strings.NewReader(chunk), int64(len(chunk)), ""); err != nil {
+			t.Fatalf("saving chunk: %v", err)
+		}
+		offset += int64(len(chunk))
+	}
+}
+
+func TestListChunks(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("contiguous chunks in order", func(t *testing.T) {
+		store := storage.NewLocalStorage(t.TempDir())
+		saveChunks(t, store, "abc", "0123456789", "abcdef", "XYZ")
+		// A chunk still being received does not count
+		if err := store.Save(ctx, tmpChunkPrefix("abc")+"f00d", strings.NewReader("junk"), 4, ""); err != nil {
+			t.Fatal(err)
+		}
+
+		keys, err := listChunks(ctx, store, &models.Carga{ID: "abc", Tamano: 19})
+		if err != nil {
+			t.Fatalf("listChunks: %v", err)
+		}
+		want := []string{chunkKey("abc", 0), chunkKey("abc", 10), chunkKey("abc", 16)}
+		if !reflect.DeepEqual(keys, want) {
+			t.Errorf("listChunks = %v, want %v", keys, want)
+		}
+	})
+
+	t.Run("gap between chunks", func(t *testing.T) {
+		store := storage.NewLocalStorage(t.TempDir())
+		saveChunks(t, store, "abc", "0123456789")
+		if err := store.Save(ctx, chunkKey("abc", 12), strings.NewReader("xy"), 2, ""); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := listChunks(ctx, store, &models.Carga{ID: "abc", Tamano: 12}); err == nil {
+			t.Error("listChunks with a gap succeeded, want an error")
+		}
+	})
+
+	t.Run("fewer bytes than announced", func(t *testing.T) {
+		store := storage.NewLocalStorage(t.TempDir())
+		saveChunks(t, store, "abc", "0123456789")
+		if _, err := listChunks(ctx, store, &models.Carga{ID: "abc", Tamano: 20}); err == nil {
+			t.Error("listChunks of an incomplete upload succeeded, want an error")
+		}
+	})
+}
+
+func TestChunkReader(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewLocalStorage(t.TempDir())
+	saveChunks(t, store, "abc", "primer ", "segundo ", "tercero")
+	keys, err := listChunks(ctx, store, &models.Carga{ID: "abc", Tamano: 22})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A tiny buffer makes reads cross chunk boundaries
+	reader := &chunkReader{ctx: ctx, store: store, keys: keys}
+	var got bytes.Buffer
+	buf := make([]byte, 3)
+	for {
+		n, err := reader.Read(buf)
+		got.Write(buf[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+	}
+	if err := reader.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if got.String() != "primer segundo tercero" {
+		t.Errorf("read %q, want %q", got.String(), "primer segundo tercero")
+	}
+
+	missing := &chunkReader{ctx: ctx, store: store, keys: []string{chunkKey("abc", 0), chunkKey("otra", 0)}}
+	if _, err := io.ReadAll(missing); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("reading a missing chunk: error = %v, want storage.ErrNotFound", err)
+	}
+}
+
+// fakeCargaDB is a database/sql connector holding a single Carga row. It answers the
+// queries of GetCargaByID, AvanzarCarga and DeleteCarga, so the tus handlers can be tested
+// without PostgreSQL.
+type fakeCargaDB struct {
+	mu            sync.Mutex
+	carga         *models.Carga
+	desactualizar bool // AvanzarCarga finds the offset already moved by another request
+}
+
+func (f *fakeCargaDB) Connect(context.Context) (driver.Conn, error) { return fakeCargaConn{f}, nil }
+func (f *fakeCargaDB) Driver() driver.Driver                        { return nil }
+
+func (f *fakeCargaDB) get() *models.Carga {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.carga == nil {
+		return nil
+	}
+	c := *f.carga
+	return &c
+}
+
+type fakeCargaConn struct{ db *fakeCargaDB }
+
+func (c fakeCargaConn) Prepare(query string) (driver.Stmt, error) {
+	return fakeCargaStmt{db: c.db, query: query}, nil
+}
+func (c fakeCargaConn) Close() error { return nil }
+func (c fakeCargaConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("fake database: transactions not supported")
+}
+
+type fakeCargaStmt struct {
+	db    *fakeCargaDB
+	query string
+}
+
+func (s fakeCargaStmt) Close() error  { return nil }
+func (s fakeCargaStmt) NumInput() int { return -1 }
+
+func (s fakeCargaStmt) Exec(args []driver.Value) (driver.Result, error) {
+	f := s.db
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case strings.HasPrefix(s.query, "UPDATE Carga SET recibido"):
+		// recibido = $1, expiraEn = $2 WHERE idCarga = $3 AND recibido = $4 AND idArchivo IS NULL
+		if f.carga == nil || f.desactualizar || f.carga.IDArchivo != nil || f.carga.Recibido != args[3].(int64) {
+			return driver.RowsAffected(0), nil
+		}
+		f.carga.Recibido = args[0].(int64)
+		f.carga.ExpiraEn = args[1].(time.Time)
+		return driver.RowsAffected(1), nil
+	case strings.HasPrefix(s.query, "DELETE FROM Carga"):
+		f.carga = nil
+		return driver.RowsAffected(1), nil
+	}
+	return nil, errors.New("fake database: unexpected statement: " + s.query)
+}
+
+func (s fakeCargaStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if !strings.HasPrefix(s.query, cargaSelectPrefix) {
+		return nil, errors.New("fake database: unexpected query: " + s.query)
+	}
+	rows := &fakeCargaRows{}
+	if c := s.db.get(); c != nil && c.ID == args[0] {
+		var idArchivo driver.Value
+		if c.IDArchivo != nil {
+			idArchivo = int64(*c.IDArchivo)
+		}
+		rows.values = [][]driver.Value{{c.ID, int64(c.IDGrupo), c.Categoria, c.Descripcion, c.Visibilidad, c.NombreOriginal,
+			c.Tamano, c.Recibido, c.Checksum, int64(c.IDUsuario), idArchivo, c.ExpiraEn, c.CreatedAt, c.UpdatedAt}}
+	}
+	return rows, nil
+}
+
+const cargaSelectPrefix = "SELECT idCarga, idGrupo"
+
+type fakeCargaRows struct{ values [][]driver.Value }
+
+func (r *fakeCargaRows) Columns() []string {
+	return []string{"idCarga", "idGrupo", "categoria", "descripcion", "visibilidad", "nombreOriginal",
+		"tamano", "recibido", "checksum", "idUsuario", "idArchivo", "expiraEn", "createdAt", "updatedAt"}
+}
+func (r *fakeCargaRows) Close() error { return nil }
+func (r *fakeCargaRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// tusRequest builds a tus request by user 7 for upload idCarga.
+func tusRequest(method, idCarga string, body []byte, headers map[string]string) *http.Request {
+	r := httptest.NewRequest(method, "/cargas/"+idCarga, bytes.NewReader(body))
+	r.Header.Set("Tus-Resumable", tusVersion)
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	r = mux.SetURLVars(r, map[string]string{"idCarga": idCarga})
+	return r.WithContext(context.WithValue(r.Context(), middleware.UserIDKey, "7"))
+}
+
+func TestTusHandlers(t *testing.T) {
+	const idCarga = "0123456789abcdef0123456789abcdef"
+	recibido := []byte("primeros bytes ")
+	chunk := []byte("siguiente parte")
+	sum := sha256.Sum256(chunk)
+	checksum := "sha256 " + base64.StdEncoding.EncodeToString(sum[:])
+	badSum := sha256.Sum256([]byte("otro contenido"))
+
+	setup := func(t *testing.T, mutate func(c *models.Carga)) (*fakeCargaDB, *sql.DB, storage.Storage) {
+		t.Helper()
+		c := &models.Carga{
+			ID:             idCarga,
+			IDGrupo:        3,
+			Categoria:      "plan",
+			Visibilidad:    models.VisibilidadInterno,
+			NombreOriginal: "plan.pdf",
+			Tamano:         1000,
+			Recibido:       int64(len(recibido)),
+			IDUsuario:      7,
+			ExpiraEn:       time.Now().Add(time.Hour).Truncate(time.Second),
+		}
+		if mutate != nil {
+			mutate(c)
+		}
+		fake := &fakeCargaDB{carga: c}
+		db := sql.OpenDB(fake)
+		t.Cleanup(func() { db.Close() })
+		store := storage.NewLocalStorage(t.TempDir())
+		saveChunks(t, store, idCarga, string(recibido))
+		return fake, db, store
+	}
+	// stored returns the keys under the prefix of the upload.
+	stored := func(t *testing.T, store storage.Storage) []string {
+		t.Helper()
+		objects, err := store.List(context.Background(), cargaPrefix(idCarga))
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys := []string{}
+		for _, obj := range objects {
+			keys = append(keys, obj.Key)
+		}
+		sort.Strings(keys)
+		return keys
+	}
+	patchHeaders := func(offset int, extra ...string) map[string]string {
+		h := map[string]string{
+			"Content-Type":  "application/offset+octet-stream",
+			"Upload-Offset": strconv.Itoa(offset),
+		}
+		for i := 0; i+1 < len(extra); i += 2 {
+			h[extra[i]] = extra[i+1]
+		}
+		return h
+	}
+
+	t.Run("HEAD reports the offset", func(t *testing.T) {
+		_, db, _ := setup(t, nil)
+		w := httptest.NewRecorder()
+		HeadCargaHandler(db)(w, tusRequest(http.MethodHead, idCarga, nil, nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", w.Code)
+		}
+		if got := w.Header().Get("Upload-Offset"); got != strconv.Itoa(len(recibido)) {
+			t.Errorf("Upload-Offset = %q, want %d", got, len(recibido))
+		}
+		if got := w.Header().Get("Upload-Length"); got != "1000" {
+			t.Errorf("Upload-Length = %q, want 1000", got)
+		}
+		if w.Header().Get("Upload-Expires") == "" || w.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("missing Upload-Expires or Cache-Control: %v", w.Header())
+		}
+	})
+
+	t.Run("HEAD of an expired upload", func(t *testing.T) {
+		_, db, _ := setup(t, func(c *models.Carga) { c.ExpiraEn = time.Now().Add(-time.Minute) })
+		w := httptest.NewRecorder()
+		HeadCargaHandler(db)(w, tusRequest(http.MethodHead, idCarga, nil, nil))
+		if w.Code != http.StatusGone {
+			t.Errorf("status = %d, want 410", w.Code)
+		}
+	})
+
+	t.Run("HEAD of another user's upload", func(t *testing.T) {
+		_, db, _ := setup(t, func(c *models.Carga) { c.IDUsuario = 8 })
+		w := httptest.NewRecorder()
+		HeadCargaHandler(db)(w, tusRequest(http.MethodHead, idCarga, nil, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want 404", w.Code)
+		}
+	})
+
+	t.Run("PATCH stores the chunk at its offset", func(t *testing.T) {
+		fake, db, store := setup(t, nil)
+		w := httptest.NewRecorder()
+		PatchCargaHandler(db, store, nil)(w, tusRequest(http.MethodPatch, idCarga, chunk, patchHeaders(len(recibido), "Upload-Checksum", checksum)))
+
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("status = %d, want 204: %s", w.Code, w.Body.String())
+		}
+		want := len(recibido) + len(chunk)
+		if got := w.Header().Get("Upload-Offset"); got != strconv.Itoa(want) {
+			t.Errorf("Upload-Offset = %q, want %d", got, want)
+		}
+		if got := fake.get().Recibido; got != int64(want) {
+			t.Errorf("stored offset = %d, want %d", got, want)
+		}
+		wantKeys := []string{chunkKey(idCarga, 0), chunkKey(idCarga, int64(len(recibido)))}
+		if got := stored(t, store); !reflect.DeepEqual(got, wantKeys) {
+			t.Errorf("stored keys = %v, want %v", got, wantKeys)
+		}
+	})
+
+	t.Run("PATCH at the wrong offset", func(t *testing.T) {
+		fake, db, store := setup(t, nil)
+		w := httptest.NewRecorder()
+		PatchCargaHandler(db, store, nil)(w, tusRequest(http.MethodPatch, idCarga, chunk, patchHeaders(0)))
+
+		if w.Code != http.StatusConflict {
+			t.Fatalf("status = %d, want 409", w.Code)
+		}
+		if got := w.Header().Get("Upload-Offset"); got != strconv.Itoa(len(recibido)) {
+			t.Errorf("Upload-Offset = %q, want the stored offset %d", got, len(recibido))
+		}
+		if got := fake.get().Recibido; got != int64(len(recibido)) {
+			t.Errorf("stored offset moved to %d", got)
+		}
+	})
+
+	t.Run("PATCH with a checksum mismatch", func(t *testing.T) {
+		fake, db, store := setup(t, nil)
+		w := httptest.NewRecorder()
+		header := "sha256 " + base64.StdEncoding.EncodeToString(badSum[:])
+		PatchCargaHandler(db, store, nil)(w, tusRequest(http.MethodPatch, idCarga, chunk, patchHeaders(len(recibido), "Upload-Checksum", header)))
+
+		if w.Code != statusChecksumMismatch {
+			t.Fatalf("status = %d, want %d", w.Code, statusChecksumMismatch)
+		}
+		if got := fake.get().Recibido; got != int64(len(recibido)) {
+			t.Errorf("stored offset moved to %d", got)
+		}
+		if got := stored(t, store); !reflect.DeepEqual(got, []string{chunkKey(idCarga, 0)}) {
+			t.Errorf("stored keys = %v, want only the first chunk", got)
+		}
+	})
+
+	t.Run("PATCH that loses a race keeps the winner's chunk", func(t *testing.T) {
+		fake, db, store := setup(t, nil)
+		winner := "del ganador"
+		if err := store.Save(context.Background(), chunkKey(idCarga, int64(len(recibido))), strings.NewReader(winner), int64(len(winner)), ""); err != nil {
+			t.Fatal(err)
+		}
+		fake.desactualizar = true
+
+		w := httptest.NewRecorder()
+		PatchCargaHandler(db, store, nil)(w, tusRequest(http.MethodPatch, idCarga, chunk, patchHeaders(len(recibido))))
+
+		if w.Code != http.StatusConflict {
+			t.Fatalf("status = %d, want 409", w.Code)
+		}
+		reader, _, err := store.Open(context.Background(), chunkKey(idCarga, int64(len(recibido))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(reader)
+		reader.Close()
+		if string(content) != winner {
+			t.Errorf("chunk at the contested offset = %q, want the winner's %q", content, winner)
+		}
+		if got := stored(t, store); len(got) != 2 {
+			t.Errorf("stored keys = %v, want the two accepted chunks and no temporary one", got)
+		}
+	})
+
+	t.Run("PATCH of an expired upload", func(t *testing.T) {
+		_, db, store := setup(t, func(c *models.Carga) { c.ExpiraEn = time.Now().Add(-time.Minute) })
+		w := httptest.NewRecorder()
+		PatchCargaHandler(db, store, nil)(w, tusRequest(http.MethodPatch, idCarga, chunk, patchHeaders(len(recibido))))
+		if w.Code != http.StatusGone {
+			t.Errorf("status = %d, want 410", w.Code)
+		}
+	})
+
+	t.Run("PATCH with another protocol version", func(t *testing.T) {
+		_, db, store := setup(t, nil)
+		r := tusRequest(http.MethodPatch, idCarga, chunk, patchHeaders(len(recibido)))
+		r.Header.Set("Tus-Resumable", "0.2.2")
+		w := httptest.NewRecorder()
+		PatchCargaHandler(db, store, nil)(w, r)
+		if w.Code != http.StatusPreconditionFailed || w.Header().Get("Tus-Version") != tusVersion {
+			t.Errorf("status = %d, Tus-Version = %q, want 412 and %q", w.Code, w.Header().Get("Tus-Version"), tusVersion)
+		}
+	})
+
+	t.Run("DELETE removes the upload and its chunks", func(t *testing.T) {
+		fake, db, store := setup(t, nil)
+		w := httptest.NewRecorder()
+		DeleteCargaHandler(db, store)(w, tusRequest(http.MethodDelete, idCarga, nil, nil))
+
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("status = %d, want 204", w.Code)
+		}
+		if fake.get() != nil {
+			t.Error("upload row was not deleted")
+		}
+		if got := stored(t, store); len(got) != 0 {
+			t.Errorf("stored keys = %v, want none", got)
+		}
+	})
+}
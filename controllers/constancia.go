@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/middleware"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/reporte"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/repository"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/utils"
+	"github.com/gorilla/mux"
+)
+
+// constanciaSecret returns the key certificates are signed with, from CONSTANCIA_SECRET. It
+// is never shared with other signatures; without it certificates are neither issued nor verified.
+func constanciaSecret() []byte {
+	return []byte(os.Getenv("CONSTANCIA_SECRET"))
+}
+
+// publicBaseURL returns PUBLIC_BASE_URL, the public address of the API (e.g.
+// "https://api.ejemplo.edu.pe"), without a trailing slash. Certificates are only issued when
+// it is set: the address printed on them must not depend on the headers of the request.
+func publicBaseURL() string {
+	return strings.TrimSuffix(os.Getenv("PUBLIC_BASE_URL"), "/")
+}
+
+// urlVerificacion returns the public address where a certificate code is checked.
+func urlVerificacion(base, codigo string) string {
+	return base + "/verificar/" + codigo
+}
+
+// gruposConstancia returns the recognized groups (approved or active) of an investigator,
+// with their role, as certified by a membership certificate.
+func gruposConstancia(db *sql.DB, idInvestigador int) ([]models.GrupoConstancia, error) {
+	return repository.GetGruposConstancia(db, idInvestigador, models.EstadosPublicos)
+}
+
+// emitirConstancia assigns a new code to a certificate, signs its content and stores it as
+// issued by the user idUsuario.
+func emitirConstancia(db *sql.DB, secret []byte, idUsuario int, datos models.DatosConstancia) (*models.Constancia, error) {
+	codigo, err := reporte.NuevoCodigo()
+	if err != nil {
+		return nil, err
+	}
+	contenido, err := json.Marshal(datos)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding certificate content: %w", err)
+	}
+	c := &models.Constancia{Codigo: codigo, IDUsuario: &idUsuario, Datos: datos, Contenido: string(contenido)}
+	c.Firma = utils.SignContent(secret, c.Codigo, c.Contenido)
+	if err := repository.CreateConstancia(db, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// CreateConstanciaHandler issues the PDF membership certificate of an investigator to an
+// authenticated user. Only recognized groups (approved or active) are certified. Each
+// certificate gets a unique verification code, sent in X-Codigo-Verificacion and printed
+// with a QR code to GET /verificar/{codigo}; its content is signed and stored, with the
+// user who issued it, so that endpoint can tell forgeries apart. It answers 503 while
+// CONSTANCIA_SECRET or PUBLIC_BASE_URL are not set.
+func CreateConstanciaHandler(db *sql.DB) http.HandlerFunc {
+	generador := generadorReportes()
+	secret := constanciaSecret()
+	base := publicBaseURL()
+	if len(secret) == 0 || base == "" {
+		log.Print("Warning: CONSTANCIA_SECRET or PUBLIC_BASE_URL not set, membership certificates will not be issued")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(secret) == 0 || base == "" {
+			http.Error(w, "Certificate issuance is not configured", http.StatusServiceUnavailable)
+			return
+		}
+		userID, ok := middleware.GetUserID(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid investigator ID", http.StatusBadRequest)
+			return
+		}
+
+		inv, err := repository.GetInvestigadorByID(db, id)
+		if err != nil {
+			log.Printf("Error getting investigator for certificate: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if inv == nil {
+			http.Error(w, "Investigador not found", http.StatusNotFound)
+			return
+		}
+		grupos, err := gruposConstancia(db, id)
+		if err != nil {
+			log.Printf("Error getting groups for certificate: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		c, err := emitirConstancia(db, secret, userID, models.DatosConstancia{
+			IDInvestigador: inv.ID,
+			Nombre:         inv.Nombre,
+			Apellido:       inv.Apellido,
+			Grupos:         grupos,
+			EmitidaEn:      time.Now().Truncate(time.Second),
+		})
+		if err != nil {
+			log.Printf("Error issuing certificate: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("X-Codigo-Verificacion", c.Codigo)
+		w.Header().Set("Location", "/verificar/"+c.Codigo)
+		writePDF(w, fmt.Sprintf("constancia-%d.pdf", id), func(buf *bytes.Buffer) error {
+			return generador.Constancia(buf, c.Datos, c.Codigo, urlVerificacion(base, c.Codigo))
+		})
+	}
+}
+
+// GetConstanciaInvestigadorHandler serves GET /investigadores/{id}/constancia.pdf for
+// clients that download certificates with a plain link. Like CreateConstanciaHandler, every
+// request issues and streams a new signed certificate on behalf of the authenticated user.
+func GetConstanciaInvestigadorHandler(db *sql.DB) http.HandlerFunc {
+	return CreateConstanciaHandler(db)
+}
+
+// observacionesConstancia compares the memberships certified by a certificate with the
+// current ones and describes each that no longer holds.
+func observacionesConstancia(certificados, actuales []models.GrupoConstancia) []string {
+	roles := make(map[int]string, len(actuales))
+	for _, g := range actuales {
+		roles[g.IDGrupo] = g.Rol
+	}
+	observaciones := []string{}
+	for _, g := range certificados {
+		rol, ok := roles[g.IDGrupo]
+		switch {
+		case !ok:
+			observaciones = append(observaciones, fmt.Sprintf("Ya no es integrante del grupo %s o el grupo ya no está reconocido", g.Nombre))
+		case rol != g.Rol:
+			observaciones = append(observaciones, fmt.Sprintf("Su rol en el grupo %s cambió de %s a %s", g.Nombre, g.Rol, rol))
+		}
+	}
+	return observaciones
+}
+
+// VerificarConstanciaHandler checks a membership certificate by its code. It returns the
+// original data of the certificate, whether it is authentic (its stored content matches the
+// signature) and whether it is still valid: every certified membership still holds, with
+// the same role, in a recognized group.
+func VerificarConstanciaHandler(db *sql.DB) http.HandlerFunc {
+	secret := constanciaSecret()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(secret) == 0 {
+			http.Error(w, "Certificate verification is not configured", http.StatusServiceUnavailable)
+			return
+		}
+		codigo := strings.ToUpper(strings.TrimSpace(mux.Vars(r)["codigo"]))
+		c, err := repository.GetConstanciaByCodigo(db, codigo)
+		if err != nil {
+			log.Printf("Error getting certificate by code: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if c == nil {
+			http.Error(w, "Constancia not found", http.StatusNotFound)
+			return
+		}
+
+		v := models.VerificacionConstancia{
+			Codigo:        c.Codigo,
+			Datos:         c.Datos,
+			Autentica:     utils.VerifyContentSignature(secret, c.Codigo, c.Contenido, c.Firma),
+			Observaciones: []string{},
+		}
+		if !v.Autentica {
+			v.Observaciones = append(v.Observaciones, "El contenido registrado no coincide con su firma")
+		} else {
+			// The stored idInvestigador follows merges of duplicate records
+			if c.IDInvestigador == nil {
+				v.Observaciones = append(v.Observaciones, "El investigador ya no está registrado")
+			} else {
+				actuales, err := gruposConstancia(db, *c.IDInvestigador)
+				if err != nil {
+					log.Printf("Error getting current groups of certificate: %v", err)
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+					return
+				}
+				v.Observaciones = observacionesConstancia(c.Datos.Grupos, actuales)
+			}
+			v.Vigente = len(v.Observaciones) == 0
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+}
@@ -34,6 +34,7 @@ func CreateDetalleGrupoInvestigadorHandler(db *sql.DB) http.HandlerFunc {
 }
 
 // GetDetalleGrupoInvestigadorHandler handles fetching a single relationship detail by its ID.
+// Like GET /grupos/{id}, anonymous callers only get details of approved or active groups.
 func GetDetalleGrupoInvestigadorHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
@@ -55,6 +56,16 @@ func GetDetalleGrupoInvestigadorHandler(db *sql.DB) http.HandlerFunc {
 			http.Error(w, "Detail not found", http.StatusNotFound)
 			return
 		}
+		// Details of groups the caller may not see are reported as not found
+		grupo, err := repository.GetGrupoByID(db, detalle.IDGrupo)
+		if err != nil {
+			log.Printf("Error getting group of detail: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !checkGrupoVisible(db, w, r, grupo, "Detail not found") {
+			return
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(detalle)
@@ -115,6 +126,7 @@ func DeleteDetalleGrupoInvestigadorHandler(db *sql.DB) http.HandlerFunc {
 }
 
 // GetDetallesByGrupoHandler handles fetching all relationship details for a given group ID.
+// Groups the caller may not see are reported as not found.
 func GetDetallesByGrupoHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
@@ -125,6 +137,16 @@ func GetDetallesByGrupoHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		grupo, err := repository.GetGrupoByID(db, grupoID)
+		if err != nil {
+			log.Printf("Error getting group for details: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !checkGrupoVisible(db, w, r, grupo, "Grupo not found") {
+			return
+		}
+
 		detalles, err := repository.GetDetallesByGrupoID(db, grupoID)
 		if err != nil {
 			log.Printf("Error getting details by group ID: %v", err)
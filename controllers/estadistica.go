@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/repository"
+	"github.com/gorilla/mux"
+)
+
+// defaultMinGrupos is the minimum number of groups of GET /estadisticas/investigadores/multigrupo.
+const defaultMinGrupos = 2
+
+// estadisticaFilterFromRequest reads the registration date range (?desde=, ?hasta=, both
+// inclusive, YYYY-MM-DD) and the visible states of a statistics request. Errors are meant
+// for a 400 response.
+func estadisticaFilterFromRequest(r *http.Request) (repository.EstadisticaFilter, error) {
+	filter := repository.EstadisticaFilter{Visibilidad: visibilidadGrupos(r)}
+	for _, p := range []struct {
+		nombre  string
+		destino **time.Time
+	}{{"desde", &filter.Desde}, {"hasta", &filter.Hasta}} {
+		valor := r.URL.Query().Get(p.nombre)
+		if valor == "" {
+			continue
+		}
+		fecha, err := time.Parse(timeFormat, valor)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s, use format %s", p.nombre, timeFormat)
+		}
+		*p.destino = &fecha
+	}
+	if filter.Desde != nil && filter.Hasta != nil && filter.Hasta.Before(*filter.Desde) {
+		return filter, errors.New("hasta must not be before desde")
+	}
+	return filter, nil
+}
+
+// writeEstadistica sends a statistic along with the date range it covers and the last
+// refresh of the views it was read from.
+func writeEstadistica(w http.ResponseWriter, db *sql.DB, filter repository.EstadisticaFilter, data interface{}) {
+	resp := models.EstadisticaResponse{Data: data}
+	refrescadaEn, err := repository.GetEstadisticasRefrescadas(db)
+	if err != nil {
+		log.Printf("Error getting statistics refresh time: %v", err)
+	} else if !refrescadaEn.IsZero() {
+		resp.LastRefreshed = &refrescadaEn
+	}
+	if filter.Desde != nil {
+		desde := filter.Desde.Format(timeFormat)
+		resp.Desde = &desde
+	}
+	if filter.Hasta != nil {
+		hasta := filter.Hasta.Format(timeFormat)
+		resp.Hasta = &hasta
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// GetEstadisticaGruposHandler counts the groups by {dimension}: tipo, linea, anio, facultad
+// or estado. Each value comes with its number of groups, ready for a chart.
+func GetEstadisticaGruposHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := estadisticaFilterFromRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		valores, err := repository.GetGruposPorDimension(db, filter, mux.Vars(r)["dimension"])
+		if err != nil {
+			if errors.Is(err, repository.ErrDimensionInvalida) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Printf("Error getting group statistics: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		writeEstadistica(w, db, filter, valores)
+	}
+}
+
+// GetEstadisticaIntegrantesHandler returns the average, median and distribution of the
+// number of members per group.
+func GetEstadisticaIntegrantesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := estadisticaFilterFromRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		e, err := repository.GetEstadisticaIntegrantes(db, filter)
+		if err != nil {
+			log.Printf("Error getting members per group statistics: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		writeEstadistica(w, db, filter, e)
+	}
+}
+
+// GetInvestigadoresMultigrupoHandler lists the investigators who belong to several groups,
+// at least ?minGrupos= (2 by default).
+func GetInvestigadoresMultigrupoHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := estadisticaFilterFromRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		minGrupos := defaultMinGrupos
+		if param := r.URL.Query().Get("minGrupos"); param != "" {
+			minGrupos, err = strconv.Atoi(param)
+			if err != nil || minGrupos < 1 {
+				http.Error(w, "Invalid minGrupos, use a positive integer", http.StatusBadRequest)
+				return
+			}
+		}
+
+		investigadores, err := repository.GetInvestigadoresMultigrupo(db, filter, minGrupos)
+		if err != nil {
+			log.Printf("Error getting investigators in several groups: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		writeEstadistica(w, db, filter, investigadores)
+	}
+}
+
+// GetGruposSinCoordinadorHandler lists the groups with no member in the coordinator role.
+func GetGruposSinCoordinadorHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := estadisticaFilterFromRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		grupos, err := repository.GetGruposSinCoordinador(db, filter)
+		if err != nil {
+			log.Printf("Error getting groups without coordinator: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		writeEstadistica(w, db, filter, grupos)
+	}
+}
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/middleware"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/repository"
+)
+
+func TestEstadisticaFilterFromRequest(t *testing.T) {
+	fecha := func(s string) *time.Time {
+		d, err := time.Parse(timeFormat, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &d
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantDesde  *time.Time
+		wantHasta  *time.Time
+		wantErrMsg string
+	}{
+		{name: "no range", query: ""},
+		{name: "both bounds", query: "desde=2023-01-01&hasta=2023-12-31", wantDesde: fecha("2023-01-01"), wantHasta: fecha("2023-12-31")},
+		{name: "only desde", query: "desde=2024-03-15", wantDesde: fecha("2024-03-15")},
+		{name: "only hasta", query: "hasta=2024-03-15", wantHasta: fecha("2024-03-15")},
+		{name: "single day", query: "desde=2024-03-15&hasta=2024-03-15", wantDesde: fecha("2024-03-15"), wantHasta: fecha("2024-03-15")},
+		{name: "wrong format", query: "desde=15/03/2024", wantErrMsg: "invalid desde, use format 2006-01-02"},
+		{name: "impossible date", query: "hasta=2024-02-30", wantErrMsg: "invalid hasta, use format 2006-01-02"},
+		{name: "reversed range", query: "desde=2024-01-02&hasta=2024-01-01", wantErrMsg: "hasta must not be before desde"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/estadisticas/integrantes?"+tt.query, nil)
+			filter, err := estadisticaFilterFromRequest(r)
+			if tt.wantErrMsg != "" {
+				if err == nil || err.Error() != tt.wantErrMsg {
+					t.Fatalf("error = %v, want %q", err, tt.wantErrMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(filter.Desde, tt.wantDesde) || !reflect.DeepEqual(filter.Hasta, tt.wantHasta) {
+				t.Errorf("range = %v..%v, want %v..%v", filter.Desde, filter.Hasta, tt.wantDesde, tt.wantHasta)
+			}
+		})
+	}
+}
+
+func TestEstadisticaFilterVisibilidad(t *testing.T) {
+	request := func(query, userID, rol string) *http.Request {
+		r := httptest.NewRequest("GET", "/estadisticas/integrantes?"+query, nil)
+		ctx := r.Context()
+		if userID != "" {
+			ctx = context.WithValue(ctx, middleware.UserIDKey, userID)
+			ctx = context.WithValue(ctx, middleware.UserRoleKey, rol)
+		}
+		return r.WithContext(ctx)
+	}
+	owner := 7
+
+	tests := []struct {
+		name string
+		req  *http.Request
+		want repository.Visibilidad
+	}{
+		{name: "anonymous", req: request("", "", ""), want: repository.Visibilidad{SoloPublicos: true}},
+		{
+			name: "user with a state filter",
+			req:  request("estado=borrador,enviado", "7", models.RolUsuario),
+			want: repository.Visibilidad{Estados: []string{"borrador", "enviado"}, SoloPublicos: true, Propietario: &owner},
+		},
+		{name: "reviewer", req: request("", "9", models.RolRevisor), want: repository.Visibilidad{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := estadisticaFilterFromRequest(tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(filter.Visibilidad, tt.want) {
+				t.Errorf("Visibilidad = %+v, want %+v", filter.Visibilidad, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/export"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/repository"
+)
+
+// layoutPlano is the ?layout= value of exports with one row per group or investigator,
+// their memberships joined in a single column, instead of one row per membership.
+const layoutPlano = "plano"
+
+// separadorMembresias joins the memberships of a flattened row.
+const separadorMembresias = "; "
+
+var errLayoutInvalido = errors.New("invalid layout, use plano or leave it empty")
+
+// Columns of the group and investigator exports.
+var (
+	columnasGrupo            = []string{"idGrupo", "nombre", "numeroResolucion", "lineaInvestigacion", "tipoInvestigacion", "facultad", "fechaRegistro", "estado"}
+	columnasIntegrante       = []string{"idInvestigador", "nombreInvestigador", "apellidoInvestigador", "rol"}
+	columnasIntegrantesPlano = []string{"numeroIntegrantes", "integrantes"}
+	columnasInvestigador     = []string{"idInvestigador", "nombre", "apellido"}
+	columnasMembresia        = []string{"idGrupo", "grupo", "rol"}
+	columnasMembresiasPlano  = []string{"numeroGrupos", "grupos"}
+)
+
+// exportacion streams a table to the response. The headers are sent with the first row, so
+// an error found before any row (e.g. an invalid sort) can still get its own status.
+type exportacion struct {
+	w        http.ResponseWriter
+	formato  string
+	nombre   string // File name without extension
+	columnas []string
+	out      export.Writer
+}
+
+// newExportacion reads ?format= (csv by default) and prepares an export named nombre.
+// Errors are meant for a 400 response.
+func newExportacion(w http.ResponseWriter, r *http.Request, nombre string, columnas []string) (*exportacion, error) {
+	formato := strings.ToLower(r.URL.Query().Get("format"))
+	if formato == "" {
+		formato = export.FormatoCSV
+	}
+	if formato != export.FormatoCSV && formato != export.FormatoXLSX {
+		return nil, export.ErrFormatoNoSoportado
+	}
+	return &exportacion{w: w, formato: formato, nombre: nombre, columnas: columnas}, nil
+}
+
+// iniciar sends the headers and the column names.
+func (e *exportacion) iniciar() error {
+	archivo := fmt.Sprintf("%s-%s.%s", e.nombre, time.Now().Format("20060102"), e.formato)
+	e.w.Header().Set("Content-Type", export.ContentType(e.formato))
+	e.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", archivo))
+	out, err := export.NewWriter(e.formato, e.w, e.nombre)
+	if err != nil {
+		return err
+	}
+	e.out = out
+	return e.out.Write(e.columnas)
+}
+
+// fila writes a row, starting the file first if needed.
+func (e *exportacion) fila(valores []string) error {
+	if e.out == nil {
+		if err := e.iniciar(); err != nil {
+			return err
+		}
+	}
+	return e.out.Write(valores)
+}
+
+// terminar finishes the export. When it failed before any row was sent, the error response
+// is written instead; otherwise the file is already partly sent and the error is only logged.
+func (e *exportacion) terminar(err error) {
+	if err != nil {
+		log.Printf("Error exporting %s: %v", e.nombre, err)
+		if e.out == nil {
+			writeListError(e.w, err)
+		}
+		return
+	}
+	if e.out == nil {
+		// No rows: send the column names alone
+		if err := e.iniciar(); err != nil {
+			log.Printf("Error exporting %s: %v", e.nombre, err)
+			return
+		}
+	}
+	if err := e.out.Close(); err != nil {
+		log.Printf("Error finishing %s export: %v", e.nombre, err)
+	}
+}
+
+func valoresGrupo(g models.Grupo) []string {
+	facultad := ""
+	if g.Facultad != nil {
+		facultad = *g.Facultad
+	}
+	return []string{strconv.Itoa(g.ID), g.Nombre, g.NumeroResolucion, g.LineaInvestigacion, g.TipoInvestigacion,
+		facultad, g.FechaRegistro.Format(timeFormat), g.Estado}
+}
+
+// ExportGruposHandler exports the groups matching the filters of GET /grupos (same
+// parameters and visibility) as ?format=csv (default) or xlsx, one row per group member.
+// With ?layout=plano each group takes a single row listing its members. Rows are streamed
+// as they are read from the database.
+func ExportGruposHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := grupoFilterFromRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		layout := r.URL.Query().Get("layout")
+		if layout != "" && layout != layoutPlano {
+			http.Error(w, errLayoutInvalido.Error(), http.StatusBadRequest)
+			return
+		}
+
+		columnas := append(append([]string{}, columnasGrupo...), columnasIntegrante...)
+		if layout == layoutPlano {
+			columnas = append(append([]string{}, columnasGrupo...), columnasIntegrantesPlano...)
+		}
+		e, err := newExportacion(w, r, "grupos", columnas)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if layout != layoutPlano {
+			e.terminar(repository.ExportGrupos(db, filter, func(g models.Grupo, i *models.InvestigadorConRol) error {
+				integrante := make([]string, len(columnasIntegrante))
+				if i != nil {
+					integrante = []string{strconv.Itoa(i.ID), i.Nombre, i.Apellido, i.Rol}
+				}
+				return e.fila(append(valoresGrupo(g), integrante...))
+			}))
+			return
+		}
+
+		// Flattened: the rows of a group are consecutive, so it is written when the next one starts
+		var actual *models.Grupo
+		var integrantes []string
+		escribir := func() error {
+			if actual == nil {
+				return nil
+			}
+			return e.fila(append(valoresGrupo(*actual), strconv.Itoa(len(integrantes)), strings.Join(integrantes, separadorMembresias)))
+		}
+		err = repository.ExportGrupos(db, filter, func(g models.Grupo, i *models.InvestigadorConRol) error {
+			if actual == nil || actual.ID != g.ID {
+				if err := escribir(); err != nil {
+					return err
+				}
+				actual, integrantes = &g, nil
+			}
+			if i != nil {
+				integrantes = append(integrantes, fmt.Sprintf("%s %s (%s)", i.Nombre, i.Apellido, i.Rol))
+			}
+			return nil
+		})
+		if err == nil {
+			err = escribir()
+		}
+		e.terminar(err)
+	}
+}
+
+// ExportInvestigadoresHandler exports the investigators matching the filters of
+// GET /investigadores (name, q, sort; all of them without filters) as ?format=csv (default)
+// or xlsx, one row per group they belong to. With ?layout=plano each investigator takes a
+// single row listing their groups. Only groups the caller may see are listed.
+func ExportInvestigadoresHandler(db *sql.DB) http.HandlerFunc {
+	umbral := umbralSimilitud()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter := repository.InvestigadorFilter{
+			Nombre: r.URL.Query().Get("name"),
+			Q:      r.URL.Query().Get("q"),
+			Umbral: umbral,
+			Orden:  r.URL.Query().Get("sort"),
+		}
+		layout := r.URL.Query().Get("layout")
+		if layout != "" && layout != layoutPlano {
+			http.Error(w, errLayoutInvalido.Error(), http.StatusBadRequest)
+			return
+		}
+
+		columnas := append(append([]string{}, columnasInvestigador...), columnasMembresia...)
+		if layout == layoutPlano {
+			columnas = append(append([]string{}, columnasInvestigador...), columnasMembresiasPlano...)
+		}
+		e, err := newExportacion(w, r, "investigadores", columnas)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		valoresInvestigador := func(inv models.Investigador) []string {
+			return []string{strconv.Itoa(inv.ID), inv.Nombre, inv.Apellido}
+		}
+
+		if layout != layoutPlano {
+			e.terminar(repository.ExportInvestigadores(db, filter, visibilidadGrupos(r), func(inv models.Investigador, g *models.MembresiaGrupo) error {
+				membresia := make([]string, len(columnasMembresia))
+				if g != nil {
+					membresia = []string{strconv.Itoa(g.IDGrupo), g.Nombre, g.Rol}
+				}
+				return e.fila(append(valoresInvestigador(inv), membresia...))
+			}))
+			return
+		}
+
+		// Flattened: the rows of an investigator are consecutive, so they are written when the next one starts
+		var actual *models.Investigador
+		var grupos []string
+		escribir := func() error {
+			if actual == nil {
+				return nil
+			}
+			return e.fila(append(valoresInvestigador(*actual), strconv.Itoa(len(grupos)), strings.Join(grupos, separadorMembresias)))
+		}
+		err = repository.ExportInvestigadores(db, filter, visibilidadGrupos(r), func(inv models.Investigador, g *models.MembresiaGrupo) error {
+			if actual == nil || actual.ID != inv.ID {
+				if err := escribir(); err != nil {
+					return err
+				}
+				actual, grupos = &inv, nil
+			}
+			if g != nil {
+				grupos = append(grupos, fmt.Sprintf("%s (%s)", g.Nombre, g.Rol))
+			}
+			return nil
+		})
+		if err == nil {
+			err = escribir()
+		}
+		e.terminar(err)
+	}
+}
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/middleware"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/repository"
+	"github.com/gorilla/mux"
+)
+
+// fusionRequest is the body of the investigator merge endpoint.
+type fusionRequest struct {
+	IDDuplicado int            `json:"idDuplicado"` // Record merged into {id} and deleted
+	Roles       map[int]string `json:"roles"`       // Role to keep per idGrupo both belonged to, overriding the default choice
+}
+
+// GetDuplicadosInvestigadoresHandler lists, with pagination, the pairs of investigators that
+// may be the same person: same normalized name or trigram similarity of at least ?umbral=
+// (0-1, 0.6 by default), with the groups both records belong to.
+func GetDuplicadosInvestigadoresHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pag, page, err := paginaFromRequest(r)
+		if err != nil || pag.PorCursor() {
+			http.Error(w, "Duplicate candidates are paginated with page and limit", http.StatusBadRequest)
+			return
+		}
+		umbral := repository.DefaultUmbralDuplicado
+		if param := r.URL.Query().Get("umbral"); param != "" {
+			umbral, err = strconv.ParseFloat(param, 64)
+			if err != nil || umbral <= 0 || umbral > 1 {
+				http.Error(w, "Invalid umbral, use a number between 0 and 1", http.StatusBadRequest)
+				return
+			}
+		}
+
+		candidatos, totalItems, err := repository.GetCandidatosDuplicados(db, umbral, pag.Limit, pag.Offset)
+		if err != nil {
+			log.Printf("Error getting duplicate investigator candidates: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.PaginatedResponse{
+			Data:       candidatos,
+			Pagination: paginationMetadata(pag, page, totalItems, repository.Cursores{}),
+		})
+	}
+}
+
+// FusionarInvestigadoresHandler merges a duplicate investigator into the one addressed by
+// {id}. Expects JSON with idDuplicado and, optionally, roles ({"idGrupo": "rol"}) for the
+// groups both belonged to; otherwise the coordinator role wins, then the survivor's role.
+// roles naming any other group get 400. Returns the audit record of the merge.
+func FusionarInvestigadoresHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid investigator ID", http.StatusBadRequest)
+			return
+		}
+		var req fusionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body format", http.StatusBadRequest)
+			return
+		}
+		if req.IDDuplicado <= 0 || req.IDDuplicado == id {
+			http.Error(w, "idDuplicado must be another investigator", http.StatusBadRequest)
+			return
+		}
+
+		var idUsuario *int
+		if userID, ok := middleware.GetUserID(r.Context()); ok {
+			idUsuario = &userID
+		}
+		fusion, err := repository.FusionarInvestigadores(db, id, req.IDDuplicado, req.Roles, idUsuario)
+		if errors.Is(err, repository.ErrRolesSinConflicto) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("Error merging investigators: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if fusion == nil {
+			http.Error(w, "Investigador not found", http.StatusNotFound)
+			return
+		}
+		go refrescarEstadisticas(db)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(fusion)
+	}
+}
+
+// GetFusionesInvestigadoresHandler lists the recorded investigator merges with pagination,
+// newest first.
+func GetFusionesInvestigadoresHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pag, page, err := paginaFromRequest(r)
+		if err != nil || pag.PorCursor() {
+			http.Error(w, "Merges are paginated with page and limit", http.StatusBadRequest)
+			return
+		}
+
+		fusiones, totalItems, err := repository.GetFusionesInvestigadores(db, pag.Limit, pag.Offset)
+		if err != nil {
+			log.Printf("Error getting investigator merges: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.PaginatedResponse{
+			Data:       fusiones,
+			Pagination: paginationMetadata(pag, page, totalItems, repository.Cursores{}),
+		})
+	}
+}
@@ -3,147 +3,155 @@ package controllers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
-	"math"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/middleware"
 	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
 	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/repository"
-	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/utils"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/scanner"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/storage"
 	"github.com/gorilla/mux"
 )
 
 const (
-	uploadDir     = "uploads"
-	maxUploadSize = 10 * 1024 * 1024
-	timeFormat    = "2006-01-02"
+	timeFormat = "2006-01-02"
 )
 
-// Helper function to save uploaded file
-func saveUploadedFile(r *http.Request, formKey string) (*string, error) {
-	err := r.ParseMultipartForm(maxUploadSize)
-	if err != nil {
-		if err == http.ErrNotMultipart || err == http.ErrMissingFile {
-			return nil, nil
-		}
-		return nil, fmt.Errorf("error parsing multipart form: %w", err)
+// optionalFormValue returns the trimmed form value of key, or nil when it is missing or blank.
+func optionalFormValue(r *http.Request, key string) *string {
+	value := strings.TrimSpace(r.FormValue(key))
+	if value == "" {
+		return nil
 	}
+	return &value
+}
 
-	file, handler, err := r.FormFile(formKey)
-	if err != nil {
-		if err == http.ErrMissingFile {
-			return nil, nil
+// listParam splits a comma-separated query parameter into its non-empty values.
+func listParam(r *http.Request, key string) []string {
+	var values []string
+	for _, v := range strings.Split(r.URL.Query().Get(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
 		}
-		return nil, fmt.Errorf("error retrieving file '%s': %w", formKey, err)
-	}
-	defer file.Close()
-
-	originalFilename := filepath.Base(handler.Filename)
-	safeFilename := strings.ReplaceAll(originalFilename, "..", "")
-	uniqueFilename := fmt.Sprintf("%d_%s", time.Now().UnixNano(), safeFilename)
-
-	err = os.MkdirAll(uploadDir, os.ModePerm)
-	if err != nil {
-		return nil, fmt.Errorf("error creating upload directory: %w", err)
 	}
+	return values
+}
 
-	filePath := filepath.Join(uploadDir, uniqueFilename)
-	dst, err := os.Create(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("error creating destination file: %w", err)
-	}
-	defer dst.Close()
-
-	_, err = io.Copy(dst, file)
+// grupoFilterFromRequest reads the group search parameters shared by the list endpoints and
+// restricts them to what the caller may see. Errors describe the invalid parameter and are
+// meant for a 400 response.
+func grupoFilterFromRequest(r *http.Request) (repository.GrupoFilter, error) {
+	filter, err := repository.ParseGrupoFilter(r.URL.Query())
 	if err != nil {
-		os.Remove(filePath)
-		return nil, fmt.Errorf("error copying uploaded file: %w", err)
+		return filter, err
 	}
-
-	relativePath := filepath.ToSlash(filePath)
-	return &relativePath, nil
+	// Others' unpublished groups and internal documents only for reviewers
+	filter.Visibilidad = visibilidadGrupos(r)
+	return filter, nil
 }
 
-func removeFile(relativePath *string) error {
-	if relativePath == nil || *relativePath == "" {
-		return nil
-	}
-	err := os.Remove(*relativePath)
-	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("error removing file '%s': %w", *relativePath, err)
+// writeListError answers a failed list query: 400 for an invalid sort parameter or cursor, 500 otherwise.
+func writeListError(w http.ResponseWriter, err error) {
+	if errors.Is(err, repository.ErrOrdenInvalido) || errors.Is(err, repository.ErrCursorInvalido) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	return nil
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
 }
 
 // GetGruposHandler handles fetching all groups or searching based on criteria with pagination.
+// List parameters (año, lineaInvestigacion, tipoInvestigacion, facultad) accept comma-separated
+// values; fechaDesde/fechaHasta and minIntegrantes/maxIntegrantes bound the registration date
+// and member count, and sort=fechaRegistro,-nombre sets the order. With ?facetas=true the
+// response also counts the matching groups per research line, research type, year, faculty
+// and state. ?after=/?before= page through the results with the cursors of a previous response.
 func GetGruposHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Read search params
-		groupName := r.URL.Query().Get("grupo")
-		investigatorName := r.URL.Query().Get("investigador")
-		year := r.URL.Query().Get("año")
-		lineaInvestigacion := r.URL.Query().Get("lineaInvestigacion")
-		tipoInvestigacion := r.URL.Query().Get("tipoInvestigacion")
+		filter, err := grupoFilterFromRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
 		// Read pagination params
-		page, limit := utils.GetPaginationParams(r)
-		offset := (page - 1) * limit
+		pag, page, err := paginaFromRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
 		var data interface{} // Holds either []Grupo or []GrupoWithInvestigadores
 		var totalItems int
-		var err error
+		var cursores repository.Cursores
 
 		// Check if *any* search parameter is provided
-		isSearch := groupName != "" || investigatorName != "" || year != "" || lineaInvestigacion != "" || tipoInvestigacion != ""
+		isSearch := filter.HasCriteria()
 
 		if isSearch {
 			// Perform search: returns groups with investigators and roles
 			var gruposConDetalles []models.GrupoWithInvestigadores
-			gruposConDetalles, totalItems, err = repository.SearchGrupos(db, groupName, investigatorName, year, lineaInvestigacion, tipoInvestigacion, limit, offset)
+			gruposConDetalles, totalItems, cursores, err = repository.SearchGrupos(db, filter, pag)
+			if err == nil && filter.Contenido != "" {
+				err = addFragmentosContenido(db, gruposConDetalles, filter)
+			}
 			data = gruposConDetalles
 		} else {
 			// Get all groups (simple list)
 			var gruposSimples []models.Grupo
-			gruposSimples, totalItems, err = repository.GetAllGrupos(db, limit, offset)
+			gruposSimples, totalItems, cursores, err = repository.GetAllGrupos(db, filter.Visibilidad, filter.Orden, pag)
 			data = gruposSimples
 		}
 
+		var facetas *models.FacetasGrupo
+		if err == nil && r.URL.Query().Get("facetas") == "true" {
+			facetas, err = repository.GetFacetasGrupos(db, filter)
+		}
+
 		if err != nil {
 			log.Printf("Error getting/searching groups: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			writeListError(w, err)
 			return
 		}
 
 		// Calculate pagination metadata
-		totalPages := 0
-		if totalItems > 0 {
-			totalPages = int(math.Ceil(float64(totalItems) / float64(limit)))
-		}
-		pagination := models.PaginationMetadata{
-			TotalItems:  totalItems,
-			TotalPages:  totalPages,
-			CurrentPage: page,
-			Limit:       limit,
-		}
+		pagination := paginationMetadata(pag, page, totalItems, cursores)
 
 		// Create paginated response
 		response := models.PaginatedResponse{
 			Data:       data,
 			Pagination: pagination,
 		}
+		if facetas != nil {
+			response.Facetas = facetas
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(response)
 	}
 }
 
+// addFragmentosContenido attaches to each group the excerpts of its documents matching filter.Contenido.
+func addFragmentosContenido(db *sql.DB, grupos []models.GrupoWithInvestigadores, filter repository.GrupoFilter) error {
+	ids := make([]int, len(grupos))
+	for i, g := range grupos {
+		ids[i] = g.Grupo.ID
+	}
+	fragmentos, err := repository.GetFragmentosContenido(db, ids, filter.Contenido, filter.Visibilidad)
+	if err != nil {
+		return err
+	}
+	for i := range grupos {
+		grupos[i].Coincidencias = fragmentos[grupos[i].Grupo.ID]
+	}
+	return nil
+}
+
 // GetGrupoHandler handles fetching a single group by ID.
 func GetGrupoHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -162,8 +170,7 @@ func GetGrupoHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		if grupo == nil {
-			http.Error(w, "Grupo not found", http.StatusNotFound)
+		if !checkGrupoVisible(db, w, r, grupo, "Grupo not found") {
 			return
 		}
 
@@ -173,17 +180,14 @@ func GetGrupoHandler(db *sql.DB) http.HandlerFunc {
 }
 
 // CreateGrupoHandler handles creating a new group with potential file upload.
+// New groups start as drafts; numeroResolucion may be left empty until approval.
 // Expects multipart/form-data
-func CreateGrupoHandler(db *sql.DB) http.HandlerFunc {
+func CreateGrupoHandler(db *sql.DB, store storage.Storage, sc scanner.Scanner) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		filePath, err := saveUploadedFile(r, "archivo")
+		filePath, err := saveUploadedFile(w, r, db, store, sc, "archivo", models.CategoriaResolucion)
 		if err != nil {
 			log.Printf("Error saving uploaded file during group creation: %v", err)
-			if strings.Contains(err.Error(), "parsing multipart form") || strings.Contains(err.Error(), "request body too large") {
-				http.Error(w, fmt.Sprintf("Error processing form: %v", err), http.StatusBadRequest)
-			} else {
-				http.Error(w, "Internal server error processing file upload", http.StatusInternalServerError)
-			}
+			writeUploadError(w, err)
 			return
 		}
 
@@ -192,34 +196,40 @@ func CreateGrupoHandler(db *sql.DB) http.HandlerFunc {
 		g.NumeroResolucion = r.FormValue("numeroResolucion")
 		g.LineaInvestigacion = r.FormValue("lineaInvestigacion")
 		g.TipoInvestigacion = r.FormValue("tipoInvestigacion")
+		g.Facultad = optionalFormValue(r, "facultad")
 
 		fechaStr := r.FormValue("fechaRegistro")
 		if fechaStr != "" {
 			parsedDate, err := time.Parse(timeFormat, fechaStr)
 			if err != nil {
-				_ = removeFile(filePath)
+				_ = removeFile(store, filePath)
 				http.Error(w, fmt.Sprintf("Invalid format for fechaRegistro. Use %s", timeFormat), http.StatusBadRequest)
 				return
 			}
 			g.FechaRegistro = parsedDate
 		}
 
-		if g.Nombre == "" || g.NumeroResolucion == "" || g.LineaInvestigacion == "" || g.TipoInvestigacion == "" {
-			_ = removeFile(filePath)
-			http.Error(w, "Missing required text fields: nombre, numeroResolucion, lineaInvestigacion, tipoInvestigacion", http.StatusBadRequest)
+		if g.Nombre == "" || g.LineaInvestigacion == "" || g.TipoInvestigacion == "" {
+			_ = removeFile(store, filePath)
+			http.Error(w, "Missing required text fields: nombre, lineaInvestigacion, tipoInvestigacion", http.StatusBadRequest)
 			return
 		}
 		if g.FechaRegistro.IsZero() {
-			_ = removeFile(filePath)
+			_ = removeFile(store, filePath)
 			http.Error(w, fmt.Sprintf("Missing or invalid required field: fechaRegistro (use format %s)", timeFormat), http.StatusBadRequest)
 			return
 		}
 
 		g.Archivo = filePath
+		g.Estado = models.EstadoBorrador
 
-		if err := repository.CreateGrupo(db, &g); err != nil {
+		var propietario *int
+		if userID, ok := middleware.GetUserID(r.Context()); ok {
+			propietario = &userID
+		}
+		if err := repository.CreateGrupo(db, &g, propietario); err != nil {
 			log.Printf("Error creating group in repository: %v", err)
-			_ = removeFile(filePath)
+			_ = removeFile(store, filePath)
 			http.Error(w, "Internal server error saving group", http.StatusInternalServerError)
 			return
 		}
@@ -231,8 +241,9 @@ func CreateGrupoHandler(db *sql.DB) http.HandlerFunc {
 }
 
 // UpdateGrupoHandler handles updating an existing group, potentially replacing the file.
+// Users may only update the drafts they own; reviewers and admins any group.
 // Expects multipart/form-data
-func UpdateGrupoHandler(db *sql.DB) http.HandlerFunc {
+func UpdateGrupoHandler(db *sql.DB, store storage.Storage, sc scanner.Scanner) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		idStr := vars["id"]
@@ -252,30 +263,31 @@ func UpdateGrupoHandler(db *sql.DB) http.HandlerFunc {
 			http.Error(w, "Grupo not found for update", http.StatusNotFound)
 			return
 		}
+		if !autorizarEdicionGrupo(db, w, r, existingGrupo) {
+			return
+		}
 
-		newFilePath, err := saveUploadedFile(r, "archivo")
+		newFilePath, err := saveUploadedFile(w, r, db, store, sc, "archivo", models.CategoriaResolucion)
 		if err != nil {
 			log.Printf("Error saving uploaded file during group update: %v", err)
-			if strings.Contains(err.Error(), "parsing multipart form") || strings.Contains(err.Error(), "request body too large") {
-				http.Error(w, fmt.Sprintf("Error processing form: %v", err), http.StatusBadRequest)
-			} else {
-				http.Error(w, "Internal server error processing file upload", http.StatusInternalServerError)
-			}
+			writeUploadError(w, err)
 			return
 		}
 
 		var updatedGrupo models.Grupo
 		updatedGrupo.ID = id
+		updatedGrupo.Estado = existingGrupo.Estado // Only updated while still in this state
 		updatedGrupo.Nombre = r.FormValue("nombre")
 		updatedGrupo.NumeroResolucion = r.FormValue("numeroResolucion")
 		updatedGrupo.LineaInvestigacion = r.FormValue("lineaInvestigacion")
 		updatedGrupo.TipoInvestigacion = r.FormValue("tipoInvestigacion")
+		updatedGrupo.Facultad = optionalFormValue(r, "facultad")
 
 		fechaStr := r.FormValue("fechaRegistro")
 		if fechaStr != "" {
 			parsedDate, err := time.Parse(timeFormat, fechaStr)
 			if err != nil {
-				_ = removeFile(newFilePath)
+				_ = removeFile(store, newFilePath)
 				http.Error(w, fmt.Sprintf("Invalid format for fechaRegistro. Use %s", timeFormat), http.StatusBadRequest)
 				return
 			}
@@ -296,6 +308,9 @@ func UpdateGrupoHandler(db *sql.DB) http.HandlerFunc {
 		if updatedGrupo.TipoInvestigacion == "" {
 			updatedGrupo.TipoInvestigacion = existingGrupo.TipoInvestigacion
 		}
+		if updatedGrupo.Facultad == nil {
+			updatedGrupo.Facultad = existingGrupo.Facultad
+		}
 
 		var oldFilePathToDelete *string = nil
 		if newFilePath != nil {
@@ -308,14 +323,18 @@ func UpdateGrupoHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		if err := repository.UpdateGrupo(db, &updatedGrupo); err != nil {
+			_ = removeFile(store, newFilePath)
+			if errors.Is(err, repository.ErrEstadoDesactualizado) {
+				http.Error(w, "The group state changed meanwhile; reload and try again", http.StatusConflict)
+				return
+			}
 			log.Printf("Error updating group in repository: %v", err)
-			_ = removeFile(newFilePath)
 			http.Error(w, "Internal server error updating group", http.StatusInternalServerError)
 			return
 		}
 
 		if oldFilePathToDelete != nil {
-			err := removeFile(oldFilePathToDelete)
+			err := removeFile(store, oldFilePathToDelete)
 			if err != nil {
 				log.Printf("Warning: Error deleting old file '%s' after group update: %v", *oldFilePathToDelete, err)
 			}
@@ -327,7 +346,8 @@ func UpdateGrupoHandler(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-// DeleteGrupoHandler handles deleting a group by ID.
+// DeleteGrupoHandler handles deleting a group by ID. Users may only delete the drafts they
+// own; reviewers and admins any group.
 func DeleteGrupoHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
@@ -338,7 +358,25 @@ func DeleteGrupoHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		if err := repository.DeleteGrupo(db, id); err != nil {
+		grupo, err := repository.GetGrupoByID(db, id)
+		if err != nil {
+			log.Printf("Error getting group by ID for deletion: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if grupo == nil {
+			http.Error(w, "Grupo not found", http.StatusNotFound)
+			return
+		}
+		if !autorizarEdicionGrupo(db, w, r, grupo) {
+			return
+		}
+
+		if err := repository.DeleteGrupo(db, id, grupo.Estado); err != nil {
+			if errors.Is(err, repository.ErrEstadoDesactualizado) {
+				http.Error(w, "The group state changed meanwhile; reload and try again", http.StatusConflict)
+				return
+			}
 			log.Printf("Error deleting group: %v", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
@@ -370,6 +408,9 @@ func GetGrupoDetailsHandler(db *sql.DB) http.HandlerFunc {
 			http.Error(w, "Grupo not found", http.StatusNotFound)
 			return
 		}
+		if !checkGrupoVisible(db, w, r, &grupoWithInvestigadores.Grupo, "Grupo not found") {
+			return
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(grupoWithInvestigadores)
@@ -424,11 +465,16 @@ func CreateGrupoWithDetailsHandler(db *sql.DB) http.HandlerFunc {
 
 		// Create the group within the transaction using QueryRow with RETURNING
 		grupoToCreate := requestBody.Grupo
+		grupoToCreate.Estado = models.EstadoBorrador // New groups always start as drafts
 		// Use lowercase snake_case names and $n placeholders
-		groupInsertQuery := `INSERT INTO grupo (nombre, numeroResolucion, lineaInvestigacion, tipoInvestigacion, fechaRegistro, archivo) VALUES ($1, $2, $3, $4, $5, $6) RETURNING idGrupo`
-		var grupoID int64 // Use int64 for Scan with RETURNING
+		groupInsertQuery := `INSERT INTO grupo (nombre, numeroResolucion, lineaInvestigacion, tipoInvestigacion, facultad, fechaRegistro, archivo, estado, idUsuario) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING idGrupo`
+		var grupoID int64    // Use int64 for Scan with RETURNING
+		var propietario *int // The caller owns the new group
+		if userID, ok := middleware.GetUserID(r.Context()); ok {
+			propietario = &userID
+		}
 
-		err = tx.QueryRow(groupInsertQuery, grupoToCreate.Nombre, grupoToCreate.NumeroResolucion, grupoToCreate.LineaInvestigacion, grupoToCreate.TipoInvestigacion, grupoToCreate.FechaRegistro, grupoToCreate.Archivo).Scan(&grupoID)
+		err = tx.QueryRow(groupInsertQuery, grupoToCreate.Nombre, grupoToCreate.NumeroResolucion, grupoToCreate.LineaInvestigacion, grupoToCreate.TipoInvestigacion, grupoToCreate.Facultad, grupoToCreate.FechaRegistro, grupoToCreate.Archivo, grupoToCreate.Estado, propietario).Scan(&grupoID)
 		if err != nil {
 			// Error is logged and transaction rolled back by defer
 			log.Printf("Error inserting group in transaction: %v", err)
@@ -470,7 +516,7 @@ func GetGruposByInvestigadorHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		gruposConIntegrantes, err := repository.GetGruposByInvestigadorID(db, id)
+		gruposConIntegrantes, err := repository.GetGruposByInvestigadorID(db, id, visibilidadGrupos(r))
 		if err != nil {
 			log.Printf("Error obteniendo grupos por investigador: %v", err)
 			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
@@ -492,31 +538,26 @@ func GetGruposByInvestigadorHandler(db *sql.DB) http.HandlerFunc {
 }
 
 // GetAllGruposWithDetailsHandler retrieves all groups with their associated investigators and roles, paginated.
+// ?sort= sets the order, as in GetGruposHandler.
 func GetAllGruposWithDetailsHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Read pagination params
-		page, limit := utils.GetPaginationParams(r)
-		offset := (page - 1) * limit
+		pag, page, err := paginaFromRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
 		// Call the repository function to get all groups with details
-		gruposConDetalles, totalItems, err := repository.GetAllGruposWithDetails(db, limit, offset)
+		gruposConDetalles, totalItems, cursores, err := repository.GetAllGruposWithDetails(db, visibilidadGrupos(r), r.URL.Query().Get("sort"), pag)
 		if err != nil {
 			log.Printf("Error getting all groups with details: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			writeListError(w, err)
 			return
 		}
 
 		// Calculate pagination metadata
-		totalPages := 0
-		if totalItems > 0 {
-			totalPages = int(math.Ceil(float64(totalItems) / float64(limit)))
-		}
-		pagination := models.PaginationMetadata{
-			TotalItems:  totalItems,
-			TotalPages:  totalPages,
-			CurrentPage: page,
-			Limit:       limit,
-		}
+		pagination := paginationMetadata(pag, page, totalItems, cursores)
 
 		// Create paginated response
 		response := models.PaginatedResponse{
@@ -0,0 +1,351 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/middleware"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/repository"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/scanner"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/storage"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/utils"
+	"github.com/gorilla/mux"
+)
+
+// defaultDownloadURLTTL is how long a signed download URL stays valid unless
+// DOWNLOAD_URL_TTL says otherwise.
+const defaultDownloadURLTTL = 15 * time.Minute
+
+// downloadURLConfig returns the secret and lifetime used for signed download URLs. The
+// secret comes from SIGNED_URL_SECRET and is never shared with the JWT or other signatures;
+// without it signed URLs are neither issued nor accepted.
+func downloadURLConfig() ([]byte, time.Duration) {
+	secret := os.Getenv("SIGNED_URL_SECRET")
+	ttl := defaultDownloadURLTTL
+	if ttlStr := os.Getenv("DOWNLOAD_URL_TTL"); ttlStr != "" {
+		parsed, err := time.ParseDuration(ttlStr)
+		if err != nil || parsed <= 0 {
+			log.Printf("Warning: invalid DOWNLOAD_URL_TTL %q, using %s", ttlStr, defaultDownloadURLTTL)
+		} else {
+			ttl = parsed
+		}
+	}
+	return []byte(secret), ttl
+}
+
+// archivoResource is the string signed for an attachment's download URL.
+func archivoResource(idArchivo int) string {
+	return fmt.Sprintf("grupo_archivo:%d", idArchivo)
+}
+
+func categoriaValida(categoria string) bool {
+	for _, c := range models.CategoriasArchivo {
+		if categoria == c {
+			return true
+		}
+	}
+	return false
+}
+
+// GetArchivosByGrupoHandler lists the attachments of a group. Optional filter: ?categoria=cv
+func GetArchivosByGrupoHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid group ID", http.StatusBadRequest)
+			return
+		}
+
+		grupo, err := repository.GetGrupoByID(db, id)
+		if err != nil {
+			log.Printf("Error getting group by ID for attachments: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !checkGrupoVisible(db, w, r, grupo, "Grupo not found") {
+			return
+		}
+
+		archivos, err := repository.GetArchivosByGrupoID(db, id, r.URL.Query().Get("categoria"))
+		if err != nil {
+			log.Printf("Error getting group attachments: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		// Internal documents only for reviewers and the group's owner
+		completo, err := accesoCompletoGrupo(db, r, id)
+		if err != nil {
+			log.Printf("Error checking access to internal attachments: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !completo {
+			publicos := []models.GrupoArchivo{}
+			for _, a := range archivos {
+				if a.Visibilidad == models.VisibilidadPublico {
+					publicos = append(publicos, a)
+				}
+			}
+			archivos = publicos
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": archivos,
+		})
+	}
+}
+
+// CreateGrupoArchivoHandler attaches a new document to a group.
+// Expects multipart/form-data with archivo, categoria, descripcion (optional) and
+// visibilidad ('publico' or 'interno', default 'interno').
+func CreateGrupoArchivoHandler(db *sql.DB, store storage.Storage, sc scanner.Scanner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid group ID", http.StatusBadRequest)
+			return
+		}
+
+		grupo, err := repository.GetGrupoByID(db, id)
+		if err != nil {
+			log.Printf("Error getting group by ID for new attachment: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if grupo == nil {
+			http.Error(w, "Grupo not found", http.StatusNotFound)
+			return
+		}
+
+		// Validate the text fields before storing the file, so a bad request leaves nothing
+		// behind; the category also decides the size limit
+		if err := parseUploadForm(w, r); err != nil {
+			log.Printf("Error parsing attachment upload form: %v", err)
+			writeUploadError(w, fmt.Errorf("error parsing multipart form: %w", err))
+			return
+		}
+		categoria := r.FormValue("categoria")
+		if !categoriaValida(categoria) {
+			http.Error(w, fmt.Sprintf("Invalid categoria. Use one of: %s", strings.Join(models.CategoriasArchivo, ", ")), http.StatusBadRequest)
+			return
+		}
+		visibilidad := r.FormValue("visibilidad")
+		if visibilidad == "" {
+			visibilidad = models.VisibilidadInterno
+		}
+		if visibilidad != models.VisibilidadPublico && visibilidad != models.VisibilidadInterno {
+			http.Error(w, "Invalid visibilidad. Use 'publico' or 'interno'", http.StatusBadRequest)
+			return
+		}
+
+		info, err := saveUploadedFileInfo(w, r, db, store, sc, "archivo", categoria)
+		if err != nil {
+			log.Printf("Error saving uploaded attachment: %v", err)
+			writeUploadError(w, err)
+			return
+		}
+		if info == nil {
+			http.Error(w, "Missing required file: archivo", http.StatusBadRequest)
+			return
+		}
+
+		archivo := models.GrupoArchivo{
+			IDGrupo:        id,
+			Categoria:      categoria,
+			Descripcion:    strings.TrimSpace(r.FormValue("descripcion")),
+			NombreOriginal: info.NombreOriginal,
+			Ruta:           info.Path,
+			Tamano:         info.Tamano,
+			MimeType:       info.MimeType,
+			Checksum:       info.Checksum,
+			EstadoEscaneo:  info.EstadoEscaneo,
+			Visibilidad:    visibilidad,
+		}
+		if userID, ok := middleware.GetUserID(r.Context()); ok {
+			archivo.IDUsuario = &userID
+		}
+
+		if err := repository.CreateGrupoArchivo(db, &archivo); err != nil {
+			log.Printf("Error creating group attachment in repository: %v", err)
+			_ = removeFile(store, &info.Path)
+			http.Error(w, "Internal server error saving attachment", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(archivo)
+	}
+}
+
+// getGrupoArchivoFromRequest loads the attachment addressed by {id}/{idArchivo}, writing
+// the error response itself when it cannot be returned.
+func getGrupoArchivoFromRequest(db *sql.DB, w http.ResponseWriter, r *http.Request) *models.GrupoArchivo {
+	vars := mux.Vars(r)
+	idGrupo, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return nil
+	}
+	idArchivo, err := strconv.Atoi(vars["idArchivo"])
+	if err != nil {
+		http.Error(w, "Invalid attachment ID", http.StatusBadRequest)
+		return nil
+	}
+
+	archivo, err := repository.GetGrupoArchivoByID(db, idGrupo, idArchivo)
+	if err != nil {
+		log.Printf("Error getting group attachment by ID: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil
+	}
+	if archivo == nil {
+		http.Error(w, "Archivo not found", http.StatusNotFound)
+		return nil
+	}
+	return archivo
+}
+
+// checkArchivoVisible writes a 404 when the caller may not see archivo, or a 500 if that
+// cannot be checked, and reports whether the request may go on. Its group must be visible,
+// and internal documents are only for reviewers and the group's owner.
+func checkArchivoVisible(db *sql.DB, w http.ResponseWriter, r *http.Request, archivo *models.GrupoArchivo) bool {
+	grupo, err := repository.GetGrupoByID(db, archivo.IDGrupo)
+	if err != nil {
+		log.Printf("Error getting group by ID for attachment: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	if !checkGrupoVisible(db, w, r, grupo, "Archivo not found") {
+		return false
+	}
+	if archivo.Visibilidad == models.VisibilidadPublico {
+		return true
+	}
+	completo, err := accesoCompletoGrupo(db, r, archivo.IDGrupo)
+	if err != nil {
+		log.Printf("Error checking access to internal attachment: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	if !completo {
+		http.Error(w, "Archivo not found", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// DownloadGrupoArchivoHandler streams an attachment from storage with its original file name.
+// Internal documents are only served to reviewers and the group's owner; they can share them
+// through a signed URL.
+func DownloadGrupoArchivoHandler(db *sql.DB, store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		archivo := getGrupoArchivoFromRequest(db, w, r)
+		if archivo == nil || !checkArchivoVisible(db, w, r, archivo) {
+			return
+		}
+
+		serveStoredFile(w, r, db, store, archivo.Ruta, archivo.MimeType, archivo.NombreOriginal)
+	}
+}
+
+// DeleteGrupoArchivoHandler removes an attachment and its file.
+func DeleteGrupoArchivoHandler(db *sql.DB, store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		archivo := getGrupoArchivoFromRequest(db, w, r)
+		if archivo == nil {
+			return
+		}
+
+		if err := repository.DeleteGrupoArchivo(db, archivo.ID); err != nil {
+			log.Printf("Error deleting group attachment: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if err := removeFile(store, &archivo.Ruta); err != nil {
+			log.Printf("Warning: Error deleting attachment file '%s': %v", archivo.Ruta, err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GetEnlaceDescargaHandler issues a time-limited signed URL for an attachment the caller may
+// download, so internal documents can be opened without sending the Authorization header
+// (e.g. in a new tab).
+func GetEnlaceDescargaHandler(db *sql.DB) http.HandlerFunc {
+	secret, ttl := downloadURLConfig()
+	if len(secret) == 0 {
+		log.Print("Warning: SIGNED_URL_SECRET not set, signed download URLs will not be issued")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(secret) == 0 {
+			http.Error(w, "Signed download URLs are not configured", http.StatusServiceUnavailable)
+			return
+		}
+		archivo := getGrupoArchivoFromRequest(db, w, r)
+		if archivo == nil || !checkArchivoVisible(db, w, r, archivo) {
+			return
+		}
+
+		expira := time.Now().Add(ttl)
+		firma := utils.SignResource(secret, archivoResource(archivo.ID), expira)
+		enlace := fmt.Sprintf("/descargas/%d?expira=%d&firma=%s", archivo.ID, expira.Unix(), firma)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"url":    enlace,
+			"expira": expira.UTC(),
+		})
+	}
+}
+
+// DownloadFirmadoHandler streams an attachment addressed by a signed URL issued by
+// GetEnlaceDescargaHandler. Expired or tampered URLs get 403.
+func DownloadFirmadoHandler(db *sql.DB, store storage.Storage) http.HandlerFunc {
+	secret, _ := downloadURLConfig()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(secret) == 0 {
+			http.Error(w, "Signed download URLs are not configured", http.StatusServiceUnavailable)
+			return
+		}
+		idArchivo, err := strconv.Atoi(mux.Vars(r)["idArchivo"])
+		if err != nil {
+			http.Error(w, "Invalid attachment ID", http.StatusBadRequest)
+			return
+		}
+		query := r.URL.Query()
+		if !utils.VerifyResourceSignature(secret, archivoResource(idArchivo), query.Get("expira"), query.Get("firma")) {
+			http.Error(w, "Invalid or expired download link", http.StatusForbidden)
+			return
+		}
+
+		archivo, err := repository.GetGrupoArchivoByIDOnly(db, idArchivo)
+		if err != nil {
+			log.Printf("Error getting group attachment for signed download: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if archivo == nil {
+			http.Error(w, "Archivo not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "private, no-store")
+		serveStoredFile(w, r, db, store, archivo.Ruta, archivo.MimeType, archivo.NombreOriginal)
+	}
+}
@@ -0,0 +1,270 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/middleware"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/repository"
+	"github.com/gorilla/mux"
+)
+
+var (
+	todosLosRoles = []string{models.RolUsuario, models.RolRevisor, models.RolAdmin}
+	rolesRevision = []string{models.RolRevisor, models.RolAdmin}
+)
+
+// transicionesGrupo is the group lifecycle state machine: for each current state, the
+// states it may move to and the roles allowed to perform that transition. Users with
+// RolUsuario may only perform them on the groups they own (see requirePropietarioGrupo).
+var transicionesGrupo = map[string]map[string][]string{
+	models.EstadoBorrador: {
+		models.EstadoEnviado: todosLosRoles,
+	},
+	models.EstadoEnviado: {
+		models.EstadoEnRevision: rolesRevision,
+		models.EstadoBorrador:   todosLosRoles, // Submitter withdraws the request
+	},
+	models.EstadoEnRevision: {
+		models.EstadoAprobado: rolesRevision,
+		models.EstadoBorrador: rolesRevision, // Returned with observations
+	},
+	models.EstadoAprobado: {
+		models.EstadoActivo: rolesRevision,
+	},
+	models.EstadoActivo: {
+		models.EstadoInactivo: rolesRevision,
+		models.EstadoDisuelto: {models.RolAdmin},
+	},
+	models.EstadoInactivo: {
+		models.EstadoActivo:   rolesRevision,
+		models.EstadoDisuelto: {models.RolAdmin},
+	},
+}
+
+// visibilidadGrupos returns which groups the caller may see, in the states they ask for
+// with ?estado=a,b. Reviewers and admins see every group; other users, the approved/active
+// ones and those they registered; anonymous users, only the approved/active ones.
+func visibilidadGrupos(r *http.Request) repository.Visibilidad {
+	var idUsuario *int
+	if userID, ok := middleware.GetUserID(r.Context()); ok {
+		idUsuario = &userID
+	}
+	return repository.NewVisibilidad(listParam(r, "estado"), middleware.GetUserRole(r.Context()), idUsuario)
+}
+
+// accesoCompletoGrupo reports whether the caller may see the group idGrupo in any state,
+// along with its internal documents: reviewers, admins and the user who registered it.
+func accesoCompletoGrupo(db *sql.DB, r *http.Request, idGrupo int) (bool, error) {
+	vis := visibilidadGrupos(r)
+	if !vis.SoloPublicos {
+		return true, nil
+	}
+	if vis.Propietario == nil {
+		return false, nil
+	}
+	return repository.EsPropietarioGrupo(db, idGrupo, *vis.Propietario)
+}
+
+// grupoVisible reports whether the caller may see the group idGrupo, in the given state.
+func grupoVisible(db *sql.DB, r *http.Request, idGrupo int, estado string) (bool, error) {
+	if repository.EsEstadoPublico(estado) {
+		return true, nil
+	}
+	return accesoCompletoGrupo(db, r, idGrupo)
+}
+
+// checkGrupoVisible writes a 404 with notFound when grupo is nil or the caller may not see
+// it (or a 500 if that cannot be checked), and reports whether the request may go on.
+func checkGrupoVisible(db *sql.DB, w http.ResponseWriter, r *http.Request, grupo *models.Grupo, notFound string) bool {
+	if grupo == nil {
+		http.Error(w, notFound, http.StatusNotFound)
+		return false
+	}
+	visible, err := grupoVisible(db, r, grupo.ID, grupo.Estado)
+	if err != nil {
+		log.Printf("Error checking group visibility: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	if !visible {
+		http.Error(w, notFound, http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// requirePropietarioGrupo checks that the caller registered the group idGrupo, writing the
+// error response itself when they did not or it cannot be checked.
+func requirePropietarioGrupo(db *sql.DB, w http.ResponseWriter, r *http.Request, idGrupo int) bool {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	propietario, err := repository.EsPropietarioGrupo(db, idGrupo, userID)
+	if err != nil {
+		log.Printf("Error checking group owner: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	if !propietario {
+		http.Error(w, "Forbidden: only the owner of the group can do this", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// autorizarEdicionGrupo checks that the caller may edit or delete grupo, writing the error
+// response itself when they may not. Reviewers and admins may change any group; users only
+// the drafts they own, since once submitted a group changes through its transitions.
+func autorizarEdicionGrupo(db *sql.DB, w http.ResponseWriter, r *http.Request, grupo *models.Grupo) bool {
+	switch middleware.GetUserRole(r.Context()) {
+	case models.RolRevisor, models.RolAdmin:
+		return true
+	case models.RolUsuario:
+		if !requirePropietarioGrupo(db, w, r, grupo.ID) {
+			return false
+		}
+		if grupo.Estado != models.EstadoBorrador {
+			http.Error(w, fmt.Sprintf("Only draft groups can be changed by their owner; this one is '%s'", grupo.Estado), http.StatusConflict)
+			return false
+		}
+		return true
+	}
+	http.Error(w, "Forbidden: insufficient role", http.StatusForbidden)
+	return false
+}
+
+// CambiarEstadoGrupoRequest is the body of a state transition request.
+type CambiarEstadoGrupoRequest struct {
+	Estado           string `json:"estado"`
+	Comentario       string `json:"comentario"`
+	NumeroResolucion string `json:"numeroResolucion"` // Required when approving a group without one
+}
+
+// CambiarEstadoGrupoHandler moves a group to a new lifecycle state, enforcing the allowed
+// transitions, the caller's role and, for plain users, that they own the group, and records
+// the reviewer comment.
+func CambiarEstadoGrupoHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid group ID", http.StatusBadRequest)
+			return
+		}
+
+		var req CambiarEstadoGrupoRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		req.Comentario = strings.TrimSpace(req.Comentario)
+		req.NumeroResolucion = strings.TrimSpace(req.NumeroResolucion)
+
+		grupo, err := repository.GetGrupoByID(db, id)
+		if err != nil {
+			log.Printf("Error getting group by ID for state transition: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if grupo == nil {
+			http.Error(w, "Grupo not found", http.StatusNotFound)
+			return
+		}
+
+		roles, ok := transicionesGrupo[grupo.Estado][req.Estado]
+		if !ok {
+			http.Error(w, fmt.Sprintf("Transition from '%s' to '%s' is not allowed", grupo.Estado, req.Estado), http.StatusConflict)
+			return
+		}
+		rol := middleware.GetUserRole(r.Context())
+		permitido := false
+		for _, allowed := range roles {
+			if rol == allowed {
+				permitido = true
+				break
+			}
+		}
+		if !permitido {
+			http.Error(w, "Forbidden: your role cannot perform this transition", http.StatusForbidden)
+			return
+		}
+		if rol == models.RolUsuario && !requirePropietarioGrupo(db, w, r, id) {
+			return
+		}
+
+		if grupo.Estado == models.EstadoEnRevision && req.Estado == models.EstadoBorrador && req.Comentario == "" {
+			http.Error(w, "A comentario is required when returning a group for corrections", http.StatusBadRequest)
+			return
+		}
+		if req.Estado == models.EstadoAprobado && req.NumeroResolucion == "" && grupo.NumeroResolucion == "" {
+			http.Error(w, "A numeroResolucion is required to approve a group", http.StatusBadRequest)
+			return
+		}
+
+		historial := models.GrupoEstadoHistorial{
+			IDGrupo:        id,
+			EstadoAnterior: grupo.Estado,
+			EstadoNuevo:    req.Estado,
+			Comentario:     req.Comentario,
+		}
+		if userID, ok := middleware.GetUserID(r.Context()); ok {
+			historial.IDUsuario = &userID
+		}
+
+		if err := repository.CambiarEstadoGrupo(db, &historial, req.NumeroResolucion); err != nil {
+			if errors.Is(err, repository.ErrEstadoDesactualizado) {
+				http.Error(w, "The group state changed meanwhile; reload and try again", http.StatusConflict)
+				return
+			}
+			log.Printf("Error changing group state: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(historial)
+	}
+}
+
+// GetHistorialEstadosGrupoHandler returns the state transitions of a group with reviewer
+// comments. Groups the caller may not see are reported as not found.
+func GetHistorialEstadosGrupoHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid group ID", http.StatusBadRequest)
+			return
+		}
+
+		grupo, err := repository.GetGrupoByID(db, id)
+		if err != nil {
+			log.Printf("Error getting group by ID for state history: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !checkGrupoVisible(db, w, r, grupo, "Grupo not found") {
+			return
+		}
+
+		historial, err := repository.GetHistorialEstadosGrupo(db, id)
+		if err != nil {
+			log.Printf("Error getting group state history: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(historial)
+	}
+}
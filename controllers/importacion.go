@@ -0,0 +1,399 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/export"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/middleware"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/repository"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/utils"
+)
+
+// maxImportSize caps the files accepted by ImportarHandler.
+const maxImportSize = 10 << 20
+
+// rolPorDefecto is the role of imported members whose row has no rol.
+const rolPorDefecto = "Integrante"
+
+// Fields of an imported row. By default each is read from the column of the same name, so
+// the files of GET /grupos/export can be imported as they are.
+const (
+	campoNombre               = "nombre" // Group name
+	campoNumeroResolucion     = "numeroResolucion"
+	campoLineaInvestigacion   = "lineaInvestigacion"
+	campoTipoInvestigacion    = "tipoInvestigacion"
+	campoFacultad             = "facultad"
+	campoFechaRegistro        = "fechaRegistro"
+	campoNombreInvestigador   = "nombreInvestigador"
+	campoApellidoInvestigador = "apellidoInvestigador"
+	campoRol                  = "rol"
+)
+
+var (
+	camposImportacion = []string{campoNombre, campoNumeroResolucion, campoLineaInvestigacion, campoTipoInvestigacion,
+		campoFacultad, campoFechaRegistro, campoNombreInvestigador, campoApellidoInvestigador, campoRol}
+	// camposGrupo are the fields describing the group of a row.
+	camposGrupo = []string{campoNumeroResolucion, campoLineaInvestigacion, campoTipoInvestigacion, campoFacultad, campoFechaRegistro}
+)
+
+// columnasImportacion maps each field to its column in the file: the column named by mapeo
+// (field -> header), or else the one named like the field. Fields without a column are left out.
+func columnasImportacion(encabezado []string, mapeo map[string]string) (map[string]int, error) {
+	indices := map[string]int{}
+	for i, nombre := range encabezado {
+		indices[strings.ToLower(strings.TrimSpace(nombre))] = i
+	}
+
+	columnas := map[string]int{}
+	for campo, columna := range mapeo {
+		if !slices.Contains(camposImportacion, campo) {
+			return nil, fmt.Errorf("unknown field '%s' in mapeo (allowed: %s)", campo, strings.Join(camposImportacion, ", "))
+		}
+		i, ok := indices[strings.ToLower(strings.TrimSpace(columna))]
+		if !ok {
+			return nil, fmt.Errorf("column '%s' mapped to %s not found in the file", columna, campo)
+		}
+		columnas[campo] = i
+	}
+	for _, campo := range camposImportacion {
+		if _, ok := columnas[campo]; ok {
+			continue
+		}
+		if i, ok := indices[strings.ToLower(campo)]; ok {
+			columnas[campo] = i
+		}
+	}
+	if _, ok := columnas[campoNombre]; !ok {
+		if _, ok := columnas[campoNombreInvestigador]; !ok {
+			return nil, fmt.Errorf("the file needs a %s or %s column", campoNombre, campoNombreInvestigador)
+		}
+	}
+	return columnas, nil
+}
+
+// grupoEnImportacion is a group of the imported file, built from the first row naming it.
+type grupoEnImportacion struct {
+	campos  map[string]string
+	grupo   models.GrupoImportado
+	claves  map[string]bool // Members already added, by normalized name
+	valido  bool
+	primera int // Row number of its first row in the file
+}
+
+// ImportarHandler imports groups, investigators and their memberships from a CSV or XLSX
+// file. Expects multipart/form-data with archivo and, optionally, mapeo (JSON object
+// field -> column header, for files whose columns are named differently). Each row has a
+// group, an investigator or both (a member of the group); rows naming the same group add
+// members to it.
+//
+// By default (dryRun=true) nothing is written: the response reports, per row, validation
+// errors and duplicates (groups that already exist, investigators found by name, which are
+// linked instead of created). With dryRun=false everything is created in a single
+// transaction, or nothing if any row has errors (422).
+func ImportarHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxImportSize+1<<20)
+		if err := r.ParseMultipartForm(maxImportSize); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid form or file larger than %d MB", maxImportSize>>20), http.StatusBadRequest)
+			return
+		}
+		file, header, err := r.FormFile("archivo")
+		if err != nil {
+			http.Error(w, "Missing required file: archivo", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		formato := strings.ToLower(r.FormValue("format"))
+		if formato == "" {
+			formato = strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), ".")
+		}
+		filas, err := export.ReadAll(formato, file)
+		if err != nil {
+			http.Error(w, "Cannot read the file: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(filas) < 2 {
+			http.Error(w, "The file has no rows besides the header", http.StatusBadRequest)
+			return
+		}
+
+		mapeo := map[string]string{}
+		if raw := r.FormValue("mapeo"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &mapeo); err != nil {
+				http.Error(w, "Invalid mapeo, expected a JSON object of field to column", http.StatusBadRequest)
+				return
+			}
+		}
+		columnas, err := columnasImportacion(filas[0], mapeo)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resultado := models.ResultadoImportacion{DryRun: r.FormValue("dryRun") != "false"}
+		investigadores, grupos, err := validarImportacion(db, filas, columnas, &resultado)
+		if err != nil {
+			log.Printf("Error validating import: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		status := http.StatusOK
+		switch {
+		case resultado.DryRun:
+		case resultado.FilasConError > 0:
+			status = http.StatusUnprocessableEntity
+		default:
+			var importador *int
+			if userID, ok := middleware.GetUserID(r.Context()); ok {
+				importador = &userID
+			}
+			if err := repository.ImportarRegistros(db, investigadores, grupos, importador); err != nil {
+				log.Printf("Error importing records: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			resultado.Importado = true
+			status = http.StatusCreated
+			go refrescarEstadisticas(db)
+			completarIDsImportados(&resultado, filas, columnas, investigadores, grupos)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(resultado)
+	}
+}
+
+// valorImportado returns the trimmed value of campo in a row, or "" when the file has no
+// such column or the row is shorter.
+func valorImportado(fila []string, columnas map[string]int, campo string) string {
+	i, ok := columnas[campo]
+	if !ok || i >= len(fila) {
+		return ""
+	}
+	return strings.TrimSpace(fila[i])
+}
+
+// claveInvestigador is the comparison key of the investigator of a row.
+func claveInvestigador(fila []string, columnas map[string]int) string {
+	return utils.NormalizarNombre(valorImportado(fila, columnas, campoNombreInvestigador) + " " + valorImportado(fila, columnas, campoApellidoInvestigador))
+}
+
+// validarImportacion checks every row of an imported file (the first being the header),
+// fills resultado with the per-row report and totals, and returns the investigators
+// (existing ones with their ID) and groups to create.
+func validarImportacion(db *sql.DB, filas [][]string, columnas map[string]int, resultado *models.ResultadoImportacion) ([]*models.Investigador, []models.GrupoImportado, error) {
+	// Look up existing records by name first
+	var clavesGrupo, clavesInvestigador []string
+	for _, fila := range filas[1:] {
+		if nombre := valorImportado(fila, columnas, campoNombre); nombre != "" {
+			clavesGrupo = append(clavesGrupo, utils.NormalizarNombre(nombre))
+		}
+		if clave := claveInvestigador(fila, columnas); clave != "" {
+			clavesInvestigador = append(clavesInvestigador, clave)
+		}
+	}
+	gruposExistentes, err := repository.GetIDsGruposPorNombre(db, clavesGrupo)
+	if err != nil {
+		return nil, nil, err
+	}
+	investigadoresExistentes, err := repository.GetIDsInvestigadoresPorNombre(db, clavesInvestigador)
+	if err != nil {
+		return nil, nil, err
+	}
+	investigadores, grupos := validarFilas(filas, columnas, gruposExistentes, investigadoresExistentes, resultado)
+	return investigadores, grupos, nil
+}
+
+// validarFilas does the work of validarImportacion once the existing groups and
+// investigators have been looked up, keyed by their normalized name.
+func validarFilas(filas [][]string, columnas map[string]int, gruposExistentes, investigadoresExistentes map[string]int, resultado *models.ResultadoImportacion) ([]*models.Investigador, []models.GrupoImportado) {
+	investigadores := map[string]*models.Investigador{}
+	var ordenInvestigadores []*models.Investigador
+	grupos := map[string]*grupoEnImportacion{}
+	var ordenGrupos []*grupoEnImportacion
+
+	for n, fila := range filas[1:] {
+		numero := n + 2 // The header is row 1
+		valores := map[string]string{}
+		vacia := true
+		for _, campo := range camposImportacion {
+			valores[campo] = valorImportado(fila, columnas, campo)
+			vacia = vacia && valores[campo] == ""
+		}
+		if vacia {
+			continue
+		}
+
+		detalle := models.FilaImportacion{Fila: numero, Grupo: valores[campoNombre]}
+		agregarError := func(format string, args ...interface{}) {
+			detalle.Errores = append(detalle.Errores, fmt.Sprintf(format, args...))
+		}
+
+		// Investigator of the row
+		var inv *models.Investigador
+		nombreInv, apellidoInv := valores[campoNombreInvestigador], valores[campoApellidoInvestigador]
+		switch {
+		case nombreInv == "" && apellidoInv == "":
+			if valores[campoRol] != "" {
+				agregarError("rol given without an investigator")
+			}
+		case nombreInv == "" || apellidoInv == "":
+			agregarError("an investigator needs both %s and %s", campoNombreInvestigador, campoApellidoInvestigador)
+		default:
+			detalle.Investigador = nombreInv + " " + apellidoInv
+			clave := claveInvestigador(fila, columnas)
+			inv = investigadores[clave]
+			if inv == nil {
+				inv = &models.Investigador{Nombre: nombreInv, Apellido: apellidoInv, ID: investigadoresExistentes[clave]}
+				investigadores[clave] = inv
+				ordenInvestigadores = append(ordenInvestigadores, inv)
+				if inv.ID != 0 {
+					resultado.InvestigadoresExistentes++
+					detalle.Avisos = append(detalle.Avisos, fmt.Sprintf("investigator already registered (idInvestigador %d), it will be linked instead of created", inv.ID))
+				} else {
+					resultado.InvestigadoresNuevos++
+				}
+			}
+			if inv.ID != 0 {
+				id := inv.ID
+				detalle.IDInvestigador = &id
+			}
+		}
+
+		// Group of the row
+		if valores[campoNombre] == "" {
+			for _, campo := range camposGrupo {
+				if valores[campo] != "" {
+					agregarError("%s given without the group %s", campo, campoNombre)
+					break
+				}
+			}
+			if inv == nil && len(detalle.Errores) == 0 {
+				agregarError("the row has neither a group nor an investigator")
+			}
+		} else {
+			clave := utils.NormalizarNombre(valores[campoNombre])
+			g := grupos[clave]
+			if g == nil {
+				g = nuevoGrupoImportado(valores, numero, agregarError)
+				if id, ok := gruposExistentes[clave]; ok {
+					agregarError("group already registered (idGrupo %d)", id)
+					g.valido = false
+				}
+				grupos[clave] = g
+				ordenGrupos = append(ordenGrupos, g)
+			} else {
+				for _, campo := range camposGrupo {
+					if valores[campo] != "" && valores[campo] != g.campos[campo] {
+						agregarError("%s differs from the one given for this group on row %d", campo, g.primera)
+					}
+				}
+			}
+
+			if inv != nil {
+				claveInv := claveInvestigador(fila, columnas)
+				rol := valores[campoRol]
+				if rol == "" {
+					rol = rolPorDefecto
+				}
+				if g.claves[claveInv] {
+					agregarError("%s is already a member of this group in an earlier row", detalle.Investigador)
+				} else {
+					g.claves[claveInv] = true
+					g.grupo.Integrantes = append(g.grupo.Integrantes, models.IntegranteImportado{Investigador: inv, Rol: rol})
+				}
+			}
+		}
+
+		resultado.Filas++
+		if len(detalle.Errores) > 0 {
+			resultado.FilasConError++
+		}
+		resultado.Detalle = append(resultado.Detalle, detalle)
+	}
+
+	var importados []models.GrupoImportado
+	for _, g := range ordenGrupos {
+		if g.valido {
+			importados = append(importados, g.grupo)
+			resultado.GruposNuevos++
+			resultado.Integrantes += len(g.grupo.Integrantes)
+		}
+	}
+	return ordenInvestigadores, importados
+}
+
+// nuevoGrupoImportado builds the group named on a row, reporting its missing or invalid
+// fields through agregarError.
+func nuevoGrupoImportado(valores map[string]string, numero int, agregarError func(string, ...interface{})) *grupoEnImportacion {
+	g := &grupoEnImportacion{primera: numero, campos: valores, claves: map[string]bool{}, valido: true}
+	grupo := &models.Grupo{
+		Nombre:             valores[campoNombre],
+		NumeroResolucion:   valores[campoNumeroResolucion],
+		LineaInvestigacion: valores[campoLineaInvestigacion],
+		TipoInvestigacion:  valores[campoTipoInvestigacion],
+	}
+	if valores[campoFacultad] != "" {
+		facultad := valores[campoFacultad]
+		grupo.Facultad = &facultad
+	}
+	for _, campo := range []string{campoLineaInvestigacion, campoTipoInvestigacion, campoFechaRegistro} {
+		if valores[campo] == "" {
+			agregarError("missing %s of the group", campo)
+			g.valido = false
+		}
+	}
+	if valores[campoFechaRegistro] != "" {
+		fecha, err := export.ParseFecha(valores[campoFechaRegistro])
+		if err != nil {
+			agregarError("%s: %v", campoFechaRegistro, err)
+			g.valido = false
+		}
+		grupo.FechaRegistro = fecha
+	}
+	g.grupo.Grupo = grupo
+	return g
+}
+
+// completarIDsImportados sets on each row of the report the IDs of its group and
+// investigator once they have been created.
+func completarIDsImportados(resultado *models.ResultadoImportacion, filas [][]string, columnas map[string]int, investigadores []*models.Investigador, grupos []models.GrupoImportado) {
+	idsGrupo := map[string]int{}
+	for _, g := range grupos {
+		idsGrupo[utils.NormalizarNombre(g.Grupo.Nombre)] = g.Grupo.ID
+	}
+	idsInvestigador := map[string]int{}
+	for _, inv := range investigadores {
+		idsInvestigador[utils.NormalizarNombre(inv.Nombre+" "+inv.Apellido)] = inv.ID
+	}
+
+	for i := range resultado.Detalle {
+		d := &resultado.Detalle[i]
+		fila := filas[d.Fila-1]
+		if id, ok := idsGrupo[utils.NormalizarNombre(d.Grupo)]; ok && d.Grupo != "" {
+			d.IDGrupo = &id
+		}
+		if id, ok := idsInvestigador[claveInvestigador(fila, columnas)]; ok && d.Investigador != "" {
+			d.IDInvestigador = &id
+		}
+	}
+}
+
+// refrescarEstadisticas refreshes the statistics views so a bulk change (an import, a merge)
+// shows up without waiting for the scheduled refresh.
+func refrescarEstadisticas(db *sql.DB) {
+	if _, err := repository.RefrescarEstadisticas(db); err != nil {
+		log.Printf("Error refreshing statistics: %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+)
+
+func TestColumnasImportacion(t *testing.T) {
+	tests := []struct {
+		name       string
+		encabezado []string
+		mapeo      map[string]string
+		want       map[string]int
+		wantErr    string
+	}{
+		{
+			name:       "export headers",
+			encabezado: []string{"idGrupo", "nombre", "numeroResolucion", "lineaInvestigacion", "tipoInvestigacion", "facultad", "fechaRegistro", "estado", "idInvestigador", "nombreInvestigador", "apellidoInvestigador", "rol"},
+			want: map[string]int{campoNombre: 1, campoNumeroResolucion: 2, campoLineaInvestigacion: 3, campoTipoInvestigacion: 4,
+				campoFacultad: 5, campoFechaRegistro: 6, campoNombreInvestigador: 9, campoApellidoInvestigador: 10, campoRol: 11},
+		},
+		{
+			name:       "case and spaces in headers",
+			encabezado: []string{" NOMBRE ", "LineaInvestigacion"},
+			want:       map[string]int{campoNombre: 0, campoLineaInvestigacion: 1},
+		},
+		{
+			name:       "mapeo",
+			encabezado: []string{"Grupo", "Nombres", "Apellidos", "nombre"},
+			mapeo:      map[string]string{campoNombre: "grupo", campoNombreInvestigador: "Nombres", campoApellidoInvestigador: "APELLIDOS"},
+			want:       map[string]int{campoNombre: 0, campoNombreInvestigador: 1, campoApellidoInvestigador: 2},
+		},
+		{
+			name:       "unknown field in mapeo",
+			encabezado: []string{"nombre"},
+			mapeo:      map[string]string{"estado": "nombre"},
+			wantErr:    "unknown field 'estado'",
+		},
+		{
+			name:       "mapped column missing",
+			encabezado: []string{"nombre"},
+			mapeo:      map[string]string{campoRol: "Cargo"},
+			wantErr:    "column 'Cargo' mapped to rol not found",
+		},
+		{
+			name:       "no group nor investigator name",
+			encabezado: []string{"facultad", "rol"},
+			wantErr:    "needs a nombre or nombreInvestigador column",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := columnasImportacion(tt.encabezado, tt.mapeo)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("columns = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidarFilas(t *testing.T) {
+	encabezado := []string{"nombre", "lineaInvestigacion", "tipoInvestigacion", "facultad", "fechaRegistro", "nombreInvestigador", "apellidoInvestigador", "rol"}
+	columnas, err := columnasImportacion(encabezado, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filas := [][]string{
+		encabezado,
+		{"Grupo de Robótica", "Robótica", "Aplicada", "Ingeniería", "2024-03-01", "José", "Quispe", "Coordinador"}, // 2
+		{"grupo de  ROBOTICA", "", "", "", "", "María", "Ñahui", ""},                                               // 3: same group, default rol
+		{"Grupo de Robótica", "Otra línea", "", "", "", "Jose", "QUISPE", "Miembro"},                               // 4: differing field, repeated member
+		{"", "", "", "", "", "", "", ""},                                        // 5: blank, skipped
+		{"", "", "", "", "", "Ana", "Torres", ""},                               // 6: investigator only, existing
+		{"Grupo Existente", "Física", "Básica", "", "01/02/2023", "", "", ""},   // 7: group already registered
+		{"Grupo Sin Fecha", "Química", "Básica", "", "", "Luis", "", "Miembro"}, // 8: missing date and apellido
+		{"", "", "", "", "", "", "", "Miembro"},                                 // 9: rol alone
+		{"Grupo Serial", "Biología", "Aplicada", "", "45292"},                   // 10: Excel date, short row
+	}
+	gruposExistentes := map[string]int{"grupo existente": 7}
+	investigadoresExistentes := map[string]int{"ana torres": 42}
+
+	var resultado models.ResultadoImportacion
+	investigadores, grupos := validarFilas(filas, columnas, gruposExistentes, investigadoresExistentes, &resultado)
+
+	errores := map[int][]string{}
+	for _, d := range resultado.Detalle {
+		errores[d.Fila] = d.Errores
+	}
+	wantErrores := map[int][]string{
+		2:  nil,
+		3:  nil,
+		4:  {"lineaInvestigacion differs from the one given for this group on row 2", "Jose QUISPE is already a member of this group in an earlier row"},
+		6:  nil,
+		7:  {"group already registered (idGrupo 7)"},
+		8:  {"an investigator needs both nombreInvestigador and apellidoInvestigador", "missing fechaRegistro of the group"},
+		9:  {"rol given without an investigator"},
+		10: nil,
+	}
+	if !reflect.DeepEqual(errores, wantErrores) {
+		t.Errorf("errors per row =\n%v\nwant\n%v", errores, wantErrores)
+	}
+	if d := resultado.Detalle[3]; d.Fila != 6 || d.IDInvestigador == nil || *d.IDInvestigador != 42 || len(d.Avisos) != 1 {
+		t.Errorf("existing investigator row = %+v", d)
+	}
+	if resultado.Filas != 8 || resultado.FilasConError != 4 || resultado.InvestigadoresNuevos != 2 || resultado.InvestigadoresExistentes != 1 {
+		t.Errorf("totals = %+v", resultado)
+	}
+
+	var nombres []string
+	for _, inv := range investigadores {
+		nombres = append(nombres, inv.Nombre+" "+inv.Apellido)
+	}
+	if want := []string{"José Quispe", "María Ñahui", "Ana Torres"}; !reflect.DeepEqual(nombres, want) {
+		t.Errorf("investigators = %q, want %q", nombres, want)
+	}
+
+	if len(grupos) != 2 || resultado.GruposNuevos != 2 || resultado.Integrantes != 2 {
+		t.Fatalf("groups = %d, GruposNuevos = %d, Integrantes = %d, want 2, 2, 2", len(grupos), resultado.GruposNuevos, resultado.Integrantes)
+	}
+	robotica := grupos[0]
+	if robotica.Grupo.Nombre != "Grupo de Robótica" || robotica.Grupo.Facultad == nil || *robotica.Grupo.Facultad != "Ingeniería" {
+		t.Errorf("group = %+v", robotica.Grupo)
+	}
+	var roles []string
+	for _, i := range robotica.Integrantes {
+		roles = append(roles, i.Investigador.Nombre+":"+i.Rol)
+	}
+	if want := []string{"José:Coordinador", "María:" + rolPorDefecto}; !reflect.DeepEqual(roles, want) {
+		t.Errorf("members = %q, want %q", roles, want)
+	}
+	if fecha := grupos[1].Grupo.FechaRegistro.Format("2006-01-02"); grupos[1].Grupo.Nombre != "Grupo Serial" || fecha != "2024-01-01" {
+		t.Errorf("second group = %s registered %s, want Grupo Serial registered 2024-01-01", grupos[1].Grupo.Nombre, fecha)
+	}
+}
@@ -4,50 +4,75 @@ import (
 	"database/sql"
 	"encoding/json"
 	"log"
-	"math"
 	"net/http"
+	"os"
 	"strconv"
+	"strings"
 
 	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
 	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/repository"
-	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/utils"
 	"github.com/gorilla/mux"
 )
 
-// GetInvestigadoresHandler handles fetching all investigators or searching by name with pagination.
+// Limits of GetSugerenciasInvestigadorHandler's ?limit=.
+const (
+	defaultSugerencias = 10
+	maxSugerencias     = 20
+)
+
+// umbralSimilitud returns the minimum trigram similarity for fuzzy name matching,
+// from SIMILITUD_UMBRAL (a number between 0 and 1).
+func umbralSimilitud() float64 {
+	umbral := repository.DefaultUmbralSimilitud
+	if umbralStr := os.Getenv("SIMILITUD_UMBRAL"); umbralStr != "" {
+		parsed, err := strconv.ParseFloat(umbralStr, 64)
+		if err != nil || parsed <= 0 || parsed > 1 {
+			log.Printf("Warning: invalid SIMILITUD_UMBRAL %q, using %g", umbralStr, repository.DefaultUmbralSimilitud)
+		} else {
+			umbral = parsed
+		}
+	}
+	return umbral
+}
+
+// GetInvestigadoresHandler handles fetching all investigators or searching them with pagination.
+// ?name= matches names containing it or similar to it (typo-tolerant), most similar first;
+// ?q= is a full-text query (websearch syntax) whose results are ordered by relevance.
+// ?sort=-createdAt,apellido sets the order instead.
 func GetInvestigadoresHandler(db *sql.DB) http.HandlerFunc {
+	umbral := umbralSimilitud()
+
 	return func(w http.ResponseWriter, r *http.Request) {
-		name := r.URL.Query().Get("name")
-		page, limit := utils.GetPaginationParams(r)
-		offset := (page - 1) * limit
+		filter := repository.InvestigadorFilter{
+			Nombre: r.URL.Query().Get("name"),
+			Q:      r.URL.Query().Get("q"),
+			Umbral: umbral,
+			Orden:  r.URL.Query().Get("sort"),
+		}
+		pag, page, err := paginaFromRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
 		var investigadores []models.Investigador
 		var totalItems int
-		var err error
+		var cursores repository.Cursores
 
-		if name != "" {
-			investigadores, totalItems, err = repository.SearchInvestigadores(db, name, limit, offset)
+		if filter.HasCriteria() {
+			investigadores, totalItems, cursores, err = repository.SearchInvestigadores(db, filter, pag)
 		} else {
-			investigadores, totalItems, err = repository.GetAllInvestigadores(db, limit, offset)
+			investigadores, totalItems, cursores, err = repository.GetAllInvestigadores(db, filter.Orden, pag)
 		}
 
 		if err != nil {
 			log.Printf("Error getting/searching investigators: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			writeListError(w, err)
 			return
 		}
 
 		// Calculate pagination metadata
-		totalPages := 0
-		if totalItems > 0 {
-			totalPages = int(math.Ceil(float64(totalItems) / float64(limit)))
-		}
-		pagination := models.PaginationMetadata{
-			TotalItems:  totalItems,
-			TotalPages:  totalPages,
-			CurrentPage: page,
-			Limit:       limit,
-		}
+		pagination := paginationMetadata(pag, page, totalItems, cursores)
 
 		// Create paginated response
 		response := models.PaginatedResponse{
@@ -60,6 +85,41 @@ func GetInvestigadoresHandler(db *sql.DB) http.HandlerFunc {
 	}
 }
 
+// GetSugerenciasInvestigadorHandler returns the investigators whose name best matches ?q=,
+// for autocomplete. ?limit= caps the results (default 10, at most 20).
+func GetSugerenciasInvestigadorHandler(db *sql.DB) http.HandlerFunc {
+	umbral := umbralSimilitud()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		texto := strings.TrimSpace(r.URL.Query().Get("q"))
+		if texto == "" {
+			http.Error(w, "Missing required parameter: q", http.StatusBadRequest)
+			return
+		}
+		limit := defaultSugerencias
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			parsed, err := strconv.Atoi(limitStr)
+			if err != nil || parsed <= 0 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = min(parsed, maxSugerencias)
+		}
+
+		sugerencias, err := repository.GetSugerenciasInvestigador(db, texto, umbral, limit)
+		if err != nil {
+			log.Printf("Error getting investigator suggestions: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": sugerencias,
+		})
+	}
+}
+
 // GetInvestigadorHandler handles fetching a single investigator by ID.
 func GetInvestigadorHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/repository"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/utils"
+)
+
+// errCursoresExcluyentes is returned when a request sets both ?after= and ?before=.
+var errCursoresExcluyentes = errors.New("after and before cannot be used together")
+
+// paginaFromRequest reads the requested page: ?after= or ?before= (opaque cursors from a
+// previous response) or, for backward compatibility, ?page=. ?limit= applies to both.
+func paginaFromRequest(r *http.Request) (repository.Pagina, int, error) {
+	page, limit := utils.GetPaginationParams(r)
+	pag := repository.Pagina{
+		Limit:  limit,
+		Offset: (page - 1) * limit,
+		After:  r.URL.Query().Get("after"),
+		Before: r.URL.Query().Get("before"),
+	}
+	if pag.After != "" && pag.Before != "" {
+		return repository.Pagina{}, 0, errCursoresExcluyentes
+	}
+	if pag.PorCursor() {
+		page = 0
+	}
+	return pag, page, nil
+}
+
+// paginationMetadata builds the pagination block of a list response. Cursor pages are not
+// counted, so their totalItems and totalPages are -1 and currentPage is 0.
+func paginationMetadata(pag repository.Pagina, page, totalItems int, cursores repository.Cursores) models.PaginationMetadata {
+	totalPages := 0
+	if totalItems < 0 {
+		totalPages = -1
+	} else if totalItems > 0 {
+		totalPages = int(math.Ceil(float64(totalItems) / float64(pag.Limit)))
+	}
+	return models.PaginationMetadata{
+		TotalItems:  totalItems,
+		TotalPages:  totalPages,
+		CurrentPage: page,
+		Limit:       pag.Limit,
+		NextCursor:  cursores.Next,
+		PrevCursor:  cursores.Prev,
+	}
+}
@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/red"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/repository"
+)
+
+// GetRedColaboracionHandler returns the collaboration network of investigators and groups:
+// nodes for investigators and groups, membership edges (with the rol) and collaboration
+// edges between investigators who share groups (weighted by how many). The groups are
+// those of GET /grupos with the same filters and visibility, e.g. ?facultad= or
+// ?lineaInvestigacion=. ?format= is json (default), graphml or dot; the last two are sent
+// as a file to open in Gephi, yEd, Cytoscape or Graphviz.
+func GetRedColaboracionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		formato := strings.ToLower(r.URL.Query().Get("format"))
+		if formato == "" {
+			formato = red.FormatoJSON
+		}
+		if formato != red.FormatoJSON && formato != red.FormatoGraphML && formato != red.FormatoDOT {
+			http.Error(w, red.ErrFormatoNoSoportado.Error(), http.StatusBadRequest)
+			return
+		}
+		filter, err := grupoFilterFromRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		grafo, err := repository.GetRedColaboracion(db, filter)
+		if err != nil {
+			log.Printf("Error getting collaboration network: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", red.ContentType(formato))
+		if formato != red.FormatoJSON {
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "red-colaboracion."+formato))
+		}
+		if err := red.Write(w, formato, grafo); err != nil {
+			log.Printf("Error writing collaboration network: %v", err)
+		}
+	}
+}
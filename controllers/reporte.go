@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/reporte"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/repository"
+	"github.com/gorilla/mux"
+)
+
+// Letterhead of the PDF documents unless REPORTE_INSTITUCION and REPORTE_OFICINA say otherwise.
+const (
+	defaultInstitucion = "Universidad Nacional Micaela Bastidas de Apurímac"
+	defaultOficina     = "Vicerrectorado de Investigación"
+)
+
+// generadorReportes returns the PDF generator with the configured letterhead.
+func generadorReportes() reporte.Generador {
+	g := reporte.Generador{Institucion: defaultInstitucion, Oficina: defaultOficina}
+	if institucion := os.Getenv("REPORTE_INSTITUCION"); institucion != "" {
+		g.Institucion = institucion
+	}
+	if oficina := os.Getenv("REPORTE_OFICINA"); oficina != "" {
+		g.Oficina = oficina
+	}
+	return g
+}
+
+// writePDF sends a rendered PDF inline with the given file name. The document is rendered
+// into a buffer first, so a rendering error still gets a 500 response.
+func writePDF(w http.ResponseWriter, archivo string, render func(*bytes.Buffer) error) {
+	var buf bytes.Buffer
+	if err := render(&buf); err != nil {
+		log.Printf("Error rendering %s: %v", archivo, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", archivo))
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	buf.WriteTo(w)
+}
+
+// GetReporteGrupoHandler returns the PDF report of a group: its data, current recognition
+// and members with their roles. Groups the caller may not see are reported as not found.
+func GetReporteGrupoHandler(db *sql.DB) http.HandlerFunc {
+	generador := generadorReportes()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid group ID", http.StatusBadRequest)
+			return
+		}
+
+		detalle, err := repository.GetGrupoDetails(db, id)
+		if err != nil {
+			log.Printf("Error getting group details for report: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if detalle == nil {
+			http.Error(w, "Grupo not found", http.StatusNotFound)
+			return
+		}
+		if !checkGrupoVisible(db, w, r, &detalle.Grupo, "Grupo not found") {
+			return
+		}
+		vigente, err := repository.GetResolucionVigente(db, id)
+		if err != nil {
+			log.Printf("Error getting current resolution for report: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		writePDF(w, fmt.Sprintf("reporte-grupo-%d.pdf", id), func(buf *bytes.Buffer) error {
+			return generador.Grupo(buf, detalle, vigente, time.Now())
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/repository"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/scanner"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/storage"
+	"github.com/gorilla/mux"
+)
+
+// GetResolucionesByGrupoHandler lists a group's resolutions together with its current recognition.
+func GetResolucionesByGrupoHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid group ID", http.StatusBadRequest)
+			return
+		}
+
+		grupo, err := repository.GetGrupoByID(db, id)
+		if err != nil {
+			log.Printf("Error getting group by ID for resolutions: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !checkGrupoVisible(db, w, r, grupo, "Grupo not found") {
+			return
+		}
+
+		resoluciones, err := repository.GetResolucionesByGrupoID(db, id)
+		if err != nil {
+			log.Printf("Error getting resolutions by group ID: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		vigente, err := repository.GetResolucionVigente(db, id)
+		if err != nil {
+			log.Printf("Error getting current resolution: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.ResolucionesGrupo{Data: resoluciones, Vigente: vigente})
+	}
+}
+
+// GetResolucionVigenteHandler returns the group's current recognition (latest valid
+// recognition or renewal).
+func GetResolucionVigenteHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid group ID", http.StatusBadRequest)
+			return
+		}
+
+		grupo, err := repository.GetGrupoByID(db, id)
+		if err != nil {
+			log.Printf("Error getting group by ID for current resolution: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !checkGrupoVisible(db, w, r, grupo, "Grupo not found") {
+			return
+		}
+
+		vigente, err := repository.GetResolucionVigente(db, id)
+		if err != nil {
+			log.Printf("Error getting current resolution: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if vigente == nil {
+			http.Error(w, "The group has no valid recognition", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(vigente)
+	}
+}
+
+// CreateResolucionHandler registers a new resolution for a group with its PDF.
+// Expects multipart/form-data with numero, tipo, fechaEmision, fechaVencimiento (optional),
+// oficinaEmisora and archivo.
+func CreateResolucionHandler(db *sql.DB, store storage.Storage, sc scanner.Scanner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid group ID", http.StatusBadRequest)
+			return
+		}
+
+		grupo, err := repository.GetGrupoByID(db, id)
+		if err != nil {
+			log.Printf("Error getting group by ID for new resolution: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if grupo == nil {
+			http.Error(w, "Grupo not found", http.StatusNotFound)
+			return
+		}
+
+		filePath, err := saveUploadedFile(w, r, db, store, sc, "archivo", models.CategoriaResolucion)
+		if err != nil {
+			log.Printf("Error saving uploaded resolution file: %v", err)
+			writeUploadError(w, err)
+			return
+		}
+
+		res := models.Resolucion{
+			IDGrupo:        id,
+			Numero:         strings.TrimSpace(r.FormValue("numero")),
+			Tipo:           r.FormValue("tipo"),
+			OficinaEmisora: strings.TrimSpace(r.FormValue("oficinaEmisora")),
+			Archivo:        filePath,
+		}
+
+		if res.Numero == "" || res.OficinaEmisora == "" {
+			_ = removeFile(store, filePath)
+			http.Error(w, "Missing required fields: numero, oficinaEmisora", http.StatusBadRequest)
+			return
+		}
+		if res.Tipo != models.TipoResolucionReconocimiento && res.Tipo != models.TipoResolucionRenovacion && res.Tipo != models.TipoResolucionModificacion {
+			_ = removeFile(store, filePath)
+			http.Error(w, "Invalid tipo. Use 'reconocimiento', 'renovacion' or 'modificacion'", http.StatusBadRequest)
+			return
+		}
+
+		res.FechaEmision, err = time.Parse(timeFormat, r.FormValue("fechaEmision"))
+		if err != nil {
+			_ = removeFile(store, filePath)
+			http.Error(w, fmt.Sprintf("Missing or invalid required field: fechaEmision (use format %s)", timeFormat), http.StatusBadRequest)
+			return
+		}
+		if vencimientoStr := r.FormValue("fechaVencimiento"); vencimientoStr != "" {
+			vencimiento, err := time.Parse(timeFormat, vencimientoStr)
+			if err != nil {
+				_ = removeFile(store, filePath)
+				http.Error(w, fmt.Sprintf("Invalid format for fechaVencimiento. Use %s", timeFormat), http.StatusBadRequest)
+				return
+			}
+			if vencimiento.Before(res.FechaEmision) {
+				_ = removeFile(store, filePath)
+				http.Error(w, "fechaVencimiento must not be before fechaEmision", http.StatusBadRequest)
+				return
+			}
+			res.FechaVencimiento = &vencimiento
+		}
+
+		if err := repository.CreateResolucion(db, &res); err != nil {
+			log.Printf("Error creating resolution in repository: %v", err)
+			_ = removeFile(store, filePath)
+			http.Error(w, "Internal server error saving resolution", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(res)
+	}
+}
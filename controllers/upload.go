@@ -0,0 +1,281 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/repository"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/scanner"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/storage"
+	"github.com/gorilla/mux"
+)
+
+const (
+	uploadDir     = "uploads"
+	maxUploadSize = 10 * 1024 * 1024 // Multipart memory threshold; larger parts spill to temp files
+)
+
+// uploadedFile describes a file stored by saveUploadedFileInfo.
+type uploadedFile struct {
+	Path           string // Storage key, e.g. uploads/1700000000_plan.pdf
+	NombreOriginal string // Client file name (base name only)
+	Tamano         int64  // Size in bytes
+	MimeType       string // Detected from the content (magic bytes)
+	Checksum       string // Hex-encoded SHA-256 of the content
+	EstadoEscaneo  string // Malware scan state (models.EscaneoLimpio or models.EscaneoPendiente)
+}
+
+// Helper function to save uploaded file
+func saveUploadedFile(w http.ResponseWriter, r *http.Request, db *sql.DB, store storage.Storage, sc scanner.Scanner, formKey, categoria string) (*string, error) {
+	info, err := saveUploadedFileInfo(w, r, db, store, sc, formKey, categoria)
+	if err != nil || info == nil {
+		return nil, err
+	}
+	return &info.Path, nil
+}
+
+// parseUploadForm parses the multipart form, bounding the request body size. It is safe
+// to call more than once.
+func parseUploadForm(w http.ResponseWriter, r *http.Request) error {
+	if r.MultipartForm != nil {
+		return nil
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize())
+	return r.ParseMultipartForm(maxUploadSize)
+}
+
+// saveUploadedFileInfo validates the file in formKey against the allow-list and the size
+// limit of categoria, scans it for malware, saves it to store and returns its metadata.
+// It returns nil, nil when the request carries no such file; validation failures and
+// infected files are returned as *uploadError (see writeUploadError). Infected files are
+// moved to quarantine; files the scanner could not check are stored as pending and
+// rescanned in the background (see jobs.StartEscaneoPendiente).
+func saveUploadedFileInfo(w http.ResponseWriter, r *http.Request, db *sql.DB, store storage.Storage, sc scanner.Scanner, formKey, categoria string) (*uploadedFile, error) {
+	err := parseUploadForm(w, r)
+	if err != nil {
+		if err == http.ErrNotMultipart || err == http.ErrMissingFile {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error parsing multipart form: %w", err)
+	}
+
+	file, handler, err := r.FormFile(formKey)
+	if err != nil {
+		if err == http.ErrMissingFile {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error retrieving file '%s': %w", formKey, err)
+	}
+	defer file.Close()
+
+	originalFilename := filepath.Base(handler.Filename)
+
+	// Detect the type from the first bytes
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("error reading uploaded file: %w", err)
+	}
+	tipo, err := validateUpload(originalFilename, handler.Size, head[:n], categoria)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateContainer(tipo, file, handler.Size); err != nil {
+		return nil, err
+	}
+
+	return storeUpload(r.Context(), db, store, sc, originalFilename, handler.Size, tipo.MimeType, func() (io.ReadCloser, error) {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("error rewinding uploaded file: %w", err)
+		}
+		return io.NopCloser(file), nil
+	})
+}
+
+// storeUpload scans already validated content for malware and saves it under uploads/.
+// open must return the content from the start each time it is called: it is read once
+// by the scanner and once more to be stored.
+func storeUpload(ctx context.Context, db *sql.DB, store storage.Storage, sc scanner.Scanner, originalFilename string, size int64, mimeType string, open func() (io.ReadCloser, error)) (*uploadedFile, error) {
+	safeFilename := strings.ReplaceAll(originalFilename, "..", "")
+	uniqueFilename := fmt.Sprintf("%d_%s", time.Now().UnixNano(), safeFilename)
+	key := path.Join(uploadDir, uniqueFilename)
+
+	content, err := open()
+	if err != nil {
+		return nil, err
+	}
+	escaneo := models.ArchivoEscaneo{Ruta: key, Estado: models.EscaneoLimpio}
+	result, scanErr := sc.Scan(ctx, content)
+	content.Close()
+	if scanErr != nil {
+		log.Printf("Warning: could not scan '%s', storing it as pending: %v", key, scanErr)
+		escaneo.Estado = models.EscaneoPendiente
+	} else if result.Infected {
+		escaneo.Estado = models.EscaneoInfectado
+		escaneo.Firma = result.Signature
+	}
+
+	// The scanner consumed the stream; read it again from the start
+	content, err = open()
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	if escaneo.Estado == models.EscaneoInfectado {
+		cuarentena := path.Join(scanner.CuarentenaDir, uniqueFilename)
+		if err := store.Save(ctx, cuarentena, content, size, mimeType); err != nil {
+			log.Printf("Error quarantining infected upload '%s': %v", originalFilename, err)
+		} else {
+			escaneo.RutaCuarentena = &cuarentena
+		}
+		if err := repository.SetEstadoEscaneo(db, &escaneo); err != nil {
+			log.Printf("Error recording infected upload '%s': %v", originalFilename, err)
+		}
+		log.Printf("Rejected infected upload '%s' (%s)", originalFilename, result.Signature)
+		return nil, &uploadError{
+			Status:  http.StatusUnprocessableEntity,
+			Code:    "malware_detected",
+			Message: "The file was rejected by the malware scanner",
+			Details: map[string]interface{}{"signature": result.Signature},
+		}
+	}
+
+	hash := sha256.New()
+	if err := store.Save(ctx, key, io.TeeReader(content, hash), size, mimeType); err != nil {
+		return nil, fmt.Errorf("error storing uploaded file: %w", err)
+	}
+	if err := repository.SetEstadoEscaneo(db, &escaneo); err != nil {
+		_ = removeFile(store, &key)
+		return nil, err
+	}
+
+	return &uploadedFile{
+		Path:           key,
+		NombreOriginal: originalFilename,
+		Tamano:         size,
+		MimeType:       mimeType,
+		Checksum:       hex.EncodeToString(hash.Sum(nil)),
+		EstadoEscaneo:  escaneo.Estado,
+	}, nil
+}
+
+// removeFile deletes a stored file. It uses a background context so cleanup still
+// happens when the client has already gone away.
+func removeFile(store storage.Storage, relativePath *string) error {
+	if relativePath == nil || *relativePath == "" {
+		return nil
+	}
+	err := store.Delete(context.Background(), *relativePath)
+	if err != nil {
+		return fmt.Errorf("error removing file '%s': %w", *relativePath, err)
+	}
+	return nil
+}
+
+// serveStoredFile streams a stored file to the client, honouring Range and conditional
+// requests when the backend can seek. If downloadName is not empty the file is sent as an
+// attachment with that name. Only files scanned clean are served:
+// pending ones and those that could not be scanned get 409, and infected ones 404.
+func serveStoredFile(w http.ResponseWriter, r *http.Request, db *sql.DB, store storage.Storage, key, contentType, downloadName string) {
+	estado, err := repository.GetEstadoEscaneo(db, key)
+	if err != nil {
+		log.Printf("Error getting scan state of '%s': %v", key, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	switch estado {
+	case models.EscaneoLimpio:
+	case models.EscaneoInfectado:
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	case models.EscaneoError:
+		http.Error(w, "File could not be scanned for malware", http.StatusConflict)
+		return
+	default:
+		http.Error(w, "File is pending malware scan, try again later", http.StatusConflict)
+		return
+	}
+
+	reader, info, err := store.Open(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error opening stored file '%s': %v", key, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer reader.Close()
+
+	if contentType == "" {
+		contentType = info.ContentType
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if downloadName != "" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", downloadName))
+	}
+
+	// Seekable content supports Range and If-Modified-Since requests
+	if content, ok := reader.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, path.Base(key), info.ModTime, content)
+		return
+	}
+
+	if info.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	if !info.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if _, err := io.Copy(w, reader); err != nil {
+		log.Printf("Error streaming stored file '%s': %v", key, err)
+	}
+}
+
+// ServeUploadHandler streams files under /uploads/ from the configured storage backend.
+// Reviewers and admins get any file; everybody else only the public documents of public
+// groups and the documents of the groups they registered. Other files are reported as not
+// found. Directories are never listed.
+func ServeUploadHandler(db *sql.DB, store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := path.Join(uploadDir, mux.Vars(r)["key"])
+		if !strings.HasPrefix(key, uploadDir+"/") {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+
+		if vis := visibilidadGrupos(r); vis.SoloPublicos {
+			visible, err := repository.IsRutaVisible(db, key, models.EstadosPublicos, vis.Propietario)
+			if err != nil {
+				log.Printf("Error checking visibility of '%s': %v", key, err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if !visible {
+				http.Error(w, "File not found", http.StatusNotFound)
+				return
+			}
+		}
+
+		serveStoredFile(w, r, db, store, key, "", "")
+	}
+}
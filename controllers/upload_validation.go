@@ -0,0 +1,263 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+)
+
+// tipoArchivo is a file type accepted for upload, recognized by its magic bytes.
+type tipoArchivo struct {
+	Nombre      string
+	MimeType    string
+	Extensiones []string
+	Firma       func(head []byte) bool
+	Parte       string // Office Open XML types: folder the ZIP container must hold, checked by validateContainer
+}
+
+// esZIP recognizes the local file header that starts ZIP containers.
+func esZIP(h []byte) bool {
+	return bytes.HasPrefix(h, []byte("PK\x03\x04"))
+}
+
+// tiposArchivoConocidos are the file types the server can recognize. UPLOAD_ALLOWED_TYPES
+// selects which of them are accepted (by Nombre, comma-separated).
+var tiposArchivoConocidos = []tipoArchivo{
+	{"pdf", "application/pdf", []string{".pdf"}, func(h []byte) bool { return bytes.HasPrefix(h, []byte("%PDF-")) }, ""},
+	// DOCX and XLSX files are ZIP containers; the extension tells them apart from other ZIP
+	// files and validateContainer checks their content
+	{"docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document", []string{".docx"}, esZIP, "word/"},
+	{"xlsx", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", []string{".xlsx"}, esZIP, "xl/"},
+	{"png", "image/png", []string{".png"}, func(h []byte) bool { return bytes.HasPrefix(h, []byte("\x89PNG\r\n\x1a\n")) }, ""},
+	{"jpg", "image/jpeg", []string{".jpg", ".jpeg"}, func(h []byte) bool { return bytes.HasPrefix(h, []byte("\xff\xd8\xff")) }, ""},
+}
+
+const defaultAllowedTypes = "pdf,docx,png,jpg"
+
+// limitesPorCategoria are the default maximum sizes, in MB, per document category.
+// UPLOAD_MAX_MB_<CATEGORIA> (e.g. UPLOAD_MAX_MB_CV=2) overrides them.
+var limitesPorCategoria = map[string]int64{
+	models.CategoriaResolucion:   10,
+	models.CategoriaPlanTrabajo:  10,
+	models.CategoriaInformeAnual: 20,
+	models.CategoriaCV:           5,
+	models.CategoriaOtro:         10,
+}
+
+// uploadError is a validation failure reported to the client as a structured JSON error.
+type uploadError struct {
+	Status  int                    // 413 or 415
+	Code    string                 // Machine-readable reason
+	Message string                 // Human-readable reason
+	Details map[string]interface{} // Extra fields merged into the response body
+}
+
+func (e *uploadError) Error() string {
+	return e.Message
+}
+
+// allowedTypes returns the accepted file types according to UPLOAD_ALLOWED_TYPES.
+func allowedTypes() []tipoArchivo {
+	config := os.Getenv("UPLOAD_ALLOWED_TYPES")
+	if config == "" {
+		config = defaultAllowedTypes
+	}
+	tipos := []tipoArchivo{}
+	for _, nombre := range strings.Split(config, ",") {
+		nombre = strings.ToLower(strings.TrimSpace(nombre))
+		found := false
+		for _, t := range tiposArchivoConocidos {
+			if t.Nombre == nombre {
+				tipos = append(tipos, t)
+				found = true
+			}
+		}
+		if !found && nombre != "" {
+			log.Printf("Warning: unknown file type %q in UPLOAD_ALLOWED_TYPES ignored", nombre)
+		}
+	}
+	return tipos
+}
+
+// maxSizeForCategory returns the maximum upload size in bytes for a document category.
+func maxSizeForCategory(categoria string) int64 {
+	mb, ok := limitesPorCategoria[categoria]
+	if !ok {
+		mb = limitesPorCategoria[models.CategoriaOtro]
+	}
+	if override := os.Getenv("UPLOAD_MAX_MB_" + strings.ToUpper(categoria)); override != "" {
+		parsed, err := strconv.ParseInt(override, 10, 64)
+		if err != nil || parsed <= 0 {
+			log.Printf("Warning: invalid UPLOAD_MAX_MB_%s %q ignored", strings.ToUpper(categoria), override)
+		} else {
+			mb = parsed
+		}
+	}
+	return mb * 1024 * 1024
+}
+
+// maxRequestSize bounds the whole multipart body: the largest category limit plus room
+// for the text fields.
+func maxRequestSize() int64 {
+	max := int64(0)
+	for categoria := range limitesPorCategoria {
+		if size := maxSizeForCategory(categoria); size > max {
+			max = size
+		}
+	}
+	return max + 1024*1024
+}
+
+// validateUpload checks an uploaded file against the allow-list and the category size limit.
+// It returns the detected type, whose MIME type is stored instead of the client's.
+func validateUpload(filename string, size int64, head []byte, categoria string) (*tipoArchivo, error) {
+	if limit := maxSizeForCategory(categoria); size > limit {
+		return nil, &uploadError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Code:    "file_too_large",
+			Message: fmt.Sprintf("File exceeds the %d MB limit for category '%s'", limit/(1024*1024), categoria),
+			Details: map[string]interface{}{"maxBytes": limit, "categoria": categoria},
+		}
+	}
+	return validateUploadType(filename, head)
+}
+
+// validateUploadType checks the magic bytes of a file against the allow-list and its extension.
+func validateUploadType(filename string, head []byte) (*tipoArchivo, error) {
+	tipos := allowedTypes()
+	nombres := make([]string, 0, len(tipos))
+	for _, t := range tipos {
+		nombres = append(nombres, t.Nombre)
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+
+	for i, t := range tipos {
+		if !t.Firma(head) {
+			continue
+		}
+		for _, e := range t.Extensiones {
+			if e == ext {
+				return &tipos[i], nil
+			}
+		}
+		if t.Parte != "" {
+			// Any other ZIP container is simply not an accepted type
+			continue
+		}
+		return nil, &uploadError{
+			Status:  http.StatusUnsupportedMediaType,
+			Code:    "extension_mismatch",
+			Message: fmt.Sprintf("File content is %s but the extension is '%s'", t.Nombre, ext),
+			Details: map[string]interface{}{"detectedType": t.Nombre, "allowedExtensions": t.Extensiones},
+		}
+	}
+
+	return nil, &uploadError{
+		Status:  http.StatusUnsupportedMediaType,
+		Code:    "unsupported_media_type",
+		Message: "File type not allowed",
+		Details: map[string]interface{}{"detectedMimeType": http.DetectContentType(head), "allowedTypes": nombres},
+	}
+}
+
+// validateContainer checks that a file of an Office Open XML type is a readable ZIP
+// container with a [Content_Types].xml part and the type's folder (word/ or xl/), so that
+// arbitrary ZIP archives cannot be uploaded just by renaming them. Other types pass as is.
+func validateContainer(t *tipoArchivo, r io.ReaderAt, size int64) error {
+	if t.Parte == "" {
+		return nil
+	}
+	invalido := &uploadError{
+		Status:  http.StatusUnsupportedMediaType,
+		Code:    "invalid_container",
+		Message: fmt.Sprintf("File is not a valid %s document", t.Nombre),
+		Details: map[string]interface{}{"detectedType": t.Nombre},
+	}
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return invalido
+	}
+	contentTypes, parte := false, false
+	for _, f := range zr.File {
+		switch {
+		case f.Name == "[Content_Types].xml":
+			contentTypes = true
+		case strings.HasPrefix(f.Name, t.Parte):
+			parte = true
+		}
+	}
+	if !contentTypes || !parte {
+		return invalido
+	}
+	return nil
+}
+
+// validateContainerContent runs validateContainer on content that can only be read as a
+// stream, copying it to a temporary file first. Other types are not read at all.
+func validateContainerContent(t *tipoArchivo, open func() (io.ReadCloser, error)) error {
+	if t.Parte == "" {
+		return nil
+	}
+	content, err := open()
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	tmp, err := os.CreateTemp("", "upload-*.zip")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, content)
+	if err != nil {
+		return fmt.Errorf("error reading upload: %w", err)
+	}
+	return validateContainer(t, tmp, size)
+}
+
+// writeUploadError reports an error returned by saveUploadedFile/saveUploadedFileInfo:
+// validation failures as structured JSON (413/415), malformed forms as 400 and anything
+// else as 500.
+func writeUploadError(w http.ResponseWriter, err error) {
+	var uerr *uploadError
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		uerr = &uploadError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Code:    "request_too_large",
+			Message: "Request body too large",
+			Details: map[string]interface{}{"maxBytes": maxBytesErr.Limit},
+		}
+	}
+	if uerr != nil || errors.As(err, &uerr) {
+		body := map[string]interface{}{}
+		for k, v := range uerr.Details {
+			body[k] = v
+		}
+		body["error"] = uerr.Message
+		body["code"] = uerr.Code
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(uerr.Status)
+		json.NewEncoder(w).Encode(body)
+		return
+	}
+
+	if strings.Contains(err.Error(), "parsing multipart form") || strings.Contains(err.Error(), "request body too large") {
+		http.Error(w, fmt.Sprintf("Error processing form: %v", err), http.StatusBadRequest)
+	} else {
+		http.Error(w, "Internal server error processing file upload", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+)
+
+// zipWith returns a ZIP archive holding empty files with the given names.
+func zipWith(t *testing.T, names ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range names {
+		if _, err := zw.Create(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestValidateUploadTypeAndContainer(t *testing.T) {
+	t.Setenv("UPLOAD_ALLOWED_TYPES", "pdf,docx,xlsx,png")
+	docx := zipWith(t, "[Content_Types].xml", "_rels/.rels", "word/document.xml")
+	xlsx := zipWith(t, "[Content_Types].xml", "xl/workbook.xml")
+
+	tests := []struct {
+		name     string
+		filename string
+		content  []byte
+		wantType string // Empty when the file must be rejected
+		wantCode string
+	}{
+		{name: "pdf", filename: "informe.pdf", content: []byte("%PDF-1.7\n..."), wantType: "pdf"},
+		{name: "pdf renamed", filename: "informe.png", content: []byte("%PDF-1.7\n..."), wantCode: "extension_mismatch"},
+		{name: "docx", filename: "plan.DOCX", content: docx, wantType: "docx"},
+		{name: "xlsx", filename: "integrantes.xlsx", content: xlsx, wantType: "xlsx"},
+		{name: "xlsx named docx", filename: "plan.docx", content: xlsx, wantCode: "invalid_container"},
+		{name: "plain zip named docx", filename: "plan.docx", content: zipWith(t, "script.js"), wantCode: "invalid_container"},
+		{name: "zip without content types", filename: "plan.docx", content: zipWith(t, "word/document.xml"), wantCode: "invalid_container"},
+		{name: "truncated zip", filename: "plan.docx", content: docx[:40], wantCode: "invalid_container"},
+		{name: "zip with another extension", filename: "fuentes.zip", content: docx, wantCode: "unsupported_media_type"},
+		{name: "executable", filename: "informe.pdf", content: []byte("MZ\x90\x00"), wantCode: "unsupported_media_type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			head := tt.content
+			if len(head) > 512 {
+				head = head[:512]
+			}
+			tipo, err := validateUploadType(tt.filename, head)
+			if err == nil {
+				err = validateContainer(tipo, bytes.NewReader(tt.content), int64(len(tt.content)))
+			}
+			if tt.wantType != "" {
+				if err != nil {
+					t.Fatalf("rejected: %v", err)
+				}
+				if tipo.Nombre != tt.wantType {
+					t.Errorf("type = %s, want %s", tipo.Nombre, tt.wantType)
+				}
+				// The chunked upload path must agree
+				open := func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(tt.content)), nil }
+				if err := validateContainerContent(tipo, open); err != nil {
+					t.Errorf("validateContainerContent: %v", err)
+				}
+				return
+			}
+			var uerr *uploadError
+			if !errors.As(err, &uerr) {
+				t.Fatalf("error = %v, want *uploadError", err)
+			}
+			if uerr.Code != tt.wantCode || uerr.Status != http.StatusUnsupportedMediaType {
+				t.Errorf("error = %d %s, want 415 %s", uerr.Status, uerr.Code, tt.wantCode)
+			}
+		})
+	}
+}
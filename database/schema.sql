@@ -4,7 +4,7 @@ CREATE TABLE Usuario (
     -- Removed supabase_user_id UUID UNIQUE NOT NULL,
     email VARCHAR(150) UNIQUE NOT NULL,
     password TEXT NOT NULL,                   -- Added password field (will store hash)
-    -- Removed rol_aplicacion
+    rol VARCHAR(20) NOT NULL DEFAULT 'usuario', -- Application role: 'usuario', 'revisor' or 'admin'
     created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, 
     updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
 );
@@ -14,6 +14,8 @@ CREATE TABLE Investigador (
     idInvestigador SERIAL PRIMARY KEY, -- SERIAL is PostgreSQL's auto-incrementing integer
     nombre VARCHAR(100) NOT NULL,
     apellido VARCHAR(100) NOT NULL,
+    tsv TSVECTOR, -- Full-text vector of nombre and apellido, maintained by trigger_tsv_investigador
+    nombreNormalizado TEXT, -- lower(unaccent(nombre || ' ' || apellido)) for trigram matching, same trigger
     createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP -- Sets timestamp on creation only
 );
@@ -25,10 +27,16 @@ CREATE TABLE Grupo (
     numeroResolucion VARCHAR(100) NOT NULL,
     lineaInvestigacion VARCHAR(200) NOT NULL,
     tipoInvestigacion VARCHAR(100) NOT NULL,
+    facultad VARCHAR(150), -- Faculty the group belongs to; NULL when unknown
     fechaRegistro DATE NOT NULL,
     archivo VARCHAR(255), -- Assuming this stores a file path or name
+    archivoFaltante BOOLEAN NOT NULL DEFAULT FALSE, -- Set by the file reconciliation when archivo is missing from storage
+    estado VARCHAR(20) NOT NULL DEFAULT 'borrador' CHECK (estado IN ('borrador', 'enviado', 'en_revision', 'aprobado', 'activo', 'inactivo', 'disuelto')), -- Lifecycle, see models.Estado*
+    tsv TSVECTOR, -- Weighted full-text vector, maintained by trigger_tsv_grupo
+    idUsuario INT, -- Owner: the user who registered the group
     createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP -- Sets timestamp on creation only
+    updatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- Sets timestamp on creation only
+    FOREIGN KEY (idUsuario) REFERENCES Usuario(idUsuario) ON DELETE SET NULL
 );
 
 -- Table: Grupo_Investigador (Associative table for Groups and Researchers)
@@ -43,6 +51,196 @@ CREATE TABLE Grupo_Investigador (
     FOREIGN KEY (idInvestigador) REFERENCES Investigador(idInvestigador) ON DELETE CASCADE
 );
 
+-- Table: Grupo_Estado_Historial (State transitions of a group with reviewer comments)
+CREATE TABLE Grupo_Estado_Historial (
+    idHistorial SERIAL PRIMARY KEY,
+    idGrupo INT NOT NULL,
+    estadoAnterior VARCHAR(20) NOT NULL,
+    estadoNuevo VARCHAR(20) NOT NULL,
+    comentario TEXT NOT NULL DEFAULT '',
+    idUsuario INT, -- User who performed the transition
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (idGrupo) REFERENCES Grupo(idGrupo) ON DELETE CASCADE,
+    FOREIGN KEY (idUsuario) REFERENCES Usuario(idUsuario) ON DELETE SET NULL
+);
+
+-- Table: Resolucion (Recognition, renewal and modification resolutions of a group)
+CREATE TABLE Resolucion (
+    idResolucion SERIAL PRIMARY KEY,
+    idGrupo INT NOT NULL,
+    numero VARCHAR(100) NOT NULL,
+    tipo VARCHAR(20) NOT NULL CHECK (tipo IN ('reconocimiento', 'renovacion', 'modificacion')),
+    fechaEmision DATE NOT NULL,
+    fechaVencimiento DATE, -- NULL means the resolution does not expire
+    oficinaEmisora VARCHAR(200) NOT NULL,
+    archivo VARCHAR(255), -- Path of the resolution PDF
+    archivoFaltante BOOLEAN NOT NULL DEFAULT FALSE, -- Set by the file reconciliation when archivo is missing from storage
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (idGrupo) REFERENCES Grupo(idGrupo) ON DELETE CASCADE
+);
+
+-- Table: Grupo_Archivo (Documents attached to a group)
+CREATE TABLE Grupo_Archivo (
+    idArchivo SERIAL PRIMARY KEY,
+    idGrupo INT NOT NULL,
+    categoria VARCHAR(30) NOT NULL CHECK (categoria IN ('resolucion', 'plan_trabajo', 'informe_anual', 'cv', 'otro')),
+    descripcion TEXT NOT NULL DEFAULT '',
+    nombreOriginal VARCHAR(255) NOT NULL, -- File name sent by the client
+    ruta VARCHAR(255) NOT NULL,           -- Storage path
+    tamano BIGINT NOT NULL,               -- Size in bytes
+    mimeType VARCHAR(100) NOT NULL,
+    checksum CHAR(64) NOT NULL,           -- Hex-encoded SHA-256
+    visibilidad VARCHAR(10) NOT NULL DEFAULT 'interno' CHECK (visibilidad IN ('publico', 'interno')),
+    idUsuario INT,                        -- Uploader
+    archivoFaltante BOOLEAN NOT NULL DEFAULT FALSE, -- Set by the file reconciliation when ruta is missing from storage
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (idGrupo) REFERENCES Grupo(idGrupo) ON DELETE CASCADE,
+    FOREIGN KEY (idUsuario) REFERENCES Usuario(idUsuario) ON DELETE SET NULL
+);
+
+-- Table: Archivo_Escaneo (Malware scan state of each stored file, keyed by storage path)
+-- Files are only served once their state is 'limpio'.
+CREATE TABLE Archivo_Escaneo (
+    ruta VARCHAR(255) PRIMARY KEY,
+    estado VARCHAR(12) NOT NULL CHECK (estado IN ('pendiente', 'limpio', 'infectado', 'error')),
+    firma TEXT NOT NULL DEFAULT '',   -- Malware signature reported by the scanner
+    rutaCuarentena VARCHAR(255),      -- Where an infected file was moved
+    escaneadoEn TIMESTAMP,
+    intentos INT NOT NULL DEFAULT 0,  -- Failed background scans; 'error' after too many
+    ultimoIntento TIMESTAMP,          -- Last failed background scan, to retry the oldest first
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Table: Carga (Resumable tus uploads in progress; chunks live in storage under cargas/<idCarga>/)
+CREATE TABLE Carga (
+    idCarga CHAR(32) PRIMARY KEY,          -- Random hex ID, part of the upload URL
+    idGrupo INT NOT NULL,
+    categoria VARCHAR(30) NOT NULL CHECK (categoria IN ('resolucion', 'plan_trabajo', 'informe_anual', 'cv', 'otro')),
+    descripcion TEXT NOT NULL DEFAULT '',
+    visibilidad VARCHAR(10) NOT NULL DEFAULT 'interno' CHECK (visibilidad IN ('publico', 'interno')),
+    nombreOriginal VARCHAR(255) NOT NULL,
+    tamano BIGINT NOT NULL,                -- Upload-Length
+    recibido BIGINT NOT NULL DEFAULT 0,    -- Upload-Offset: bytes stored so far
+    checksum VARCHAR(64) NOT NULL DEFAULT '', -- Expected hex SHA-256 of the whole file, if given
+    idUsuario INT NOT NULL,                -- Only the creator may continue the upload
+    idArchivo INT,                         -- Resulting attachment once completed
+    expiraEn TIMESTAMP NOT NULL,
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (idGrupo) REFERENCES Grupo(idGrupo) ON DELETE CASCADE,
+    FOREIGN KEY (idUsuario) REFERENCES Usuario(idUsuario) ON DELETE CASCADE,
+    FOREIGN KEY (idArchivo) REFERENCES Grupo_Archivo(idArchivo) ON DELETE SET NULL
+);
+
+-- Table: Archivo_Texto (Text extracted from stored PDFs, indexed for full-text search)
+CREATE TABLE Archivo_Texto (
+    ruta VARCHAR(255) PRIMARY KEY,
+    estado VARCHAR(10) NOT NULL CHECK (estado IN ('extraido', 'sin_texto', 'error')),
+    texto TEXT NOT NULL DEFAULT '',
+    tsv TSVECTOR,                      -- Maintained by trigger_tsv_archivo_texto
+    error TEXT NOT NULL DEFAULT '',    -- Why the extraction failed
+    extraidoEn TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Table: Busqueda_Guardada (Named group searches saved by a user, optionally with alerts)
+CREATE TABLE Busqueda_Guardada (
+    idBusqueda SERIAL PRIMARY KEY,
+    idUsuario INT NOT NULL,
+    nombre VARCHAR(150) NOT NULL,
+    parametros TEXT NOT NULL DEFAULT '', -- Query string of GET /grupos, e.g. tipoInvestigacion=Aplicada&facultad=Ingeniería
+    alertas BOOLEAN NOT NULL DEFAULT FALSE, -- Notify new matching groups and members
+    evaluadaEn TIMESTAMP, -- Last alert evaluation; NULL until the first one records the baseline
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (idUsuario) REFERENCES Usuario(idUsuario) ON DELETE CASCADE
+);
+
+-- Table: Busqueda_Coincidencia (Groups matching a saved search at its last alert evaluation)
+CREATE TABLE Busqueda_Coincidencia (
+    idBusqueda INT NOT NULL,
+    idGrupo INT NOT NULL,
+    PRIMARY KEY (idBusqueda, idGrupo),
+    FOREIGN KEY (idBusqueda) REFERENCES Busqueda_Guardada(idBusqueda) ON DELETE CASCADE,
+    FOREIGN KEY (idGrupo) REFERENCES Grupo(idGrupo) ON DELETE CASCADE
+);
+
+-- Table: Busqueda_Alerta (Notifications of a saved search: a new matching group or a new member of one)
+CREATE TABLE Busqueda_Alerta (
+    idAlerta SERIAL PRIMARY KEY,
+    idBusqueda INT NOT NULL,
+    tipo VARCHAR(20) NOT NULL CHECK (tipo IN ('grupo_nuevo', 'integrante_nuevo')),
+    idGrupo INT NOT NULL,
+    idInvestigador INT, -- Set for integrante_nuevo
+    leida BOOLEAN NOT NULL DEFAULT FALSE,
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (idBusqueda) REFERENCES Busqueda_Guardada(idBusqueda) ON DELETE CASCADE,
+    FOREIGN KEY (idGrupo) REFERENCES Grupo(idGrupo) ON DELETE CASCADE,
+    FOREIGN KEY (idInvestigador) REFERENCES Investigador(idInvestigador) ON DELETE CASCADE
+);
+
+-- Table: Constancia (Issued membership certificates, verifiable by their code)
+CREATE TABLE Constancia (
+    idConstancia SERIAL PRIMARY KEY,
+    codigo VARCHAR(32) NOT NULL UNIQUE, -- Printed on the certificate and in its QR code
+    idInvestigador INT,
+    contenido TEXT NOT NULL, -- Certified data as JSON, kept byte for byte as signed
+    firma VARCHAR(64) NOT NULL, -- Hex HMAC-SHA256 of codigo and contenido
+    idUsuario INT, -- User who issued it
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (idInvestigador) REFERENCES Investigador(idInvestigador) ON DELETE SET NULL,
+    FOREIGN KEY (idUsuario) REFERENCES Usuario(idUsuario) ON DELETE SET NULL
+);
+
+-- Table: Investigador_Fusion (Audit of duplicate investigators merged into another record)
+CREATE TABLE Investigador_Fusion (
+    idFusion SERIAL PRIMARY KEY,
+    idSuperviviente INT NOT NULL, -- No foreign keys: the audit outlives both records
+    idEliminado INT NOT NULL,
+    nombreEliminado VARCHAR(100) NOT NULL,
+    apellidoEliminado VARCHAR(100) NOT NULL,
+    detalle JSONB NOT NULL, -- {"gruposMovidos": [...], "conflictos": [{"idGrupo", "rolSuperviviente", "rolEliminado", "rolFinal"}]}
+    idUsuario INT,
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (idUsuario) REFERENCES Usuario(idUsuario) ON DELETE SET NULL
+);
+
+-- Table: Vista_Refresco (Last refresh of each materialized reporting view)
+CREATE TABLE Vista_Refresco (
+    vista VARCHAR(63) PRIMARY KEY,
+    refrescadaEn TIMESTAMP NOT NULL
+);
+
+-- View: Grupo_Documento (Every stored document of a group, with its visibility)
+-- The main file and resolutions are public while the group is; attachments carry their own visibility.
+CREATE VIEW Grupo_Documento AS
+    SELECT idGrupo, archivo AS ruta, 'archivo' AS origen, NULL::INT AS idArchivo, regexp_replace(archivo, '^.*/[0-9]+_', '') AS nombre, 'publico' AS visibilidad
+    FROM Grupo WHERE archivo IS NOT NULL AND archivo <> ''
+    UNION ALL
+    SELECT idGrupo, archivo, 'resolucion', NULL, numero, 'publico'
+    FROM Resolucion WHERE archivo IS NOT NULL AND archivo <> ''
+    UNION ALL
+    SELECT idGrupo, ruta, categoria, idArchivo, nombreOriginal, visibilidad
+    FROM Grupo_Archivo;
+
+CREATE INDEX idx_grupo_estado ON Grupo(estado);
+CREATE INDEX idx_grupo_archivo_grupo ON Grupo_Archivo(idGrupo, categoria);
+-- Lookups by stored path, used to decide whether /uploads/ may serve a file
+CREATE INDEX idx_grupo_archivo_ruta ON Grupo_Archivo(ruta);
+CREATE INDEX idx_grupo_ruta_archivo ON Grupo(archivo);
+CREATE INDEX idx_resolucion_archivo ON Resolucion(archivo);
+CREATE INDEX idx_resolucion_grupo ON Resolucion(idGrupo, fechaEmision DESC);
+CREATE INDEX idx_grupo_estado_historial_grupo ON Grupo_Estado_Historial(idGrupo);
+CREATE INDEX idx_carga_expira ON Carga(expiraEn);
+CREATE INDEX idx_archivo_texto_tsv ON Archivo_Texto USING GIN(tsv);
+CREATE INDEX idx_grupo_tsv ON Grupo USING GIN(tsv);
+CREATE INDEX idx_investigador_tsv ON Investigador USING GIN(tsv);
+CREATE INDEX idx_busqueda_guardada_usuario ON Busqueda_Guardada(idUsuario);
+CREATE INDEX idx_busqueda_guardada_alertas ON Busqueda_Guardada(idBusqueda) WHERE alertas;
+CREATE INDEX idx_busqueda_alerta_busqueda ON Busqueda_Alerta(idBusqueda, leida);
+CREATE INDEX idx_constancia_investigador ON Constancia(idInvestigador);
+CREATE INDEX idx_grupo_investigador_investigador ON Grupo_Investigador(idInvestigador);
+
 -- Función para actualizar updatedAt
 CREATE OR REPLACE FUNCTION actualizar_updatedat()
 RETURNS TRIGGER AS $$
@@ -72,10 +270,105 @@ BEFORE UPDATE ON Grupo
 FOR EACH ROW
 EXECUTE FUNCTION actualizar_updatedat();
 
+-- Resolucion
+CREATE TRIGGER trigger_updatedat_resolucion
+BEFORE UPDATE ON Resolucion
+FOR EACH ROW
+EXECUTE FUNCTION actualizar_updatedat();
+
+-- Carga
+CREATE TRIGGER trigger_updatedat_carga
+BEFORE UPDATE ON Carga
+FOR EACH ROW
+EXECUTE FUNCTION actualizar_updatedat();
+
 -- Grupo_Investigador
 CREATE TRIGGER trigger_updatedat_grupo_investigador
 BEFORE UPDATE ON grupo_investigador
 FOR EACH ROW
 EXECUTE FUNCTION actualizar_updatedat();
 
-CREATE EXTENSION IF NOT EXISTS unaccent;
\ No newline at end of file
+CREATE EXTENSION IF NOT EXISTS unaccent;
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Spanish text search configuration that ignores accents, so 'investigacion' matches
+-- 'investigación' while ts_headline still highlights the original text
+CREATE TEXT SEARCH CONFIGURATION spanish_unaccent (COPY = spanish);
+ALTER TEXT SEARCH CONFIGURATION spanish_unaccent
+    ALTER MAPPING FOR hword, hword_part, word WITH unaccent, spanish_stem;
+
+-- Full-text vector of extracted document text
+CREATE OR REPLACE FUNCTION actualizar_tsv_archivo_texto()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.tsv = to_tsvector('spanish_unaccent', NEW.texto);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trigger_tsv_archivo_texto
+BEFORE INSERT OR UPDATE OF texto ON Archivo_Texto
+FOR EACH ROW
+EXECUTE FUNCTION actualizar_tsv_archivo_texto();
+
+-- Full-text vector of a group: nombre weighs most, then research line, type and resolution number
+CREATE OR REPLACE FUNCTION actualizar_tsv_grupo()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.tsv = setweight(to_tsvector('spanish_unaccent', COALESCE(NEW.nombre, '')), 'A')
+        || setweight(to_tsvector('spanish_unaccent', COALESCE(NEW.lineaInvestigacion, '')), 'B')
+        || setweight(to_tsvector('spanish_unaccent', COALESCE(NEW.tipoInvestigacion, '')), 'C')
+        || setweight(to_tsvector('simple', COALESCE(NEW.numeroResolucion, '')), 'D');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trigger_tsv_grupo
+BEFORE INSERT OR UPDATE OF nombre, lineaInvestigacion, tipoInvestigacion, numeroResolucion ON Grupo
+FOR EACH ROW
+EXECUTE FUNCTION actualizar_tsv_grupo();
+
+-- Full-text vector and normalized form of a researcher's full name
+CREATE OR REPLACE FUNCTION actualizar_tsv_investigador()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.tsv = setweight(to_tsvector('spanish_unaccent', COALESCE(NEW.nombre, '') || ' ' || COALESCE(NEW.apellido, '')), 'A');
+    NEW.nombreNormalizado = lower(unaccent(COALESCE(NEW.nombre, '') || ' ' || COALESCE(NEW.apellido, '')));
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trigger_tsv_investigador
+BEFORE INSERT OR UPDATE OF nombre, apellido ON Investigador
+FOR EACH ROW
+EXECUTE FUNCTION actualizar_tsv_investigador();
+
+-- Trigram index for typo-tolerant name search (needs pg_trgm, hence created here)
+CREATE INDEX idx_investigador_nombre_trgm ON Investigador USING GIN(nombreNormalizado gin_trgm_ops);
+
+-- Materialized views behind the statistics endpoints (unaccent is needed, hence created
+-- here). They are refreshed concurrently by a background job and after bulk imports; the
+-- unique indexes are required by REFRESH MATERIALIZED VIEW CONCURRENTLY.
+
+-- Each group with its member and coordinator counts
+CREATE MATERIALIZED VIEW Estadistica_Grupo AS
+    SELECT g.idGrupo, g.nombre, g.lineaInvestigacion, g.tipoInvestigacion, g.facultad, g.fechaRegistro, g.estado, g.idUsuario,
+        COUNT(gi.idInvestigador) AS integrantes,
+        COUNT(gi.idInvestigador) FILTER (WHERE lower(unaccent(gi.rol)) LIKE 'coordinador%') AS coordinadores
+    FROM Grupo g
+    LEFT JOIN Grupo_Investigador gi ON gi.idGrupo = g.idGrupo
+    GROUP BY g.idGrupo;
+CREATE UNIQUE INDEX idx_estadistica_grupo ON Estadistica_Grupo(idGrupo);
+CREATE INDEX idx_estadistica_grupo_fecha ON Estadistica_Grupo(fechaRegistro);
+
+-- Each membership with the investigator's name
+CREATE MATERIALIZED VIEW Estadistica_Membresia AS
+    SELECT gi.idGrupo_Investigador, gi.idGrupo, gi.idInvestigador, i.nombre, i.apellido
+    FROM Grupo_Investigador gi
+    JOIN Investigador i ON i.idInvestigador = gi.idInvestigador;
+CREATE UNIQUE INDEX idx_estadistica_membresia ON Estadistica_Membresia(idGrupo_Investigador);
+CREATE INDEX idx_estadistica_membresia_grupo ON Estadistica_Membresia(idGrupo);
+
+INSERT INTO Vista_Refresco (vista, refrescadaEn) VALUES
+    ('estadistica_grupo', CURRENT_TIMESTAMP),
+    ('estadistica_membresia', CURRENT_TIMESTAMP);
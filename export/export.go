@@ -0,0 +1,136 @@
+// Package export writes tables as CSV or XLSX files row by row, so large exports can be
+// streamed to the client, and reads them back for imports.
+package export
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Supported file formats.
+const (
+	FormatoCSV  = "csv"
+	FormatoXLSX = "xlsx"
+)
+
+// bom is the UTF-8 byte order mark, which makes Excel read CSV files as UTF-8 (accents, ñ).
+const bom = "\uFEFF"
+
+// ErrFormatoNoSoportado is returned for a format other than FormatoCSV and FormatoXLSX.
+var ErrFormatoNoSoportado = errors.New("unsupported export format, use csv or xlsx")
+
+// Writer writes a table one row at a time. Values that would be read as formulas are
+// escaped. Close must be called to finish the file.
+type Writer interface {
+	Write(fila []string) error
+	Close() error
+}
+
+// prefijoFormula starts the cells that spreadsheets would evaluate as a formula.
+const prefijoFormula = "=+-@\t\r"
+
+// escaparCelda prefixes with an apostrophe the values a spreadsheet would read as a
+// formula, so that names or resolutions typed by users cannot run formulas (CSV/formula
+// injection) when an export is opened.
+func escaparCelda(valor string) string {
+	if valor != "" && strings.ContainsRune(prefijoFormula, rune(valor[0])) {
+		return "'" + valor
+	}
+	return valor
+}
+
+// desescaparCelda reverses escaparCelda for imported files.
+func desescaparCelda(valor string) string {
+	if len(valor) > 1 && valor[0] == '\'' && strings.ContainsRune(prefijoFormula, rune(valor[1])) {
+		return valor[1:]
+	}
+	return valor
+}
+
+// ContentType returns the MIME type of a supported format.
+func ContentType(formato string) string {
+	if formato == FormatoXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// NewWriter returns a Writer of formato that writes to w. hoja names the worksheet of XLSX files.
+func NewWriter(formato string, w io.Writer, hoja string) (Writer, error) {
+	switch formato {
+	case FormatoCSV:
+		if _, err := io.WriteString(w, bom); err != nil {
+			return nil, err
+		}
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	case FormatoXLSX:
+		return newXLSXWriter(w, hoja)
+	}
+	return nil, ErrFormatoNoSoportado
+}
+
+// csvWriter writes CSV; encoding/csv buffers rows and sends them as the buffer fills.
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) Write(fila []string) error {
+	escapada := make([]string, len(fila))
+	for i, v := range fila {
+		escapada[i] = escaparCelda(v)
+	}
+	return c.w.Write(escapada)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// xlsxWriter writes a single-sheet workbook with excelize's stream writer, which spills
+// rows to a temporary file instead of keeping them in memory. The workbook is sent on Close.
+type xlsxWriter struct {
+	w      io.Writer
+	file   *excelize.File
+	stream *excelize.StreamWriter
+	filas  int
+}
+
+func newXLSXWriter(w io.Writer, hoja string) (*xlsxWriter, error) {
+	file := excelize.NewFile()
+	if err := file.SetSheetName(file.GetSheetName(0), hoja); err != nil {
+		file.Close()
+		return nil, err
+	}
+	stream, err := file.NewStreamWriter(hoja)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &xlsxWriter{w: w, file: file, stream: stream}, nil
+}
+
+func (x *xlsxWriter) Write(fila []string) error {
+	x.filas++
+	celda, err := excelize.CoordinatesToCellName(1, x.filas)
+	if err != nil {
+		return err
+	}
+	valores := make([]interface{}, len(fila))
+	for i, v := range fila {
+		valores[i] = escaparCelda(v)
+	}
+	return x.stream.SetRow(celda, valores)
+}
+
+func (x *xlsxWriter) Close() error {
+	defer x.file.Close()
+	if err := x.stream.Flush(); err != nil {
+		return err
+	}
+	return x.file.Write(x.w)
+}
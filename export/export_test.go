@@ -0,0 +1,77 @@
+package export
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEscaparCelda(t *testing.T) {
+	tests := []struct {
+		valor string
+		want  string
+	}{
+		{"", ""},
+		{"Grupo de Robótica", "Grupo de Robótica"},
+		{"=HYPERLINK(\"http://x\")", "'=HYPERLINK(\"http://x\")"},
+		{"+1+1", "'+1+1"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"'=1", "'=1"}, // Already quoted by the user: kept as typed
+		{"a=1", "a=1"},
+	}
+	for _, tt := range tests {
+		got := escaparCelda(tt.valor)
+		if got != tt.want {
+			t.Errorf("escaparCelda(%q) = %q, want %q", tt.valor, got, tt.want)
+		}
+		if tt.valor != "'=1" && desescaparCelda(got) != tt.valor {
+			t.Errorf("desescaparCelda(%q) = %q, want %q", got, desescaparCelda(got), tt.valor)
+		}
+	}
+}
+
+func TestWriterEscapesFormulasAndRoundTrips(t *testing.T) {
+	filas := [][]string{
+		{"idGrupo", "nombre", "numeroResolucion"},
+		{"1", "=cmd|' /C calc'!A0", "R-001"},
+		{"2", "Señales y Ñandúes", "-15"},
+	}
+	for _, formato := range []string{FormatoCSV, FormatoXLSX} {
+		t.Run(formato, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewWriter(formato, &buf, "grupos")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, fila := range filas {
+				if err := w.Write(fila); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if formato == FormatoCSV {
+				csv := buf.String()
+				if !strings.HasPrefix(csv, bom) {
+					t.Error("CSV lacks the UTF-8 BOM")
+				}
+				if !strings.Contains(csv, ",'=cmd|") || !strings.Contains(csv, ",'-15\n") {
+					t.Errorf("formula-like values are not escaped:\n%s", csv)
+				}
+			}
+
+			got, err := ReadAll(formato, &buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, filas) {
+				t.Errorf("ReadAll = %q, want %q", got, filas)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package export
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// errFechaInvalida is returned by ParseFecha for a value that is not a date.
+var errFechaInvalida = errors.New("invalid date, use YYYY-MM-DD or DD/MM/YYYY")
+
+// ReadAll reads every row of a CSV file or of the first worksheet of an XLSX file. XLSX
+// cells are returned unformatted, so dates come as Excel serial numbers (see ParseFecha).
+// The apostrophe the exports add before formula-like values is removed, so exported files
+// can be imported back unchanged.
+func ReadAll(formato string, r io.Reader) ([][]string, error) {
+	var filas [][]string
+	switch formato {
+	case FormatoCSV:
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		reader := csv.NewReader(strings.NewReader(strings.TrimPrefix(string(data), bom)))
+		reader.FieldsPerRecord = -1 // Spreadsheets drop trailing empty cells
+		if filas, err = reader.ReadAll(); err != nil {
+			return nil, err
+		}
+	case FormatoXLSX:
+		file, err := excelize.OpenReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		if filas, err = file.GetRows(file.GetSheetName(0), excelize.Options{RawCellValue: true}); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrFormatoNoSoportado
+	}
+	for _, fila := range filas {
+		for i, v := range fila {
+			fila[i] = desescaparCelda(v)
+		}
+	}
+	return filas, nil
+}
+
+// ParseFecha parses a date read from an imported file: YYYY-MM-DD, DD/MM/YYYY or an Excel
+// serial date number.
+func ParseFecha(valor string) (time.Time, error) {
+	for _, layout := range []string{time.DateOnly, "02/01/2006"} {
+		if fecha, err := time.Parse(layout, valor); err == nil {
+			return fecha, nil
+		}
+	}
+	if serial, err := strconv.ParseFloat(valor, 64); err == nil && serial > 0 {
+		fecha, err := excelize.ExcelDateToTime(serial, false)
+		if err == nil {
+			return time.Date(fecha.Year(), fecha.Month(), fecha.Day(), 0, 0, 0, 0, time.UTC), nil
+		}
+	}
+	return time.Time{}, errFechaInvalida
+}
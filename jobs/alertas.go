@@ -0,0 +1,91 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/repository"
+)
+
+const defaultAlertasInt = 15 * time.Minute
+
+// StartAlertasBusquedas evaluates, every interval, the saved searches with alerts enabled
+// and notifies their owners of the groups that started matching them and of the members
+// who joined a matching group. It returns when ctx is cancelled.
+func StartAlertasBusquedas(ctx context.Context, db *sql.DB, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultAlertasInt
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := evaluarBusquedas(ctx, db); err != nil {
+			log.Printf("Error evaluating saved search alerts: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func evaluarBusquedas(ctx context.Context, db *sql.DB) error {
+	busquedas, err := repository.GetBusquedasConAlertas(db)
+	if err != nil {
+		return err
+	}
+	total := 0
+	for _, b := range busquedas {
+		if ctx.Err() != nil {
+			return nil
+		}
+		alertas, err := evaluarBusqueda(db, b)
+		if err != nil {
+			log.Printf("Error evaluating saved search %d: %v", b.ID, err)
+			continue
+		}
+		total += alertas
+	}
+	if total > 0 {
+		log.Printf("created %d saved search alerts", total)
+	}
+	return nil
+}
+
+// evaluarBusqueda records the current matches of a saved search and returns how many alerts
+// they raised.
+func evaluarBusqueda(db *sql.DB, b models.BusquedaGuardada) (int, error) {
+	usuario, err := repository.GetUsuarioByID(db, b.IDUsuario)
+	if err != nil {
+		return 0, err
+	}
+	if usuario == nil {
+		return 0, nil // Deleted along with its searches
+	}
+	filter, err := filtroBusqueda(b, usuario.Rol)
+	if err != nil {
+		return 0, err
+	}
+	return repository.RegistrarEvaluacionBusqueda(db, b, filter)
+}
+
+// filtroBusqueda parses the parameters of a saved search into the filter GET /grupos would
+// apply for its owner, whose role is rol: only the groups the owner may see are searched.
+func filtroBusqueda(b models.BusquedaGuardada, rol string) (repository.GrupoFilter, error) {
+	parametros, err := url.ParseQuery(b.Parametros)
+	if err != nil {
+		return repository.GrupoFilter{}, err
+	}
+	filter, err := repository.ParseGrupoFilter(parametros)
+	if err != nil {
+		return repository.GrupoFilter{}, err
+	}
+	filter.Visibilidad = repository.NewVisibilidad(filter.Estados, rol, &b.IDUsuario)
+	return filter, nil
+}
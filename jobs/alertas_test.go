@@ -0,0 +1,73 @@
+package jobs
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/repository"
+)
+
+func TestFiltroBusqueda(t *testing.T) {
+	owner := 7
+
+	tests := []struct {
+		name       string
+		parametros string
+		rol        string
+		check      func(t *testing.T, f repository.GrupoFilter)
+		wantErr    bool
+	}{
+		{
+			name:       "filters of GET /grupos",
+			parametros: "tipoInvestigacion=Aplicada&facultad=Ingenier%C3%ADa,Ciencias&a%C3%B1o=2023,2024&minIntegrantes=3&q=agua",
+			rol:        models.RolUsuario,
+			check: func(t *testing.T, f repository.GrupoFilter) {
+				if !reflect.DeepEqual(f.TiposInvestigacion, []string{"Aplicada"}) ||
+					!reflect.DeepEqual(f.Facultades, []string{"Ingeniería", "Ciencias"}) ||
+					!reflect.DeepEqual(f.Anios, []int{2023, 2024}) ||
+					f.MinIntegrantes == nil || *f.MinIntegrantes != 3 || f.Q != "agua" {
+					t.Errorf("filter = %+v", f)
+				}
+			},
+		},
+		{
+			name:       "a user only searches public groups and their own",
+			parametros: "estado=borrador",
+			rol:        models.RolUsuario,
+			check: func(t *testing.T, f repository.GrupoFilter) {
+				want := repository.Visibilidad{Estados: []string{"borrador"}, SoloPublicos: true, Propietario: &owner}
+				if !reflect.DeepEqual(f.Visibilidad, want) {
+					t.Errorf("Visibilidad = %+v, want %+v", f.Visibilidad, want)
+				}
+			},
+		},
+		{
+			name:       "a reviewer searches every group",
+			parametros: "estado=en_revision",
+			rol:        models.RolRevisor,
+			check: func(t *testing.T, f repository.GrupoFilter) {
+				want := repository.Visibilidad{Estados: []string{"en_revision"}}
+				if !reflect.DeepEqual(f.Visibilidad, want) {
+					t.Errorf("Visibilidad = %+v, want %+v", f.Visibilidad, want)
+				}
+			},
+		},
+		{name: "malformed query string", parametros: "facultad=%zz", rol: models.RolUsuario, wantErr: true},
+		{name: "invalid year", parametros: "a%C3%B1o=dos", rol: models.RolUsuario, wantErr: true},
+		{name: "invalid date", parametros: "fechaDesde=01/02/2024", rol: models.RolUsuario, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := models.BusquedaGuardada{ID: 1, IDUsuario: owner, Parametros: tt.parametros}
+			f, err := filtroBusqueda(b, tt.rol)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("filtroBusqueda error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.check != nil {
+				tt.check(t, f)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/repository"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/storage"
+)
+
+const cargasBatchSize = 100
+
+// StartLimpiezaCargas deletes, every interval, resumable uploads whose expiry has passed
+// together with their stored chunks. It returns when ctx is cancelled.
+func StartLimpiezaCargas(ctx context.Context, db *sql.DB, store storage.Storage, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := limpiarCargasExpiradas(ctx, db, store); err != nil {
+			log.Printf("Error deleting expired uploads: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func limpiarCargasExpiradas(ctx context.Context, db *sql.DB, store storage.Storage) error {
+	ids, err := repository.GetCargasExpiradas(db, cargasBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		// Chunks first: if this fails the row stays and the next run retries
+		if err := storage.DeletePrefix(ctx, store, "cargas/"+id+"/"); err != nil {
+			log.Printf("Error deleting chunks of expired upload %s: %v", id, err)
+			continue
+		}
+		if err := repository.DeleteCarga(db, id); err != nil {
+			log.Printf("Error deleting expired upload %s: %v", id, err)
+		}
+	}
+	if len(ids) > 0 {
+		log.Printf("deleted %d expired uploads", len(ids))
+	}
+	return nil
+}
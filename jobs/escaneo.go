@@ -0,0 +1,120 @@
+// Package jobs contains background tasks started by the server.
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"path"
+	"time"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/repository"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/scanner"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/storage"
+)
+
+const (
+	escaneoBatchSize   = 50
+	escaneoMaxIntentos = 10 // Failed attempts before a file is marked as error
+	defaultEscaneoInt  = 5 * time.Minute
+)
+
+// StartEscaneoPendiente rescans, every interval, the stored files that are pending a
+// malware scan: uploads the scanner could not check and files uploaded before scanning
+// was enabled. Infected files are moved to quarantine, and files that fail
+// escaneoMaxIntentos times (missing from storage, or the scanner errors on them) are marked
+// as error and no longer retried. It returns when ctx is cancelled.
+func StartEscaneoPendiente(ctx context.Context, db *sql.DB, store storage.Storage, sc scanner.Scanner, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultEscaneoInt
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := escanearPendientes(ctx, db, store, sc); err != nil {
+			log.Printf("Error rescanning pending files: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func escanearPendientes(ctx context.Context, db *sql.DB, store storage.Storage, sc scanner.Scanner) error {
+	rutas, err := repository.GetRutasPorEscanear(db, escaneoBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, ruta := range rutas {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err := escanearArchivo(ctx, db, store, sc, ruta); err != nil {
+			if errors.Is(err, scanner.ErrNotConfigured) {
+				// Nothing can be scanned until CLAMD_ADDRESS is set
+				return nil
+			}
+			if ctx.Err() != nil {
+				return nil
+			}
+			log.Printf("Error scanning '%s': %v", ruta, err)
+			estado, err := repository.RegistrarIntentoEscaneo(db, ruta, escaneoMaxIntentos)
+			if err != nil {
+				return err
+			}
+			if estado == models.EscaneoError {
+				log.Printf("Giving up scanning '%s' after %d attempts", ruta, escaneoMaxIntentos)
+			}
+		}
+	}
+	return nil
+}
+
+func escanearArchivo(ctx context.Context, db *sql.DB, store storage.Storage, sc scanner.Scanner, ruta string) error {
+	reader, info, err := store.Open(ctx, ruta)
+	if err != nil {
+		// Missing files count as failed attempts too; the orphan reconciliation reports them
+		return err
+	}
+	result, err := sc.Scan(ctx, reader)
+	reader.Close()
+	if err != nil {
+		return err
+	}
+
+	escaneo := models.ArchivoEscaneo{Ruta: ruta, Estado: models.EscaneoLimpio}
+	if result.Infected {
+		escaneo.Estado = models.EscaneoInfectado
+		escaneo.Firma = result.Signature
+		if cuarentena, err := moverACuarentena(ctx, store, ruta, info); err != nil {
+			log.Printf("Error quarantining infected file '%s': %v", ruta, err)
+		} else {
+			escaneo.RutaCuarentena = &cuarentena
+		}
+		log.Printf("Infected file '%s' detected (%s)", ruta, result.Signature)
+	}
+	return repository.SetEstadoEscaneo(db, &escaneo)
+}
+
+// moverACuarentena copies a stored file under cuarentena/ and deletes the original.
+func moverACuarentena(ctx context.Context, store storage.Storage, ruta string, info *storage.ObjectInfo) (string, error) {
+	reader, _, err := store.Open(ctx, ruta)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	cuarentena := path.Join(scanner.CuarentenaDir, path.Base(ruta))
+	if err := store.Save(ctx, cuarentena, reader, info.Size, info.ContentType); err != nil {
+		return "", err
+	}
+	if err := store.Delete(ctx, ruta); err != nil {
+		return "", err
+	}
+	return cuarentena, nil
+}
@@ -0,0 +1,33 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/repository"
+)
+
+const defaultEstadisticasInt = 30 * time.Minute
+
+// StartRefrescoEstadisticas refreshes, every interval, the materialized views the
+// statistics endpoints read from. It returns when ctx is cancelled.
+func StartRefrescoEstadisticas(ctx context.Context, db *sql.DB, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultEstadisticasInt
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := repository.RefrescarEstadisticas(db); err != nil {
+			log.Printf("Error refreshing statistics: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+	"unicode/utf8"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/pdftext"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/repository"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/storage"
+)
+
+const (
+	extraccionBatchSize = 20
+	maxPDFSize          = 100 * 1024 * 1024 // PDFs are parsed in memory
+	// maxTextoIndexado keeps the text under PostgreSQL's 1 MB tsvector limit.
+	maxTextoIndexado = 512 * 1024
+)
+
+// StartExtraccionTexto extracts, every interval, the text of group PDFs that have been
+// scanned clean, so they can be found with ?contenido=. It returns when ctx is cancelled.
+func StartExtraccionTexto(ctx context.Context, db *sql.DB, store storage.Storage, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := extraerPendientes(ctx, db, store); err != nil {
+			log.Printf("Error extracting document text: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func extraerPendientes(ctx context.Context, db *sql.DB, store storage.Storage) error {
+	rutas, err := repository.GetRutasPorExtraer(db, extraccionBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, ruta := range rutas {
+		if ctx.Err() != nil {
+			return nil
+		}
+		estado, texto, errMsg, err := extraerTexto(ctx, store, ruta)
+		if err != nil {
+			// Storage unavailable: retried on the next run
+			log.Printf("Error reading '%s' for text extraction: %v", ruta, err)
+			continue
+		}
+		if err := repository.SetTextoArchivo(db, ruta, estado, texto, errMsg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extraerTexto returns the extraction state, text and failure reason of a stored PDF.
+// It only returns an error for failures worth retrying.
+func extraerTexto(ctx context.Context, store storage.Storage, ruta string) (string, string, string, error) {
+	reader, _, err := store.Open(ctx, ruta)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return models.TextoError, "", "file not found", nil
+		}
+		return "", "", "", err
+	}
+	data, err := io.ReadAll(io.LimitReader(reader, maxPDFSize+1))
+	reader.Close()
+	if err != nil {
+		return "", "", "", err
+	}
+	if len(data) > maxPDFSize {
+		return models.TextoError, "", fmt.Sprintf("file larger than %d MB", maxPDFSize/(1024*1024)), nil
+	}
+
+	texto, err := extraerPDF(data)
+	if err != nil {
+		return models.TextoError, "", err.Error(), nil
+	}
+	if texto == "" {
+		return models.TextoSinTexto, "", "", nil
+	}
+	return models.TextoExtraido, texto, "", nil
+}
+
+// extraerPDF runs the extractor, turning a panic on a malformed file into an error.
+func extraerPDF(data []byte) (texto string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("malformed PDF: %v", r)
+		}
+	}()
+	texto, err = pdftext.Extract(data)
+	if err != nil {
+		return "", err
+	}
+	if len(texto) > maxTextoIndexado {
+		texto = texto[:maxTextoIndexado]
+		for !utf8.ValidString(texto) {
+			texto = texto[:len(texto)-1]
+		}
+	}
+	return texto, nil
+}
@@ -0,0 +1,119 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/repository"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/storage"
+)
+
+// uploadsPrefix is where uploaded files are stored (see controllers.uploadDir).
+const uploadsPrefix = "uploads/"
+
+// OpcionesReconciliacion configures ReconciliarArchivos.
+type OpcionesReconciliacion struct {
+	DryRun           bool          // Only report; change nothing
+	Eliminar         bool          // Delete orphan files (ignored in dry-run)
+	AntiguedadMinima time.Duration // Younger files are skipped: their row may not be committed yet
+}
+
+// ReconciliarArchivos compares the files under uploads/ with the rows that reference them.
+// It reports orphan files (no row points to them) and rows whose file is missing. Unless
+// DryRun is set, the missing rows are flagged with archivoFaltante and, with Eliminar,
+// the orphan files are deleted.
+func ReconciliarArchivos(ctx context.Context, db *sql.DB, store storage.Storage, opts OpcionesReconciliacion) (*models.ReporteReconciliacion, error) {
+	// List the files before reading the rows, so a file stored after the listing is never
+	// seen as an orphan. Files whose row is still being created are covered by AntiguedadMinima.
+	objetos, err := store.List(ctx, uploadsPrefix)
+	if err != nil {
+		return nil, err
+	}
+	referencias, err := repository.GetArchivoReferencias(db)
+	if err != nil {
+		return nil, err
+	}
+
+	reporte := &models.ReporteReconciliacion{
+		DryRun:            opts.DryRun,
+		ArchivosRevisados: len(objetos),
+		Huerfanos:         []models.ArchivoHuerfano{},
+		Faltantes:         []models.ArchivoReferencia{},
+	}
+
+	almacenados := make(map[string]bool, len(objetos))
+	for _, obj := range objetos {
+		almacenados[obj.Key] = true
+	}
+	referenciados := make(map[string]bool, len(referencias))
+	for _, ref := range referencias {
+		referenciados[ref.Ruta] = true
+		if almacenados[ref.Ruta] {
+			continue
+		}
+		if !strings.HasPrefix(ref.Ruta, uploadsPrefix) {
+			// Outside the listed prefix; ask the backend directly
+			existe, err := existeArchivo(ctx, store, ref.Ruta)
+			if err != nil {
+				return nil, err
+			}
+			if existe {
+				continue
+			}
+		}
+		reporte.Faltantes = append(reporte.Faltantes, ref)
+	}
+
+	limite := time.Now().Add(-opts.AntiguedadMinima)
+	for _, obj := range objetos {
+		if referenciados[obj.Key] || obj.ModTime.After(limite) {
+			continue
+		}
+		reporte.Huerfanos = append(reporte.Huerfanos, models.ArchivoHuerfano{
+			Ruta:    obj.Key,
+			Tamano:  obj.Size,
+			ModTime: obj.ModTime,
+		})
+		reporte.BytesHuerfanos += obj.Size
+	}
+
+	if opts.DryRun {
+		return reporte, nil
+	}
+
+	if err := repository.SetArchivosFaltantes(db, reporte.Faltantes); err != nil {
+		return nil, err
+	}
+	if opts.Eliminar {
+		for i := range reporte.Huerfanos {
+			h := &reporte.Huerfanos[i]
+			if err := store.Delete(ctx, h.Ruta); err != nil {
+				log.Printf("Error deleting orphan file '%s': %v", h.Ruta, err)
+				continue
+			}
+			h.Eliminado = true
+			if err := repository.DeleteEstadoEscaneo(db, h.Ruta); err != nil {
+				log.Printf("Error deleting scan state of orphan file '%s': %v", h.Ruta, err)
+			}
+		}
+	}
+	return reporte, nil
+}
+
+func existeArchivo(ctx context.Context, store storage.Storage, ruta string) (bool, error) {
+	reader, _, err := store.Open(ctx, ruta)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error checking file '%s': %w", ruta, err)
+	}
+	reader.Close()
+	return true, nil
+}
@@ -0,0 +1,234 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/storage"
+)
+
+// fakeReconciliacionDB is a database/sql connector that answers GetArchivoReferencias with
+// referencias and records every statement executed, with its arguments and whether its
+// transaction was committed.
+type fakeReconciliacionDB struct {
+	referencias []models.ArchivoReferencia
+
+	mu        sync.Mutex
+	ejecutado []string // Statements run outside a transaction or in a committed one
+}
+
+func (f *fakeReconciliacionDB) Connect(context.Context) (driver.Conn, error) {
+	return &fakeReconciliacionConn{db: f}, nil
+}
+func (f *fakeReconciliacionDB) Driver() driver.Driver { return nil }
+
+func (f *fakeReconciliacionDB) statements() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.ejecutado...)
+}
+
+type fakeReconciliacionConn struct {
+	db        *fakeReconciliacionDB
+	pendiente []string // Statements of the open transaction
+	enTx      bool
+}
+
+func (c *fakeReconciliacionConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeReconciliacionStmt{conn: c, query: query}, nil
+}
+func (c *fakeReconciliacionConn) Close() error { return nil }
+func (c *fakeReconciliacionConn) Begin() (driver.Tx, error) {
+	c.enTx, c.pendiente = true, nil
+	return c, nil
+}
+func (c *fakeReconciliacionConn) Commit() error {
+	c.db.mu.Lock()
+	c.db.ejecutado = append(c.db.ejecutado, c.pendiente...)
+	c.db.mu.Unlock()
+	c.enTx, c.pendiente = false, nil
+	return nil
+}
+func (c *fakeReconciliacionConn) Rollback() error {
+	c.enTx, c.pendiente = false, nil
+	return nil
+}
+
+type fakeReconciliacionStmt struct {
+	conn  *fakeReconciliacionConn
+	query string
+}
+
+func (s *fakeReconciliacionStmt) Close() error  { return nil }
+func (s *fakeReconciliacionStmt) NumInput() int { return -1 }
+
+func (s *fakeReconciliacionStmt) Exec(args []driver.Value) (driver.Result, error) {
+	statement := strings.Join(strings.Fields(s.query), " ")
+	for _, arg := range args {
+		if str, ok := arg.(string); ok {
+			statement += " [" + str + "]"
+		}
+	}
+	if s.conn.enTx {
+		s.conn.pendiente = append(s.conn.pendiente, statement)
+	} else {
+		s.conn.db.mu.Lock()
+		s.conn.db.ejecutado = append(s.conn.db.ejecutado, statement)
+		s.conn.db.mu.Unlock()
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeReconciliacionStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if !strings.Contains(s.query, "UNION ALL") {
+		return nil, errors.New("fake database: unexpected query: " + s.query)
+	}
+	rows := &fakeReferenciasRows{}
+	for _, ref := range s.conn.db.referencias {
+		rows.values = append(rows.values, []driver.Value{ref.Tabla, int64(ref.ID), ref.Ruta})
+	}
+	return rows, nil
+}
+
+type fakeReferenciasRows struct{ values [][]driver.Value }
+
+func (r *fakeReferenciasRows) Columns() []string { return []string{"tabla", "id", "ruta"} }
+func (r *fakeReferenciasRows) Close() error      { return nil }
+func (r *fakeReferenciasRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestReconciliarArchivos(t *testing.T) {
+	ctx := context.Background()
+	referencias := []models.ArchivoReferencia{
+		{Tabla: models.TablaGrupo, ID: 1, Ruta: "uploads/plan.pdf"},
+		{Tabla: models.TablaResolucion, ID: 4, Ruta: "uploads/resolucion.pdf"}, // Missing
+		{Tabla: models.TablaGrupoArchivo, ID: 9, Ruta: "uploads/acta.pdf"},
+	}
+
+	setup := func(t *testing.T) (*fakeReconciliacionDB, *sql.DB, storage.Storage) {
+		t.Helper()
+		fake := &fakeReconciliacionDB{referencias: referencias}
+		db := sql.OpenDB(fake)
+		t.Cleanup(func() { db.Close() })
+		store := storage.NewLocalStorage(t.TempDir())
+		for _, key := range []string{"uploads/plan.pdf", "uploads/acta.pdf", "uploads/huerfano.pdf"} {
+			if err := store.Save(ctx, key, strings.NewReader("%PDF-1.4"), 8, "application/pdf"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return fake, db, store
+	}
+	existe := func(t *testing.T, store storage.Storage, key string) bool {
+		t.Helper()
+		ok, err := existeArchivo(ctx, store, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+	checkReporte := func(t *testing.T, reporte *models.ReporteReconciliacion, dryRun bool) {
+		t.Helper()
+		if reporte.DryRun != dryRun || reporte.ArchivosRevisados != 3 {
+			t.Errorf("DryRun = %v, ArchivosRevisados = %d, want %v and 3", reporte.DryRun, reporte.ArchivosRevisados, dryRun)
+		}
+		if len(reporte.Faltantes) != 1 || reporte.Faltantes[0] != referencias[1] {
+			t.Errorf("Faltantes = %+v, want the resolution", reporte.Faltantes)
+		}
+		if len(reporte.Huerfanos) != 1 || reporte.Huerfanos[0].Ruta != "uploads/huerfano.pdf" || reporte.BytesHuerfanos != 8 {
+			t.Errorf("Huerfanos = %+v (%d bytes), want uploads/huerfano.pdf", reporte.Huerfanos, reporte.BytesHuerfanos)
+		}
+	}
+
+	t.Run("dry run changes nothing", func(t *testing.T) {
+		fake, db, store := setup(t)
+		reporte, err := ReconciliarArchivos(ctx, db, store, OpcionesReconciliacion{DryRun: true, Eliminar: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkReporte(t, reporte, true)
+		if reporte.Huerfanos[0].Eliminado || !existe(t, store, "uploads/huerfano.pdf") {
+			t.Error("dry run deleted the orphan file")
+		}
+		if got := fake.statements(); len(got) != 0 {
+			t.Errorf("dry run wrote to the database: %v", got)
+		}
+	})
+
+	t.Run("apply flags missing files and keeps orphans", func(t *testing.T) {
+		fake, db, store := setup(t)
+		reporte, err := ReconciliarArchivos(ctx, db, store, OpcionesReconciliacion{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkReporte(t, reporte, false)
+		if reporte.Huerfanos[0].Eliminado || !existe(t, store, "uploads/huerfano.pdf") {
+			t.Error("orphan file deleted without Eliminar")
+		}
+
+		got := fake.statements()
+		if len(got) != 3 {
+			t.Fatalf("statements = %v, want the three archivoFaltante updates", got)
+		}
+		marcados := map[string]string{}
+		for _, stmt := range got {
+			for _, tabla := range []string{"UPDATE grupo ", "UPDATE Resolucion ", "UPDATE Grupo_Archivo "} {
+				if strings.HasPrefix(stmt, tabla) {
+					marcados[tabla] = stmt[strings.LastIndex(stmt, " ")+1:]
+				}
+			}
+		}
+		want := map[string]string{"UPDATE grupo ": "[{}]", "UPDATE Resolucion ": "[{4}]", "UPDATE Grupo_Archivo ": "[{}]"}
+		if len(marcados) != len(want) {
+			t.Fatalf("statements = %v", got)
+		}
+		for tabla, ids := range want {
+			if marcados[tabla] != ids {
+				t.Errorf("%s flags %s, want %s", tabla, marcados[tabla], ids)
+			}
+		}
+	})
+
+	t.Run("apply with Eliminar deletes orphans and their scan state", func(t *testing.T) {
+		fake, db, store := setup(t)
+		reporte, err := ReconciliarArchivos(ctx, db, store, OpcionesReconciliacion{Eliminar: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkReporte(t, reporte, false)
+		if !reporte.Huerfanos[0].Eliminado || existe(t, store, "uploads/huerfano.pdf") {
+			t.Error("orphan file was not deleted")
+		}
+		if !existe(t, store, "uploads/plan.pdf") || !existe(t, store, "uploads/acta.pdf") {
+			t.Error("a referenced file was deleted")
+		}
+		got := fake.statements()
+		if last := got[len(got)-1]; last != "DELETE FROM Archivo_Escaneo WHERE ruta = $1 [uploads/huerfano.pdf]" {
+			t.Errorf("last statement = %q, want the scan state deletion", last)
+		}
+	})
+
+	t.Run("recent files are not orphans yet", func(t *testing.T) {
+		_, db, store := setup(t)
+		reporte, err := ReconciliarArchivos(ctx, db, store, OpcionesReconciliacion{Eliminar: true, AntiguedadMinima: time.Hour})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(reporte.Huerfanos) != 0 || !existe(t, store, "uploads/huerfano.pdf") {
+			t.Errorf("Huerfanos = %+v, want none for files younger than AntiguedadMinima", reporte.Huerfanos)
+		}
+	})
+}
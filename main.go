@@ -1,15 +1,20 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/database"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/jobs"
 	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/routes" // Usa gorilla/mux
-	"github.com/joho/godotenv"                                            // Para cargar variables de entorno desde .env
-	"github.com/rs/cors"                                                  // Importar CORS para gorilla/mux
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/scanner"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/storage"
+	"github.com/joho/godotenv" // Para cargar variables de entorno desde .env
+	"github.com/rs/cors"       // Importar CORS para gorilla/mux
 	// Se eliminan imports de gin
 )
 
@@ -33,14 +38,40 @@ func main() {
 	}
 	defer db.Close()
 
+	// Initialize file storage (local disk or S3-compatible, see STORAGE_DRIVER)
+	store, err := storage.NewFromEnv()
+	if err != nil {
+		log.Fatal("Failed to initialize file storage:", err)
+	}
+
+	// Initialize malware scanning (clamd, see CLAMD_ADDRESS) and rescan pending files in the background
+	sc := scanner.NewFromEnv()
+	go jobs.StartEscaneoPendiente(context.Background(), db, store, sc, envInterval("ESCANEO_INTERVAL"))
+
+	// Delete abandoned resumable uploads (see CARGA_TTL)
+	go jobs.StartLimpiezaCargas(context.Background(), db, store, time.Hour)
+
+	// Extract the text of uploaded PDFs for ?contenido= searches
+	go jobs.StartExtraccionTexto(context.Background(), db, store, time.Minute)
+
+	// Notify new matches of saved searches with alerts (see ALERTAS_INTERVAL)
+	go jobs.StartAlertasBusquedas(context.Background(), db, envInterval("ALERTAS_INTERVAL"))
+
+	// Refresh the materialized views of the statistics (see ESTADISTICAS_INTERVAL)
+	go jobs.StartRefrescoEstadisticas(context.Background(), db, envInterval("ESTADISTICAS_INTERVAL"))
+
 	// Setup routes using the routes package (gorilla/mux)
-	r := routes.SetupRoutes(db)
+	r := routes.SetupRoutes(db, store, sc)
 
 	// --- Configuración de CORS usando rs/cors ---
 	c := cors.New(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:4200"},                   // Origen permitido
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}, // Métodos permitidos
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},           // Cabeceras permitidas
+		AllowedOrigins: []string{"http://localhost:4200"},                                    // Origen permitido
+		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "HEAD", "PATCH"}, // Métodos permitidos (HEAD/PATCH: subidas tus)
+		// Cabeceras permitidas, incluidas las del protocolo tus de subidas reanudables
+		AllowedHeaders: []string{"Content-Type", "Authorization",
+			"Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata", "Upload-Checksum", "Upload-Defer-Length"},
+		ExposedHeaders: []string{"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size",
+			"Upload-Offset", "Upload-Length", "Upload-Expires"},
 		AllowCredentials: true,
 		// Debug:            true, // Habilita logs de CORS si necesitas depurar
 	})
@@ -61,3 +92,13 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// envInterval reads the period of a background job from the environment variable key
+// (e.g. ESCANEO_INTERVAL="5m").
+func envInterval(key string) time.Duration {
+	interval, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return 0 // Job default
+	}
+	return interval
+}
@@ -2,13 +2,16 @@ package middleware
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/repository"
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -18,16 +21,60 @@ type contextKey string
 const (
 	// UserIDKey is the key used to store the user ID in the request context
 	UserIDKey contextKey = "userID"
+	// UserRoleKey is the key used to store the user's application role in the request context
+	UserRoleKey contextKey = "userRole"
 )
 
-// JWTMiddleware verifies the JWT token from the Authorization header.
-func JWTMiddleware(next http.Handler) http.Handler {
-	// Get the secret key from environment variable
+// Claims are the JWT claims issued at login. Rol carries the user's application role.
+type Claims struct {
+	Rol string `json:"rol"`
+	jwt.RegisteredClaims
+}
+
+// getJWTSecret returns the signing secret, aborting if it is not configured.
+func getJWTSecret() string {
 	jwtSecret := os.Getenv("JWT_SECRET")
 	if jwtSecret == "" {
 		// Log fatal error if secret is not set, as the app cannot securely function
 		log.Fatal("FATAL: JWT_SECRET environment variable not set.")
 	}
+	return jwtSecret
+}
+
+// parseToken validates a raw token string and returns its claims.
+func parseToken(tokenString, jwtSecret string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		// Don't forget to validate the alg is what you expect:
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		// Return the secret key for validation
+		return []byte(jwtSecret), nil
+	})
+}
+
+// withClaims copies the user ID and role from a validated token into the request context.
+func withClaims(r *http.Request, token *jwt.Token) *http.Request {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		log.Printf("Warning: Could not parse token claims")
+		return r
+	}
+	ctx := r.Context()
+	// Extract 'sub' (subject) claim, used for the user ID
+	if userID, ok := claims["sub"].(string); ok {
+		ctx = context.WithValue(ctx, UserIDKey, userID)
+	}
+	if rol, ok := claims["rol"].(string); ok {
+		ctx = context.WithValue(ctx, UserRoleKey, rol)
+	}
+	return r.WithContext(ctx)
+}
+
+// JWTMiddleware verifies the JWT token from the Authorization header.
+func JWTMiddleware(next http.Handler) http.Handler {
+	// Get the secret key from environment variable
+	jwtSecret := getJWTSecret()
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// 1. Get the token from the Authorization header
@@ -47,14 +94,7 @@ func JWTMiddleware(next http.Handler) http.Handler {
 		tokenString := parts[1]
 
 		// 2. Parse and validate the token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Don't forget to validate the alg is what you expect:
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			// Return the secret key for validation
-			return []byte(jwtSecret), nil
-		})
+		token, err := parseToken(tokenString, jwtSecret)
 
 		if err != nil {
 			log.Printf("Token validation error: %v", err)
@@ -79,23 +119,125 @@ func JWTMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		// 3. Optional: Extract claims (e.g., user ID) and add to context
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			// Example: Extract 'sub' (subject) claim, often used for user ID
-			if userID, ok := claims["sub"].(string); ok { // Assuming user ID is a string in 'sub'
-				// Add user ID to context
-				ctx := context.WithValue(r.Context(), UserIDKey, userID)
-				r = r.WithContext(ctx)
-			} else {
-				// Handle case where 'sub' claim is missing or not a string if it's mandatory
-				// log.Printf("Warning: 'sub' claim missing or not a string in token")
-			}
-			// You can extract other claims similarly
-		} else {
-			log.Printf("Warning: Could not parse token claims")
-		}
+		// 3. Extract claims (user ID and role) and add to context
+		r = withClaims(r, token)
 
 		// 4. Call the next handler if the token is valid
 		next.ServeHTTP(w, r)
 	})
 }
+
+// OptionalJWTMiddleware adds the user to the request context when a valid Bearer token
+// is present, but lets anonymous requests (or invalid tokens) through unchanged.
+// Public routes use it to show more data to authenticated users.
+func OptionalJWTMiddleware(next http.Handler) http.Handler {
+	jwtSecret := getJWTSecret()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(r.Header.Get("Authorization"), " ")
+		if len(parts) == 2 && strings.ToLower(parts[0]) == "bearer" {
+			token, err := parseToken(parts[1], jwtSecret)
+			if err == nil && token.Valid {
+				r = withClaims(r, token)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CurrentRoleMiddleware replaces the role carried by the token with the one stored in Usuario,
+// so role changes take effect on the next request instead of when the token expires. Tokens
+// of deleted users are rejected. It must run after JWTMiddleware.
+func CurrentRoleMiddleware(db *sql.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := GetUserID(r.Context())
+			if !ok {
+				http.Error(w, "Invalid token (missing subject)", http.StatusUnauthorized)
+				return
+			}
+			user, err := repository.GetUsuarioByID(db, userID)
+			if err != nil {
+				log.Printf("Error loading current role: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if user == nil {
+				http.Error(w, "User no longer exists", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), UserRoleKey, user.Rol)))
+		})
+	}
+}
+
+// OptionalCurrentRoleMiddleware is CurrentRoleMiddleware for routes where a token is
+// optional: the role of an authenticated user is read from Usuario, and the token of a
+// deleted user is ignored, as if the request were anonymous. It must run after
+// OptionalJWTMiddleware.
+func OptionalCurrentRoleMiddleware(db *sql.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := GetUserID(r.Context())
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			user, err := repository.GetUsuarioByID(db, userID)
+			if err != nil {
+				log.Printf("Error loading current role: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			ctx := r.Context()
+			if user == nil {
+				ctx = context.WithValue(context.WithValue(ctx, UserIDKey, nil), UserRoleKey, nil)
+			} else {
+				ctx = context.WithValue(ctx, UserRoleKey, user.Rol)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireRole returns a middleware that only lets through users whose role is one of roles.
+// It must run after JWTMiddleware and CurrentRoleMiddleware.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rol := GetUserRole(r.Context())
+			for _, allowed := range roles {
+				if rol == allowed {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			http.Error(w, "Forbidden: insufficient role", http.StatusForbidden)
+		})
+	}
+}
+
+// GetUserID returns the authenticated user's ID from the context, if any.
+func GetUserID(ctx context.Context) (int, bool) {
+	userIDStr, ok := ctx.Value(UserIDKey).(string)
+	if !ok {
+		return 0, false
+	}
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return 0, false
+	}
+	return userID, true
+}
+
+// GetUserRole returns the authenticated user's role from the context, or "" for anonymous requests.
+func GetUserRole(ctx context.Context) string {
+	rol, _ := ctx.Value(UserRoleKey).(string)
+	return rol
+}
+
+// IsAuthenticated reports whether the request context carries an authenticated user.
+func IsAuthenticated(ctx context.Context) bool {
+	_, ok := GetUserID(ctx)
+	return ok
+}
@@ -0,0 +1,28 @@
+package models
+
+// Result types of the global search.
+const (
+	TipoResultadoGrupo        = "grupo"
+	TipoResultadoInvestigador = "investigador"
+	TipoResultadoDocumento    = "documento"
+)
+
+// TiposResultado lists every result type of the global search.
+var TiposResultado = []string{TipoResultadoGrupo, TipoResultadoInvestigador, TipoResultadoDocumento}
+
+// ResultadoBusqueda is one hit of the global search. Datos holds the matched entity:
+// a GrupoWithInvestigadores, an Investigador or a DocumentoEncontrado, according to Tipo.
+type ResultadoBusqueda struct {
+	Tipo       string      `json:"tipo"`
+	Titulo     string      `json:"titulo"`
+	Relevancia float64     `json:"relevancia"` // Rank relative to the best hit of the same type, from 0 to 1
+	Datos      interface{} `json:"datos"`
+}
+
+// BusquedaGlobal is the response of the global search: the hits of every type merged by
+// relevance, and how many matches each type has in total.
+type BusquedaGlobal struct {
+	Q          string              `json:"q"`
+	Resultados []ResultadoBusqueda `json:"resultados"`
+	Totales    map[string]int      `json:"totales"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// Kinds of saved search alerts.
+const (
+	AlertaGrupoNuevo      = "grupo_nuevo"      // A group started matching the search
+	AlertaIntegranteNuevo = "integrante_nuevo" // A member joined a group matching the search
+)
+
+// BusquedaGuardada is a named group search saved by a user. Parametros is the query string
+// of GET /grupos it runs.
+type BusquedaGuardada struct {
+	ID         int        `json:"idBusqueda" db:"idBusqueda"`
+	IDUsuario  int        `json:"idUsuario" db:"idUsuario"`
+	Nombre     string     `json:"nombre" db:"nombre"`
+	Parametros string     `json:"parametros" db:"parametros"`
+	Alertas    bool       `json:"alertas" db:"alertas"`       // Opted in to alerts of new matches
+	EvaluadaEn *time.Time `json:"evaluadaEn" db:"evaluadaEn"` // Last alert evaluation
+	CreatedAt  time.Time  `json:"createdAt" db:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt" db:"updatedAt"`
+}
+
+// AlertaBusqueda notifies a user of a new match of one of their saved searches.
+type AlertaBusqueda struct {
+	ID                 int       `json:"idAlerta" db:"idAlerta"`
+	IDBusqueda         int       `json:"idBusqueda" db:"idBusqueda"`
+	NombreBusqueda     string    `json:"nombreBusqueda"`
+	Tipo               string    `json:"tipo" db:"tipo"`
+	IDGrupo            int       `json:"idGrupo" db:"idGrupo"`
+	NombreGrupo        string    `json:"nombreGrupo"`
+	IDInvestigador     *int      `json:"idInvestigador" db:"idInvestigador"` // Set for integrante_nuevo
+	NombreInvestigador *string   `json:"nombreInvestigador"`
+	Leida              bool      `json:"leida" db:"leida"`
+	CreatedAt          time.Time `json:"createdAt" db:"createdAt"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Carga is a resumable (tus) upload of a group attachment. Its chunks are kept in storage
+// until the last byte arrives, when they are assembled into a GrupoArchivo.
+type Carga struct {
+	ID             string    `json:"idCarga" db:"idCarga"`
+	IDGrupo        int       `json:"idGrupo" db:"idGrupo"`
+	Categoria      string    `json:"categoria" db:"categoria"`
+	Descripcion    string    `json:"descripcion" db:"descripcion"`
+	Visibilidad    string    `json:"visibilidad" db:"visibilidad"`
+	NombreOriginal string    `json:"nombreOriginal" db:"nombreOriginal"`
+	Tamano         int64     `json:"tamano" db:"tamano"`     // Total size announced by the client
+	Recibido       int64     `json:"recibido" db:"recibido"` // Bytes stored so far (tus Upload-Offset)
+	Checksum       string    `json:"checksum" db:"checksum"` // Expected hex SHA-256, empty if not given
+	IDUsuario      int       `json:"idUsuario" db:"idUsuario"`
+	IDArchivo      *int      `json:"idArchivo" db:"idArchivo"` // Set once the upload is complete
+	ExpiraEn       time.Time `json:"expiraEn" db:"expiraEn"`
+	CreatedAt      time.Time `json:"createdAt" db:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt" db:"updatedAt"`
+}
+
+// Completa reports whether every byte of the upload has been received.
+func (c *Carga) Completa() bool {
+	return c.Recibido >= c.Tamano
+}
@@ -1,15 +1,19 @@
 package models
 
 // PaginationMetadata holds information about the pagination state.
+// Pages requested by cursor are not counted: TotalItems and TotalPages are -1 and CurrentPage is 0.
 type PaginationMetadata struct {
-	TotalItems  int `json:"totalItems"`
-	TotalPages  int `json:"totalPages"`
-	CurrentPage int `json:"currentPage"`
-	Limit       int `json:"limit"`
+	TotalItems  int    `json:"totalItems"`
+	TotalPages  int    `json:"totalPages"`
+	CurrentPage int    `json:"currentPage"`
+	Limit       int    `json:"limit"`
+	NextCursor  string `json:"nextCursor,omitempty"` // Pass as ?after= to get the next page
+	PrevCursor  string `json:"prevCursor,omitempty"` // Pass as ?before= to get the previous page
 }
 
 // PaginatedResponse is a generic wrapper for paginated API responses.
 type PaginatedResponse struct {
 	Data       interface{}        `json:"data"` // Holds the actual slice of results (e.g., []Investigador, []GrupoWithInvestigadores)
 	Pagination PaginationMetadata `json:"pagination"`
+	Facetas    interface{}        `json:"facetas,omitempty"` // Facet counts, when requested (e.g. *FacetasGrupo)
 }
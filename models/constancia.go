@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// GrupoConstancia is a group certified by a Constancia, as it was when the certificate was issued.
+type GrupoConstancia struct {
+	IDGrupo          int       `json:"idGrupo"`
+	Nombre           string    `json:"nombre"`
+	Rol              string    `json:"rol"`
+	NumeroResolucion string    `json:"numeroResolucion"`
+	FechaRegistro    time.Time `json:"fechaRegistro"`
+}
+
+// DatosConstancia is the content of a membership certificate, signed when it is issued.
+type DatosConstancia struct {
+	IDInvestigador int               `json:"idInvestigador"`
+	Nombre         string            `json:"nombre"`
+	Apellido       string            `json:"apellido"`
+	Grupos         []GrupoConstancia `json:"grupos"`
+	EmitidaEn      time.Time         `json:"emitidaEn"`
+}
+
+// Constancia is an issued membership certificate. Contenido is Datos serialized as JSON,
+// exactly as signed in Firma.
+type Constancia struct {
+	ID             int             `json:"idConstancia" db:"idConstancia"`
+	Codigo         string          `json:"codigo" db:"codigo"`
+	IDInvestigador *int            `json:"idInvestigador" db:"idInvestigador"` // Current record of the certified investigator, after merges
+	IDUsuario      *int            `json:"idUsuario" db:"idUsuario"`           // User who issued it
+	Datos          DatosConstancia `json:"datos"`
+	Contenido      string          `json:"-" db:"contenido"`
+	Firma          string          `json:"-" db:"firma"`
+	CreatedAt      time.Time       `json:"createdAt" db:"createdAt"`
+}
+
+// VerificacionConstancia is the public answer to the verification of a certificate code.
+type VerificacionConstancia struct {
+	Codigo        string          `json:"codigo"`
+	Datos         DatosConstancia `json:"datos"`         // Original content of the certificate
+	Autentica     bool            `json:"autentica"`     // The stored content matches its signature
+	Vigente       bool            `json:"vigente"`       // Authentic and every certified membership still holds
+	Observaciones []string        `json:"observaciones"` // Why it is not valid any more, if so
+}
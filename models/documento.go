@@ -0,0 +1,27 @@
+package models
+
+// Text extraction states of a stored PDF.
+const (
+	TextoExtraido = "extraido"  // Text indexed
+	TextoSinTexto = "sin_texto" // No text layer (e.g. a scanned document)
+	TextoError    = "error"     // The file could not be read
+)
+
+// FragmentoDocumento is a highlighted excerpt of a group document matching a content search.
+type FragmentoDocumento struct {
+	Origen    string `json:"origen"`    // 'archivo', 'resolucion' or the attachment category
+	IDArchivo *int   `json:"idArchivo"` // Set for attachments
+	Nombre    string `json:"nombre"`    // Attachment file name or resolution number
+	Fragmento string `json:"fragmento"` // Matches wrapped in <mark></mark>
+}
+
+// DocumentoEncontrado is a group document whose text matches a global search.
+type DocumentoEncontrado struct {
+	IDGrupo     int     `json:"idGrupo"`
+	NombreGrupo string  `json:"nombreGrupo"`
+	Origen      string  `json:"origen"`    // 'archivo', 'resolucion' or the attachment category
+	IDArchivo   *int    `json:"idArchivo"` // Set for attachments
+	Nombre      string  `json:"nombre"`    // Attachment file name or resolution number
+	Fragmento   string  `json:"fragmento"` // Matches wrapped in <mark></mark>
+	Relevancia  float64 `json:"relevancia"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Malware scan states of a stored file. Only clean files are served.
+const (
+	EscaneoPendiente = "pendiente"
+	EscaneoLimpio    = "limpio"
+	EscaneoInfectado = "infectado"
+	EscaneoError     = "error" // Could not be scanned after repeated attempts; not retried
+)
+
+// ArchivoEscaneo records the malware scan state of a stored file, keyed by its storage path.
+type ArchivoEscaneo struct {
+	Ruta           string     `json:"ruta" db:"ruta"`
+	Estado         string     `json:"estado" db:"estado"`
+	Firma          string     `json:"firma" db:"firma"`                   // Malware signature when infected
+	RutaCuarentena *string    `json:"rutaCuarentena" db:"rutaCuarentena"` // Where an infected file was moved
+	EscaneadoEn    *time.Time `json:"escaneadoEn" db:"escaneadoEn"`
+	Intentos       int        `json:"intentos" db:"intentos"`           // Failed background scans
+	UltimoIntento  *time.Time `json:"ultimoIntento" db:"ultimoIntento"` // Last failed background scan
+}
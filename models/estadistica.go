@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// EstadisticaResponse wraps the result of a statistics endpoint with the registration date
+// range it covers and the time of the data it was computed from.
+type EstadisticaResponse struct {
+	Data          interface{} `json:"data"`
+	Desde         *string     `json:"desde,omitempty"` // fechaRegistro from, inclusive (YYYY-MM-DD)
+	Hasta         *string     `json:"hasta,omitempty"` // fechaRegistro to, inclusive (YYYY-MM-DD)
+	LastRefreshed *time.Time  `json:"lastRefreshed"`   // Last refresh of the reporting views; changes made since are not counted yet
+}
+
+// EstadisticaIntegrantes summarizes the number of members per group.
+type EstadisticaIntegrantes struct {
+	Grupos       int           `json:"grupos"`
+	Integrantes  int           `json:"integrantes"` // Memberships, counting an investigator once per group
+	Promedio     float64       `json:"promedio"`
+	Mediana      float64       `json:"mediana"`
+	Minimo       int           `json:"minimo"`
+	Maximo       int           `json:"maximo"`
+	Distribucion []FacetaValor `json:"distribucion"` // Groups per number of members, from fewest members
+}
+
+// InvestigadorMultigrupo is an investigator who belongs to several groups.
+type InvestigadorMultigrupo struct {
+	ID       int      `json:"idInvestigador"`
+	Nombre   string   `json:"nombre"`
+	Apellido string   `json:"apellido"`
+	Grupos   int      `json:"grupos"`
+	Nombres  []string `json:"nombresGrupos"`
+}
+
+// GrupoSinCoordinador is a group none of whose members has the coordinator role.
+type GrupoSinCoordinador struct {
+	ID            int    `json:"idGrupo"`
+	Nombre        string `json:"nombre"`
+	Estado        string `json:"estado"`
+	FechaRegistro string `json:"fechaRegistro"`
+	Integrantes   int    `json:"integrantes"`
+}
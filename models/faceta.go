@@ -0,0 +1,16 @@
+package models
+
+// FacetaValor is one value of a facet and how many groups in the current result set have it.
+type FacetaValor struct {
+	Valor string `json:"valor"`
+	Total int    `json:"total"`
+}
+
+// FacetasGrupo holds the facet counts of a group search, most frequent values first.
+type FacetasGrupo struct {
+	LineaInvestigacion []FacetaValor `json:"lineaInvestigacion"`
+	TipoInvestigacion  []FacetaValor `json:"tipoInvestigacion"`
+	Anio               []FacetaValor `json:"anio"`
+	Facultad           []FacetaValor `json:"facultad"`
+	Estado             []FacetaValor `json:"estado"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// InvestigadorDuplicado is one of the two records of a duplicate candidate.
+type InvestigadorDuplicado struct {
+	ID                int       `json:"idInvestigador"`
+	Nombre            string    `json:"nombre"`
+	Apellido          string    `json:"apellido"`
+	NombreNormalizado string    `json:"nombreNormalizado"`
+	Grupos            int       `json:"grupos"` // Groups the record belongs to
+	CreatedAt         time.Time `json:"createdAt"`
+}
+
+// CandidatoDuplicado is a pair of investigators that may be the same person.
+type CandidatoDuplicado struct {
+	Investigadores    [2]InvestigadorDuplicado `json:"investigadores"` // Oldest record first
+	Similitud         float64                  `json:"similitud"`      // Trigram similarity of the normalized full names (0-1)
+	MismoNombre       bool                     `json:"mismoNombre"`    // Same name once case, accents and spacing are ignored
+	GruposCompartidos []int                    `json:"gruposCompartidos"`
+}
+
+// ConflictoRol is a group both merged investigators belonged to, with the role kept.
+type ConflictoRol struct {
+	IDGrupo          int    `json:"idGrupo"`
+	RolSuperviviente string `json:"rolSuperviviente"`
+	RolEliminado     string `json:"rolEliminado"`
+	RolFinal         string `json:"rolFinal"`
+}
+
+// FusionInvestigador records the merge of a duplicate investigator into the surviving one.
+type FusionInvestigador struct {
+	ID                int            `json:"idFusion" db:"idFusion"`
+	IDSuperviviente   int            `json:"idSuperviviente" db:"idSuperviviente"`
+	IDEliminado       int            `json:"idEliminado" db:"idEliminado"`
+	NombreEliminado   string         `json:"nombreEliminado" db:"nombreEliminado"`
+	ApellidoEliminado string         `json:"apellidoEliminado" db:"apellidoEliminado"`
+	GruposMovidos     []int          `json:"gruposMovidos"` // Memberships moved to the survivor as they were
+	Conflictos        []ConflictoRol `json:"conflictos"`    // Groups both belonged to
+	IDUsuario         *int           `json:"idUsuario" db:"idUsuario"`
+	CreatedAt         time.Time      `json:"createdAt" db:"createdAt"`
+}
@@ -2,6 +2,20 @@ package models
 
 import "time"
 
+// Lifecycle states of a Grupo, following the research vice-rectorate's approval process.
+const (
+	EstadoBorrador   = "borrador"
+	EstadoEnviado    = "enviado"
+	EstadoEnRevision = "en_revision"
+	EstadoAprobado   = "aprobado"
+	EstadoActivo     = "activo"
+	EstadoInactivo   = "inactivo"
+	EstadoDisuelto   = "disuelto"
+)
+
+// EstadosPublicos lists the states visible to anonymous users.
+var EstadosPublicos = []string{EstadoAprobado, EstadoActivo}
+
 // Grupo represents a research group in the database.
 type Grupo struct {
 	ID                 int       `json:"idGrupo" db:"idGrupo"`
@@ -9,8 +23,10 @@ type Grupo struct {
 	NumeroResolucion   string    `json:"numeroResolucion" db:"numeroResolucion"`
 	LineaInvestigacion string    `json:"lineaInvestigacion" db:"lineaInvestigacion"`
 	TipoInvestigacion  string    `json:"tipoInvestigacion" db:"tipoInvestigacion"`
+	Facultad           *string   `json:"facultad" db:"facultad"` // Faculty the group belongs to, if known
 	FechaRegistro      time.Time `json:"fechaRegistro" db:"fechaRegistro"`
 	Archivo            *string   `json:"archivo" db:"archivo"`
+	Estado             string    `json:"estado" db:"estado"`
 	CreatedAt          time.Time `json:"createdAt" db:"createdAt"`
 	UpdatedAt          time.Time `json:"updatedAt" db:"updatedAt"`
 }
@@ -19,4 +35,18 @@ type Grupo struct {
 type GrupoWithInvestigadores struct {
 	Grupo          Grupo                `json:"grupo"`
 	Investigadores []InvestigadorConRol `json:"investigadores"`
+	Coincidencias  []FragmentoDocumento `json:"coincidencias,omitempty"` // Document excerpts matching ?contenido=
+	Relevancia     float64              `json:"relevancia,omitempty"`    // ts_rank of the ?q= match
+	Resaltado      map[string]string    `json:"resaltado,omitempty"`     // Fields matching ?q=, with <mark> around the hits
+}
+
+// GrupoEstadoHistorial records a single state transition of a group, with the reviewer's comment.
+type GrupoEstadoHistorial struct {
+	ID             int       `json:"idHistorial" db:"idHistorial"`
+	IDGrupo        int       `json:"idGrupo" db:"idGrupo"`
+	EstadoAnterior string    `json:"estadoAnterior" db:"estadoAnterior"`
+	EstadoNuevo    string    `json:"estadoNuevo" db:"estadoNuevo"`
+	Comentario     string    `json:"comentario" db:"comentario"`
+	IDUsuario      *int      `json:"idUsuario" db:"idUsuario"`
+	CreatedAt      time.Time `json:"createdAt" db:"createdAt"`
 }
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// Document categories of a group attachment.
+const (
+	CategoriaResolucion   = "resolucion"
+	CategoriaPlanTrabajo  = "plan_trabajo"
+	CategoriaInformeAnual = "informe_anual"
+	CategoriaCV           = "cv"
+	CategoriaOtro         = "otro"
+)
+
+// Visibility of a group attachment.
+const (
+	VisibilidadPublico = "publico" // Downloadable by anyone while the group is public
+	VisibilidadInterno = "interno" // Only for authenticated users or through a signed URL
+)
+
+// CategoriasArchivo lists the valid attachment categories.
+var CategoriasArchivo = []string{CategoriaResolucion, CategoriaPlanTrabajo, CategoriaInformeAnual, CategoriaCV, CategoriaOtro}
+
+// GrupoArchivo represents a document attached to a group.
+type GrupoArchivo struct {
+	ID             int       `json:"idArchivo" db:"idArchivo"`
+	IDGrupo        int       `json:"idGrupo" db:"idGrupo"`
+	Categoria      string    `json:"categoria" db:"categoria"`
+	Descripcion    string    `json:"descripcion" db:"descripcion"`
+	NombreOriginal string    `json:"nombreOriginal" db:"nombreOriginal"`
+	Ruta           string    `json:"-" db:"ruta"` // Storage path; clients download through the API
+	Tamano         int64     `json:"tamano" db:"tamano"`
+	MimeType       string    `json:"mimeType" db:"mimeType"`
+	Checksum       string    `json:"checksum" db:"checksum"` // Hex-encoded SHA-256
+	Visibilidad    string    `json:"visibilidad" db:"visibilidad"`
+	IDUsuario      *int      `json:"idUsuario" db:"idUsuario"` // Uploader
+	CreatedAt      time.Time `json:"createdAt" db:"createdAt"`
+	EstadoEscaneo  string    `json:"estadoEscaneo" db:"-"` // Malware scan state (see EscaneoPendiente)
+}
@@ -0,0 +1,38 @@
+package models
+
+// FilaImportacion reports the outcome of one row of an imported file.
+type FilaImportacion struct {
+	Fila           int      `json:"fila"` // Row number in the file, the header being row 1
+	Grupo          string   `json:"grupo,omitempty"`
+	Investigador   string   `json:"investigador,omitempty"`
+	IDGrupo        *int     `json:"idGrupo,omitempty"`        // Created group, once imported
+	IDInvestigador *int     `json:"idInvestigador,omitempty"` // Existing investigator, or the created one once imported
+	Errores        []string `json:"errores,omitempty"`        // Why the row cannot be imported
+	Avisos         []string `json:"avisos,omitempty"`         // Imported anyway, but worth checking
+}
+
+// ResultadoImportacion is the report of a bulk import of groups and investigators.
+type ResultadoImportacion struct {
+	DryRun                   bool              `json:"dryRun"`
+	Importado                bool              `json:"importado"` // Whether anything was written
+	Filas                    int               `json:"filas"`
+	FilasConError            int               `json:"filasConError"`
+	GruposNuevos             int               `json:"gruposNuevos"`
+	InvestigadoresNuevos     int               `json:"investigadoresNuevos"`
+	InvestigadoresExistentes int               `json:"investigadoresExistentes"` // Matched by name and linked instead of created
+	Integrantes              int               `json:"integrantes"`              // Group memberships
+	Detalle                  []FilaImportacion `json:"detalle"`
+}
+
+// GrupoImportado is a group to create in a bulk import, with its members.
+type GrupoImportado struct {
+	Grupo       *Grupo
+	Integrantes []IntegranteImportado
+}
+
+// IntegranteImportado is a member of an imported group. Investigador.ID is 0 for an
+// investigator created by the same import.
+type IntegranteImportado struct {
+	Investigador *Investigador
+	Rol          string
+}
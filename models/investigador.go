@@ -9,6 +9,18 @@ type Investigador struct {
 	Apellido  string    `json:"apellido" db:"apellido"`
 	CreatedAt time.Time `json:"createdAt" db:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt" db:"updatedAt"`
+
+	Relevancia float64 `json:"relevancia,omitempty" db:"-"` // ts_rank of the ?q= match
+	Resaltado  string  `json:"resaltado,omitempty" db:"-"`  // Full name with <mark> around the ?q= hits
+	Similitud  float64 `json:"similarity,omitempty" db:"-"` // Trigram similarity to ?name= (0-1)
+}
+
+// SugerenciaInvestigador is an autocomplete match for an investigator's name.
+type SugerenciaInvestigador struct {
+	ID        int     `json:"idInvestigador"`
+	Nombre    string  `json:"nombre"`
+	Apellido  string  `json:"apellido"`
+	Similitud float64 `json:"similarity"` // Trigram word similarity to the typed text (0-1)
 }
 
 // InvestigadorConRol represents an investigator with their specific role within a group.
@@ -20,3 +32,10 @@ type InvestigadorConRol struct {
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 }
+
+// MembresiaGrupo is a group an investigator belongs to, with their role in it.
+type MembresiaGrupo struct {
+	IDGrupo int    `json:"idGrupo"`
+	Nombre  string `json:"nombre"`
+	Rol     string `json:"rol"`
+}
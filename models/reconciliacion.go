@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Tables whose rows reference a stored file.
+const (
+	TablaGrupo        = "grupo"
+	TablaResolucion   = "Resolucion"
+	TablaGrupoArchivo = "Grupo_Archivo"
+)
+
+// ArchivoReferencia is a row that points to a stored file.
+type ArchivoReferencia struct {
+	Tabla string `json:"tabla"` // TablaGrupo, TablaResolucion or TablaGrupoArchivo
+	ID    int    `json:"id"`    // Primary key of the row
+	Ruta  string `json:"ruta"`
+}
+
+// ArchivoHuerfano is a stored file that no row references.
+type ArchivoHuerfano struct {
+	Ruta      string    `json:"ruta"`
+	Tamano    int64     `json:"tamano"`
+	ModTime   time.Time `json:"modTime"`
+	Eliminado bool      `json:"eliminado"`
+}
+
+// ReporteReconciliacion is the outcome of comparing stored files with the rows that reference them.
+type ReporteReconciliacion struct {
+	DryRun            bool                `json:"dryRun"`
+	ArchivosRevisados int                 `json:"archivosRevisados"`
+	Huerfanos         []ArchivoHuerfano   `json:"huerfanos"` // Files with no row
+	Faltantes         []ArchivoReferencia `json:"faltantes"` // Rows whose file is missing
+	BytesHuerfanos    int64               `json:"bytesHuerfanos"`
+}
@@ -0,0 +1,35 @@
+package models
+
+// Kinds of nodes and edges of the collaboration network.
+const (
+	NodoInvestigador   = "investigador"
+	NodoGrupo          = "grupo"
+	AristaMembresia    = "membresia"    // Investigador - Grupo, with the investigator's rol
+	AristaColaboracion = "colaboracion" // Investigador - Investigador, weighted by shared groups
+)
+
+// NodoRed is an investigator or a group of the collaboration network. ID is unique across
+// both kinds ("i12", "g3"); IDRegistro is the idInvestigador or idGrupo.
+type NodoRed struct {
+	ID                 string  `json:"id"`
+	Tipo               string  `json:"tipo"`
+	IDRegistro         int     `json:"idRegistro"`
+	Etiqueta           string  `json:"etiqueta"`
+	LineaInvestigacion string  `json:"lineaInvestigacion,omitempty"` // Groups only
+	Facultad           *string `json:"facultad,omitempty"`           // Groups only
+}
+
+// AristaRed is an undirected edge of the collaboration network between two NodoRed IDs.
+type AristaRed struct {
+	Origen  string `json:"origen"`
+	Destino string `json:"destino"`
+	Tipo    string `json:"tipo"`
+	Rol     string `json:"rol,omitempty"` // Membership edges
+	Peso    int    `json:"peso"`          // Shared groups for collaboration edges, 1 for memberships
+}
+
+// RedColaboracion is the network of investigators and the groups they share.
+type RedColaboracion struct {
+	Nodos   []NodoRed   `json:"nodos"`
+	Aristas []AristaRed `json:"aristas"`
+}
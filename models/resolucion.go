@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Resolution types issued for a research group.
+const (
+	TipoResolucionReconocimiento = "reconocimiento"
+	TipoResolucionRenovacion     = "renovacion"
+	TipoResolucionModificacion   = "modificacion"
+)
+
+// Resolucion represents an official resolution document issued for a group.
+type Resolucion struct {
+	ID               int        `json:"idResolucion" db:"idResolucion"`
+	IDGrupo          int        `json:"idGrupo" db:"idGrupo"`
+	Numero           string     `json:"numero" db:"numero"`
+	Tipo             string     `json:"tipo" db:"tipo"`
+	FechaEmision     time.Time  `json:"fechaEmision" db:"fechaEmision"`
+	FechaVencimiento *time.Time `json:"fechaVencimiento" db:"fechaVencimiento"` // nil means no expiry
+	OficinaEmisora   string     `json:"oficinaEmisora" db:"oficinaEmisora"`
+	Archivo          *string    `json:"archivo" db:"archivo"` // Path of the uploaded PDF
+	CreatedAt        time.Time  `json:"createdAt" db:"createdAt"`
+	UpdatedAt        time.Time  `json:"updatedAt" db:"updatedAt"`
+}
+
+// ResolucionesGrupo lists a group's resolutions together with its current recognition.
+type ResolucionesGrupo struct {
+	Data    []Resolucion `json:"data"`
+	Vigente *Resolucion  `json:"vigente"` // Latest valid recognition/renewal, nil if none
+}
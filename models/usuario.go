@@ -2,11 +2,19 @@ package models
 
 import "time"
 
+// Application roles stored in Usuario.Rol.
+const (
+	RolUsuario = "usuario" // Default role: registers and submits groups
+	RolRevisor = "revisor" // Research office staff: reviews and approves groups
+	RolAdmin   = "admin"   // Full access, including role management
+)
+
 // Usuario represents a user in the application database.
 type Usuario struct {
 	ID        int       `json:"idUsuario" db:"idusuario"` // Use lowercase db tag
 	Email     string    `json:"email" db:"email"`
 	Password  string    `json:"-" db:"password"` // Exclude password hash from JSON responses
+	Rol       string    `json:"rol" db:"rol"`
 	CreatedAt time.Time `json:"createdAt" db:"created_at"`
 	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
 }
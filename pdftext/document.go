@@ -0,0 +1,345 @@
+package pdftext
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Limits on the work done for one document, so that malformed or hostile uploads cannot
+// exhaust memory, the stack or the CPU. Real documents stay far below them.
+const (
+	maxStreamSize  = 32 * 1024 * 1024  // Decoded size of one stream (compression bombs)
+	maxDecodedSize = 128 * 1024 * 1024 // Decoded size of all streams, counting every decoding
+	maxTokens      = 50_000_000        // Tokens read from the file and its decoded streams
+	maxNesting     = 64                // Nested arrays and dictionaries
+	maxCMapCodes   = 1 << 17           // Codes mapped by one ToUnicode CMap
+)
+
+// ErrLimitExceeded is returned by Extract when a document exceeds one of the limits above.
+var ErrLimitExceeded = errors.New("pdftext: document exceeds processing limits")
+
+// budget is the work left for one document, shared by all its lexers.
+type budget struct {
+	tokens   int
+	decoded  int
+	exceeded bool
+}
+
+func newBudget() *budget {
+	return &budget{tokens: maxTokens, decoded: maxDecodedSize}
+}
+
+// stream is a stream object: its dictionary and its still-encoded data.
+type stream struct {
+	d   dict
+	raw []byte
+}
+
+// document indexes the objects of a PDF file. It does not rely on the cross-reference
+// table, which is often broken in scanned or re-saved files: objects are located by
+// scanning for "N G obj", later definitions winning as incremental updates would.
+type document struct {
+	data       []byte
+	objects    map[int]interface{}
+	endstreams []int // Offsets of every "endstream", for streams without a usable /Length
+	budget     *budget
+}
+
+// lexer returns a lexer over data that counts against the document's budget.
+func (doc *document) lexer(data []byte, pos int) *lexer {
+	return &lexer{data: data, pos: pos, budget: doc.budget}
+}
+
+var objHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+func parseDocument(data []byte) (*document, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, " \r\n\t"), []byte("%PDF-")) {
+		return nil, errors.New("not a PDF file")
+	}
+	doc := &document{data: data, objects: map[int]interface{}{}, budget: newBudget()}
+	for i := 0; ; {
+		j := bytes.Index(data[i:], []byte("endstream"))
+		if j < 0 {
+			break
+		}
+		doc.endstreams = append(doc.endstreams, i+j)
+		i += j + len("endstream")
+	}
+
+	offsets := map[int]int{}
+	for _, m := range objHeader.FindAllSubmatchIndex(data, -1) {
+		num, err := strconv.Atoi(string(data[m[2]:m[3]]))
+		if err != nil {
+			continue
+		}
+		offsets[num] = m[1]
+	}
+	nums := make([]int, 0, len(offsets))
+	for num := range offsets {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		doc.objects[num] = doc.parseObjectAt(offsets[num])
+	}
+
+	// Objects compressed in object streams (PDF 1.5+)
+	for _, num := range nums {
+		s, ok := doc.objects[num].(*stream)
+		if !ok || s.d["Type"] != name("ObjStm") {
+			continue
+		}
+		doc.loadObjectStream(s)
+	}
+	return doc, nil
+}
+
+// parseObjectAt parses the object that starts at offset, including stream data.
+func (doc *document) parseObjectAt(offset int) interface{} {
+	l := doc.lexer(doc.data, offset)
+	obj, ok := l.object()
+	if !ok {
+		return nil
+	}
+	d, isDict := obj.(dict)
+	if !isDict {
+		return obj
+	}
+	save := l.pos
+	if kw, ok := l.next(); !ok || kw != keyword("stream") {
+		l.pos = save
+		return d
+	}
+	// The data starts after the end of line that follows "stream"
+	start := l.pos
+	if start < len(doc.data) && doc.data[start] == '\r' {
+		start++
+	}
+	if start < len(doc.data) && doc.data[start] == '\n' {
+		start++
+	}
+	end := -1
+	if length, ok := d["Length"].(float64); ok {
+		if e := start + int(length); e >= start && e <= len(doc.data) {
+			if bytes.HasPrefix(bytes.TrimLeft(doc.data[e:], " \r\n\t"), []byte("endstream")) {
+				end = e
+			}
+		}
+	}
+	if end < 0 {
+		// Missing or indirect /Length: look for the end marker instead
+		i := sort.SearchInts(doc.endstreams, start)
+		if i == len(doc.endstreams) {
+			return d
+		}
+		end = doc.endstreams[i]
+		for end > start && (doc.data[end-1] == '\n' || doc.data[end-1] == '\r') {
+			end--
+		}
+	}
+	return &stream{d: d, raw: doc.data[start:end]}
+}
+
+// loadObjectStream adds the objects stored in an object stream, unless they are also
+// defined directly in the file.
+func (doc *document) loadObjectStream(s *stream) {
+	data, err := doc.decode(s)
+	if err != nil {
+		return
+	}
+	n, _ := doc.resolve(s.d["N"]).(float64)
+	first, _ := doc.resolve(s.d["First"]).(float64)
+	header := doc.lexer(data, 0)
+	for i := 0; i < int(n); i++ {
+		num, ok1 := header.next()
+		off, ok2 := header.next()
+		if !ok1 || !ok2 {
+			return
+		}
+		objNum, isNum := num.(float64)
+		objOff, isOff := off.(float64)
+		if !isNum || !isOff {
+			return
+		}
+		if _, exists := doc.objects[int(objNum)]; exists {
+			continue
+		}
+		l := doc.lexer(data, int(first)+int(objOff))
+		if l.pos < 0 || l.pos >= len(data) {
+			continue
+		}
+		if obj, ok := l.object(); ok {
+			doc.objects[int(objNum)] = obj
+		}
+	}
+}
+
+// resolve follows indirect references.
+func (doc *document) resolve(obj interface{}) interface{} {
+	for i := 0; i < 32; i++ {
+		r, ok := obj.(ref)
+		if !ok {
+			return obj
+		}
+		obj = doc.objects[r.num]
+	}
+	return nil
+}
+
+func (doc *document) dict(obj interface{}) dict {
+	switch v := doc.resolve(obj).(type) {
+	case dict:
+		return v
+	case *stream:
+		return v.d
+	}
+	return nil
+}
+
+// decode returns the decoded data of a stream. Only FlateDecode is supported; it covers
+// the content streams, fonts' ToUnicode maps and object streams of practically every
+// text-bearing PDF. Every decoding counts against the document's budget, including
+// unfiltered streams, since a form XObject may be drawn many times.
+func (doc *document) decode(s *stream) ([]byte, error) {
+	var filters []interface{}
+	switch f := doc.resolve(s.d["Filter"]).(type) {
+	case name:
+		filters = []interface{}{f}
+	case array:
+		filters = f
+	}
+	data := s.raw
+	for _, f := range filters {
+		switch doc.resolve(f) {
+		case name("FlateDecode"), name("Fl"):
+			zr, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, fmt.Errorf("invalid FlateDecode stream: %w", err)
+			}
+			limit := min(maxStreamSize, doc.budget.decoded)
+			decoded, err := io.ReadAll(io.LimitReader(zr, int64(limit)+1))
+			zr.Close()
+			if len(decoded) > limit {
+				doc.budget.exceeded = true
+				return nil, ErrLimitExceeded
+			}
+			if err != nil && len(decoded) == 0 {
+				return nil, fmt.Errorf("invalid FlateDecode stream: %w", err)
+			}
+			// Keep what was decoded from truncated streams
+			data = decoded
+		default:
+			return nil, fmt.Errorf("unsupported stream filter %v", f)
+		}
+	}
+	if len(data) > doc.budget.decoded {
+		doc.budget.exceeded = true
+		return nil, ErrLimitExceeded
+	}
+	doc.budget.decoded -= len(data)
+	return data, nil
+}
+
+// catalog returns the document catalog, or nil if there is none.
+func (doc *document) catalog() dict {
+	var catalog dict
+	maxNum := -1
+	for num, obj := range doc.objects {
+		if d, ok := obj.(dict); ok && d["Type"] == name("Catalog") && num > maxNum {
+			catalog, maxNum = d, num
+		}
+	}
+	return catalog
+}
+
+// page is a page's content together with its (possibly inherited) resources.
+type page struct {
+	d         dict
+	resources dict
+}
+
+// pages returns the pages in reading order, walking the page tree. Files without a usable
+// page tree fall back to every page object in object-number order.
+func (doc *document) pages() []page {
+	var result []page
+	visited := map[interface{}]bool{}
+	var walk func(node interface{}, inherited dict, depth int)
+	walk = func(node interface{}, inherited dict, depth int) {
+		if depth > 64 {
+			return
+		}
+		if r, ok := node.(ref); ok {
+			if visited[r] {
+				return
+			}
+			visited[r] = true
+		}
+		d := doc.dict(node)
+		if d == nil {
+			return
+		}
+		resources := inherited
+		if res := doc.dict(d["Resources"]); res != nil {
+			resources = res
+		}
+		if d["Type"] == name("Page") {
+			result = append(result, page{d: d, resources: resources})
+			return
+		}
+		if kids, ok := doc.resolve(d["Kids"]).(array); ok {
+			for _, kid := range kids {
+				walk(kid, resources, depth+1)
+			}
+		}
+	}
+	if catalog := doc.catalog(); catalog != nil {
+		walk(catalog["Pages"], nil, 0)
+	}
+	if len(result) > 0 {
+		return result
+	}
+
+	nums := make([]int, 0, len(doc.objects))
+	for num, obj := range doc.objects {
+		if d, ok := obj.(dict); ok && d["Type"] == name("Page") {
+			nums = append(nums, num)
+		}
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		d := doc.objects[num].(dict)
+		result = append(result, page{d: d, resources: doc.dict(d["Resources"])})
+	}
+	return result
+}
+
+// contents returns the decoded content streams of a page, concatenated.
+func (doc *document) contents(p page) []byte {
+	var parts []interface{}
+	switch c := doc.resolve(p.d["Contents"]).(type) {
+	case *stream:
+		parts = []interface{}{c}
+	case array:
+		parts = c
+	}
+	var b bytes.Buffer
+	for _, part := range parts {
+		s, ok := doc.resolve(part).(*stream)
+		if !ok {
+			continue
+		}
+		data, err := doc.decode(s)
+		if err != nil {
+			continue
+		}
+		b.Write(data)
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,336 @@
+package pdftext
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// font turns the bytes of a shown string into text.
+type font struct {
+	cmap      *cmap       // From /ToUnicode, when present
+	simple    [256]string // Single-byte encoding of simple fonts
+	composite bool        // Type0 font without ToUnicode: codes cannot be mapped
+}
+
+func (f *font) decode(s []byte) string {
+	if f == nil {
+		return latin1(s)
+	}
+	if f.cmap != nil {
+		return f.cmap.decode(s)
+	}
+	if f.composite {
+		return ""
+	}
+	var b strings.Builder
+	for _, c := range s {
+		b.WriteString(f.simple[c])
+	}
+	return b.String()
+}
+
+// loadFont builds the decoder of a font dictionary.
+func (doc *document) loadFont(d dict) *font {
+	f := &font{}
+	if s, ok := doc.resolve(d["ToUnicode"]).(*stream); ok {
+		if data, err := doc.decode(s); err == nil {
+			f.cmap = parseCMap(doc.lexer(data, 0))
+		}
+	}
+	if f.cmap != nil && len(f.cmap.mapping) > 0 {
+		return f
+	}
+	f.cmap = nil
+	if d["Subtype"] == name("Type0") {
+		f.composite = true
+		return f
+	}
+
+	base := winAnsi
+	var differences array
+	switch enc := doc.resolve(d["Encoding"]).(type) {
+	case name:
+		if enc == "MacRomanEncoding" {
+			base = macRoman
+		}
+	case dict:
+		if doc.resolve(enc["BaseEncoding"]) == name("MacRomanEncoding") {
+			base = macRoman
+		}
+		differences, _ = doc.resolve(enc["Differences"]).(array)
+	}
+	for i := 0; i < 256; i++ {
+		f.simple[i] = base(byte(i))
+	}
+	code := 0
+	for _, item := range differences {
+		switch v := doc.resolve(item).(type) {
+		case float64:
+			code = int(v)
+		case name:
+			if code >= 0 && code < 256 {
+				if r, ok := glyphToUnicode(string(v)); ok {
+					f.simple[code] = r
+				}
+			}
+			code++
+		}
+	}
+	return f
+}
+
+// cmap is a parsed ToUnicode CMap.
+type cmap struct {
+	codeLengths []int // Byte lengths of the codes, from the codespace ranges
+	mapping     map[string]string
+}
+
+// parseCMap reads the codespace ranges and the bfchar/bfrange mappings of a CMap. At most
+// maxCMapCodes codes are mapped; bfrange entries can otherwise describe billions of them.
+func parseCMap(l *lexer) *cmap {
+	c := &cmap{mapping: map[string]string{}}
+	lengths := map[int]bool{}
+	codes := 0
+	var operands []interface{}
+	for codes <= maxCMapCodes {
+		tok, ok := l.next()
+		if !ok {
+			break
+		}
+		kw, isKeyword := tok.(keyword)
+		if !isKeyword {
+			operands = append(operands, tok)
+			continue
+		}
+		switch kw {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				if lo, ok := operands[i].([]byte); ok && len(lo) > 0 {
+					lengths[len(lo)] = true
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].([]byte)
+				dst, ok2 := operands[i+1].([]byte)
+				if ok1 && ok2 {
+					c.mapping[string(src)] = utf16BE(dst)
+					codes++
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].([]byte)
+				hi, ok2 := operands[i+1].([]byte)
+				if !ok1 || !ok2 || len(lo) != len(hi) || len(lo) == 0 || len(lo) > 4 {
+					continue
+				}
+				start, end := bytesToInt(lo), bytesToInt(hi)
+				if end < start || end-start > 65535 {
+					continue
+				}
+				if codes += end - start + 1; codes > maxCMapCodes {
+					break
+				}
+				switch dst := operands[i+2].(type) {
+				case []byte:
+					for code := start; code <= end; code++ {
+						c.mapping[string(intToBytes(code, len(lo)))] = utf16BE(incrementLast(dst, code-start))
+					}
+				case array:
+					for j, item := range dst {
+						if s, ok := item.([]byte); ok && start+j <= end {
+							c.mapping[string(intToBytes(start+j, len(lo)))] = utf16BE(s)
+						}
+					}
+				}
+			}
+		}
+		if strings.HasPrefix(string(kw), "begin") || strings.HasPrefix(string(kw), "end") {
+			operands = operands[:0]
+		}
+	}
+	if codes > maxCMapCodes && l.budget != nil {
+		l.budget.exceeded = true
+	}
+	for n := range lengths {
+		c.codeLengths = append(c.codeLengths, n)
+	}
+	if len(c.codeLengths) == 0 {
+		for code := range c.mapping {
+			lengths[len(code)] = true
+		}
+		for n := range lengths {
+			c.codeLengths = append(c.codeLengths, n)
+		}
+	}
+	return c
+}
+
+// decode maps each code of s, trying the shortest code length first.
+func (c *cmap) decode(s []byte) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		matched := false
+		for n := 1; n <= 4 && i+n <= len(s); n++ {
+			if !c.hasLength(n) {
+				continue
+			}
+			if text, ok := c.mapping[string(s[i:i+n])]; ok {
+				b.WriteString(text)
+				i += n
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			// Unmapped code: skip it using the longest code length
+			step := 1
+			for _, n := range c.codeLengths {
+				if n > step {
+					step = n
+				}
+			}
+			i += step
+		}
+	}
+	return b.String()
+}
+
+func (c *cmap) hasLength(n int) bool {
+	for _, l := range c.codeLengths {
+		if l == n {
+			return true
+		}
+	}
+	return false
+}
+
+func bytesToInt(b []byte) int {
+	v := 0
+	for _, c := range b {
+		v = v<<8 | int(c)
+	}
+	return v
+}
+
+func intToBytes(v, n int) []byte {
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return b
+}
+
+// incrementLast adds delta to the last code unit of a bfrange destination, as the CMap
+// spec requires.
+func incrementLast(b []byte, delta int) []byte {
+	out := append([]byte(nil), b...)
+	n := len(out)
+	switch {
+	case n == 1:
+		out[0] += byte(delta)
+	case n >= 2:
+		v := (int(out[n-2])<<8 | int(out[n-1])) + delta
+		out[n-2], out[n-1] = byte(v>>8), byte(v)
+	}
+	return out
+}
+
+func utf16BE(b []byte) string {
+	if len(b)%2 != 0 {
+		return latin1(b)
+	}
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+	}
+	return string(utf16.Decode(units))
+}
+
+func latin1(b []byte) string {
+	if len(b) >= 2 && b[0] == 0xFE && b[1] == 0xFF {
+		return utf16BE(b[2:])
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// winAnsiHigh maps the 0x80-0x9F range of WinAnsiEncoding (Windows-1252).
+var winAnsiHigh = [32]rune{
+	'€', 0, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0, 'Ž', 0,
+	0, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0, 'ž', 'Ÿ',
+}
+
+func winAnsi(c byte) string {
+	if c >= 0x80 && c <= 0x9F {
+		if r := winAnsiHigh[c-0x80]; r != 0 {
+			return string(r)
+		}
+		return ""
+	}
+	if c < 0x20 && c != '\t' && c != '\n' && c != '\r' {
+		return ""
+	}
+	return string(rune(c))
+}
+
+// macRomanHigh maps the 0x80-0xFF range of MacRomanEncoding; only letters used in
+// Spanish and common punctuation are listed.
+var macRomanHigh = map[byte]rune{
+	0x80: 'Ä', 0x81: 'Å', 0x82: 'Ç', 0x83: 'É', 0x84: 'Ñ', 0x85: 'Ö', 0x86: 'Ü', 0x87: 'á',
+	0x88: 'à', 0x89: 'â', 0x8A: 'ä', 0x8B: 'ã', 0x8C: 'å', 0x8D: 'ç', 0x8E: 'é', 0x8F: 'è',
+	0x90: 'ê', 0x91: 'ë', 0x92: 'í', 0x93: 'ì', 0x94: 'î', 0x95: 'ï', 0x96: 'ñ', 0x97: 'ó',
+	0x98: 'ò', 0x99: 'ô', 0x9A: 'ö', 0x9B: 'õ', 0x9C: 'ú', 0x9D: 'ù', 0x9E: 'û', 0x9F: 'ü',
+	0xA5: '•', 0xC0: '¿', 0xC1: '¡', 0xC7: '«', 0xC8: '»', 0xC9: '…', 0xCA: ' ', 0xD0: '–',
+	0xD1: '—', 0xD2: '“', 0xD3: '”', 0xD4: '‘', 0xD5: '’', 0xE7: 'Á', 0xEA: 'Í', 0xEE: 'Ó',
+	0xF2: 'Ú',
+}
+
+func macRoman(c byte) string {
+	if c >= 0x80 {
+		if r, ok := macRomanHigh[c]; ok {
+			return string(r)
+		}
+		return ""
+	}
+	return winAnsi(c)
+}
+
+// glyphNames maps the Adobe glyph names found in /Differences arrays of Spanish
+// documents. Single letters and digits are handled in glyphToUnicode.
+var glyphNames = map[string]string{
+	"space": " ", "exclam": "!", "quotedbl": "\"", "numbersign": "#", "dollar": "$", "percent": "%",
+	"ampersand": "&", "quotesingle": "'", "quoteright": "’", "quoteleft": "‘", "parenleft": "(",
+	"parenright": ")", "asterisk": "*", "plus": "+", "comma": ",", "hyphen": "-", "period": ".",
+	"slash": "/", "colon": ":", "semicolon": ";", "less": "<", "equal": "=", "greater": ">",
+	"question": "?", "at": "@", "bracketleft": "[", "backslash": "\\", "bracketright": "]",
+	"underscore": "_", "quotedblleft": "“", "quotedblright": "”", "endash": "–", "emdash": "—",
+	"bullet": "•", "ellipsis": "…", "degree": "°", "ordfeminine": "ª", "ordmasculine": "º",
+	"questiondown": "¿", "exclamdown": "¡", "guillemotleft": "«", "guillemotright": "»",
+	"aacute": "á", "eacute": "é", "iacute": "í", "oacute": "ó", "uacute": "ú", "ntilde": "ñ",
+	"Aacute": "Á", "Eacute": "É", "Iacute": "Í", "Oacute": "Ó", "Uacute": "Ú", "Ntilde": "Ñ",
+	"udieresis": "ü", "Udieresis": "Ü", "ccedilla": "ç", "Ccedilla": "Ç",
+	"zero": "0", "one": "1", "two": "2", "three": "3", "four": "4", "five": "5", "six": "6",
+	"seven": "7", "eight": "8", "nine": "9", "fi": "fi", "fl": "fl", "ff": "ff",
+}
+
+func glyphToUnicode(glyph string) (string, bool) {
+	if len(glyph) == 1 && ((glyph[0] >= 'a' && glyph[0] <= 'z') || (glyph[0] >= 'A' && glyph[0] <= 'Z')) {
+		return glyph, true
+	}
+	if s, ok := glyphNames[glyph]; ok {
+		return s, true
+	}
+	if strings.HasPrefix(glyph, "uni") && len(glyph) == 7 {
+		if v, err := strconv.ParseUint(glyph[3:], 16, 16); err == nil {
+			return string(rune(v)), true
+		}
+	}
+	return "", false
+}
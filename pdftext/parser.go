@@ -0,0 +1,320 @@
+package pdftext
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// PDF object types produced by the parser.
+type (
+	name  string
+	dict  map[string]interface{}
+	array []interface{}
+	ref   struct{ num, gen int }
+	// keyword is a bare word such as an operator in a content stream, "obj" or "R".
+	keyword string
+)
+
+// lexer reads PDF tokens and objects from a byte slice. A lexer with a budget stops, as if
+// at the end of the data, once the budget runs out or containers nest too deeply.
+type lexer struct {
+	data   []byte
+	pos    int
+	depth  int // Nesting of the array or dictionary being parsed
+	budget *budget
+}
+
+// spend counts one token against the budget and reports whether there was any left.
+func (l *lexer) spend() bool {
+	if l.budget == nil {
+		return true
+	}
+	if l.budget.tokens <= 0 {
+		l.budget.exceeded = true
+		return false
+	}
+	l.budget.tokens--
+	return true
+}
+
+// enter starts parsing a nested container. Past maxNesting the rest of the data is
+// skipped: only hostile files nest that deep, and recursing further could exhaust the stack.
+func (l *lexer) enter() bool {
+	l.depth++
+	if l.depth > maxNesting {
+		if l.budget != nil {
+			l.budget.exceeded = true
+		}
+		l.pos = len(l.data)
+		return false
+	}
+	return true
+}
+
+func isWhitespace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isDelimiter(c byte) bool {
+	return c == '(' || c == ')' || c == '<' || c == '>' || c == '[' || c == ']' || c == '{' || c == '}' || c == '/' || c == '%'
+}
+
+// skipSpace skips whitespace and comments.
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isWhitespace(c) {
+			l.pos++
+		} else if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		} else {
+			return
+		}
+	}
+}
+
+// endOfArray and endOfDict mark the closing delimiters while parsing containers.
+type endOfArray struct{}
+type endOfDict struct{}
+
+// next returns the next token as an object. It returns nil, false at the end of the data.
+// Indirect references ("1 0 R") are not recognized here; see object.
+func (l *lexer) next() (interface{}, bool) {
+	l.skipSpace()
+	if l.pos >= len(l.data) || !l.spend() {
+		return nil, false
+	}
+	c := l.data[l.pos]
+	switch {
+	case c == '/':
+		l.pos++
+		start := l.pos
+		for l.pos < len(l.data) && !isWhitespace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+			l.pos++
+		}
+		return name(decodeName(l.data[start:l.pos])), true
+	case c == '(':
+		return l.literalString(), true
+	case c == '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return l.dictBody(), true
+		}
+		return l.hexString(), true
+	case c == '>':
+		l.pos++
+		if l.pos < len(l.data) && l.data[l.pos] == '>' {
+			l.pos++
+		}
+		return endOfDict{}, true
+	case c == '[':
+		l.pos++
+		return l.arrayBody(), true
+	case c == ']':
+		l.pos++
+		return endOfArray{}, true
+	case c == '{' || c == '}' || c == ')':
+		l.pos++
+		return keyword(string(c)), true
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && !isWhitespace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+	switch word {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	case "null":
+		return nil, true
+	}
+	if f, err := strconv.ParseFloat(word, 64); err == nil {
+		return f, true
+	}
+	return keyword(word), true
+}
+
+// object parses the next object, combining "num gen R" into a ref.
+func (l *lexer) object() (interface{}, bool) {
+	obj, ok := l.next()
+	if !ok {
+		return nil, false
+	}
+	if num, isNum := obj.(float64); isNum {
+		save := l.pos
+		if gen, ok := l.next(); ok {
+			if g, isNum := gen.(float64); isNum {
+				if kw, ok := l.next(); ok && kw == keyword("R") {
+					return ref{int(num), int(g)}, true
+				}
+			}
+		}
+		l.pos = save
+	}
+	return obj, true
+}
+
+func (l *lexer) arrayBody() array {
+	a := array{}
+	defer func() { l.depth-- }()
+	if !l.enter() {
+		return a
+	}
+	for {
+		obj, ok := l.object()
+		if !ok {
+			return a
+		}
+		if _, end := obj.(endOfArray); end {
+			return a
+		}
+		a = append(a, obj)
+	}
+}
+
+func (l *lexer) dictBody() dict {
+	d := dict{}
+	defer func() { l.depth-- }()
+	if !l.enter() {
+		return d
+	}
+	for {
+		key, ok := l.next()
+		if !ok {
+			return d
+		}
+		if _, end := key.(endOfDict); end {
+			return d
+		}
+		k, isName := key.(name)
+		if !isName {
+			continue // Malformed; resynchronize on the next name
+		}
+		value, ok := l.object()
+		if !ok {
+			return d
+		}
+		if _, end := value.(endOfDict); end {
+			return d
+		}
+		d[string(k)] = value
+	}
+}
+
+func (l *lexer) literalString() []byte {
+	l.pos++ // (
+	var b bytes.Buffer
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return b.Bytes()
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return b.Bytes()
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue // Line continuation
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		b.WriteByte(c)
+	}
+	return b.Bytes()
+}
+
+func (l *lexer) hexString() []byte {
+	l.pos++ // <
+	var b []byte
+	var digit int = -1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		if c == '>' {
+			break
+		}
+		v := unhex(c)
+		if v < 0 {
+			continue
+		}
+		if digit < 0 {
+			digit = v
+		} else {
+			b = append(b, byte(digit<<4|v))
+			digit = -1
+		}
+	}
+	if digit >= 0 {
+		b = append(b, byte(digit<<4))
+	}
+	return b
+}
+
+func unhex(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'f':
+		return int(c-'a') + 10
+	case c >= 'A' && c <= 'F':
+		return int(c-'A') + 10
+	}
+	return -1
+}
+
+// decodeName resolves #xx escapes in a name.
+func decodeName(b []byte) string {
+	if bytes.IndexByte(b, '#') < 0 {
+		return string(b)
+	}
+	var out []byte
+	for i := 0; i < len(b); i++ {
+		if b[i] == '#' && i+2 < len(b) && unhex(b[i+1]) >= 0 && unhex(b[i+2]) >= 0 {
+			out = append(out, byte(unhex(b[i+1])<<4|unhex(b[i+2])))
+			i += 2
+			continue
+		}
+		out = append(out, b[i])
+	}
+	return string(out)
+}
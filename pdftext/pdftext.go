@@ -0,0 +1,237 @@
+// Package pdftext extracts plain text from PDF files so they can be indexed for search.
+//
+// It is a best-effort extractor: it reads the text shown on each page (including form
+// XObjects), mapping character codes through the fonts' ToUnicode maps or their simple
+// encodings. Scanned documents without a text layer yield no text, and content encoded
+// with filters other than FlateDecode is skipped.
+//
+// The extractor is written here rather than wrapping pdftotext or a cgo binding because
+// the service ships as a single static binary: the image has no poppler, and indexing
+// must not depend on a tool that deployments may lack. It only needs the text operators,
+// not layout or rendering, which keeps it small. Every document runs under a fixed budget
+// (see the limits in document.go) tested against compression bombs, deep nesting and
+// truncated files; the recover in the extraction job is a last line of defense that turns
+// an unexpected panic into an error for that file, not the way limits are enforced.
+package pdftext
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+)
+
+// Extract returns the text of a PDF file, one line per text line and a blank line
+// between pages. Documents that would take too much memory or time to process (deep
+// nesting, compression bombs, huge CMaps) fail with ErrLimitExceeded.
+func Extract(data []byte) (string, error) {
+	doc, err := parseDocument(data)
+	if err != nil {
+		return "", err
+	}
+	var pages []string
+	for _, p := range doc.pages() {
+		if doc.budget.exceeded {
+			break
+		}
+		e := &extractor{doc: doc, fonts: map[interface{}]*font{}}
+		e.run(doc.contents(p), p.resources, 0)
+		if text := e.text(); text != "" {
+			pages = append(pages, text)
+		}
+	}
+	if doc.budget.exceeded {
+		return "", ErrLimitExceeded
+	}
+	return strings.Join(pages, "\n\n"), nil
+}
+
+// maxFormDepth bounds nested form XObjects.
+const maxFormDepth = 8
+
+// extractor interprets the text operators of content streams.
+type extractor struct {
+	doc   *document
+	fonts map[interface{}]*font // Cache by font object
+	out   strings.Builder
+	font  *font
+}
+
+func (e *extractor) write(s string) {
+	e.out.WriteString(s)
+}
+
+// space adds a separator unless the output already ends with one.
+func (e *extractor) space(sep string) {
+	text := e.out.String()
+	if text == "" {
+		return
+	}
+	last := text[len(text)-1]
+	if last == '\n' || (sep == " " && last == ' ') {
+		return
+	}
+	e.out.WriteString(sep)
+}
+
+// text returns the extracted text with blank runs collapsed and control characters removed.
+func (e *extractor) text() string {
+	lines := strings.Split(e.out.String(), "\n")
+	cleaned := lines[:0]
+	for _, line := range lines {
+		line = strings.Map(func(r rune) rune {
+			if unicode.IsControl(r) && !unicode.IsSpace(r) {
+				return -1
+			}
+			return r
+		}, line)
+		line = strings.Join(strings.FieldsFunc(line, unicode.IsSpace), " ")
+		if line != "" {
+			cleaned = append(cleaned, line)
+		}
+	}
+	return strings.Join(cleaned, "\n")
+}
+
+func (e *extractor) fontFor(resources dict, fontName name) *font {
+	fonts := e.doc.dict(resources["Font"])
+	if fonts == nil {
+		return nil
+	}
+	obj := fonts[string(fontName)]
+	key := interface{}(string(fontName))
+	if r, ok := obj.(ref); ok {
+		key = r
+	}
+	if f, ok := e.fonts[key]; ok {
+		return f
+	}
+	d := e.doc.dict(obj)
+	if d == nil {
+		return nil
+	}
+	f := e.doc.loadFont(d)
+	e.fonts[key] = f
+	return f
+}
+
+// run interprets one content stream with the given resources.
+func (e *extractor) run(content []byte, resources dict, depth int) {
+	l := e.doc.lexer(content, 0)
+	var operands []interface{}
+	for {
+		tok, ok := l.object()
+		if !ok {
+			return
+		}
+		op, isOp := tok.(keyword)
+		if !isOp {
+			operands = append(operands, tok)
+			continue
+		}
+
+		switch op {
+		case "Tf":
+			if len(operands) >= 2 {
+				if fontName, ok := operands[len(operands)-2].(name); ok {
+					e.font = e.fontFor(resources, fontName)
+				}
+			}
+		case "Tj":
+			e.show(operands)
+		case "'", "\"":
+			e.space("\n")
+			e.show(operands)
+		case "TJ":
+			if len(operands) > 0 {
+				if items, ok := operands[len(operands)-1].(array); ok {
+					for _, item := range items {
+						switch v := item.(type) {
+						case []byte:
+							e.write(e.font.decode(v))
+						case float64:
+							// Large negative adjustments separate words
+							if v < -200 {
+								e.space(" ")
+							}
+						}
+					}
+				}
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				if ty, ok := operands[len(operands)-1].(float64); ok && ty != 0 {
+					e.space("\n")
+				} else {
+					e.space(" ")
+				}
+			}
+		case "T*", "Tm":
+			e.space("\n")
+		case "ET":
+			e.space(" ")
+		case "BI":
+			skipInlineImage(l)
+		case "Do":
+			if depth < maxFormDepth && len(operands) > 0 {
+				if xname, ok := operands[len(operands)-1].(name); ok {
+					e.form(resources, xname, depth)
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+func (e *extractor) show(operands []interface{}) {
+	if len(operands) == 0 {
+		return
+	}
+	if s, ok := operands[len(operands)-1].([]byte); ok {
+		e.write(e.font.decode(s))
+	}
+}
+
+// form extracts the text of a form XObject drawn with Do.
+func (e *extractor) form(resources dict, xname name, depth int) {
+	xobjects := e.doc.dict(resources["XObject"])
+	if xobjects == nil {
+		return
+	}
+	s, ok := e.doc.resolve(xobjects[string(xname)]).(*stream)
+	if !ok || s.d["Subtype"] != name("Form") {
+		return
+	}
+	data, err := e.doc.decode(s)
+	if err != nil {
+		return
+	}
+	formResources := resources
+	if res := e.doc.dict(s.d["Resources"]); res != nil {
+		formResources = res
+	}
+	saved := e.font
+	e.run(data, formResources, depth+1)
+	e.font = saved
+}
+
+// skipInlineImage moves past the binary data of an inline image (BI ... ID data EI).
+func skipInlineImage(l *lexer) {
+	i := bytes.Index(l.data[l.pos:], []byte("ID"))
+	if i < 0 {
+		l.pos = len(l.data)
+		return
+	}
+	l.pos += i + 2
+	for l.pos < len(l.data) {
+		j := bytes.Index(l.data[l.pos:], []byte("EI"))
+		if j < 0 {
+			l.pos = len(l.data)
+			return
+		}
+		end := l.pos + j
+		l.pos = end + 2
+		if end > 0 && isWhitespace(l.data[end-1]) && (l.pos >= len(l.data) || isWhitespace(l.data[l.pos])) {
+			return
+		}
+	}
+}
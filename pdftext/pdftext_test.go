@@ -0,0 +1,266 @@
+package pdftext
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// fpdfDocument returns a PDF written by fpdf, the library that generates the reports,
+// with one page per entry of pages. Content streams are compressed.
+func fpdfDocument(t *testing.T, pages ...[]string) []byte {
+	t.Helper()
+	pdf := fpdf.New("P", "mm", "A4", "")
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.SetFont("Helvetica", "", 12)
+	for _, lines := range pages {
+		pdf.AddPage()
+		for _, line := range lines {
+			pdf.CellFormat(0, 8, tr(line), "", 1, "L", false, 0, "")
+		}
+	}
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// pdfFile joins the given objects, numbered from 1, into a PDF file. Extract does not
+// need a cross-reference table, so none is written.
+func pdfFile(objects ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.5\n")
+	for i, obj := range objects {
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	b.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return b.Bytes()
+}
+
+func streamObject(dict string, data []byte) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func deflate(data []byte) []byte {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	w.Write(data)
+	w.Close()
+	return b.Bytes()
+}
+
+// onePage returns the objects of a single-page document whose page uses font F1 and
+// draws content, followed by extra objects numbered from 5.
+func onePage(font, content string, extra ...string) []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 " + font + " >> /XObject << /X1 5 0 R >> >> /Contents 4 0 R >>",
+		streamObject("", []byte(content)),
+	}
+	return pdfFile(append(objects, extra...)...)
+}
+
+const helvetica = "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>"
+
+func TestExtract(t *testing.T) {
+	toUnicode := "/CIDInit /ProcSet findresource begin 12 dict begin begincmap\n" +
+		"1 begincodespacerange <0000> <FFFF> endcodespacerange\n" +
+		"2 beginbfchar <0001> <0048> <0002> <00ED> endbfchar\n" +
+		"1 beginbfrange <0010> <0012> <0061> endbfrange\n" +
+		"endcmap CMapName currentdict /CMap defineresource pop end end"
+	objStm := []byte("6 0 7 30 " +
+		"<< /Type /Catalog /Pages 7 0 R >> " +
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>")
+
+	tests := []struct {
+		name string
+		pdf  []byte
+		want string
+	}{
+		{
+			name: "fpdf report with accents",
+			pdf:  fpdfDocument(t, []string{"Informe de avance", "Investigación en señales"}),
+			want: "Informe de avance\nInvestigación en señales",
+		},
+		{
+			name: "fpdf pages",
+			pdf:  fpdfDocument(t, []string{"Primera página"}, []string{"Segunda página"}),
+			want: "Primera página\n\nSegunda página",
+		},
+		{
+			name: "literal strings and TJ spacing",
+			pdf:  onePage(helvetica, `BT /F1 12 Tf 72 720 Td (Grupo \(GI\)) Tj 0 -14 Td [(Red)-300(de)-300(colabora)10(ci\363n)] TJ ET`),
+			want: "Grupo (GI)\nRed de colaboración",
+		},
+		{
+			name: "compressed content",
+			pdf: pdfFile(
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+				"<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 5 0 R >> >> /Contents 4 0 R >>",
+				streamObject("/Filter /FlateDecode", deflate([]byte("BT /F1 12 Tf (Comprimido) Tj ET"))),
+				helvetica,
+			),
+			want: "Comprimido",
+		},
+		{
+			name: "ToUnicode CMap",
+			pdf: onePage("6 0 R", "BT /F1 12 Tf <00010002001000110012> Tj ET",
+				"null",
+				"<< /Type /Font /Subtype /Type0 /BaseFont /Custom /ToUnicode 7 0 R >>",
+				streamObject("", []byte(toUnicode)),
+			),
+			want: "Híabc",
+		},
+		{
+			name: "Type0 font without ToUnicode yields nothing",
+			pdf:  onePage("<< /Type /Font /Subtype /Type0 /BaseFont /Custom >>", "BT /F1 12 Tf <0001> Tj ET"),
+			want: "",
+		},
+		{
+			name: "Differences encoding",
+			pdf:  onePage("<< /Type /Font /Subtype /Type1 /Encoding << /Differences [65 /ntilde /uni00E1] >> >>", "BT /F1 12 Tf (AB) Tj ET"),
+			want: "ñá",
+		},
+		{
+			name: "form XObject",
+			pdf: onePage(helvetica, "BT /F1 12 Tf (Cuerpo) Tj ET /X1 Do",
+				streamObject("/Type /XObject /Subtype /Form", []byte("BT /F1 12 Tf 0 -14 Td (Pie de p\\341gina) Tj ET")),
+			),
+			want: "Cuerpo\nPie de página",
+		},
+		{
+			name: "inline image is skipped",
+			pdf:  onePage(helvetica, "BI /W 2 /H 1 /BPC 8 /CS /G ID \x00(Tj)\xff EI BT /F1 12 Tf (Texto) Tj ET"),
+			want: "Texto",
+		},
+		{
+			name: "stream without Length",
+			pdf: pdfFile(
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+				"<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 5 0 R >> >> /Contents 4 0 R >>",
+				"<< /Length 99 0 R >>\nstream\nBT /F1 12 Tf (Sin longitud) Tj ET\nendstream",
+				helvetica,
+			),
+			want: "Sin longitud",
+		},
+		{
+			name: "object stream",
+			pdf: pdfFile(
+				"<< /Type /Catalog /Pages 99 0 R >>", // Superseded by the catalog in the object stream
+				"null",
+				"<< /Type /Page /Parent 7 0 R /Resources << /Font << /F1 5 0 R >> >> /Contents 4 0 R >>",
+				streamObject("", []byte("BT /F1 12 Tf (Objetos comprimidos) Tj ET")),
+				helvetica,
+				"null",
+				"null",
+				"null",
+				streamObject("/Type /ObjStm /N 2 /First 9 /Filter /FlateDecode", deflate(objStm)),
+			),
+			want: "Objetos comprimidos",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Extract(tt.pdf)
+			if err != nil {
+				t.Fatalf("Extract error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Extract = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractMalformed(t *testing.T) {
+	zero := make([]byte, maxStreamSize+1)
+	bomb := deflate(zero)
+	cmapBomb := "1 begincodespacerange <0000> <FFFF> endcodespacerange\n" +
+		strings.Repeat("1 beginbfrange <0000> <FFFF> <0041> endbfrange\n", 4)
+
+	tests := []struct {
+		name    string
+		pdf     []byte
+		wantErr error // nil when any error, or none, is acceptable
+	}{
+		{name: "empty", pdf: nil},
+		{name: "not a PDF", pdf: []byte("PK\x03\x04 word/document.xml")},
+		{name: "header only", pdf: []byte("%PDF-1.7\n")},
+		{name: "unterminated string", pdf: onePage(helvetica, "BT /F1 12 Tf (sin cierre Tj ET")},
+		{name: "unterminated dictionary", pdf: []byte("%PDF-1.4\n1 0 obj\n<< /Type /Catalog /Pages << /Kids [")},
+		{name: "invalid compressed data", pdf: onePage(helvetica, "", streamObject("/Filter /FlateDecode", []byte("no es zlib")))},
+		{name: "unsupported filter", pdf: pdfFile("<< /Type /Catalog >>", streamObject("/Type /ObjStm /N 1 /First 0 /Filter /DCTDecode", []byte{0xFF, 0xD8}))},
+		{name: "page tree cycle", pdf: pdfFile("<< /Type /Catalog /Pages 2 0 R >>", "<< /Type /Pages /Kids [2 0 R 1 0 R] >>")},
+		{name: "reference cycle", pdf: pdfFile("<< /Type /Catalog /Pages 2 0 R >>", "3 0 R", "2 0 R")},
+		{name: "self-drawing form", pdf: onePage(helvetica, "/X1 Do", streamObject("/Subtype /Form", []byte("/X1 Do /X1 Do (x) Tj")))},
+		{
+			name:    "deep nesting",
+			pdf:     []byte("%PDF-1.4\n1 0 obj\n" + strings.Repeat("[", 1_000_000) + "\nendobj\n"),
+			wantErr: ErrLimitExceeded,
+		},
+		{
+			name:    "deep dictionary nesting in content",
+			pdf:     onePage(helvetica, strings.Repeat("<< /A ", 100_000)),
+			wantErr: ErrLimitExceeded,
+		},
+		{
+			name:    "compression bomb",
+			pdf:     onePage(helvetica, "/X1 Do", streamObject("/Subtype /Form /Filter /FlateDecode", bomb)),
+			wantErr: ErrLimitExceeded,
+		},
+		{
+			name:    "CMap bomb",
+			pdf:     onePage("6 0 R", "BT /F1 12 Tf <0000> Tj ET", "null", "<< /Type /Font /Subtype /Type0 /ToUnicode 7 0 R >>", streamObject("", []byte(cmapBomb))),
+			wantErr: ErrLimitExceeded,
+		},
+		{
+			name: "many streams without endstream",
+			pdf:  []byte("%PDF-1.4\n" + strings.Repeat("1 0 obj << >> stream\n", 200_000)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			_, err := Extract(tt.pdf)
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Extract error = %v, want %v", err, tt.wantErr)
+			}
+			if elapsed := time.Since(start); elapsed > 10*time.Second {
+				t.Errorf("Extract took %v", elapsed)
+			}
+		})
+	}
+}
+
+// Every prefix of a valid file must be handled without panicking.
+func TestExtractTruncated(t *testing.T) {
+	docs := [][]byte{
+		fpdfDocument(t, []string{"Informe truncado", "con varias líneas"}),
+		onePage(helvetica, "BT /F1 12 Tf [(a)-300(b)] TJ ET /X1 Do",
+			streamObject("/Subtype /Form /Filter /FlateDecode", deflate([]byte("BT (forma) Tj ET")))),
+	}
+	for _, doc := range docs {
+		for n := 0; n <= len(doc); n++ {
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						t.Fatalf("Extract panicked on %d of %d bytes: %v", n, len(doc), r)
+					}
+				}()
+				Extract(doc[:n])
+			}()
+		}
+	}
+}
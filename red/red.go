@@ -0,0 +1,133 @@
+// Package red writes the collaboration network of investigators and groups in graph
+// formats understood by visualization tools: GraphML (Gephi, yEd, Cytoscape) and Graphviz DOT.
+package red
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+)
+
+// Supported formats.
+const (
+	FormatoJSON    = "json"
+	FormatoGraphML = "graphml"
+	FormatoDOT     = "dot"
+)
+
+// ErrFormatoNoSoportado is returned for a format other than FormatoJSON, FormatoGraphML and FormatoDOT.
+var ErrFormatoNoSoportado = errors.New("unsupported network format, use json, graphml or dot")
+
+// ContentType returns the MIME type of a format.
+func ContentType(formato string) string {
+	switch formato {
+	case FormatoGraphML:
+		return "application/graphml+xml"
+	case FormatoDOT:
+		return "text/vnd.graphviz; charset=utf-8"
+	default:
+		return "application/json"
+	}
+}
+
+// Write writes red to w in the given format.
+func Write(w io.Writer, formato string, red *models.RedColaboracion) error {
+	switch formato {
+	case FormatoJSON:
+		return json.NewEncoder(w).Encode(red)
+	case FormatoGraphML:
+		return writeGraphML(w, red)
+	case FormatoDOT:
+		return writeDOT(w, red)
+	default:
+		return ErrFormatoNoSoportado
+	}
+}
+
+// xmlEscape escapes text for an XML element or attribute.
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// graphMLKeys declares the attributes of nodes and edges.
+var graphMLKeys = []struct{ id, para, nombre, tipo string }{
+	{"tipo", "node", "tipo", "string"},
+	{"idRegistro", "node", "idRegistro", "int"},
+	{"etiqueta", "node", "etiqueta", "string"},
+	{"lineaInvestigacion", "node", "lineaInvestigacion", "string"},
+	{"facultad", "node", "facultad", "string"},
+	{"tipoArista", "edge", "tipo", "string"},
+	{"rol", "edge", "rol", "string"},
+	{"peso", "edge", "peso", "int"},
+}
+
+func writeGraphML(w io.Writer, red *models.RedColaboracion) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(xml.Header)
+	bw.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	for _, k := range graphMLKeys {
+		fmt.Fprintf(bw, `  <key id="%s" for="%s" attr.name="%s" attr.type="%s"/>`+"\n", k.id, k.para, k.nombre, k.tipo)
+	}
+	bw.WriteString(`  <graph id="colaboracion" edgedefault="undirected">` + "\n")
+
+	dato := func(key, valor string) {
+		if valor != "" {
+			fmt.Fprintf(bw, `      <data key="%s">%s</data>`+"\n", key, xmlEscape(valor))
+		}
+	}
+	for _, n := range red.Nodos {
+		fmt.Fprintf(bw, `    <node id="%s">`+"\n", xmlEscape(n.ID))
+		dato("tipo", n.Tipo)
+		dato("idRegistro", fmt.Sprint(n.IDRegistro))
+		dato("etiqueta", n.Etiqueta)
+		dato("lineaInvestigacion", n.LineaInvestigacion)
+		if n.Facultad != nil {
+			dato("facultad", *n.Facultad)
+		}
+		bw.WriteString("    </node>\n")
+	}
+	for i, a := range red.Aristas {
+		fmt.Fprintf(bw, `    <edge id="e%d" source="%s" target="%s">`+"\n", i, xmlEscape(a.Origen), xmlEscape(a.Destino))
+		dato("tipoArista", a.Tipo)
+		dato("rol", a.Rol)
+		dato("peso", fmt.Sprint(a.Peso))
+		bw.WriteString("    </edge>\n")
+	}
+	bw.WriteString("  </graph>\n</graphml>\n")
+	return bw.Flush()
+}
+
+// dotQuote returns s as a quoted DOT identifier.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+func writeDOT(w io.Writer, red *models.RedColaboracion) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("graph colaboracion {\n")
+	bw.WriteString("  node [fontname=\"Helvetica\"];\n")
+	for _, n := range red.Nodos {
+		forma := "ellipse"
+		if n.Tipo == models.NodoGrupo {
+			forma = "box"
+		}
+		fmt.Fprintf(bw, "  %s [label=%s, shape=%s, tipo=%s];\n", dotQuote(n.ID), dotQuote(n.Etiqueta), forma, dotQuote(n.Tipo))
+	}
+	for _, a := range red.Aristas {
+		if a.Tipo == models.AristaMembresia {
+			fmt.Fprintf(bw, "  %s -- %s [tipo=%s, label=%s, style=dashed];\n", dotQuote(a.Origen), dotQuote(a.Destino), dotQuote(a.Tipo), dotQuote(a.Rol))
+		} else {
+			fmt.Fprintf(bw, "  %s -- %s [tipo=%s, weight=%d, penwidth=%d, label=\"%d\"];\n", dotQuote(a.Origen), dotQuote(a.Destino), dotQuote(a.Tipo), a.Peso, a.Peso, a.Peso)
+		}
+	}
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
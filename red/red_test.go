@@ -0,0 +1,132 @@
+package red
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+)
+
+func ejemploRed() *models.RedColaboracion {
+	facultad := "Ingeniería & Ciencias"
+	return &models.RedColaboracion{
+		Nodos: []models.NodoRed{
+			{ID: "g1", Tipo: models.NodoGrupo, IDRegistro: 1, Etiqueta: `Grupo "<IA>"`, LineaInvestigacion: "Visión", Facultad: &facultad},
+			{ID: "i10", Tipo: models.NodoInvestigador, IDRegistro: 10, Etiqueta: "Ana Pérez"},
+			{ID: "i20", Tipo: models.NodoInvestigador, IDRegistro: 20, Etiqueta: `Luis \ Soto`},
+		},
+		Aristas: []models.AristaRed{
+			{Origen: "i10", Destino: "g1", Tipo: models.AristaMembresia, Rol: "Coordinador", Peso: 1},
+			{Origen: "i20", Destino: "g1", Tipo: models.AristaMembresia, Rol: "Miembro", Peso: 1},
+			{Origen: "i10", Destino: "i20", Tipo: models.AristaColaboracion, Peso: 3},
+		},
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatoJSON, ejemploRed()); err != nil {
+		t.Fatal(err)
+	}
+	var got models.RedColaboracion
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&got, ejemploRed()) {
+		t.Errorf("JSON round trip = %+v", got)
+	}
+}
+
+func TestWriteGraphML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatoGraphML, ejemploRed()); err != nil {
+		t.Fatal(err)
+	}
+
+	type data struct {
+		Key   string `xml:"key,attr"`
+		Valor string `xml:",chardata"`
+	}
+	var doc struct {
+		Keys []struct {
+			ID  string `xml:"id,attr"`
+			For string `xml:"for,attr"`
+		} `xml:"key"`
+		Graph struct {
+			EdgeDefault string `xml:"edgedefault,attr"`
+			Nodes       []struct {
+				ID   string `xml:"id,attr"`
+				Data []data `xml:"data"`
+			} `xml:"node"`
+			Edges []struct {
+				Source string `xml:"source,attr"`
+				Target string `xml:"target,attr"`
+				Data   []data `xml:"data"`
+			} `xml:"edge"`
+		} `xml:"graph"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid GraphML: %v\n%s", err, buf.String())
+	}
+	if len(doc.Keys) != len(graphMLKeys) || doc.Graph.EdgeDefault != "undirected" {
+		t.Errorf("keys = %d, edgedefault = %q", len(doc.Keys), doc.Graph.EdgeDefault)
+	}
+	valores := func(ds []data) map[string]string {
+		m := map[string]string{}
+		for _, d := range ds {
+			m[d.Key] = d.Valor
+		}
+		return m
+	}
+
+	if len(doc.Graph.Nodes) != 3 || len(doc.Graph.Edges) != 3 {
+		t.Fatalf("nodes = %d, edges = %d, want 3 and 3", len(doc.Graph.Nodes), len(doc.Graph.Edges))
+	}
+	grupo := valores(doc.Graph.Nodes[0].Data)
+	if grupo["etiqueta"] != `Grupo "<IA>"` || grupo["facultad"] != "Ingeniería & Ciencias" || grupo["tipo"] != models.NodoGrupo {
+		t.Errorf("group node data = %v", grupo)
+	}
+	if _, ok := valores(doc.Graph.Nodes[1].Data)["facultad"]; ok {
+		t.Error("investigator node has a facultad")
+	}
+	membresia := valores(doc.Graph.Edges[0].Data)
+	if doc.Graph.Edges[0].Source != "i10" || doc.Graph.Edges[0].Target != "g1" || membresia["rol"] != "Coordinador" || membresia["peso"] != "1" {
+		t.Errorf("membership edge = %+v", doc.Graph.Edges[0])
+	}
+	colaboracion := valores(doc.Graph.Edges[2].Data)
+	if colaboracion["tipoArista"] != models.AristaColaboracion || colaboracion["peso"] != "3" {
+		t.Errorf("collaboration edge data = %v", colaboracion)
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatoDOT, ejemploRed()); err != nil {
+		t.Fatal(err)
+	}
+	dot := buf.String()
+	for _, want := range []string{
+		"graph colaboracion {\n",
+		`  "g1" [label="Grupo \"<IA>\"", shape=box, tipo="grupo"];`,
+		`  "i20" [label="Luis \\ Soto", shape=ellipse, tipo="investigador"];`,
+		`  "i10" -- "g1" [tipo="membresia", label="Coordinador", style=dashed];`,
+		`  "i10" -- "i20" [tipo="colaboracion", weight=3, penwidth=3, label="3"];`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("DOT output lacks %s\n%s", want, dot)
+		}
+	}
+	if !strings.HasSuffix(dot, "}\n") {
+		t.Error("DOT graph is not closed")
+	}
+}
+
+func TestWriteUnsupportedFormat(t *testing.T) {
+	if err := Write(&bytes.Buffer{}, "gexf", ejemploRed()); err != ErrFormatoNoSoportado {
+		t.Errorf("error = %v, want ErrFormatoNoSoportado", err)
+	}
+}
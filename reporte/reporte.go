@@ -0,0 +1,236 @@
+// Package reporte renders the PDF documents issued by the research office: the report of a
+// group and the membership certificate of an investigator.
+package reporte
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/go-pdf/fpdf"
+	"rsc.io/qr"
+)
+
+// Page layout, in millimetres.
+const (
+	margen       = 20.0
+	anchoUtil    = 210 - 2*margen // A4 width minus the margins
+	altoLinea    = 6.0
+	fuente       = "Helvetica"
+	sinDato      = "—"
+	formatoFecha = "02/01/2006"
+	ladoQR       = 30.0 // Side of the verification QR code
+)
+
+var meses = []string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto",
+	"septiembre", "octubre", "noviembre", "diciembre"}
+
+// fechaLarga formats a date the way official documents do, e.g. "18 de octubre de 2026".
+func fechaLarga(t time.Time) string {
+	return fmt.Sprintf("%d de %s de %d", t.Day(), meses[t.Month()-1], t.Year())
+}
+
+// Generador renders the documents with a common letterhead.
+type Generador struct {
+	Institucion string // First line of the letterhead
+	Oficina     string // Issuing office, second line of the letterhead
+}
+
+// documento wraps an fpdf document, translating UTF-8 text to the encoding of its core fonts.
+type documento struct {
+	pdf *fpdf.Fpdf
+	tr  func(string) string
+}
+
+// nuevoDocumento starts an A4 document with the letterhead and the given title.
+func (g Generador) nuevoDocumento(titulo string, emitido time.Time) *documento {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(margen, margen, margen)
+	pdf.SetAutoPageBreak(true, margen)
+	d := &documento{pdf: pdf, tr: pdf.UnicodeTranslatorFromDescriptor("")}
+	pdf.SetTitle(titulo, true)
+	pdf.SetCreator(g.Institucion, true)
+	pdf.SetCreationDate(emitido)
+
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-margen + 5)
+		pdf.SetFont(fuente, "I", 8)
+		pdf.CellFormat(0, 5, d.tr(fmt.Sprintf("Emitido el %s - Página %d", emitido.Format(formatoFecha), pdf.PageNo())), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+
+	pdf.SetFont(fuente, "B", 13)
+	pdf.CellFormat(0, 7, d.tr(g.Institucion), "", 1, "C", false, 0, "")
+	if g.Oficina != "" {
+		pdf.SetFont(fuente, "", 11)
+		pdf.CellFormat(0, 6, d.tr(g.Oficina), "", 1, "C", false, 0, "")
+	}
+	pdf.Ln(8)
+	pdf.SetFont(fuente, "B", 15)
+	pdf.CellFormat(0, 8, d.tr(titulo), "", 1, "C", false, 0, "")
+	pdf.Ln(6)
+	return d
+}
+
+// campo writes a "label: value" line.
+func (d *documento) campo(etiqueta, valor string) {
+	if valor == "" {
+		valor = sinDato
+	}
+	d.pdf.SetFont(fuente, "B", 10)
+	d.pdf.CellFormat(55, altoLinea, d.tr(etiqueta+":"), "", 0, "L", false, 0, "")
+	d.pdf.SetFont(fuente, "", 10)
+	d.pdf.MultiCell(0, altoLinea, d.tr(valor), "", "L", false)
+}
+
+// subtitulo writes the heading of a section.
+func (d *documento) subtitulo(texto string) {
+	d.pdf.Ln(4)
+	d.pdf.SetFont(fuente, "B", 11)
+	d.pdf.CellFormat(0, 7, d.tr(texto), "B", 1, "L", false, 0, "")
+	d.pdf.Ln(2)
+}
+
+// parrafo writes justified text.
+func (d *documento) parrafo(texto string) {
+	d.pdf.SetFont(fuente, "", 11)
+	d.pdf.MultiCell(0, altoLinea+1, d.tr(texto), "", "J", false)
+	d.pdf.Ln(3)
+}
+
+// tabla writes a table whose column widths are fractions of the usable width.
+func (d *documento) tabla(encabezado []string, anchos []float64, filas [][]string) {
+	d.pdf.SetFont(fuente, "B", 10)
+	d.pdf.SetFillColor(230, 230, 230)
+	for i, titulo := range encabezado {
+		d.pdf.CellFormat(anchos[i]*anchoUtil, 7, d.tr(titulo), "1", 0, "L", true, 0, "")
+	}
+	d.pdf.Ln(-1)
+	d.pdf.SetFont(fuente, "", 10)
+	for _, fila := range filas {
+		for i, valor := range fila {
+			d.pdf.CellFormat(anchos[i]*anchoUtil, 7, d.tr(valor), "1", 0, "L", false, 0, "")
+		}
+		d.pdf.Ln(-1)
+	}
+}
+
+func (d *documento) escribir(w io.Writer) error {
+	if err := d.pdf.Output(w); err != nil {
+		return fmt.Errorf("error rendering PDF: %w", err)
+	}
+	return nil
+}
+
+func valorOpcional(valor *string) string {
+	if valor == nil {
+		return ""
+	}
+	return *valor
+}
+
+// Grupo renders the report of a group: its data, current recognition (vigente, nil if it
+// has none) and members with their roles.
+func (g Generador) Grupo(w io.Writer, detalle *models.GrupoWithInvestigadores, vigente *models.Resolucion, emitido time.Time) error {
+	grupo := detalle.Grupo
+	d := g.nuevoDocumento("Reporte de grupo de investigación", emitido)
+
+	d.subtitulo("Datos del grupo")
+	d.campo("Nombre", grupo.Nombre)
+	d.campo("Línea de investigación", grupo.LineaInvestigacion)
+	d.campo("Tipo de investigación", grupo.TipoInvestigacion)
+	d.campo("Facultad", valorOpcional(grupo.Facultad))
+	d.campo("Fecha de registro", grupo.FechaRegistro.Format(formatoFecha))
+	d.campo("Estado", grupo.Estado)
+
+	d.subtitulo("Resolución de reconocimiento")
+	if vigente == nil {
+		d.campo("Número de resolución", grupo.NumeroResolucion)
+		d.parrafo("El grupo no tiene una resolución de reconocimiento vigente.")
+	} else {
+		vence := "Sin vencimiento"
+		if vigente.FechaVencimiento != nil {
+			vence = vigente.FechaVencimiento.Format(formatoFecha)
+		}
+		d.campo("Número de resolución", vigente.Numero)
+		d.campo("Tipo", vigente.Tipo)
+		d.campo("Fecha de emisión", vigente.FechaEmision.Format(formatoFecha))
+		d.campo("Vencimiento", vence)
+		d.campo("Oficina emisora", vigente.OficinaEmisora)
+	}
+
+	d.subtitulo(fmt.Sprintf("Integrantes (%d)", len(detalle.Investigadores)))
+	if len(detalle.Investigadores) == 0 {
+		d.parrafo("El grupo no tiene integrantes registrados.")
+	} else {
+		filas := make([][]string, len(detalle.Investigadores))
+		for i, inv := range detalle.Investigadores {
+			filas[i] = []string{fmt.Sprint(i + 1), inv.Apellido + ", " + inv.Nombre, inv.Rol}
+		}
+		d.tabla([]string{"N.°", "Apellidos y nombres", "Rol"}, []float64{0.1, 0.6, 0.3}, filas)
+	}
+	return d.escribir(w)
+}
+
+// Constancia renders the membership certificate described by datos, identified by its
+// verification code. A QR code links to urlVerificacion, where anyone can check it.
+func (g Generador) Constancia(w io.Writer, datos models.DatosConstancia, codigo, urlVerificacion string) error {
+	d := g.nuevoDocumento("Constancia de pertenencia a grupos de investigación", datos.EmitidaEn)
+
+	nombre := strings.TrimSpace(datos.Nombre + " " + datos.Apellido)
+	if len(datos.Grupos) == 0 {
+		d.parrafo(fmt.Sprintf("Se hace constar que %s no figura como integrante de ningún grupo de investigación reconocido a la fecha.", nombre))
+	} else {
+		d.parrafo(fmt.Sprintf("Se hace constar que %s figura como integrante de los siguientes grupos de investigación reconocidos:", nombre))
+		filas := make([][]string, len(datos.Grupos))
+		for i, grupo := range datos.Grupos {
+			filas[i] = []string{grupo.Nombre, grupo.Rol, grupo.FechaRegistro.Format(formatoFecha), grupo.NumeroResolucion}
+		}
+		d.tabla([]string{"Grupo", "Rol", "Registro", "Resolución"}, []float64{0.45, 0.2, 0.15, 0.2}, filas)
+		d.pdf.Ln(4)
+	}
+	d.parrafo(fmt.Sprintf("Se expide la presente a solicitud del interesado, el %s.", fechaLarga(datos.EmitidaEn)))
+
+	if err := d.codigoQR(codigo, urlVerificacion); err != nil {
+		return err
+	}
+	return d.escribir(w)
+}
+
+// codigoQR writes the verification block of a certificate: a QR code linking to
+// urlVerificacion, next to the code and the address where it can be checked.
+func (d *documento) codigoQR(codigo, urlVerificacion string) error {
+	code, err := qr.Encode(urlVerificacion, qr.M)
+	if err != nil {
+		return fmt.Errorf("error encoding verification QR code: %w", err)
+	}
+	opciones := fpdf.ImageOptions{ImageType: "PNG"}
+	d.pdf.RegisterImageOptionsReader("qr", opciones, bytes.NewReader(code.PNG()))
+
+	d.pdf.Ln(6)
+	x, y := d.pdf.GetX(), d.pdf.GetY()
+	d.pdf.ImageOptions("qr", x, y, ladoQR, ladoQR, false, opciones, 0, "")
+	d.pdf.SetXY(x+ladoQR+5, y+5)
+	d.pdf.SetFont(fuente, "B", 10)
+	d.pdf.CellFormat(0, altoLinea, d.tr("Código de verificación: "+codigo), "", 2, "L", false, 0, "")
+	d.pdf.SetFont(fuente, "", 9)
+	d.pdf.MultiCell(0, 5, d.tr("Verifique la autenticidad y vigencia de esta constancia escaneando el código QR o en "+urlVerificacion), "", "L", false)
+	d.pdf.SetY(y + ladoQR)
+	return d.pdf.Error()
+}
+
+// NuevoCodigo returns a random verification code for a certificate: 16 base32 characters
+// in groups of four, e.g. "K7QD-M2XA-P9RT-4WCE".
+func NuevoCodigo() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating verification code: %w", err)
+	}
+	c := base32.StdEncoding.EncodeToString(b)
+	return c[0:4] + "-" + c[4:8] + "-" + c[8:12] + "-" + c[12:16], nil
+}
@@ -0,0 +1,321 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/lib/pq"
+)
+
+const busquedaGuardadaSelect = `SELECT idBusqueda, idUsuario, nombre, parametros, alertas, evaluadaEn, createdAt, updatedAt FROM Busqueda_Guardada`
+
+// CreateBusquedaGuardada inserts a new saved search.
+func CreateBusquedaGuardada(db *sql.DB, b *models.BusquedaGuardada) error {
+	query := `INSERT INTO Busqueda_Guardada (idUsuario, nombre, parametros, alertas) VALUES ($1, $2, $3, $4) RETURNING idBusqueda, createdAt, updatedAt`
+	err := db.QueryRow(query, b.IDUsuario, b.Nombre, b.Parametros, b.Alertas).Scan(&b.ID, &b.CreatedAt, &b.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("error inserting saved search: %w", err)
+	}
+	return nil
+}
+
+// GetBusquedaGuardadaByID retrieves a saved search, or nil if not found.
+func GetBusquedaGuardadaByID(db *sql.DB, id int) (*models.BusquedaGuardada, error) {
+	b, err := scanBusquedaGuardada(db.QueryRow(busquedaGuardadaSelect+` WHERE idBusqueda = $1`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+// GetBusquedasGuardadasByUsuario lists the saved searches of a user by name.
+func GetBusquedasGuardadasByUsuario(db *sql.DB, idUsuario int) ([]models.BusquedaGuardada, error) {
+	return queryBusquedasGuardadas(db, busquedaGuardadaSelect+` WHERE idUsuario = $1 ORDER BY nombre, idBusqueda`, idUsuario)
+}
+
+// GetBusquedasConAlertas lists the saved searches whose owners opted in to alerts.
+func GetBusquedasConAlertas(db *sql.DB) ([]models.BusquedaGuardada, error) {
+	return queryBusquedasGuardadas(db, busquedaGuardadaSelect+` WHERE alertas ORDER BY idBusqueda`)
+}
+
+// UpdateBusquedaGuardada updates the name, parameters and alert opt-in of a saved search.
+// Changing the parameters or turning alerts off discards the alert baseline, so the next
+// evaluation records the current matches without notifying them.
+func UpdateBusquedaGuardada(db *sql.DB, b *models.BusquedaGuardada) error {
+	query := `UPDATE Busqueda_Guardada
+		SET nombre = $1, parametros = $2, alertas = $3,
+			evaluadaEn = CASE WHEN alertas AND $3 AND parametros = $2 THEN evaluadaEn END,
+			updatedAt = CURRENT_TIMESTAMP
+		WHERE idBusqueda = $4
+		RETURNING evaluadaEn, createdAt, updatedAt`
+	var evaluadaEn sql.NullTime
+	err := db.QueryRow(query, b.Nombre, b.Parametros, b.Alertas, b.ID).Scan(&evaluadaEn, &b.CreatedAt, &b.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("error updating saved search: %w", err)
+	}
+	b.EvaluadaEn = nil
+	if evaluadaEn.Valid {
+		b.EvaluadaEn = &evaluadaEn.Time
+	}
+	return nil
+}
+
+// DeleteBusquedaGuardada deletes a saved search together with its alerts.
+func DeleteBusquedaGuardada(db *sql.DB, id int) error {
+	if _, err := db.Exec(`DELETE FROM Busqueda_Guardada WHERE idBusqueda = $1`, id); err != nil {
+		return fmt.Errorf("error deleting saved search: %w", err)
+	}
+	return nil
+}
+
+// compararCoincidencias splits the groups matching a saved search now (actuales) by whether
+// they matched at its previous evaluation (anteriores): nuevos raise a grupo_nuevo alert,
+// and the members who joined persistentes since then an integrante_nuevo alert. A group
+// that stopped matching and matches again is new again.
+func compararCoincidencias(anteriores, actuales []int) (nuevos, persistentes []int64) {
+	antes := make(map[int]bool, len(anteriores))
+	for _, id := range anteriores {
+		antes[id] = true
+	}
+	nuevos, persistentes = []int64{}, []int64{}
+	for _, id := range actuales {
+		if antes[id] {
+			persistentes = append(persistentes, int64(id))
+		} else {
+			nuevos = append(nuevos, int64(id))
+		}
+	}
+	return nuevos, persistentes
+}
+
+// idsCoincidencias returns the groups that matched a saved search at its last evaluation.
+func idsCoincidencias(tx *sql.Tx, idBusqueda int) ([]int, error) {
+	rows, err := tx.Query(`SELECT idGrupo FROM Busqueda_Coincidencia WHERE idBusqueda = $1`, idBusqueda)
+	if err != nil {
+		return nil, fmt.Errorf("error querying saved search matches: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scanning saved search match row: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating saved search matches: %w", err)
+	}
+	return ids, nil
+}
+
+// RegistrarEvaluacionBusqueda records the groups currently matching a saved search, given
+// by filter (its parsed parametros), and, unless this is its first evaluation, creates an
+// alert for each group that did not match before and for each member who joined a group
+// that did (see compararCoincidencias). It returns the number of alerts created. The evaluation is dropped (0, nil) if
+// the search was edited since b was read.
+//
+// The matches are computed in the same repeatable-read transaction that records them and
+// the alerts, so the groups, their members and the evaluation time all come from a single
+// snapshot: no group or member can change between the search and the alerts it raises.
+func RegistrarEvaluacionBusqueda(db *sql.DB, b models.BusquedaGuardada, filter GrupoFilter) (int, error) {
+	tx, err := db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return 0, fmt.Errorf("error starting saved search evaluation transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op after a successful commit
+
+	// Claim the evaluation first, so an edit made meanwhile is not evaluated with stale matches
+	res, err := tx.Exec(`UPDATE Busqueda_Guardada SET evaluadaEn = CURRENT_TIMESTAMP
+		WHERE idBusqueda = $1 AND alertas AND parametros = $2 AND evaluadaEn IS NOT DISTINCT FROM $3`,
+		b.ID, b.Parametros, b.EvaluadaEn)
+	if err != nil {
+		return 0, fmt.Errorf("error updating saved search evaluation time: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking saved search evaluation: %w", err)
+	}
+	if affected == 0 {
+		return 0, nil
+	}
+
+	idsGrupo, err := idsGruposFiltrados(tx, filter)
+	if err != nil {
+		return 0, err
+	}
+	ids := make([]int64, len(idsGrupo))
+	for i, id := range idsGrupo {
+		ids[i] = int64(id)
+	}
+
+	alertas := 0
+	if b.EvaluadaEn != nil {
+		anteriores, err := idsCoincidencias(tx, b.ID)
+		if err != nil {
+			return 0, err
+		}
+		nuevos, persistentes := compararCoincidencias(anteriores, idsGrupo)
+
+		res, err := tx.Exec(`INSERT INTO Busqueda_Alerta (idBusqueda, tipo, idGrupo)
+			SELECT $1, $2, unnest($3::INT[])`,
+			b.ID, models.AlertaGrupoNuevo, pq.Array(nuevos))
+		if err != nil {
+			return 0, fmt.Errorf("error inserting new group alerts: %w", err)
+		}
+		grupos, err := res.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("error checking new group alerts: %w", err)
+		}
+
+		res, err = tx.Exec(`INSERT INTO Busqueda_Alerta (idBusqueda, tipo, idGrupo, idInvestigador)
+			SELECT $1, $2, gi.idGrupo, gi.idInvestigador
+			FROM Grupo_Investigador gi
+			WHERE gi.idGrupo = ANY($3) AND gi.createdAt > $4`,
+			b.ID, models.AlertaIntegranteNuevo, pq.Array(persistentes), *b.EvaluadaEn)
+		if err != nil {
+			return 0, fmt.Errorf("error inserting new member alerts: %w", err)
+		}
+		integrantes, err := res.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("error checking new member alerts: %w", err)
+		}
+		alertas = int(grupos + integrantes)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM Busqueda_Coincidencia WHERE idBusqueda = $1`, b.ID); err != nil {
+		return 0, fmt.Errorf("error clearing saved search matches: %w", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO Busqueda_Coincidencia (idBusqueda, idGrupo) SELECT $1, unnest($2::INT[])`, b.ID, pq.Array(ids)); err != nil {
+		return 0, fmt.Errorf("error inserting saved search matches: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing saved search evaluation: %w", err)
+	}
+	return alertas, nil
+}
+
+// GetAlertasByUsuario retrieves a page of the alerts of a user's saved searches, newest
+// first, along with their total. With soloNoLeidas only unread alerts are returned.
+func GetAlertasByUsuario(db *sql.DB, idUsuario int, soloNoLeidas bool, limit, offset int) ([]models.AlertaBusqueda, int, error) {
+	from := ` FROM Busqueda_Alerta a
+		JOIN Busqueda_Guardada b ON b.idBusqueda = a.idBusqueda
+		WHERE b.idUsuario = $1`
+	if soloNoLeidas {
+		from += ` AND NOT a.leida`
+	}
+
+	var total int
+	if err := db.QueryRow(`SELECT COUNT(*)`+from, idUsuario).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("error querying total alert count: %w", err)
+	}
+
+	query := `SELECT a.idAlerta, a.idBusqueda, b.nombre, a.tipo, a.idGrupo, g.nombre, a.idInvestigador, i.nombre || ' ' || i.apellido, a.leida, a.createdAt
+		FROM Busqueda_Alerta a
+		JOIN Busqueda_Guardada b ON b.idBusqueda = a.idBusqueda
+		JOIN grupo g ON g.idGrupo = a.idGrupo
+		LEFT JOIN investigador i ON i.idInvestigador = a.idInvestigador
+		WHERE b.idUsuario = $1`
+	if soloNoLeidas {
+		query += ` AND NOT a.leida`
+	}
+	query += ` ORDER BY a.createdAt DESC, a.idAlerta DESC LIMIT $2 OFFSET $3`
+
+	rows, err := db.Query(query, idUsuario, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error querying alerts page: %w", err)
+	}
+	defer rows.Close()
+
+	alertas := []models.AlertaBusqueda{}
+	for rows.Next() {
+		var a models.AlertaBusqueda
+		var idInvestigador sql.NullInt64
+		var nombreInvestigador sql.NullString
+		if err := rows.Scan(&a.ID, &a.IDBusqueda, &a.NombreBusqueda, &a.Tipo, &a.IDGrupo, &a.NombreGrupo, &idInvestigador, &nombreInvestigador, &a.Leida, &a.CreatedAt); err != nil {
+			return nil, 0, fmt.Errorf("error scanning alert row: %w", err)
+		}
+		if idInvestigador.Valid {
+			id := int(idInvestigador.Int64)
+			a.IDInvestigador = &id
+		}
+		if nombreInvestigador.Valid {
+			a.NombreInvestigador = &nombreInvestigador.String
+		}
+		alertas = append(alertas, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error after iterating alert rows: %w", err)
+	}
+	return alertas, total, nil
+}
+
+// MarcarAlertasLeidas marks as read the given alerts of a user, or all of them when ids is
+// empty. Alerts of other users are left untouched. It returns how many were marked.
+func MarcarAlertasLeidas(db *sql.DB, idUsuario int, ids []int) (int, error) {
+	query := `UPDATE Busqueda_Alerta a SET leida = TRUE
+		FROM Busqueda_Guardada b
+		WHERE b.idBusqueda = a.idBusqueda AND b.idUsuario = $1 AND NOT a.leida`
+	args := []interface{}{idUsuario}
+	if len(ids) > 0 {
+		ids64 := make([]int64, len(ids))
+		for i, id := range ids {
+			ids64[i] = int64(id)
+		}
+		query += ` AND a.idAlerta = ANY($2)`
+		args = append(args, pq.Array(ids64))
+	}
+	res, err := db.Exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("error marking alerts as read: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking alerts marked as read: %w", err)
+	}
+	return int(affected), nil
+}
+
+func queryBusquedasGuardadas(db *sql.DB, query string, args ...interface{}) ([]models.BusquedaGuardada, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying saved searches: %w", err)
+	}
+	defer rows.Close()
+
+	busquedas := []models.BusquedaGuardada{}
+	for rows.Next() {
+		b, err := scanBusquedaGuardada(rows)
+		if err != nil {
+			return nil, err
+		}
+		busquedas = append(busquedas, *b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating saved search rows: %w", err)
+	}
+	return busquedas, nil
+}
+
+func scanBusquedaGuardada(row rowScanner) (*models.BusquedaGuardada, error) {
+	var b models.BusquedaGuardada
+	var evaluadaEn sql.NullTime
+	err := row.Scan(&b.ID, &b.IDUsuario, &b.Nombre, &b.Parametros, &b.Alertas, &evaluadaEn, &b.CreatedAt, &b.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error scanning saved search row: %w", err)
+	}
+	if evaluadaEn.Valid {
+		b.EvaluadaEn = &evaluadaEn.Time
+	}
+	return &b, nil
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompararCoincidencias(t *testing.T) {
+	tests := []struct {
+		name                 string
+		anteriores, actuales []int
+		nuevos, persistentes []int64
+	}{
+		{name: "no matches", nuevos: []int64{}, persistentes: []int64{}},
+		{
+			name:       "only groups that start matching are new",
+			anteriores: []int{1, 2},
+			actuales:   []int{1, 2, 5},
+			nuevos:     []int64{5}, persistentes: []int64{1, 2},
+		},
+		{
+			name:       "unchanged matches raise no group alert",
+			anteriores: []int{3, 4},
+			actuales:   []int{3, 4},
+			nuevos:     []int64{}, persistentes: []int64{3, 4},
+		},
+		{
+			name:       "groups that stop matching are dropped",
+			anteriores: []int{1, 2, 3},
+			actuales:   []int{2},
+			nuevos:     []int64{}, persistentes: []int64{2},
+		},
+		{
+			// The matches are replaced at every evaluation, so a group that left the
+			// results at the previous one is new again when it comes back
+			name:       "group matching again",
+			anteriores: []int{2},
+			actuales:   []int{1, 2},
+			nuevos:     []int64{1}, persistentes: []int64{2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nuevos, persistentes := compararCoincidencias(tt.anteriores, tt.actuales)
+			if !reflect.DeepEqual(nuevos, tt.nuevos) {
+				t.Errorf("nuevos = %v, want %v", nuevos, tt.nuevos)
+			}
+			if !reflect.DeepEqual(persistentes, tt.persistentes) {
+				t.Errorf("persistentes = %v, want %v", persistentes, tt.persistentes)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+)
+
+// ErrCargaDesactualizada is returned when a resumable upload is no longer at the expected
+// offset or state, e.g. because two PATCH requests raced.
+var ErrCargaDesactualizada = errors.New("upload changed concurrently")
+
+const cargaSelect = `SELECT idCarga, idGrupo, categoria, descripcion, visibilidad, nombreOriginal, tamano, recibido, checksum, idUsuario, idArchivo, expiraEn, createdAt, updatedAt FROM Carga`
+
+// CreateCarga inserts a new resumable upload.
+func CreateCarga(db *sql.DB, c *models.Carga) error {
+	query := `INSERT INTO Carga (idCarga, idGrupo, categoria, descripcion, visibilidad, nombreOriginal, tamano, checksum, idUsuario, expiraEn) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING createdAt, updatedAt`
+	err := db.QueryRow(query, c.ID, c.IDGrupo, c.Categoria, c.Descripcion, c.Visibilidad, c.NombreOriginal, c.Tamano, c.Checksum, c.IDUsuario, c.ExpiraEn).Scan(&c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("error inserting upload: %w", err)
+	}
+	return nil
+}
+
+// GetCargaByID retrieves a resumable upload, or nil if not found.
+func GetCargaByID(db *sql.DB, idCarga string) (*models.Carga, error) {
+	c, err := scanCarga(db.QueryRow(cargaSelect+` WHERE idCarga = $1`, idCarga))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// AvanzarCarga moves the offset of an upload from recibido to nuevoRecibido and extends
+// its expiry. It returns ErrCargaDesactualizada if the offset is no longer recibido.
+func AvanzarCarga(db *sql.DB, idCarga string, recibido, nuevoRecibido int64, expiraEn time.Time) error {
+	res, err := db.Exec(`UPDATE Carga SET recibido = $1, expiraEn = $2, updatedAt = CURRENT_TIMESTAMP WHERE idCarga = $3 AND recibido = $4 AND idArchivo IS NULL`,
+		nuevoRecibido, expiraEn, idCarga, recibido)
+	if err != nil {
+		return fmt.Errorf("error updating upload offset: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking updated upload offset: %w", err)
+	}
+	if affected == 0 {
+		return ErrCargaDesactualizada
+	}
+	return nil
+}
+
+// CompletarCarga creates the attachment assembled from an upload and links it to the
+// upload, in a single transaction. It returns ErrCargaDesactualizada if the upload was
+// already completed.
+func CompletarCarga(db *sql.DB, idCarga string, a *models.GrupoArchivo) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting upload completion transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op after a successful commit
+
+	query := `INSERT INTO Grupo_Archivo (idGrupo, categoria, descripcion, nombreOriginal, ruta, tamano, mimeType, checksum, visibilidad, idUsuario) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING idArchivo, createdAt`
+	err = tx.QueryRow(query, a.IDGrupo, a.Categoria, a.Descripcion, a.NombreOriginal, a.Ruta, a.Tamano, a.MimeType, a.Checksum, a.Visibilidad, a.IDUsuario).Scan(&a.ID, &a.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error inserting group attachment: %w", err)
+	}
+
+	res, err := tx.Exec(`UPDATE Carga SET idArchivo = $1, updatedAt = CURRENT_TIMESTAMP WHERE idCarga = $2 AND idArchivo IS NULL`, a.ID, idCarga)
+	if err != nil {
+		return fmt.Errorf("error linking upload to attachment: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking completed upload: %w", err)
+	}
+	if affected == 0 {
+		return ErrCargaDesactualizada
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing upload completion: %w", err)
+	}
+	return nil
+}
+
+// DeleteCarga deletes a resumable upload. The caller removes its chunks.
+func DeleteCarga(db *sql.DB, idCarga string) error {
+	_, err := db.Exec(`DELETE FROM Carga WHERE idCarga = $1`, idCarga)
+	if err != nil {
+		return fmt.Errorf("error deleting upload: %w", err)
+	}
+	return nil
+}
+
+// GetCargasExpiradas returns the IDs of up to limit uploads whose expiry has passed.
+func GetCargasExpiradas(db *sql.DB, limit int) ([]string, error) {
+	rows, err := db.Query(`SELECT idCarga FROM Carga WHERE expiraEn < CURRENT_TIMESTAMP ORDER BY expiraEn LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying expired uploads: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scanning expired upload row: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating expired upload rows: %w", err)
+	}
+	return ids, nil
+}
+
+func scanCarga(row rowScanner) (*models.Carga, error) {
+	var c models.Carga
+	var idArchivo sql.NullInt64
+	err := row.Scan(&c.ID, &c.IDGrupo, &c.Categoria, &c.Descripcion, &c.Visibilidad, &c.NombreOriginal, &c.Tamano, &c.Recibido, &c.Checksum, &c.IDUsuario, &idArchivo, &c.ExpiraEn, &c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error scanning upload row: %w", err)
+	}
+	if idArchivo.Valid {
+		id := int(idArchivo.Int64)
+		c.IDArchivo = &id
+	}
+	return &c, nil
+}
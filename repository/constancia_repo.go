@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+)
+
+// CreateConstancia stores an issued certificate. Its Contenido and Firma must be set.
+func CreateConstancia(db *sql.DB, c *models.Constancia) error {
+	query := `INSERT INTO Constancia (codigo, idInvestigador, contenido, firma, idUsuario) VALUES ($1, $2, $3, $4, $5) RETURNING idConstancia, createdAt`
+	err := db.QueryRow(query, c.Codigo, c.Datos.IDInvestigador, c.Contenido, c.Firma, c.IDUsuario).Scan(&c.ID, &c.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error inserting certificate: %w", err)
+	}
+	return nil
+}
+
+// GetConstanciaByCodigo retrieves an issued certificate by its code, or nil if there is none.
+// Datos is decoded from the stored content; IDInvestigador is nil once the investigator is deleted.
+func GetConstanciaByCodigo(db *sql.DB, codigo string) (*models.Constancia, error) {
+	var c models.Constancia
+	var idInvestigador, idUsuario sql.NullInt64
+	err := db.QueryRow(`SELECT idConstancia, codigo, idInvestigador, contenido, firma, idUsuario, createdAt FROM Constancia WHERE codigo = $1`, codigo).
+		Scan(&c.ID, &c.Codigo, &idInvestigador, &c.Contenido, &c.Firma, &idUsuario, &c.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error getting certificate by code: %w", err)
+	}
+	if idInvestigador.Valid {
+		id := int(idInvestigador.Int64)
+		c.IDInvestigador = &id
+	}
+	if idUsuario.Valid {
+		id := int(idUsuario.Int64)
+		c.IDUsuario = &id
+	}
+	if err := json.Unmarshal([]byte(c.Contenido), &c.Datos); err != nil {
+		return nil, fmt.Errorf("error decoding certificate content: %w", err)
+	}
+	return &c, nil
+}
+
+// GetGruposConstancia returns the groups of an investigator in one of estados, with the role
+// held in each, sorted by name: the memberships a certificate certifies.
+func GetGruposConstancia(db *sql.DB, idInvestigador int, estados []string) ([]models.GrupoConstancia, error) {
+	var b queryBuilder
+	b.where("gi.idInvestigador = " + b.arg(idInvestigador))
+	b.whereIn("g.estado", estados)
+	query := `SELECT g.idGrupo, g.nombre, gi.rol, g.numeroResolucion, g.fechaRegistro
+		FROM Grupo g
+		JOIN Grupo_Investigador gi ON gi.idGrupo = g.idGrupo` + b.whereClause() + `
+		ORDER BY g.nombre, g.idGrupo`
+	rows, err := db.Query(query, b.args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying certified groups: %w", err)
+	}
+	defer rows.Close()
+
+	grupos := []models.GrupoConstancia{}
+	for rows.Next() {
+		var g models.GrupoConstancia
+		if err := rows.Scan(&g.IDGrupo, &g.Nombre, &g.Rol, &g.NumeroResolucion, &g.FechaRegistro); err != nil {
+			return nil, fmt.Errorf("error scanning certified group row: %w", err)
+		}
+		grupos = append(grupos, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating certified groups: %w", err)
+	}
+	return grupos, nil
+}
@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/lib/pq"
+)
+
+// Highlight markers passed to ts_headline. Control characters cannot appear in extracted
+// text, so the excerpt can be HTML-escaped before they are turned into <mark> tags.
+const (
+	headlineStart   = "\x02"
+	headlineStop    = "\x03"
+	headlineOptions = "StartSel=" + headlineStart + ", StopSel=" + headlineStop + ", MaxFragments=2, MaxWords=25, MinWords=8, FragmentDelimiter=\" … \""
+	// headlineCampoOptions highlights short fields (names, research lines) whole.
+	headlineCampoOptions = "StartSel=" + headlineStart + ", StopSel=" + headlineStop + ", HighlightAll=true"
+)
+
+// tsQuery returns the tsquery for the websearch-syntax text in placeholder param ($n).
+func tsQuery(param string) string {
+	return fmt.Sprintf(`websearch_to_tsquery('spanish_unaccent', %s)`, param)
+}
+
+// contenidoCondition returns a WHERE condition matching groups with a document whose text
+// matches the websearch query in placeholder param. Only documents the caller may see with
+// vis count.
+func (b *queryBuilder) contenidoCondition(column, param string, vis Visibilidad) string {
+	cond := fmt.Sprintf(`%s IN (SELECT d.idGrupo FROM Grupo_Documento d JOIN Archivo_Texto t ON t.ruta = d.ruta
+		WHERE t.tsv @@ %s`, column, tsQuery(param))
+	if docs := b.documentoVisibleCondition("d", vis); docs != "" {
+		cond += " AND " + docs
+	}
+	return cond + `)`
+}
+
+// GetRutasPorExtraer returns up to limit PDFs of groups that have been scanned clean but
+// whose text has not been extracted yet.
+func GetRutasPorExtraer(db *sql.DB, limit int) ([]string, error) {
+	query := `SELECT DISTINCT d.ruta
+		FROM Grupo_Documento d
+		JOIN Archivo_Escaneo e ON e.ruta = d.ruta AND e.estado = 'limpio'
+		LEFT JOIN Archivo_Texto t ON t.ruta = d.ruta
+		WHERE t.ruta IS NULL AND lower(d.ruta) LIKE '%.pdf'
+		LIMIT $1`
+	rows, err := db.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying documents to extract: %w", err)
+	}
+	defer rows.Close()
+
+	rutas := []string{}
+	for rows.Next() {
+		var ruta string
+		if err := rows.Scan(&ruta); err != nil {
+			return nil, fmt.Errorf("error scanning document path row: %w", err)
+		}
+		rutas = append(rutas, ruta)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating documents to extract: %w", err)
+	}
+	return rutas, nil
+}
+
+// SetTextoArchivo stores the text extracted from a file; the search vector is computed by
+// a trigger.
+func SetTextoArchivo(db *sql.DB, ruta, estado, texto, errMsg string) error {
+	query := `INSERT INTO Archivo_Texto (ruta, estado, texto, error) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (ruta) DO UPDATE SET estado = EXCLUDED.estado, texto = EXCLUDED.texto, error = EXCLUDED.error, extraidoEn = CURRENT_TIMESTAMP`
+	if _, err := db.Exec(query, ruta, estado, texto, errMsg); err != nil {
+		return fmt.Errorf("error saving extracted text: %w", err)
+	}
+	return nil
+}
+
+// GetFragmentosContenido returns, per group, highlighted excerpts of the documents whose
+// text matches contenido (websearch syntax), best match first.
+func GetFragmentosContenido(db *sql.DB, idsGrupo []int, contenido string, vis Visibilidad) (map[int][]models.FragmentoDocumento, error) {
+	fragmentos := map[int][]models.FragmentoDocumento{}
+	if len(idsGrupo) == 0 || contenido == "" {
+		return fragmentos, nil
+	}
+	ids := make([]int64, len(idsGrupo))
+	for i, id := range idsGrupo {
+		ids[i] = int64(id)
+	}
+
+	var b queryBuilder
+	query := fmt.Sprintf(`SELECT d.idGrupo, d.origen, d.idArchivo, d.nombre, ts_headline('spanish_unaccent', t.texto, q, %s)
+		FROM Grupo_Documento d
+		JOIN Archivo_Texto t ON t.ruta = d.ruta,
+			websearch_to_tsquery('spanish_unaccent', %s) q
+		WHERE d.idGrupo = ANY(%s) AND t.tsv @@ q`, b.arg(headlineOptions), b.arg(contenido), b.arg(pq.Array(ids)))
+	if docs := b.documentoVisibleCondition("d", vis); docs != "" {
+		query += " AND " + docs
+	}
+	query += ` ORDER BY d.idGrupo, ts_rank(t.tsv, q) DESC`
+
+	rows, err := db.Query(query, b.args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying document excerpts: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var idGrupo int
+		var f models.FragmentoDocumento
+		var idArchivo sql.NullInt64
+		if err := rows.Scan(&idGrupo, &f.Origen, &idArchivo, &f.Nombre, &f.Fragmento); err != nil {
+			return nil, fmt.Errorf("error scanning document excerpt row: %w", err)
+		}
+		if idArchivo.Valid {
+			id := int(idArchivo.Int64)
+			f.IDArchivo = &id
+		}
+		f.Fragmento = resaltar(f.Fragmento)
+		fragmentos[idGrupo] = append(fragmentos[idGrupo], f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating document excerpt rows: %w", err)
+	}
+	return fragmentos, nil
+}
+
+// SearchDocumentos returns up to limit group documents whose text matches q (websearch
+// syntax), best match first, with a highlighted excerpt, along with the total number of
+// matches. Only the documents the caller may see with vis count: those of visible groups,
+// internal ones only for reviewers and the group's owner.
+func SearchDocumentos(db *sql.DB, q string, vis Visibilidad, limit int) ([]models.DocumentoEncontrado, int, error) {
+	var b queryBuilder
+	tsq := tsQuery(b.arg(q))
+	b.where(fmt.Sprintf(`t.tsv @@ %s`, tsq))
+	b.whereVisible("g", vis)
+	if docs := b.documentoVisibleCondition("d", vis); docs != "" {
+		b.where(docs)
+	}
+	from := ` FROM Grupo_Documento d
+		JOIN Archivo_Texto t ON t.ruta = d.ruta
+		JOIN grupo g ON g.idGrupo = d.idGrupo` + b.whereClause()
+
+	var total int
+	if err := db.QueryRow(`SELECT COUNT(*)`+from, b.args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("error counting matching documents: %w", err)
+	}
+
+	query := fmt.Sprintf(`SELECT d.idGrupo, g.nombre, d.origen, d.idArchivo, d.nombre, ts_headline('spanish_unaccent', t.texto, %[1]s, %[2]s), ts_rank(t.tsv, %[1]s) AS relevancia`,
+		tsq, b.arg(headlineOptions)) + from + ` ORDER BY relevancia DESC, d.idGrupo, d.ruta LIMIT ` + b.arg(limit)
+	rows, err := db.Query(query, b.args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error searching documents: %w", err)
+	}
+	defer rows.Close()
+
+	documentos := []models.DocumentoEncontrado{}
+	for rows.Next() {
+		var d models.DocumentoEncontrado
+		var idArchivo sql.NullInt64
+		if err := rows.Scan(&d.IDGrupo, &d.NombreGrupo, &d.Origen, &idArchivo, &d.Nombre, &d.Fragmento, &d.Relevancia); err != nil {
+			return nil, 0, fmt.Errorf("error scanning matching document row: %w", err)
+		}
+		if idArchivo.Valid {
+			id := int(idArchivo.Int64)
+			d.IDArchivo = &id
+		}
+		d.Fragmento = resaltar(d.Fragmento)
+		documentos = append(documentos, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error after iterating matching document rows: %w", err)
+	}
+	return documentos, total, nil
+}
+
+// resaltado returns the highlighted form of a ts_headline field, or "" when nothing in it matched.
+func resaltado(campo sql.NullString) string {
+	if !campo.Valid || !strings.Contains(campo.String, headlineStart) {
+		return ""
+	}
+	return resaltar(campo.String)
+}
+
+// resaltar HTML-escapes a ts_headline excerpt and turns its markers into <mark> tags.
+func resaltar(fragmento string) string {
+	fragmento = html.EscapeString(fragmento)
+	fragmento = strings.ReplaceAll(fragmento, headlineStart, "<mark>")
+	return strings.ReplaceAll(fragmento, headlineStop, "</mark>")
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+)
+
+// SetEstadoEscaneo inserts or updates the scan state of a stored file. Pending files have
+// no scan time; otherwise e.EscaneadoEn is set to now.
+func SetEstadoEscaneo(db *sql.DB, e *models.ArchivoEscaneo) error {
+	e.EscaneadoEn = nil
+	if e.Estado != models.EscaneoPendiente {
+		now := time.Now()
+		e.EscaneadoEn = &now
+	}
+	query := `INSERT INTO Archivo_Escaneo (ruta, estado, firma, rutaCuarentena, escaneadoEn)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (ruta) DO UPDATE SET estado = EXCLUDED.estado, firma = EXCLUDED.firma,
+			rutaCuarentena = EXCLUDED.rutaCuarentena, escaneadoEn = EXCLUDED.escaneadoEn`
+	_, err := db.Exec(query, e.Ruta, e.Estado, e.Firma, e.RutaCuarentena, e.EscaneadoEn)
+	if err != nil {
+		return fmt.Errorf("error saving file scan state: %w", err)
+	}
+	return nil
+}
+
+// GetEstadoEscaneo returns the scan state of a stored file, or "" if it was never scanned.
+func GetEstadoEscaneo(db *sql.DB, ruta string) (string, error) {
+	var estado string
+	err := db.QueryRow(`SELECT estado FROM Archivo_Escaneo WHERE ruta = $1`, ruta).Scan(&estado)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", fmt.Errorf("error getting file scan state: %w", err)
+	}
+	return estado, nil
+}
+
+// RegistrarIntentoEscaneo records a failed background scan of a stored file and returns its
+// new state: after maxIntentos failures it moves to the error state and is no longer
+// retried. Files that were scanned meanwhile are left alone and "" is returned.
+func RegistrarIntentoEscaneo(db *sql.DB, ruta string, maxIntentos int) (string, error) {
+	query := `INSERT INTO Archivo_Escaneo (ruta, estado, intentos, ultimoIntento)
+		VALUES ($1, CASE WHEN 1 >= $2 THEN 'error' ELSE 'pendiente' END, 1, CURRENT_TIMESTAMP)
+		ON CONFLICT (ruta) DO UPDATE SET intentos = Archivo_Escaneo.intentos + 1,
+			ultimoIntento = CURRENT_TIMESTAMP,
+			estado = CASE WHEN Archivo_Escaneo.intentos + 1 >= $2 THEN 'error' ELSE 'pendiente' END
+		WHERE Archivo_Escaneo.estado = 'pendiente'
+		RETURNING estado`
+	var estado string
+	err := db.QueryRow(query, ruta, maxIntentos).Scan(&estado)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", fmt.Errorf("error saving failed scan attempt: %w", err)
+	}
+	return estado, nil
+}
+
+// GetRutasPorEscanear returns up to limit stored files that still need a scan: those
+// marked pending, and files referenced by a group, resolution or attachment that were
+// uploaded before scanning existed. Files never tried in the background come first, then
+// the ones whose last failed attempt is oldest, so files that keep failing do not hold
+// back new uploads.
+func GetRutasPorEscanear(db *sql.DB, limit int) ([]string, error) {
+	query := `SELECT r.ruta FROM (
+			SELECT ruta FROM Archivo_Escaneo WHERE estado = 'pendiente'
+			UNION
+			SELECT archivo FROM grupo WHERE archivo IS NOT NULL AND archivo <> '' AND NOT archivoFaltante
+			UNION
+			SELECT archivo FROM Resolucion WHERE archivo IS NOT NULL AND archivo <> '' AND NOT archivoFaltante
+			UNION
+			SELECT ruta FROM Grupo_Archivo WHERE NOT archivoFaltante
+		) r
+		LEFT JOIN Archivo_Escaneo e ON e.ruta = r.ruta
+		WHERE e.ruta IS NULL OR e.estado = 'pendiente'
+		ORDER BY e.ultimoIntento NULLS FIRST, r.ruta
+		LIMIT $1`
+	rows, err := db.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying files to scan: %w", err)
+	}
+	defer rows.Close()
+
+	rutas := []string{}
+	for rows.Next() {
+		var ruta string
+		if err := rows.Scan(&ruta); err != nil {
+			return nil, fmt.Errorf("error scanning file path row: %w", err)
+		}
+		rutas = append(rutas, ruta)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating files to scan: %w", err)
+	}
+	return rutas, nil
+}
+
+// DeleteEstadoEscaneo removes the scan record of a file that no longer exists.
+func DeleteEstadoEscaneo(db *sql.DB, ruta string) error {
+	_, err := db.Exec(`DELETE FROM Archivo_Escaneo WHERE ruta = $1`, ruta)
+	if err != nil {
+		return fmt.Errorf("error deleting file scan state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/lib/pq"
+)
+
+// ErrDimensionInvalida is returned for a group statistic other than those in DimensionesEstadistica.
+var ErrDimensionInvalida = errors.New("invalid statistics dimension")
+
+// dimensionEstadistica is a property groups are counted by: the expression of its value in
+// EstadisticaGrupos and the order of its values.
+type dimensionEstadistica struct {
+	expr  string
+	orden string
+}
+
+// dimensionesEstadistica are the group statistics of GetGruposPorDimension. Years are
+// sorted chronologically, for time series; the others from the most frequent value.
+var dimensionesEstadistica = map[string]dimensionEstadistica{
+	"tipo":     {expr: "tipoInvestigacion", orden: "2 DESC, 1"},
+	"linea":    {expr: "lineaInvestigacion", orden: "2 DESC, 1"},
+	"anio":     {expr: "EXTRACT(YEAR FROM fechaRegistro)::INT::TEXT", orden: "1"},
+	"facultad": {expr: "COALESCE(facultad, 'Sin facultad')", orden: "2 DESC, 1"},
+	"estado":   {expr: "estado", orden: "2 DESC, 1"},
+}
+
+// DimensionesEstadistica lists the dimensions accepted by GetGruposPorDimension.
+func DimensionesEstadistica() []string {
+	dimensiones := make([]string, 0, len(dimensionesEstadistica))
+	for d := range dimensionesEstadistica {
+		dimensiones = append(dimensiones, d)
+	}
+	sort.Strings(dimensiones)
+	return dimensiones
+}
+
+// EstadisticaFilter restricts the groups statistics are computed over.
+type EstadisticaFilter struct {
+	Desde       *time.Time // fechaRegistro from, inclusive
+	Hasta       *time.Time // fechaRegistro to, inclusive
+	Visibilidad Visibilidad
+}
+
+// vistasEstadistica are the materialized views the statistics are read from, in refresh order.
+var vistasEstadistica = []string{"estadistica_grupo", "estadistica_membresia"}
+
+// estadisticaGruposCTE returns the EstadisticaGrupos CTE, the rows of the Estadistica_Grupo
+// view (one per group, with its member and coordinator counts) matching filter, and the
+// builder holding its arguments.
+func estadisticaGruposCTE(filter EstadisticaFilter) (string, *queryBuilder) {
+	b := &queryBuilder{}
+	b.whereVisible("Estadistica_Grupo", filter.Visibilidad)
+	if filter.Desde != nil {
+		b.where("fechaRegistro >= " + b.arg(*filter.Desde))
+	}
+	if filter.Hasta != nil {
+		b.where("fechaRegistro <= " + b.arg(*filter.Hasta))
+	}
+	return `WITH EstadisticaGrupos AS (
+		SELECT * FROM Estadistica_Grupo` + b.whereClause() + `
+	)`, b
+}
+
+// RefrescarEstadisticas refreshes the materialized views of the statistics without blocking
+// their readers, and records when. It returns the time of the refresh.
+func RefrescarEstadisticas(db *sql.DB) (time.Time, error) {
+	for _, vista := range vistasEstadistica {
+		if _, err := db.Exec(`REFRESH MATERIALIZED VIEW CONCURRENTLY ` + vista); err != nil {
+			return time.Time{}, fmt.Errorf("error refreshing %s: %w", vista, err)
+		}
+		_, err := db.Exec(`INSERT INTO Vista_Refresco (vista, refrescadaEn) VALUES ($1, CURRENT_TIMESTAMP)
+			ON CONFLICT (vista) DO UPDATE SET refrescadaEn = EXCLUDED.refrescadaEn`, vista)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("error recording refresh of %s: %w", vista, err)
+		}
+	}
+	return GetEstadisticasRefrescadas(db)
+}
+
+// GetEstadisticasRefrescadas returns when the statistics were last refreshed: the oldest
+// refresh among their views, or the zero time if one was never recorded.
+func GetEstadisticasRefrescadas(db *sql.DB) (time.Time, error) {
+	var refrescadaEn sql.NullTime
+	err := db.QueryRow(`SELECT CASE WHEN COUNT(*) = $2 THEN MIN(refrescadaEn) END FROM Vista_Refresco WHERE vista = ANY($1)`,
+		pq.Array(vistasEstadistica), len(vistasEstadistica)).Scan(&refrescadaEn)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error getting statistics refresh time: %w", err)
+	}
+	return refrescadaEn.Time, nil
+}
+
+// GetGruposPorDimension counts the groups matching filter by one of DimensionesEstadistica.
+func GetGruposPorDimension(db *sql.DB, filter EstadisticaFilter, dimension string) ([]models.FacetaValor, error) {
+	d, ok := dimensionesEstadistica[dimension]
+	if !ok {
+		return nil, fmt.Errorf("%w '%s' (allowed: %s)", ErrDimensionInvalida, dimension, strings.Join(DimensionesEstadistica(), ", "))
+	}
+	cte, b := estadisticaGruposCTE(filter)
+	query := cte + `
+		SELECT ` + d.expr + `, COUNT(*) FROM EstadisticaGrupos GROUP BY 1 ORDER BY ` + d.orden
+
+	rows, err := db.Query(query, b.args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying groups by %s: %w", dimension, err)
+	}
+	defer rows.Close()
+
+	valores := []models.FacetaValor{}
+	for rows.Next() {
+		var v models.FacetaValor
+		if err := rows.Scan(&v.Valor, &v.Total); err != nil {
+			return nil, fmt.Errorf("error scanning groups by %s: %w", dimension, err)
+		}
+		valores = append(valores, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating groups by %s: %w", dimension, err)
+	}
+	return valores, nil
+}
+
+// GetEstadisticaIntegrantes summarizes the number of members of the groups matching filter.
+func GetEstadisticaIntegrantes(db *sql.DB, filter EstadisticaFilter) (*models.EstadisticaIntegrantes, error) {
+	cte, b := estadisticaGruposCTE(filter)
+	e := &models.EstadisticaIntegrantes{Distribucion: []models.FacetaValor{}}
+	err := db.QueryRow(cte+`
+		SELECT COUNT(*), COALESCE(SUM(integrantes), 0), COALESCE(AVG(integrantes), 0),
+			COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY integrantes), 0),
+			COALESCE(MIN(integrantes), 0), COALESCE(MAX(integrantes), 0)
+		FROM EstadisticaGrupos`, b.args...).Scan(&e.Grupos, &e.Integrantes, &e.Promedio, &e.Mediana, &e.Minimo, &e.Maximo)
+	if err != nil {
+		return nil, fmt.Errorf("error querying members per group: %w", err)
+	}
+
+	rows, err := db.Query(cte+`
+		SELECT integrantes::TEXT, COUNT(*) FROM EstadisticaGrupos GROUP BY integrantes ORDER BY integrantes`, b.args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying members per group distribution: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v models.FacetaValor
+		if err := rows.Scan(&v.Valor, &v.Total); err != nil {
+			return nil, fmt.Errorf("error scanning members per group distribution: %w", err)
+		}
+		e.Distribucion = append(e.Distribucion, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating members per group distribution: %w", err)
+	}
+	return e, nil
+}
+
+// GetInvestigadoresMultigrupo lists the investigators who belong to at least minGrupos of
+// the groups matching filter, from the one in most groups.
+func GetInvestigadoresMultigrupo(db *sql.DB, filter EstadisticaFilter, minGrupos int) ([]models.InvestigadorMultigrupo, error) {
+	cte, b := estadisticaGruposCTE(filter)
+	query := cte + `
+		SELECT m.idInvestigador, m.nombre, m.apellido, COUNT(*), array_agg(eg.nombre ORDER BY eg.nombre)
+		FROM Estadistica_Membresia m
+		JOIN EstadisticaGrupos eg ON eg.idGrupo = m.idGrupo
+		GROUP BY m.idInvestigador, m.nombre, m.apellido
+		HAVING COUNT(*) >= ` + b.arg(minGrupos) + `
+		ORDER BY 4 DESC, m.apellido, m.nombre, m.idInvestigador`
+
+	rows, err := db.Query(query, b.args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying investigators in several groups: %w", err)
+	}
+	defer rows.Close()
+
+	investigadores := []models.InvestigadorMultigrupo{}
+	for rows.Next() {
+		var inv models.InvestigadorMultigrupo
+		if err := rows.Scan(&inv.ID, &inv.Nombre, &inv.Apellido, &inv.Grupos, pq.Array(&inv.Nombres)); err != nil {
+			return nil, fmt.Errorf("error scanning investigator in several groups: %w", err)
+		}
+		investigadores = append(investigadores, inv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating investigators in several groups: %w", err)
+	}
+	return investigadores, nil
+}
+
+// GetGruposSinCoordinador lists the groups matching filter none of whose members has the
+// coordinator role, including groups without members.
+func GetGruposSinCoordinador(db *sql.DB, filter EstadisticaFilter) ([]models.GrupoSinCoordinador, error) {
+	cte, b := estadisticaGruposCTE(filter)
+	query := cte + `
+		SELECT idGrupo, nombre, estado, to_char(fechaRegistro, 'YYYY-MM-DD'), integrantes
+		FROM EstadisticaGrupos
+		WHERE coordinadores = 0
+		ORDER BY nombre, idGrupo`
+
+	rows, err := db.Query(query, b.args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying groups without coordinator: %w", err)
+	}
+	defer rows.Close()
+
+	grupos := []models.GrupoSinCoordinador{}
+	for rows.Next() {
+		var g models.GrupoSinCoordinador
+		if err := rows.Scan(&g.ID, &g.Nombre, &g.Estado, &g.FechaRegistro, &g.Integrantes); err != nil {
+			return nil, fmt.Errorf("error scanning group without coordinator: %w", err)
+		}
+		grupos = append(grupos, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating groups without coordinator: %w", err)
+	}
+	return grupos, nil
+}
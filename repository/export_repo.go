@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+)
+
+// ExportGrupos streams every group matching filter, in the order of SearchGrupos (by name
+// when there is no filter.Q), calling fila once per member with the member's role, or once
+// with a nil integrante for a group without members. The rows of a group are consecutive.
+// Rows are read as fila consumes them, so the result is never held in memory.
+func ExportGrupos(db *sql.DB, filter GrupoFilter, fila func(g models.Grupo, integrante *models.InvestigadorConRol) error) error {
+	porDefecto := ordenLista{{expr: "g.nombre"}}
+	if filter.Q != "" {
+		porDefecto = ordenLista{{expr: "f.relevancia", desc: true}}
+	}
+	o, err := parseOrden(filter.Orden, camposOrdenBusquedaGrupo, porDefecto, "g.idGrupo")
+	if err != nil {
+		return err
+	}
+
+	cte, b := filteredGroupsCTE(filter)
+	query := cte + `
+	SELECT g.idGrupo, g.nombre, g.numeroResolucion, g.lineaInvestigacion, g.tipoInvestigacion, g.facultad, g.fechaRegistro, g.archivo, g.estado, g.createdAt, g.updatedAt,
+		i.idInvestigador, i.nombre, i.apellido, gi.rol, gi.createdAt, gi.updatedAt
+	FROM FilteredGroups f
+	JOIN grupo g ON g.idGrupo = f.idGrupo
+	LEFT JOIN Grupo_Investigador gi ON gi.idGrupo = g.idGrupo
+	LEFT JOIN investigador i ON i.idInvestigador = gi.idInvestigador
+	ORDER BY ` + o.sql(false) + `, i.apellido, i.nombre, i.idInvestigador`
+
+	rows, err := db.Query(query, b.args...)
+	if err != nil {
+		return fmt.Errorf("error querying groups to export: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var g models.Grupo
+		var idInvestigador sql.NullInt64
+		var nombre, apellido, rol sql.NullString
+		var createdAt, updatedAt sql.NullTime
+		if err := rows.Scan(&g.ID, &g.Nombre, &g.NumeroResolucion, &g.LineaInvestigacion, &g.TipoInvestigacion, &g.Facultad, &g.FechaRegistro, &g.Archivo, &g.Estado, &g.CreatedAt, &g.UpdatedAt,
+			&idInvestigador, &nombre, &apellido, &rol, &createdAt, &updatedAt); err != nil {
+			return fmt.Errorf("error scanning group export row: %w", err)
+		}
+		var integrante *models.InvestigadorConRol
+		if idInvestigador.Valid {
+			integrante = &models.InvestigadorConRol{
+				ID: int(idInvestigador.Int64), Nombre: nombre.String, Apellido: apellido.String, Rol: rol.String,
+				CreatedAt: createdAt.Time, UpdatedAt: updatedAt.Time,
+			}
+		}
+		if err := fila(g, integrante); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error after iterating group export rows: %w", err)
+	}
+	return nil
+}
+
+// ExportInvestigadores streams every investigator matching filter (all of them when it has
+// no criteria), in the order of SearchInvestigadores, calling fila once per group they
+// belong to, or once with a nil grupo for an investigator without groups. Only groups
+// visible with vis count. The rows of an investigator are consecutive.
+// Rows are read as fila consumes them, so the result is never held in memory.
+func ExportInvestigadores(db *sql.DB, filter InvestigadorFilter, vis Visibilidad, fila func(inv models.Investigador, grupo *models.MembresiaGrupo) error) error {
+	bq, err := newBusquedaInvestigadores(filter)
+	if err != nil {
+		return err
+	}
+	b := &bq.b
+
+	grupos := `Grupo_Investigador gi JOIN grupo g ON g.idGrupo = gi.idGrupo`
+	if cond := b.visibleCondition("g", vis); cond != "" {
+		grupos += " AND " + cond
+	}
+	query := fmt.Sprintf(`SELECT i.idInvestigador, i.nombre, i.apellido, i.createdAt, i.updatedAt, g.idGrupo, g.nombre, gi.rol
+		FROM (
+			SELECT idInvestigador, nombre, apellido, createdAt, updatedAt, ROW_NUMBER() OVER (ORDER BY %s) AS posicion
+			FROM investigador%s
+		) i
+		LEFT JOIN (%s) ON gi.idInvestigador = i.idInvestigador
+		ORDER BY i.posicion, g.nombre, g.idGrupo`, bq.orden.sql(false), b.whereClause(), grupos)
+
+	return conUmbralSimilitud(db, filter.Umbral, func(tx *sql.Tx) error {
+		rows, err := tx.Query(query, b.args...)
+		if err != nil {
+			return fmt.Errorf("error querying investigators to export: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var inv models.Investigador
+			var idGrupo sql.NullInt64
+			var nombreGrupo, rol sql.NullString
+			if err := rows.Scan(&inv.ID, &inv.Nombre, &inv.Apellido, &inv.CreatedAt, &inv.UpdatedAt, &idGrupo, &nombreGrupo, &rol); err != nil {
+				return fmt.Errorf("error scanning investigator export row: %w", err)
+			}
+			var grupo *models.MembresiaGrupo
+			if idGrupo.Valid {
+				grupo = &models.MembresiaGrupo{IDGrupo: int(idGrupo.Int64), Nombre: nombreGrupo.String, Rol: rol.String}
+			}
+			if err := fila(inv, grupo); err != nil {
+				return err
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error after iterating investigator export rows: %w", err)
+		}
+		return nil
+	})
+}
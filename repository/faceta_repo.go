@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+)
+
+// GetFacetasGrupos counts, for the groups matching filter, how many have each research line,
+// research type, registration year, faculty and state. Groups without a faculty are left out
+// of that facet.
+func GetFacetasGrupos(db *sql.DB, filter GrupoFilter) (*models.FacetasGrupo, error) {
+	cte, b := filteredGroupsCTE(filter)
+	query := cte + `,
+	Facetados AS (
+		SELECT g.* FROM grupo g JOIN FilteredGroups f ON f.idGrupo = g.idGrupo
+	)
+	SELECT 'lineaInvestigacion', lineaInvestigacion, COUNT(*) FROM Facetados GROUP BY 2
+	UNION ALL
+	SELECT 'tipoInvestigacion', tipoInvestigacion, COUNT(*) FROM Facetados GROUP BY 2
+	UNION ALL
+	SELECT 'anio', EXTRACT(YEAR FROM fechaRegistro)::INT::TEXT, COUNT(*) FROM Facetados GROUP BY 2
+	UNION ALL
+	SELECT 'facultad', facultad, COUNT(*) FROM Facetados WHERE facultad IS NOT NULL GROUP BY 2
+	UNION ALL
+	SELECT 'estado', estado, COUNT(*) FROM Facetados GROUP BY 2
+	ORDER BY 1, 3 DESC, 2`
+
+	rows, err := db.Query(query, b.args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying group facets: %w", err)
+	}
+	defer rows.Close()
+
+	facetas := &models.FacetasGrupo{
+		LineaInvestigacion: []models.FacetaValor{},
+		TipoInvestigacion:  []models.FacetaValor{},
+		Anio:               []models.FacetaValor{},
+		Facultad:           []models.FacetaValor{},
+		Estado:             []models.FacetaValor{},
+	}
+	destinos := map[string]*[]models.FacetaValor{
+		"lineaInvestigacion": &facetas.LineaInvestigacion,
+		"tipoInvestigacion":  &facetas.TipoInvestigacion,
+		"anio":               &facetas.Anio,
+		"facultad":           &facetas.Facultad,
+		"estado":             &facetas.Estado,
+	}
+	for rows.Next() {
+		var faceta string
+		var v models.FacetaValor
+		if err := rows.Scan(&faceta, &v.Valor, &v.Total); err != nil {
+			return nil, fmt.Errorf("error scanning group facet row: %w", err)
+		}
+		*destinos[faceta] = append(*destinos[faceta], v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating group facet rows: %w", err)
+	}
+	return facetas, nil
+}
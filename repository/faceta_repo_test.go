@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+)
+
+// recordingDB is a database/sql connector that answers every query with rows and records
+// the last query and its arguments, to test how repository functions build SQL and read
+// its results without PostgreSQL.
+type recordingDB struct {
+	columns []string
+	rows    [][]driver.Value
+	query   string
+	args    []driver.Value
+}
+
+func (f *recordingDB) Connect(context.Context) (driver.Conn, error) { return recordingConn{f}, nil }
+func (f *recordingDB) Driver() driver.Driver                        { return nil }
+
+type recordingConn struct{ db *recordingDB }
+
+func (c recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return recordingStmt{db: c.db, query: query}, nil
+}
+func (c recordingConn) Close() error { return nil }
+func (c recordingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("recording database: transactions not supported")
+}
+
+type recordingStmt struct {
+	db    *recordingDB
+	query string
+}
+
+func (s recordingStmt) Close() error  { return nil }
+func (s recordingStmt) NumInput() int { return -1 }
+func (s recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("recording database: Exec not supported")
+}
+func (s recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.query, s.db.args = s.query, args
+	return &recordingRows{columns: s.db.columns, values: s.db.rows}, nil
+}
+
+type recordingRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *recordingRows) Columns() []string { return r.columns }
+func (r *recordingRows) Close() error      { return nil }
+func (r *recordingRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestGetFacetasGrupos(t *testing.T) {
+	fake := &recordingDB{
+		columns: []string{"faceta", "valor", "total"},
+		rows: [][]driver.Value{
+			{"anio", "2024", int64(3)},
+			{"anio", "2023", int64(1)},
+			{"estado", "activo", int64(4)},
+			{"facultad", "Ciencias", int64(4)},
+			{"lineaInvestigacion", "Biodiversidad", int64(2)},
+			{"lineaInvestigacion", "Recursos hídricos", int64(2)},
+		},
+	}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+
+	filter := GrupoFilter{
+		Q:          "agua",
+		Facultades: []string{"Ciencias"},
+		Visibilidad: Visibilidad{
+			Estados: []string{"activo"}, SoloPublicos: true,
+		},
+	}
+	facetas, err := GetFacetasGrupos(db, filter)
+	if err != nil {
+		t.Fatalf("GetFacetasGrupos: %v", err)
+	}
+
+	want := &models.FacetasGrupo{
+		LineaInvestigacion: []models.FacetaValor{{Valor: "Biodiversidad", Total: 2}, {Valor: "Recursos hídricos", Total: 2}},
+		TipoInvestigacion:  []models.FacetaValor{}, // Empty facets are [] in JSON, not null
+		Anio:               []models.FacetaValor{{Valor: "2024", Total: 3}, {Valor: "2023", Total: 1}},
+		Facultad:           []models.FacetaValor{{Valor: "Ciencias", Total: 4}},
+		Estado:             []models.FacetaValor{{Valor: "activo", Total: 4}},
+	}
+	if !reflect.DeepEqual(facetas, want) {
+		t.Errorf("GetFacetasGrupos =\n%+v\nwant\n%+v", facetas, want)
+	}
+
+	// Facets count the same groups the search lists: every condition of the filter, with
+	// the caller's visibility, applies to FilteredGroups
+	cte, b := filteredGroupsCTE(filter)
+	if !strings.HasPrefix(fake.query, cte) {
+		t.Errorf("facet query does not start with the filtered groups CTE:\n%s", fake.query)
+	}
+	for _, cond := range []string{"g.tsv @@", "unaccent(g.facultad) ILIKE", "g.estado = ANY"} {
+		if !strings.Contains(fake.query, cond) {
+			t.Errorf("facet query lacks %q:\n%s", cond, fake.query)
+		}
+	}
+	if len(fake.args) != len(b.args) || fake.args[0] != "agua" {
+		t.Errorf("facet query args = %v, want the %d filter args starting with the search", fake.args, len(b.args))
+	}
+	for _, faceta := range []string{"'lineaInvestigacion'", "'tipoInvestigacion'", "'anio'", "'facultad'", "'estado'"} {
+		if !strings.Contains(fake.query, faceta) {
+			t.Errorf("facet query lacks the %s facet", faceta)
+		}
+	}
+	if !strings.Contains(fake.query, "facultad IS NOT NULL") {
+		t.Error("groups without a faculty must be left out of the faculty facet")
+	}
+}
@@ -0,0 +1,320 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/utils"
+	"github.com/lib/pq"
+)
+
+// DefaultUmbralDuplicado is the minimum trigram similarity (0-1) of two full names for the
+// investigators to be reported as duplicate candidates.
+const DefaultUmbralDuplicado = 0.6
+
+// duplicadosCTE pairs every two investigators whose normalized names are similar enough, as
+// set by pg_trgm.similarity_threshold, the oldest record first.
+const duplicadosCTE = `
+	WITH Pares AS (
+		SELECT a.idInvestigador AS idA, b.idInvestigador AS idB,
+			similarity(a.nombreNormalizado, b.nombreNormalizado) AS similitud,
+			btrim(regexp_replace(a.nombreNormalizado, '\s+', ' ', 'g')) = btrim(regexp_replace(b.nombreNormalizado, '\s+', ' ', 'g')) AS mismoNombre
+		FROM investigador a
+		JOIN investigador b ON a.idInvestigador < b.idInvestigador AND a.nombreNormalizado % b.nombreNormalizado
+	)`
+
+// GetCandidatosDuplicados returns a page of the pairs of investigators that may be the same
+// person: those whose normalized full names have a trigram similarity of at least umbral
+// (0 means DefaultUmbralDuplicado), exact matches first, with the groups both belong to.
+func GetCandidatosDuplicados(db *sql.DB, umbral float64, limit, offset int) ([]models.CandidatoDuplicado, int, error) {
+	if umbral <= 0 {
+		umbral = DefaultUmbralDuplicado
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, 0, fmt.Errorf("error starting duplicate search transaction: %w", err)
+	}
+	defer tx.Rollback() // Nothing to commit; the setting only lives in this transaction
+
+	if _, err := tx.Exec(`SELECT set_config('pg_trgm.similarity_threshold', $1, true)`, strconv.FormatFloat(umbral, 'f', -1, 64)); err != nil {
+		return nil, 0, fmt.Errorf("error setting similarity threshold: %w", err)
+	}
+
+	var total int
+	if err := tx.QueryRow(duplicadosCTE + ` SELECT COUNT(*) FROM Pares`).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("error querying total duplicate candidate count: %w", err)
+	}
+
+	query := duplicadosCTE + `
+		SELECT p.similitud, p.mismoNombre,
+			a.idInvestigador, a.nombre, a.apellido, COALESCE(a.nombreNormalizado, ''), a.createdAt,
+			(SELECT COUNT(*) FROM Grupo_Investigador x WHERE x.idInvestigador = a.idInvestigador),
+			b.idInvestigador, b.nombre, b.apellido, COALESCE(b.nombreNormalizado, ''), b.createdAt,
+			(SELECT COUNT(*) FROM Grupo_Investigador x WHERE x.idInvestigador = b.idInvestigador),
+			ARRAY(SELECT DISTINCT x.idGrupo FROM Grupo_Investigador x
+				JOIN Grupo_Investigador y ON y.idGrupo = x.idGrupo
+				WHERE x.idInvestigador = a.idInvestigador AND y.idInvestigador = b.idInvestigador ORDER BY 1)
+		FROM Pares p
+		JOIN investigador a ON a.idInvestigador = p.idA
+		JOIN investigador b ON b.idInvestigador = p.idB
+		ORDER BY p.mismoNombre DESC, p.similitud DESC, p.idA, p.idB
+		LIMIT $1 OFFSET $2`
+
+	rows, err := tx.Query(query, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error querying duplicate candidates: %w", err)
+	}
+	defer rows.Close()
+
+	candidatos := []models.CandidatoDuplicado{}
+	for rows.Next() {
+		var c models.CandidatoDuplicado
+		a, b := &c.Investigadores[0], &c.Investigadores[1]
+		var compartidos pq.Int64Array
+		if err := rows.Scan(&c.Similitud, &c.MismoNombre,
+			&a.ID, &a.Nombre, &a.Apellido, &a.NombreNormalizado, &a.CreatedAt, &a.Grupos,
+			&b.ID, &b.Nombre, &b.Apellido, &b.NombreNormalizado, &b.CreatedAt, &b.Grupos,
+			&compartidos); err != nil {
+			return nil, 0, fmt.Errorf("error scanning duplicate candidate: %w", err)
+		}
+		c.GruposCompartidos = make([]int, len(compartidos))
+		for i, id := range compartidos {
+			c.GruposCompartidos[i] = int(id)
+		}
+		candidatos = append(candidatos, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error after iterating duplicate candidates: %w", err)
+	}
+	return candidatos, total, nil
+}
+
+// ErrRolesSinConflicto is returned by FusionarInvestigadores when roles names a group that
+// is not shared by both investigators, so there is no role to choose there.
+var ErrRolesSinConflicto = errors.New("roles given for groups the investigators do not share")
+
+// esRolCoordinador reports whether rol is the coordinator role. It is the Go form of the
+// condition the Estadistica_Grupo view counts coordinators with,
+// lower(unaccent(rol)) LIKE 'coordinador%', and must stay in line with it.
+func esRolCoordinador(rol string) bool {
+	return strings.HasPrefix(strings.ToLower(utils.QuitarTildes(rol)), "coordinador")
+}
+
+// rolFusionado decides the role kept in a group both merged investigators belonged to: the
+// one given in roles for the group, else the coordinator role if either had it, else the
+// survivor's.
+func rolFusionado(idGrupo int, superviviente, eliminado string, roles map[int]string) string {
+	if rol := strings.TrimSpace(roles[idGrupo]); rol != "" {
+		return rol
+	}
+	if esRolCoordinador(eliminado) && !esRolCoordinador(superviviente) {
+		return eliminado
+	}
+	return superviviente
+}
+
+// membresiaFusion is a Grupo_Investigador row of a merged investigator.
+type membresiaFusion struct {
+	id  int
+	rol string
+}
+
+// membresiasFusion locks and returns the memberships of an investigator by group.
+func membresiasFusion(tx *sql.Tx, idInvestigador int) (map[int]membresiaFusion, []int, error) {
+	rows, err := tx.Query(`SELECT idGrupo_Investigador, idGrupo, rol FROM Grupo_Investigador
+		WHERE idInvestigador = $1 ORDER BY idGrupo, idGrupo_Investigador FOR UPDATE`, idInvestigador)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error querying memberships to merge: %w", err)
+	}
+	defer rows.Close()
+
+	membresias := map[int]membresiaFusion{}
+	var extra []int // Repeated rows of a group, already duplicates of the first one
+	for rows.Next() {
+		var m membresiaFusion
+		var idGrupo int
+		if err := rows.Scan(&m.id, &idGrupo, &m.rol); err != nil {
+			return nil, nil, fmt.Errorf("error scanning membership to merge: %w", err)
+		}
+		if _, ok := membresias[idGrupo]; ok {
+			extra = append(extra, m.id)
+			continue
+		}
+		membresias[idGrupo] = m
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error after iterating memberships to merge: %w", err)
+	}
+	return membresias, extra, nil
+}
+
+// FusionarInvestigadores merges the investigator idEliminado into idSuperviviente in a
+// single transaction: its memberships move to the survivor, groups both belonged to keep a
+// single membership with the role chosen by rolFusionado (roles overrides it per group), its
+// references in alerts and certificates follow, and the record is deleted. The merge is
+// recorded in Investigador_Fusion on behalf of idUsuario. Returns nil when either
+// investigator does not exist, and ErrRolesSinConflicto, merging nothing, when roles names
+// a group they do not both belong to.
+func FusionarInvestigadores(db *sql.DB, idSuperviviente, idEliminado int, roles map[int]string, idUsuario *int) (*models.FusionInvestigador, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting merge transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op after a successful commit
+
+	// Lock both records so concurrent merges or edits wait for this one
+	f := &models.FusionInvestigador{IDSuperviviente: idSuperviviente, IDEliminado: idEliminado,
+		GruposMovidos: []int{}, Conflictos: []models.ConflictoRol{}, IDUsuario: idUsuario}
+	rows, err := tx.Query(`SELECT idInvestigador, nombre, apellido FROM investigador WHERE idInvestigador = ANY($1) FOR UPDATE`,
+		pq.Array([]int64{int64(idSuperviviente), int64(idEliminado)}))
+	if err != nil {
+		return nil, fmt.Errorf("error locking investigators to merge: %w", err)
+	}
+	encontrados := 0
+	for rows.Next() {
+		var id int
+		var nombre, apellido string
+		if err := rows.Scan(&id, &nombre, &apellido); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning investigator to merge: %w", err)
+		}
+		if id == idEliminado {
+			f.NombreEliminado, f.ApellidoEliminado = nombre, apellido
+		}
+		encontrados++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating investigators to merge: %w", err)
+	}
+	if encontrados < 2 {
+		return nil, nil
+	}
+
+	supervivientes, repetidas, err := membresiasFusion(tx, idSuperviviente)
+	if err != nil {
+		return nil, err
+	}
+	eliminadas, repetidasEliminado, err := membresiasFusion(tx, idEliminado)
+	if err != nil {
+		return nil, err
+	}
+
+	// A role can only be chosen for groups both belong to
+	var sinConflicto []int
+	for idGrupo := range roles {
+		_, enSuperviviente := supervivientes[idGrupo]
+		_, enEliminado := eliminadas[idGrupo]
+		if !enSuperviviente || !enEliminado {
+			sinConflicto = append(sinConflicto, idGrupo)
+		}
+	}
+	if len(sinConflicto) > 0 {
+		sort.Ints(sinConflicto)
+		return nil, fmt.Errorf("%w: %v", ErrRolesSinConflicto, sinConflicto)
+	}
+
+	borrar := append(repetidas, repetidasEliminado...)
+
+	for idGrupo, m := range eliminadas {
+		s, ok := supervivientes[idGrupo]
+		if !ok {
+			if _, err := tx.Exec(`UPDATE Grupo_Investigador SET idInvestigador = $1, updatedAt = CURRENT_TIMESTAMP WHERE idGrupo_Investigador = $2`,
+				idSuperviviente, m.id); err != nil {
+				return nil, fmt.Errorf("error moving membership: %w", err)
+			}
+			f.GruposMovidos = append(f.GruposMovidos, idGrupo)
+			continue
+		}
+
+		rol := rolFusionado(idGrupo, s.rol, m.rol, roles)
+		if rol != s.rol {
+			if _, err := tx.Exec(`UPDATE Grupo_Investigador SET rol = $1, updatedAt = CURRENT_TIMESTAMP WHERE idGrupo_Investigador = $2`,
+				rol, s.id); err != nil {
+				return nil, fmt.Errorf("error updating merged membership role: %w", err)
+			}
+		}
+		borrar = append(borrar, m.id)
+		f.Conflictos = append(f.Conflictos, models.ConflictoRol{IDGrupo: idGrupo, RolSuperviviente: s.rol, RolEliminado: m.rol, RolFinal: rol})
+	}
+	if len(borrar) > 0 {
+		ids := make([]int64, len(borrar))
+		for i, id := range borrar {
+			ids[i] = int64(id)
+		}
+		if _, err := tx.Exec(`DELETE FROM Grupo_Investigador WHERE idGrupo_Investigador = ANY($1)`, pq.Array(ids)); err != nil {
+			return nil, fmt.Errorf("error deleting merged memberships: %w", err)
+		}
+	}
+	sort.Ints(f.GruposMovidos)
+	sort.Slice(f.Conflictos, func(i, j int) bool { return f.Conflictos[i].IDGrupo < f.Conflictos[j].IDGrupo })
+
+	// Other references to the deleted record follow the survivor
+	for _, tabla := range []string{"Busqueda_Alerta", "Constancia"} {
+		if _, err := tx.Exec(`UPDATE `+tabla+` SET idInvestigador = $1 WHERE idInvestigador = $2`, idSuperviviente, idEliminado); err != nil {
+			return nil, fmt.Errorf("error moving %s references: %w", tabla, err)
+		}
+	}
+
+	detalle, err := json.Marshal(map[string]interface{}{"gruposMovidos": f.GruposMovidos, "conflictos": f.Conflictos})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding merge detail: %w", err)
+	}
+	err = tx.QueryRow(`INSERT INTO Investigador_Fusion (idSuperviviente, idEliminado, nombreEliminado, apellidoEliminado, detalle, idUsuario)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING idFusion, createdAt`,
+		idSuperviviente, idEliminado, f.NombreEliminado, f.ApellidoEliminado, string(detalle), idUsuario).Scan(&f.ID, &f.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error recording merge: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM investigador WHERE idInvestigador = $1`, idEliminado); err != nil {
+		return nil, fmt.Errorf("error deleting merged investigator: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing merge: %w", err)
+	}
+	return f, nil
+}
+
+// GetFusionesInvestigadores returns a page of the recorded investigator merges, newest first.
+func GetFusionesInvestigadores(db *sql.DB, limit, offset int) ([]models.FusionInvestigador, int, error) {
+	var total int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM Investigador_Fusion`).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("error querying total merge count: %w", err)
+	}
+
+	rows, err := db.Query(`SELECT idFusion, idSuperviviente, idEliminado, nombreEliminado, apellidoEliminado, detalle, idUsuario, createdAt
+		FROM Investigador_Fusion ORDER BY createdAt DESC, idFusion DESC LIMIT $1 OFFSET $2`, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error querying merges page: %w", err)
+	}
+	defer rows.Close()
+
+	fusiones := []models.FusionInvestigador{}
+	for rows.Next() {
+		var f models.FusionInvestigador
+		var detalle []byte
+		var idUsuario sql.NullInt64
+		if err := rows.Scan(&f.ID, &f.IDSuperviviente, &f.IDEliminado, &f.NombreEliminado, &f.ApellidoEliminado, &detalle, &idUsuario, &f.CreatedAt); err != nil {
+			return nil, 0, fmt.Errorf("error scanning merge row: %w", err)
+		}
+		if err := json.Unmarshal(detalle, &f); err != nil {
+			return nil, 0, fmt.Errorf("error decoding merge detail: %w", err)
+		}
+		if idUsuario.Valid {
+			id := int(idUsuario.Int64)
+			f.IDUsuario = &id
+		}
+		fusiones = append(fusiones, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error after iterating merge rows: %w", err)
+	}
+	return fusiones, total, nil
+}
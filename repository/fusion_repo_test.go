@@ -0,0 +1,51 @@
+package repository
+
+import "testing"
+
+func TestEsRolCoordinador(t *testing.T) {
+	// Same answers as lower(unaccent(rol)) LIKE 'coordinador%' in the Estadistica_Grupo view
+	tests := []struct {
+		rol  string
+		want bool
+	}{
+		{"Coordinador", true},
+		{"coordinador", true},
+		{"COORDINADOR GENERAL", true},
+		{"Coordinadora", true},
+		{"Coórdinador", true},
+		{"Co-coordinador", false},
+		{" Coordinador", false}, // The view does not trim either
+		{"Integrante", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := esRolCoordinador(tt.rol); got != tt.want {
+			t.Errorf("esRolCoordinador(%q) = %v, want %v", tt.rol, got, tt.want)
+		}
+	}
+}
+
+func TestRolFusionado(t *testing.T) {
+	tests := []struct {
+		name                     string
+		superviviente, eliminado string
+		roles                    map[int]string
+		want                     string
+	}{
+		{name: "same role", superviviente: "Integrante", eliminado: "Integrante", want: "Integrante"},
+		{name: "survivor's role by default", superviviente: "Investigador", eliminado: "Integrante", want: "Investigador"},
+		{name: "coordinator of the deleted record wins", superviviente: "Integrante", eliminado: "Coordinador", want: "Coordinador"},
+		{name: "coordinator written differently", superviviente: "Integrante", eliminado: "COORDINADORA", want: "COORDINADORA"},
+		{name: "both coordinators keep the survivor's", superviviente: "Coordinador", eliminado: "coordinador general", want: "Coordinador"},
+		{name: "explicit role", superviviente: "Coordinador", eliminado: "Integrante", roles: map[int]string{5: " Integrante "}, want: "Integrante"},
+		{name: "blank explicit role is ignored", superviviente: "Integrante", eliminado: "Coordinador", roles: map[int]string{5: "  "}, want: "Coordinador"},
+		{name: "explicit role of another group", superviviente: "Integrante", eliminado: "Asesor", roles: map[int]string{6: "Asesor"}, want: "Integrante"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rolFusionado(5, tt.superviviente, tt.eliminado, tt.roles); got != tt.want {
+				t.Errorf("rolFusionado = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/lib/pq"
+)
+
+// grupoArchivoSelect selects attachment columns together with the malware scan state of
+// the file; files without a scan record are still pending.
+const grupoArchivoSelect = `SELECT a.idArchivo, a.idGrupo, a.categoria, a.descripcion, a.nombreOriginal, a.ruta, a.tamano, a.mimeType, a.checksum, a.visibilidad, a.idUsuario, a.createdAt, COALESCE(e.estado, 'pendiente')
+	FROM Grupo_Archivo a LEFT JOIN Archivo_Escaneo e ON e.ruta = a.ruta`
+
+// CreateGrupoArchivo inserts the metadata of a new group attachment.
+func CreateGrupoArchivo(db *sql.DB, a *models.GrupoArchivo) error {
+	query := `INSERT INTO Grupo_Archivo (idGrupo, categoria, descripcion, nombreOriginal, ruta, tamano, mimeType, checksum, visibilidad, idUsuario) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING idArchivo, createdAt`
+	err := db.QueryRow(query, a.IDGrupo, a.Categoria, a.Descripcion, a.NombreOriginal, a.Ruta, a.Tamano, a.MimeType, a.Checksum, a.Visibilidad, a.IDUsuario).Scan(&a.ID, &a.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error inserting group attachment: %w", err)
+	}
+	return nil
+}
+
+// GetArchivosByGrupoID retrieves the attachments of a group, optionally filtered by category.
+func GetArchivosByGrupoID(db *sql.DB, idGrupo int, categoria string) ([]models.GrupoArchivo, error) {
+	query := grupoArchivoSelect + ` WHERE a.idGrupo = $1`
+	args := []interface{}{idGrupo}
+	if categoria != "" {
+		query += ` AND a.categoria = $2`
+		args = append(args, categoria)
+	}
+	query += ` ORDER BY a.categoria, a.createdAt DESC`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying group attachments: %w", err)
+	}
+	defer rows.Close()
+
+	archivos := []models.GrupoArchivo{}
+	for rows.Next() {
+		a, err := scanGrupoArchivo(rows)
+		if err != nil {
+			return nil, err
+		}
+		archivos = append(archivos, *a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating group attachment rows: %w", err)
+	}
+	return archivos, nil
+}
+
+// GetGrupoArchivoByID retrieves a single attachment of a group, or nil if not found.
+func GetGrupoArchivoByID(db *sql.DB, idGrupo, idArchivo int) (*models.GrupoArchivo, error) {
+	row := db.QueryRow(grupoArchivoSelect+` WHERE a.idGrupo = $1 AND a.idArchivo = $2`, idGrupo, idArchivo)
+	a, err := scanGrupoArchivo(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return a, nil
+}
+
+// DeleteGrupoArchivo deletes the metadata of an attachment. The caller removes the file.
+func DeleteGrupoArchivo(db *sql.DB, idArchivo int) error {
+	_, err := db.Exec(`DELETE FROM Grupo_Archivo WHERE idArchivo = $1`, idArchivo)
+	if err != nil {
+		return fmt.Errorf("error deleting group attachment: %w", err)
+	}
+	return nil
+}
+
+// GetGrupoArchivoByIDOnly retrieves an attachment by its ID alone, or nil if not found.
+// Used by signed download URLs, which do not carry the group ID.
+func GetGrupoArchivoByIDOnly(db *sql.DB, idArchivo int) (*models.GrupoArchivo, error) {
+	row := db.QueryRow(grupoArchivoSelect+` WHERE a.idArchivo = $1`, idArchivo)
+	a, err := scanGrupoArchivo(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return a, nil
+}
+
+// IsRutaVisible reports whether a stored file belongs to a document the user idUsuario (nil
+// for anonymous callers) may see without reviewing rights: a public document (the main file,
+// a resolution or a public attachment) of a group in one of estadosPublicos, or any document
+// of a group the user registered.
+func IsRutaVisible(db *sql.DB, ruta string, estadosPublicos []string, idUsuario *int) (bool, error) {
+	query := `SELECT EXISTS (
+		SELECT 1 FROM grupo g WHERE g.archivo = $1 AND (g.estado = ANY($2) OR g.idUsuario = $3)
+		UNION ALL
+		SELECT 1 FROM Resolucion r JOIN grupo g ON g.idGrupo = r.idGrupo WHERE r.archivo = $1 AND (g.estado = ANY($2) OR g.idUsuario = $3)
+		UNION ALL
+		SELECT 1 FROM Grupo_Archivo a JOIN grupo g ON g.idGrupo = a.idGrupo WHERE a.ruta = $1 AND ((a.visibilidad = 'publico' AND g.estado = ANY($2)) OR g.idUsuario = $3)
+	)`
+	var visible bool
+	if err := db.QueryRow(query, ruta, pq.Array(estadosPublicos), idUsuario).Scan(&visible); err != nil {
+		return false, fmt.Errorf("error checking file visibility: %w", err)
+	}
+	return visible, nil
+}
+
+func scanGrupoArchivo(row rowScanner) (*models.GrupoArchivo, error) {
+	var a models.GrupoArchivo
+	var idUsuario sql.NullInt64
+	err := row.Scan(&a.ID, &a.IDGrupo, &a.Categoria, &a.Descripcion, &a.NombreOriginal, &a.Ruta, &a.Tamano, &a.MimeType, &a.Checksum, &a.Visibilidad, &idUsuario, &a.CreatedAt, &a.EstadoEscaneo)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error scanning group attachment row: %w", err)
+	}
+	if idUsuario.Valid {
+		id := int(idUsuario.Int64)
+		a.IDUsuario = &id
+	}
+	return &a, nil
+}
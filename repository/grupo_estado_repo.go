@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+)
+
+// ErrEstadoDesactualizado is returned by CambiarEstadoGrupo when the group is no longer
+// in the expected state (e.g. another reviewer changed it concurrently).
+var ErrEstadoDesactualizado = errors.New("group state changed concurrently")
+
+// EsPropietarioGrupo reports whether the user idUsuario registered the group idGrupo.
+func EsPropietarioGrupo(db *sql.DB, idGrupo, idUsuario int) (bool, error) {
+	var propietario bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM grupo WHERE idGrupo = $1 AND idUsuario = $2)`, idGrupo, idUsuario).Scan(&propietario)
+	if err != nil {
+		return false, fmt.Errorf("error checking group owner: %w", err)
+	}
+	return propietario, nil
+}
+
+// CambiarEstadoGrupo moves a group from estadoAnterior to h.EstadoNuevo and records the
+// transition in Grupo_Estado_Historial, in a single transaction. If numeroResolucion is
+// not empty it replaces the group's resolution number (used on approval).
+func CambiarEstadoGrupo(db *sql.DB, h *models.GrupoEstadoHistorial, numeroResolucion string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting state transition transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op after a successful commit
+
+	res, err := tx.Exec(`UPDATE grupo SET estado = $1, numeroResolucion = COALESCE(NULLIF($2, ''), numeroResolucion), updatedAt = CURRENT_TIMESTAMP WHERE idGrupo = $3 AND estado = $4`,
+		h.EstadoNuevo, numeroResolucion, h.IDGrupo, h.EstadoAnterior)
+	if err != nil {
+		return fmt.Errorf("error updating group state: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking updated group state: %w", err)
+	}
+	if affected == 0 {
+		return ErrEstadoDesactualizado
+	}
+
+	query := `INSERT INTO Grupo_Estado_Historial (idGrupo, estadoAnterior, estadoNuevo, comentario, idUsuario) VALUES ($1, $2, $3, $4, $5) RETURNING idHistorial, createdAt`
+	err = tx.QueryRow(query, h.IDGrupo, h.EstadoAnterior, h.EstadoNuevo, h.Comentario, h.IDUsuario).Scan(&h.ID, &h.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error inserting group state history: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing state transition: %w", err)
+	}
+	return nil
+}
+
+// GetHistorialEstadosGrupo retrieves the state transitions of a group, oldest first.
+func GetHistorialEstadosGrupo(db *sql.DB, idGrupo int) ([]models.GrupoEstadoHistorial, error) {
+	rows, err := db.Query(`SELECT idHistorial, idGrupo, estadoAnterior, estadoNuevo, comentario, idUsuario, createdAt FROM Grupo_Estado_Historial WHERE idGrupo = $1 ORDER BY createdAt, idHistorial`, idGrupo)
+	if err != nil {
+		return nil, fmt.Errorf("error querying group state history: %w", err)
+	}
+	defer rows.Close()
+
+	historial := []models.GrupoEstadoHistorial{}
+	for rows.Next() {
+		var h models.GrupoEstadoHistorial
+		var idUsuario sql.NullInt64
+		if err := rows.Scan(&h.ID, &h.IDGrupo, &h.EstadoAnterior, &h.EstadoNuevo, &h.Comentario, &idUsuario, &h.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning group state history row: %w", err)
+		}
+		if idUsuario.Valid {
+			id := int(idUsuario.Int64)
+			h.IDUsuario = &id
+		}
+		historial = append(historial, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating group state history rows: %w", err)
+	}
+	return historial, nil
+}
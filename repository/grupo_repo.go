@@ -3,48 +3,181 @@ package repository
 import (
 	"database/sql"
 	"fmt"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
-	// Import math for ceiling calculation
 	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/lib/pq"
 )
 
-// GetAllGrupos retrieves a paginated list of all groups.
-func GetAllGrupos(db *sql.DB, limit, offset int) ([]models.Grupo, int, error) {
+// GrupoFilter holds the search criteria accepted by SearchGrupos.
+// Empty fields are ignored; list fields match any of their values. Visibilidad restricts
+// results to the groups the caller may see, in the lifecycle states they asked for.
+type GrupoFilter struct {
+	Grupo               string
+	Investigador        string
+	Anios               []int
+	LineasInvestigacion []string
+	TiposInvestigacion  []string
+	Facultades          []string
+	FechaDesde          *time.Time // fechaRegistro on or after this date
+	FechaHasta          *time.Time // fechaRegistro on or before this date
+	MinIntegrantes      *int       // At least this many members
+	MaxIntegrantes      *int       // At most this many members
+	Contenido           string     // Words inside the group's documents (websearch syntax)
+	Q                   string     // Full-text query over the group's fields and members (websearch syntax)
+	Visibilidad                    // Also restricts Contenido to the documents the caller may see
+	// Orden is a sort parameter such as "fechaRegistro,-nombre" (see camposOrdenGrupo).
+	Orden string
+}
+
+// HasCriteria reports whether any search criterion (besides Visibilidad and Orden) is set.
+func (f GrupoFilter) HasCriteria() bool {
+	return f.Grupo != "" || f.Investigador != "" || len(f.Anios) > 0 || len(f.LineasInvestigacion) > 0 ||
+		len(f.TiposInvestigacion) > 0 || len(f.Facultades) > 0 || f.FechaDesde != nil || f.FechaHasta != nil ||
+		f.MinIntegrantes != nil || f.MaxIntegrantes != nil || f.Contenido != "" || f.Q != ""
+}
+
+// ParseGrupoFilter reads the group search parameters of a query string (grupo, investigador,
+// año, lineaInvestigacion, tipoInvestigacion, facultad, fechaDesde, fechaHasta,
+// minIntegrantes, maxIntegrantes, contenido, q, estado and sort). List parameters are
+// comma-separated. Only the requested Estados of Visibilidad are set: callers restrict it to
+// what the user may see. Errors describe the invalid parameter.
+func ParseGrupoFilter(query url.Values) (GrupoFilter, error) {
+	filter := GrupoFilter{
+		Grupo:               query.Get("grupo"),
+		Investigador:        query.Get("investigador"),
+		LineasInvestigacion: splitLista(query.Get("lineaInvestigacion")),
+		TiposInvestigacion:  splitLista(query.Get("tipoInvestigacion")),
+		Facultades:          splitLista(query.Get("facultad")),
+		Contenido:           query.Get("contenido"),
+		Q:                   query.Get("q"),
+		Visibilidad:         Visibilidad{Estados: splitLista(query.Get("estado"))},
+		Orden:               query.Get("sort"),
+	}
+
+	for _, a := range splitLista(query.Get("año")) {
+		anio, err := strconv.Atoi(a)
+		if err != nil {
+			return filter, fmt.Errorf("invalid año '%s'", a)
+		}
+		filter.Anios = append(filter.Anios, anio)
+	}
+	for key, dest := range map[string]**time.Time{"fechaDesde": &filter.FechaDesde, "fechaHasta": &filter.FechaHasta} {
+		if value := query.Get(key); value != "" {
+			fecha, err := time.Parse(time.DateOnly, value)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s, use format %s", key, time.DateOnly)
+			}
+			*dest = &fecha
+		}
+	}
+	for key, dest := range map[string]**int{"minIntegrantes": &filter.MinIntegrantes, "maxIntegrantes": &filter.MaxIntegrantes} {
+		if value := query.Get(key); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return filter, fmt.Errorf("invalid %s, use a non-negative integer", key)
+			}
+			*dest = &n
+		}
+	}
+	return filter, nil
+}
+
+// splitLista splits a comma-separated parameter into its non-empty values.
+func splitLista(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// integrantesExpr counts the members of the group aliased g.
+const integrantesExpr = `(SELECT COUNT(*) FROM Grupo_Investigador x WHERE x.idGrupo = g.idGrupo)`
+
+// camposOrdenGrupo whitelists the fields groups can be sorted by, as columns of alias g.
+var camposOrdenGrupo = map[string]string{
+	"nombre":             "g.nombre",
+	"fechaRegistro":      "g.fechaRegistro",
+	"lineaInvestigacion": "g.lineaInvestigacion",
+	"tipoInvestigacion":  "g.tipoInvestigacion",
+	"facultad":           "COALESCE(g.facultad, '')", // Keyset pagination cannot compare NULLs
+	"estado":             "g.estado",
+	"integrantes":        integrantesExpr,
+	"createdAt":          "g.createdAt",
+	"updatedAt":          "g.updatedAt",
+}
+
+// camposOrdenBusquedaGrupo adds the search relevance (FilteredGroups alias f) to camposOrdenGrupo.
+var camposOrdenBusquedaGrupo = func() map[string]string {
+	campos := map[string]string{"relevancia": "f.relevancia"}
+	for k, v := range camposOrdenGrupo {
+		campos[k] = v
+	}
+	return campos
+}()
+
+// GetAllGrupos retrieves a page of all groups visible with vis.
+// orden is a sort parameter (see camposOrdenGrupo); by default groups are sorted by name.
+// The total is -1 for cursor pages, which skip the count.
+func GetAllGrupos(db *sql.DB, vis Visibilidad, orden string, pag Pagina) ([]models.Grupo, int, Cursores, error) {
+	o, err := parseOrden(orden, camposOrdenGrupo, ordenLista{{expr: "g.nombre"}}, "g.idGrupo")
+	if err != nil {
+		return nil, 0, Cursores{}, err
+	}
+	var b queryBuilder
+	b.whereVisible("g", vis)
+
+	// Query for the total count, only for offset pages
+	total := -1
+	if !pag.PorCursor() {
+		countQuery := `SELECT COUNT(*) FROM grupo g` + b.whereClause()
+		if err := db.QueryRow(countQuery, b.args...).Scan(&total); err != nil {
+			return nil, 0, Cursores{}, fmt.Errorf("error querying total group count: %w", err)
+		}
+	}
+
 	// Query for the data page
-	query := `SELECT idGrupo, nombre, numeroResolucion, lineaInvestigacion, tipoInvestigacion, fechaRegistro, archivo, createdAt, updatedAt FROM grupo ORDER BY nombre LIMIT $1 OFFSET $2`
-	rows, err := db.Query(query, limit, offset)
+	paginacion, err := o.paginar(&b, pag)
+	if err != nil {
+		return nil, 0, Cursores{}, err
+	}
+	query := `SELECT idGrupo, nombre, numeroResolucion, lineaInvestigacion, tipoInvestigacion, facultad, fechaRegistro, archivo, estado, createdAt, updatedAt, ` + o.claves() + ` FROM grupo g` + b.whereClause() + paginacion
+	rows, err := db.Query(query, b.args...)
 	if err != nil {
-		return nil, 0, fmt.Errorf("error querying groups page: %w", err)
+		return nil, 0, Cursores{}, fmt.Errorf("error querying groups page: %w", err)
 	}
 	defer rows.Close()
 
 	grupos := []models.Grupo{}
+	claves := [][]string{}
+	destClaves, valoresClaves := o.destinos()
 	for rows.Next() {
 		var g models.Grupo
-		if err := rows.Scan(&g.ID, &g.Nombre, &g.NumeroResolucion, &g.LineaInvestigacion, &g.TipoInvestigacion, &g.FechaRegistro, &g.Archivo, &g.CreatedAt, &g.UpdatedAt); err != nil {
-			return nil, 0, fmt.Errorf("error scanning group row: %w", err)
+		dest := append([]interface{}{&g.ID, &g.Nombre, &g.NumeroResolucion, &g.LineaInvestigacion, &g.TipoInvestigacion, &g.Facultad, &g.FechaRegistro, &g.Archivo, &g.Estado, &g.CreatedAt, &g.UpdatedAt}, destClaves...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, 0, Cursores{}, fmt.Errorf("error scanning group row: %w", err)
 		}
 		grupos = append(grupos, g)
+		claves = append(claves, valoresClaves())
 	}
 	if err := rows.Err(); err != nil {
-		return nil, 0, fmt.Errorf("error after iterating through group rows: %w", err)
-	}
-
-	// Query for the total count
-	var total int
-	countQuery := `SELECT COUNT(*) FROM grupo`
-	if err := db.QueryRow(countQuery).Scan(&total); err != nil {
-		return nil, 0, fmt.Errorf("error querying total group count: %w", err)
+		return nil, 0, Cursores{}, fmt.Errorf("error after iterating through group rows: %w", err)
 	}
 
-	return grupos, total, nil
+	grupos, cursores := recortarPagina(o, pag, grupos, claves)
+	return grupos, total, cursores, nil
 }
 
 // GetGrupoByID retrieves a single group by its ID.
 func GetGrupoByID(db *sql.DB, id int) (*models.Grupo, error) {
 	var g models.Grupo
-	err := db.QueryRow(`SELECT idGrupo, nombre, numeroResolucion, lineaInvestigacion, tipoInvestigacion, fechaRegistro, archivo, createdAt, updatedAt FROM grupo WHERE idGrupo = $1`, id).Scan(&g.ID, &g.Nombre, &g.NumeroResolucion, &g.LineaInvestigacion, &g.TipoInvestigacion, &g.FechaRegistro, &g.Archivo, &g.CreatedAt, &g.UpdatedAt)
+	err := db.QueryRow(`SELECT idGrupo, nombre, numeroResolucion, lineaInvestigacion, tipoInvestigacion, facultad, fechaRegistro, archivo, estado, createdAt, updatedAt FROM grupo WHERE idGrupo = $1`, id).Scan(&g.ID, &g.Nombre, &g.NumeroResolucion, &g.LineaInvestigacion, &g.TipoInvestigacion, &g.Facultad, &g.FechaRegistro, &g.Archivo, &g.Estado, &g.CreatedAt, &g.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil // Return nil for both when not found
@@ -54,123 +187,204 @@ func GetGrupoByID(db *sql.DB, id int) (*models.Grupo, error) {
 	return &g, nil
 }
 
-// CreateGrupo inserts a new group into the database.
-func CreateGrupo(db *sql.DB, g *models.Grupo) error {
-	query := `INSERT INTO grupo (nombre, numeroResolucion, lineaInvestigacion, tipoInvestigacion, fechaRegistro, archivo) VALUES ($1, $2, $3, $4, $5, $6) RETURNING idGrupo, createdAt, updatedAt`
-	err := db.QueryRow(query, g.Nombre, g.NumeroResolucion, g.LineaInvestigacion, g.TipoInvestigacion, g.FechaRegistro, g.Archivo).Scan(&g.ID, &g.CreatedAt, &g.UpdatedAt)
+// CreateGrupo inserts a new group into the database, owned by the user idUsuario (nil if unknown).
+func CreateGrupo(db *sql.DB, g *models.Grupo, idUsuario *int) error {
+	if g.Estado == "" {
+		g.Estado = models.EstadoBorrador
+	}
+	query := `INSERT INTO grupo (nombre, numeroResolucion, lineaInvestigacion, tipoInvestigacion, facultad, fechaRegistro, archivo, estado, idUsuario) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING idGrupo, createdAt, updatedAt`
+	err := db.QueryRow(query, g.Nombre, g.NumeroResolucion, g.LineaInvestigacion, g.TipoInvestigacion, g.Facultad, g.FechaRegistro, g.Archivo, g.Estado, idUsuario).Scan(&g.ID, &g.CreatedAt, &g.UpdatedAt)
 	if err != nil {
 		return fmt.Errorf("error inserting group: %w", err)
 	}
 	return nil
 }
 
-// UpdateGrupo updates an existing group in the database.
+// UpdateGrupo updates an existing group in the database, provided it is still in g.Estado;
+// otherwise it returns ErrEstadoDesactualizado. The lifecycle state is not touched here;
+// use CambiarEstadoGrupo for transitions.
 func UpdateGrupo(db *sql.DB, g *models.Grupo) error {
-	_, err := db.Exec(`UPDATE grupo SET nombre = $1, numeroResolucion = $2, lineaInvestigacion = $3, tipoInvestigacion = $4, fechaRegistro = $5, archivo = $6, updatedAt = CURRENT_TIMESTAMP WHERE idGrupo = $7`, g.Nombre, g.NumeroResolucion, g.LineaInvestigacion, g.TipoInvestigacion, g.FechaRegistro, g.Archivo, g.ID)
+	res, err := db.Exec(`UPDATE grupo SET nombre = $1, numeroResolucion = $2, lineaInvestigacion = $3, tipoInvestigacion = $4, facultad = $5, fechaRegistro = $6, archivo = $7, updatedAt = CURRENT_TIMESTAMP WHERE idGrupo = $8 AND estado = $9`, g.Nombre, g.NumeroResolucion, g.LineaInvestigacion, g.TipoInvestigacion, g.Facultad, g.FechaRegistro, g.Archivo, g.ID, g.Estado)
 	if err != nil {
 		return fmt.Errorf("error updating group: %w", err)
 	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking updated group: %w", err)
+	}
+	if affected == 0 {
+		return ErrEstadoDesactualizado
+	}
 	return nil
 }
 
-// DeleteGrupo deletes a group from the database.
-func DeleteGrupo(db *sql.DB, id int) error {
-	_, err := db.Exec(`DELETE FROM grupo WHERE idGrupo = $1`, id)
+// DeleteGrupo deletes a group from the database, provided it is still in estado; otherwise
+// it returns ErrEstadoDesactualizado.
+func DeleteGrupo(db *sql.DB, id int, estado string) error {
+	res, err := db.Exec(`DELETE FROM grupo WHERE idGrupo = $1 AND estado = $2`, id, estado)
 	if err != nil {
 		return fmt.Errorf("error deleting group: %w", err)
 	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking deleted group: %w", err)
+	}
+	if affected == 0 {
+		return ErrEstadoDesactualizado
+	}
 	return nil
 }
 
-// SearchGrupos searches for groups with pagination and returns them with investigators and roles.
-func SearchGrupos(db *sql.DB, groupName, investigatorName, year, lineaInvestigacion, tipoInvestigacion string, limit, offset int) ([]models.GrupoWithInvestigadores, int, error) {
-	args := []interface{}{}
-	placeholderCount := 1
+// filteredGroupsCTE returns a "WITH FilteredGroups" clause selecting the idGrupo and
+// relevancia of every group matching filter, and the builder holding its arguments.
+// When filter.Q is set it is always argument $1, so callers can reuse tsQuery("$1").
+func filteredGroupsCTE(filter GrupoFilter) (string, *queryBuilder) {
+	b := &queryBuilder{}
 
-	// --- Build WHERE clause dynamically (for the initial filtering CTE) ---
-	whereConditions := ""
-
-	if groupName != "" {
-		whereConditions += fmt.Sprintf(` AND unaccent(g.nombre) ILIKE unaccent($%d)`, placeholderCount)
-		args = append(args, "%"+groupName+"%")
-		placeholderCount++
+	relevancia := "0::REAL"
+	if filter.Q != "" {
+		tsq := tsQuery(b.arg(filter.Q))
+		b.where(fmt.Sprintf(`(g.tsv @@ %s OR i.tsv @@ %s)`, tsq, tsq))
+		relevancia = fmt.Sprintf(`MAX(COALESCE(ts_rank(g.tsv, %s), 0) + COALESCE(ts_rank(i.tsv, %s), 0) * 0.5)`, tsq, tsq)
 	}
-
-	if investigatorName != "" {
-		whereConditions += fmt.Sprintf(` AND unaccent(i.nombre || ' ' || i.apellido) ILIKE unaccent($%d)`, placeholderCount)
-		args = append(args, "%"+investigatorName+"%")
-		placeholderCount++
+	if filter.Grupo != "" {
+		b.whereILike("g.nombre", []string{filter.Grupo})
 	}
-
-	if year != "" {
-		whereConditions += fmt.Sprintf(` AND EXTRACT(YEAR FROM g.fechaRegistro) = $%d`, placeholderCount)
-		args = append(args, year)
-		placeholderCount++
+	if filter.Investigador != "" {
+		b.whereILike("i.nombre || ' ' || i.apellido", []string{filter.Investigador})
 	}
-
-	if lineaInvestigacion != "" {
-		whereConditions += fmt.Sprintf(` AND unaccent(g.lineaInvestigacion) ILIKE unaccent($%d)`, placeholderCount)
-		args = append(args, "%"+lineaInvestigacion+"%")
-		placeholderCount++
+	if len(filter.Anios) > 0 {
+		anios := make([]int64, len(filter.Anios))
+		for i, a := range filter.Anios {
+			anios[i] = int64(a)
+		}
+		b.where(fmt.Sprintf(`EXTRACT(YEAR FROM g.fechaRegistro)::INT = ANY(%s)`, b.arg(pq.Array(anios))))
 	}
-
-	if tipoInvestigacion != "" {
-		whereConditions += fmt.Sprintf(` AND unaccent(g.tipoInvestigacion) ILIKE unaccent($%d)`, placeholderCount)
-		args = append(args, "%"+tipoInvestigacion+"%")
-		placeholderCount++
+	b.whereILike("g.lineaInvestigacion", filter.LineasInvestigacion)
+	b.whereILike("g.tipoInvestigacion", filter.TiposInvestigacion)
+	b.whereILike("g.facultad", filter.Facultades)
+	if filter.FechaDesde != nil {
+		b.where("g.fechaRegistro >= " + b.arg(*filter.FechaDesde))
+	}
+	if filter.FechaHasta != nil {
+		b.where("g.fechaRegistro <= " + b.arg(*filter.FechaHasta))
+	}
+	if filter.MinIntegrantes != nil {
+		b.where(integrantesExpr + " >= " + b.arg(*filter.MinIntegrantes))
 	}
-	// --- End WHERE clause build ---
+	if filter.MaxIntegrantes != nil {
+		b.where(integrantesExpr + " <= " + b.arg(*filter.MaxIntegrantes))
+	}
+	if filter.Contenido != "" {
+		b.where(b.contenidoCondition("g.idGrupo", b.arg(filter.Contenido), filter.Visibilidad))
+	}
+	b.whereVisible("g", filter.Visibilidad)
 
-	// CTE 1: Find all unique group IDs matching the filters
-	cteFilteredGroups := `
+	cte := `
 	WITH FilteredGroups AS (
-		SELECT DISTINCT g.idGrupo
+		SELECT g.idGrupo, ` + relevancia + ` AS relevancia
 		FROM grupo g
 		LEFT JOIN Grupo_Investigador dgi ON g.idGrupo = dgi.idGrupo
-		LEFT JOIN investigador i ON dgi.idInvestigador = i.idInvestigador
-		WHERE 1=1` + whereConditions + `
+		LEFT JOIN investigador i ON dgi.idInvestigador = i.idInvestigador` + b.whereClause() + `
+		GROUP BY g.idGrupo
 	)`
+	return cte, b
+}
+
+// idsGruposFiltrados returns the IDs of every group matching filter, without pagination,
+// as seen by tx.
+func idsGruposFiltrados(tx *sql.Tx, filter GrupoFilter) ([]int, error) {
+	cte, b := filteredGroupsCTE(filter)
+	rows, err := tx.Query(cte+` SELECT idGrupo FROM FilteredGroups ORDER BY idGrupo`, b.args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying matching group IDs: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scanning matching group ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating matching group IDs: %w", err)
+	}
+	return ids, nil
+}
 
-	// --- Query for the total count using the first CTE ---
-	var totalItems int
-	countQuery := cteFilteredGroups + ` SELECT COUNT(*) FROM FilteredGroups`
-	if err := db.QueryRow(countQuery, args...).Scan(&totalItems); err != nil { // Use original args for count
-		return nil, 0, fmt.Errorf("error searching total group count: %w", err)
+// SearchGrupos searches for groups with pagination and returns them with investigators and roles.
+// With filter.Q results are ordered by relevance (a member's name match counts half as much as
+// a match in the group's own fields) and carry the highlighted fields that matched; filter.Orden
+// overrides the order.
+func SearchGrupos(db *sql.DB, filter GrupoFilter, pag Pagina) ([]models.GrupoWithInvestigadores, int, Cursores, error) {
+	o, err := parseOrden(filter.Orden, camposOrdenBusquedaGrupo, ordenLista{{expr: "f.relevancia", desc: true}}, "g.idGrupo")
+	if err != nil {
+		return nil, 0, Cursores{}, err
 	}
 
-	// If no items found, return early
-	if totalItems == 0 {
-		return []models.GrupoWithInvestigadores{}, 0, nil
+	// CTE 1: Find all unique group IDs matching the filters, with their relevance
+	cteFilteredGroups, b := filteredGroupsCTE(filter)
+
+	// --- Query for the total count using the first CTE, only for offset pages ---
+	totalItems := -1
+	if !pag.PorCursor() {
+		countQuery := cteFilteredGroups + ` SELECT COUNT(*) FROM FilteredGroups`
+		if err := db.QueryRow(countQuery, b.args...).Scan(&totalItems); err != nil {
+			return nil, 0, Cursores{}, fmt.Errorf("error searching total group count: %w", err)
+		}
+
+		// If no items found, return early
+		if totalItems == 0 {
+			return []models.GrupoWithInvestigadores{}, 0, Cursores{}, nil
+		}
 	}
 
 	// --- Build the final query to get paginated details ---
 
-	// CTE 2: Paginate the filtered group IDs
+	// CTE 2: Paginate the filtered group IDs, numbering them in the order they are read.
+	// Its conditions (the cursor's keyset) continue the placeholders of CTE 1.
+	pb := &queryBuilder{args: b.args}
+	paginacion, err := o.paginar(pb, pag)
+	if err != nil {
+		return nil, 0, Cursores{}, err
+	}
 	ctePaginatedIDs := fmt.Sprintf(`,
 	PaginatedGroupIDs AS (
-		SELECT idGrupo
-		FROM FilteredGroups
-		ORDER BY idGrupo -- Or another relevant field like g.nombre from the join if needed
-		LIMIT $%d OFFSET $%d
-	)`, placeholderCount, placeholderCount+1)
+		SELECT f.idGrupo, f.relevancia, ROW_NUMBER() OVER (ORDER BY %s) AS posicion, %s
+		FROM FilteredGroups f
+		JOIN grupo g ON g.idGrupo = f.idGrupo%s%s
+	)`, o.sql(pag.Before != ""), o.claves(), pb.whereClause(), paginacion)
+
+	// Highlighted fields, only computed for full-text searches
+	resaltados := `NULL::TEXT, NULL::TEXT, NULL::TEXT`
+	if filter.Q != "" {
+		tsq := tsQuery("$1")
+		opts := pb.arg(headlineCampoOptions)
+		resaltados = fmt.Sprintf(`ts_headline('spanish_unaccent', g.nombre, %[1]s, %[2]s),
+		ts_headline('spanish_unaccent', g.lineaInvestigacion, %[1]s, %[2]s),
+		ts_headline('spanish_unaccent', g.tipoInvestigacion, %[1]s, %[2]s)`, tsq, opts)
+	}
+	finalArgs := pb.args
 
 	// Main query to get details for the paginated group IDs
 	dataQuery := cteFilteredGroups + ctePaginatedIDs + `
 	SELECT
-		g.idGrupo, g.nombre, g.numeroResolucion, g.lineaInvestigacion, g.tipoInvestigacion, g.fechaRegistro, g.archivo, g.createdAt, g.updatedAt,
+		g.idGrupo, g.nombre, g.numeroResolucion, g.lineaInvestigacion, g.tipoInvestigacion, g.facultad, g.fechaRegistro, g.archivo, g.estado, g.createdAt, g.updatedAt,
 		i.idInvestigador, i.nombre as invNombre, i.apellido as invApellido, i.createdAt as invCreatedAt, i.updatedAt as invUpdatedAt,
-		dgi.rol
+		dgi.rol, p.relevancia,
+		` + resaltados + `,
+		` + o.clavesDe("p") + `
 	FROM grupo g
+	JOIN PaginatedGroupIDs p ON p.idGrupo = g.idGrupo
 	LEFT JOIN Grupo_Investigador dgi ON g.idGrupo = dgi.idGrupo
 	LEFT JOIN investigador i ON dgi.idInvestigador = i.idInvestigador
-	WHERE g.idGrupo IN (SELECT idGrupo FROM PaginatedGroupIDs)
-	ORDER BY g.idGrupo, i.idInvestigador -- Ensure consistent order for grouping`
-
-	// Append limit and offset to the original args
-	finalArgs := append(args, limit, offset)
+	ORDER BY p.posicion, i.idInvestigador -- Ensure consistent order for grouping`
 	rows, err := db.Query(dataQuery, finalArgs...)
 	if err != nil {
-		return nil, 0, fmt.Errorf("error searching groups page with details: %w, Query: %s, Args: %v", err, dataQuery, finalArgs)
+		return nil, 0, Cursores{}, fmt.Errorf("error searching groups page with details: %w, Query: %s, Args: %v", err, dataQuery, finalArgs)
 	}
 	defer rows.Close()
 
@@ -178,19 +392,25 @@ func SearchGrupos(db *sql.DB, groupName, investigatorName, year, lineaInvestigac
 	grupoMap := make(map[int]*models.GrupoWithInvestigadores)
 	// Slice to maintain order based on PaginatedGroupIDs query order
 	orderedGrupos := []*models.GrupoWithInvestigadores{}
+	claves := [][]string{} // Sort keys of each group in orderedGrupos
+	destClaves, valoresClaves := o.destinos()
 
 	for rows.Next() {
 		var g models.Grupo
 		var invID sql.NullInt64 // Use Null types for LEFT JOIN results
 		var invNombre, invApellido, invRol sql.NullString
 		var invCreatedAt, invUpdatedAt sql.NullTime
+		var relevancia float64
+		var hNombre, hLinea, hTipo sql.NullString
 
-		if err := rows.Scan(
-			&g.ID, &g.Nombre, &g.NumeroResolucion, &g.LineaInvestigacion, &g.TipoInvestigacion, &g.FechaRegistro, &g.Archivo, &g.CreatedAt, &g.UpdatedAt,
+		dest := append([]interface{}{
+			&g.ID, &g.Nombre, &g.NumeroResolucion, &g.LineaInvestigacion, &g.TipoInvestigacion, &g.Facultad, &g.FechaRegistro, &g.Archivo, &g.Estado, &g.CreatedAt, &g.UpdatedAt,
 			&invID, &invNombre, &invApellido, &invCreatedAt, &invUpdatedAt,
-			&invRol,
-		); err != nil {
-			return nil, 0, fmt.Errorf("error scanning group/investigator row during search: %w", err)
+			&invRol, &relevancia,
+			&hNombre, &hLinea, &hTipo,
+		}, destClaves...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, 0, Cursores{}, fmt.Errorf("error scanning group/investigator row during search: %w", err)
 		}
 
 		// Check if we've already seen this group
@@ -200,9 +420,19 @@ func SearchGrupos(db *sql.DB, groupName, investigatorName, year, lineaInvestigac
 			grupoWithDetails = &models.GrupoWithInvestigadores{
 				Grupo:          g,
 				Investigadores: []models.InvestigadorConRol{}, // Initialize empty slice
+				Relevancia:     relevancia,
+			}
+			for campo, h := range map[string]sql.NullString{"nombre": hNombre, "lineaInvestigacion": hLinea, "tipoInvestigacion": hTipo} {
+				if texto := resaltado(h); texto != "" {
+					if grupoWithDetails.Resaltado == nil {
+						grupoWithDetails.Resaltado = map[string]string{}
+					}
+					grupoWithDetails.Resaltado[campo] = texto
+				}
 			}
 			grupoMap[g.ID] = grupoWithDetails
 			orderedGrupos = append(orderedGrupos, grupoWithDetails) // Add to ordered list
+			claves = append(claves, valoresClaves())
 		}
 
 		// If an investigator was joined (not a group without investigators matched by filter)
@@ -225,7 +455,7 @@ func SearchGrupos(db *sql.DB, groupName, investigatorName, year, lineaInvestigac
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, 0, fmt.Errorf("error after iterating through group search rows: %w", err)
+		return nil, 0, Cursores{}, fmt.Errorf("error after iterating through group search rows: %w", err)
 	}
 
 	// Convert []*models.GrupoWithInvestigadores to []models.GrupoWithInvestigadores
@@ -234,7 +464,8 @@ func SearchGrupos(db *sql.DB, groupName, investigatorName, year, lineaInvestigac
 		result[i] = *ptr
 	}
 
-	return result, totalItems, nil
+	result, cursores := recortarPagina(o, pag, result, claves)
+	return result, totalItems, cursores, nil
 }
 
 // GetGrupoDetails retrieves a group and its associated investigators including their roles.
@@ -288,13 +519,16 @@ func GetGrupoDetails(db *sql.DB, id int) (*models.GrupoWithInvestigadores, error
 }
 
 // GetGruposByInvestigadorID obtiene todos los grupos a los que pertenece un investigador dado su id.
-func GetGruposByInvestigadorID(db *sql.DB, idInvestigador int) ([]map[string]interface{}, error) {
-	query := `SELECT g.idGrupo, g.nombre, g.numeroResolucion, g.lineaInvestigacion, g.tipoInvestigacion, g.fechaRegistro, g.archivo, g.createdAt, g.updatedAt
+// Solo se devuelven los grupos visibles con vis.
+func GetGruposByInvestigadorID(db *sql.DB, idInvestigador int, vis Visibilidad) ([]map[string]interface{}, error) {
+	var b queryBuilder
+	b.where("dgi.idInvestigador = " + b.arg(idInvestigador))
+	b.whereVisible("g", vis)
+	query := `SELECT g.idGrupo, g.nombre, g.numeroResolucion, g.lineaInvestigacion, g.tipoInvestigacion, g.facultad, g.fechaRegistro, g.archivo, g.estado, g.createdAt, g.updatedAt
 				 , dgi.rol
 			 FROM grupo g
-			 JOIN Grupo_Investigador dgi ON g.idGrupo = dgi.idGrupo
-			 WHERE dgi.idInvestigador = $1`
-	rows, err := db.Query(query, idInvestigador)
+			 JOIN Grupo_Investigador dgi ON g.idGrupo = dgi.idGrupo` + b.whereClause()
+	rows, err := db.Query(query, b.args...)
 	if err != nil {
 		return nil, fmt.Errorf("error obteniendo grupos por idInvestigador: %w", err)
 	}
@@ -304,7 +538,7 @@ func GetGruposByInvestigadorID(db *sql.DB, idInvestigador int) ([]map[string]int
 	for rows.Next() {
 		var g models.Grupo
 		var rol string
-		if err := rows.Scan(&g.ID, &g.Nombre, &g.NumeroResolucion, &g.LineaInvestigacion, &g.TipoInvestigacion, &g.FechaRegistro, &g.Archivo, &g.CreatedAt, &g.UpdatedAt, &rol); err != nil {
+		if err := rows.Scan(&g.ID, &g.Nombre, &g.NumeroResolucion, &g.LineaInvestigacion, &g.TipoInvestigacion, &g.Facultad, &g.FechaRegistro, &g.Archivo, &g.Estado, &g.CreatedAt, &g.UpdatedAt, &rol); err != nil {
 			return nil, fmt.Errorf("error escaneando grupo: %w", err)
 		}
 
@@ -348,44 +582,66 @@ func GetGruposByInvestigadorID(db *sql.DB, idInvestigador int) ([]map[string]int
 }
 
 // GetAllGruposWithDetails retrieves a paginated list of all groups with their associated investigators and roles.
-func GetAllGruposWithDetails(db *sql.DB, limit, offset int) ([]models.GrupoWithInvestigadores, int, error) {
-	// 1. Get the total count of groups
-	var totalItems int
-	countQuery := `SELECT COUNT(*) FROM grupo`
-	if err := db.QueryRow(countQuery).Scan(&totalItems); err != nil {
-		return nil, 0, fmt.Errorf("error querying total group count for get all with details: %w", err)
+// Only groups visible with vis are returned. orden is a sort parameter
+// (see camposOrdenGrupo); by default groups are sorted by name. The total is -1 for cursor
+// pages, which skip the count.
+func GetAllGruposWithDetails(db *sql.DB, vis Visibilidad, orden string, pag Pagina) ([]models.GrupoWithInvestigadores, int, Cursores, error) {
+	o, err := parseOrden(orden, camposOrdenGrupo, ordenLista{{expr: "g.nombre"}}, "g.idGrupo")
+	if err != nil {
+		return nil, 0, Cursores{}, err
 	}
+	var b queryBuilder
+	b.whereVisible("g", vis)
+
+	// 1. Get the total count of groups, only for offset pages
+	totalItems := -1
+	if !pag.PorCursor() {
+		countQuery := `SELECT COUNT(*) FROM grupo g` + b.whereClause()
+		if err := db.QueryRow(countQuery, b.args...).Scan(&totalItems); err != nil {
+			return nil, 0, Cursores{}, fmt.Errorf("error querying total group count for get all with details: %w", err)
+		}
 
-	// If no groups, return early
-	if totalItems == 0 {
-		return []models.GrupoWithInvestigadores{}, 0, nil
+		// If no groups, return early
+		if totalItems == 0 {
+			return []models.GrupoWithInvestigadores{}, 0, Cursores{}, nil
+		}
 	}
 
 	// 2. Get the IDs of the groups for the current page
-	paginatedIDsQuery := `SELECT idGrupo FROM grupo ORDER BY nombre, idGrupo LIMIT $1 OFFSET $2`
-	rowsIDs, err := db.Query(paginatedIDsQuery, limit, offset)
+	paginacion, err := o.paginar(&b, pag)
 	if err != nil {
-		return nil, 0, fmt.Errorf("error querying paginated group IDs: %w", err)
+		return nil, 0, Cursores{}, err
+	}
+	paginatedIDsQuery := `SELECT g.idGrupo, ` + o.claves() + ` FROM grupo g` + b.whereClause() + paginacion
+	rowsIDs, err := db.Query(paginatedIDsQuery, b.args...)
+	if err != nil {
+		return nil, 0, Cursores{}, fmt.Errorf("error querying paginated group IDs: %w", err)
 	}
 	defer rowsIDs.Close()
 
-	var groupIDs []interface{} // Use interface{} for IN clause argument
-	var groupIDOrder []int     // Maintain the order for final result sorting
+	var groupIDOrder []int // Maintain the order for final result sorting
+	var claves [][]string
+	destClaves, valoresClaves := o.destinos()
 	for rowsIDs.Next() {
 		var id int
-		if err := rowsIDs.Scan(&id); err != nil {
-			return nil, 0, fmt.Errorf("error scanning group ID: %w", err)
+		if err := rowsIDs.Scan(append([]interface{}{&id}, destClaves...)...); err != nil {
+			return nil, 0, Cursores{}, fmt.Errorf("error scanning group ID: %w", err)
 		}
-		groupIDs = append(groupIDs, id)
 		groupIDOrder = append(groupIDOrder, id)
+		claves = append(claves, valoresClaves())
 	}
 	if err := rowsIDs.Err(); err != nil {
-		return nil, 0, fmt.Errorf("error after iterating group IDs: %w", err)
+		return nil, 0, Cursores{}, fmt.Errorf("error after iterating group IDs: %w", err)
+	}
+	groupIDOrder, cursores := recortarPagina(o, pag, groupIDOrder, claves)
+	groupIDs := make([]interface{}, len(groupIDOrder)) // Use interface{} for IN clause argument
+	for i, id := range groupIDOrder {
+		groupIDs[i] = id
 	}
 
 	// If no IDs found for this page (shouldn't happen if totalItems > 0 and offset is valid, but check anyway)
 	if len(groupIDs) == 0 {
-		return []models.GrupoWithInvestigadores{}, totalItems, nil
+		return []models.GrupoWithInvestigadores{}, totalItems, cursores, nil
 	}
 
 	// 3. Get details for the selected group IDs using LEFT JOINs
@@ -398,7 +654,7 @@ func GetAllGruposWithDetails(db *sql.DB, limit, offset int) ([]models.GrupoWithI
 
 	detailsQuery := `
 	SELECT
-		g.idGrupo, g.nombre, g.numeroResolucion, g.lineaInvestigacion, g.tipoInvestigacion, g.fechaRegistro, g.archivo, g.createdAt, g.updatedAt,
+		g.idGrupo, g.nombre, g.numeroResolucion, g.lineaInvestigacion, g.tipoInvestigacion, g.facultad, g.fechaRegistro, g.archivo, g.estado, g.createdAt, g.updatedAt,
 		i.idInvestigador, i.nombre as invNombre, i.apellido as invApellido, i.createdAt as invCreatedAt, i.updatedAt as invUpdatedAt,
 		dgi.rol
 	FROM grupo g
@@ -409,7 +665,7 @@ func GetAllGruposWithDetails(db *sql.DB, limit, offset int) ([]models.GrupoWithI
 
 	rowsDetails, err := db.Query(detailsQuery, groupIDs...) // Pass IDs as variadic arguments
 	if err != nil {
-		return nil, 0, fmt.Errorf("error querying group details for selected IDs: %w, Query: %s, Args: %v", err, detailsQuery, groupIDs)
+		return nil, 0, Cursores{}, fmt.Errorf("error querying group details for selected IDs: %w, Query: %s, Args: %v", err, detailsQuery, groupIDs)
 	}
 	defer rowsDetails.Close()
 
@@ -423,11 +679,11 @@ func GetAllGruposWithDetails(db *sql.DB, limit, offset int) ([]models.GrupoWithI
 		var invCreatedAt, invUpdatedAt sql.NullTime
 
 		if err := rowsDetails.Scan(
-			&g.ID, &g.Nombre, &g.NumeroResolucion, &g.LineaInvestigacion, &g.TipoInvestigacion, &g.FechaRegistro, &g.Archivo, &g.CreatedAt, &g.UpdatedAt,
+			&g.ID, &g.Nombre, &g.NumeroResolucion, &g.LineaInvestigacion, &g.TipoInvestigacion, &g.Facultad, &g.FechaRegistro, &g.Archivo, &g.Estado, &g.CreatedAt, &g.UpdatedAt,
 			&invID, &invNombre, &invApellido, &invCreatedAt, &invUpdatedAt,
 			&invRol,
 		); err != nil {
-			return nil, 0, fmt.Errorf("error scanning group/investigator row during get all with details: %w", err)
+			return nil, 0, Cursores{}, fmt.Errorf("error scanning group/investigator row during get all with details: %w", err)
 		}
 
 		// Check if we've already seen this group
@@ -469,7 +725,7 @@ func GetAllGruposWithDetails(db *sql.DB, limit, offset int) ([]models.GrupoWithI
 	}
 
 	if err := rowsDetails.Err(); err != nil {
-		return nil, 0, fmt.Errorf("error after iterating through get all groups with details rows: %w", err)
+		return nil, 0, Cursores{}, fmt.Errorf("error after iterating through get all groups with details rows: %w", err)
 	}
 
 	// 5. Build the final result slice, respecting the paginated order
@@ -481,5 +737,5 @@ func GetAllGruposWithDetails(db *sql.DB, limit, offset int) ([]models.GrupoWithI
 		// If a group ID was selected but somehow not found in the details query (shouldn't happen), it's skipped.
 	}
 
-	return result, totalItems, nil
+	return result, totalItems, cursores, nil
 }
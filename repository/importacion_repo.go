@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/lib/pq"
+)
+
+// GetIDsGruposPorNombre returns the IDs of the existing groups whose name matches any of
+// claves, keyed by the matching clave. Claves are names normalized with utils.NormalizarNombre.
+func GetIDsGruposPorNombre(db *sql.DB, claves []string) (map[string]int, error) {
+	return idsPorClave(db, `SELECT clave, MIN(idGrupo) FROM (
+			SELECT idGrupo, btrim(regexp_replace(lower(unaccent(nombre)), '\s+', ' ', 'g')) AS clave FROM grupo
+		) g WHERE clave = ANY($1) GROUP BY clave`, claves)
+}
+
+// GetIDsInvestigadoresPorNombre returns the IDs of the existing investigators whose full
+// name (nombre and apellido) matches any of claves, keyed by the matching clave; the oldest
+// record wins when there are several. Claves are normalized with utils.NormalizarNombre.
+func GetIDsInvestigadoresPorNombre(db *sql.DB, claves []string) (map[string]int, error) {
+	return idsPorClave(db, `SELECT clave, MIN(idInvestigador) FROM (
+			SELECT idInvestigador, btrim(regexp_replace(nombreNormalizado, '\s+', ' ', 'g')) AS clave FROM investigador
+		) i WHERE clave = ANY($1) GROUP BY clave`, claves)
+}
+
+func idsPorClave(db *sql.DB, query string, claves []string) (map[string]int, error) {
+	ids := map[string]int{}
+	if len(claves) == 0 {
+		return ids, nil
+	}
+	rows, err := db.Query(query, pq.Array(claves))
+	if err != nil {
+		return nil, fmt.Errorf("error querying records by name: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var clave string
+		var id int
+		if err := rows.Scan(&clave, &id); err != nil {
+			return nil, fmt.Errorf("error scanning record by name: %w", err)
+		}
+		ids[clave] = id
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating records by name: %w", err)
+	}
+	return ids, nil
+}
+
+// ImportarRegistros creates, in a single transaction, the investigators whose ID is 0, the
+// groups (as drafts, owned by idUsuario) and their memberships. The IDs of the created records
+// are set on them. Nothing is written if any insert fails.
+func ImportarRegistros(db *sql.DB, investigadores []*models.Investigador, grupos []models.GrupoImportado, idUsuario *int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting import transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op after a successful commit
+
+	for _, inv := range investigadores {
+		if inv.ID != 0 {
+			continue
+		}
+		err := tx.QueryRow(`INSERT INTO investigador (nombre, apellido) VALUES ($1, $2) RETURNING idInvestigador, createdAt, updatedAt`,
+			inv.Nombre, inv.Apellido).Scan(&inv.ID, &inv.CreatedAt, &inv.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("error inserting imported investigator: %w", err)
+		}
+	}
+
+	for _, gi := range grupos {
+		g := gi.Grupo
+		g.Estado = models.EstadoBorrador // New groups always start as drafts
+		err := tx.QueryRow(`INSERT INTO grupo (nombre, numeroResolucion, lineaInvestigacion, tipoInvestigacion, facultad, fechaRegistro, estado, idUsuario) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING idGrupo, createdAt, updatedAt`,
+			g.Nombre, g.NumeroResolucion, g.LineaInvestigacion, g.TipoInvestigacion, g.Facultad, g.FechaRegistro, g.Estado, idUsuario).Scan(&g.ID, &g.CreatedAt, &g.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("error inserting imported group: %w", err)
+		}
+		for _, integrante := range gi.Integrantes {
+			if _, err := tx.Exec(`INSERT INTO Grupo_Investigador (idGrupo, idInvestigador, rol) VALUES ($1, $2, $3)`,
+				g.ID, integrante.Investigador.ID, integrante.Rol); err != nil {
+				return fmt.Errorf("error inserting imported group member: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing import: %w", err)
+	}
+	return nil
+}
@@ -1,43 +1,69 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"strings" // Import strings for query building
+	"strconv"
 
 	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
 )
 
-// GetAllInvestigadores retrieves a paginated list of all investigators.
-func GetAllInvestigadores(db *sql.DB, limit, offset int) ([]models.Investigador, int, error) {
+// camposOrdenInvestigador whitelists the fields investigators can be sorted by.
+var camposOrdenInvestigador = map[string]string{
+	"nombre":    "nombre",
+	"apellido":  "apellido",
+	"createdAt": "createdAt",
+	"updatedAt": "updatedAt",
+}
+
+// GetAllInvestigadores retrieves a page of all investigators. orden is a sort parameter
+// (see camposOrdenInvestigador); by default they are sorted by name. The total is -1 for
+// cursor pages, which skip the count.
+func GetAllInvestigadores(db *sql.DB, orden string, pag Pagina) ([]models.Investigador, int, Cursores, error) {
+	o, err := parseOrden(orden, camposOrdenInvestigador, ordenLista{{expr: "nombre"}, {expr: "apellido"}}, "idInvestigador")
+	if err != nil {
+		return nil, 0, Cursores{}, err
+	}
+
+	// Query for the total count, only for offset pages
+	total := -1
+	if !pag.PorCursor() {
+		if err := db.QueryRow(`SELECT COUNT(*) FROM investigador`).Scan(&total); err != nil {
+			return nil, 0, Cursores{}, fmt.Errorf("error querying total investigator count: %w", err)
+		}
+	}
+
 	// Query for the data page
-	query := `SELECT idInvestigador, nombre, apellido, createdAt, updatedAt FROM investigador ORDER BY nombre, apellido LIMIT $1 OFFSET $2`
-	rows, err := db.Query(query, limit, offset)
+	var b queryBuilder
+	paginacion, err := o.paginar(&b, pag)
 	if err != nil {
-		return nil, 0, fmt.Errorf("error querying investigators page: %w", err)
+		return nil, 0, Cursores{}, err
+	}
+	query := `SELECT idInvestigador, nombre, apellido, createdAt, updatedAt, ` + o.claves() + ` FROM investigador` + b.whereClause() + paginacion
+	rows, err := db.Query(query, b.args...)
+	if err != nil {
+		return nil, 0, Cursores{}, fmt.Errorf("error querying investigators page: %w", err)
 	}
 	defer rows.Close()
 
 	investigadores := []models.Investigador{}
+	claves := [][]string{}
+	destClaves, valoresClaves := o.destinos()
 	for rows.Next() {
 		var inv models.Investigador
-		if err := rows.Scan(&inv.ID, &inv.Nombre, &inv.Apellido, &inv.CreatedAt, &inv.UpdatedAt); err != nil {
-			return nil, 0, fmt.Errorf("error scanning investigator row: %w", err)
+		if err := rows.Scan(append([]interface{}{&inv.ID, &inv.Nombre, &inv.Apellido, &inv.CreatedAt, &inv.UpdatedAt}, destClaves...)...); err != nil {
+			return nil, 0, Cursores{}, fmt.Errorf("error scanning investigator row: %w", err)
 		}
 		investigadores = append(investigadores, inv)
+		claves = append(claves, valoresClaves())
 	}
 	if err := rows.Err(); err != nil {
-		return nil, 0, fmt.Errorf("error after iterating through investigator rows: %w", err)
-	}
-
-	// Query for the total count
-	var total int
-	countQuery := `SELECT COUNT(*) FROM investigador`
-	if err := db.QueryRow(countQuery).Scan(&total); err != nil {
-		return nil, 0, fmt.Errorf("error querying total investigator count: %w", err)
+		return nil, 0, Cursores{}, fmt.Errorf("error after iterating through investigator rows: %w", err)
 	}
 
-	return investigadores, total, nil
+	investigadores, cursores := recortarPagina(o, pag, investigadores, claves)
+	return investigadores, total, cursores, nil
 }
 
 // GetInvestigadorByID retrieves a single investigator by their ID.
@@ -81,55 +107,191 @@ func DeleteInvestigador(db *sql.DB, id int) error {
 	return nil
 }
 
-// SearchInvestigadores searches for investigators with pagination.
-func SearchInvestigadores(db *sql.DB, name string, limit, offset int) ([]models.Investigador, int, error) {
-	// Base query and conditions
-	baseQuery := `FROM investigador WHERE 1=1`
-	var conditions []string
-	args := []interface{}{}
-	placeholderCount := 1
+// DefaultUmbralSimilitud is the minimum trigram word similarity (0-1) for a name to match
+// when no other threshold is configured.
+const DefaultUmbralSimilitud = 0.3
+
+// InvestigadorFilter holds the search criteria accepted by SearchInvestigadores.
+// Empty fields are ignored.
+type InvestigadorFilter struct {
+	Nombre string  // Full or partial name; tolerates typos (trigram similarity)
+	Q      string  // Full-text query over the full name (websearch syntax)
+	Umbral float64 // Minimum similarity for Nombre; 0 means DefaultUmbralSimilitud
+	Orden  string  // Sort parameter such as "-createdAt,apellido" (see camposOrdenBusquedaInvestigador)
+}
 
-	if name != "" {
-		conditions = append(conditions, fmt.Sprintf(`(unaccent(nombre) ILIKE unaccent($%d) OR unaccent(apellido) ILIKE unaccent($%d))`, placeholderCount, placeholderCount+1))
-		searchPattern := "%" + name + "%"
-		args = append(args, searchPattern, searchPattern)
-		placeholderCount += 2
+// HasCriteria reports whether any criterion is set.
+func (f InvestigadorFilter) HasCriteria() bool {
+	return f.Nombre != "" || f.Q != ""
+}
+
+// conUmbralSimilitud runs fn in a read-only transaction whose pg_trgm word similarity
+// threshold is umbral, so the <% operator (and the trigram index) applies it.
+func conUmbralSimilitud(db *sql.DB, umbral float64, fn func(tx *sql.Tx) error) error {
+	if umbral <= 0 {
+		umbral = DefaultUmbralSimilitud
+	}
+	tx, err := db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("error starting similarity search transaction: %w", err)
 	}
+	defer tx.Rollback() // Nothing to commit; the setting only lives in this transaction
 
-	whereClause := ""
-	if len(conditions) > 0 {
-		whereClause = " AND " + strings.Join(conditions, " AND ")
+	if _, err := tx.Exec(`SELECT set_config('pg_trgm.word_similarity_threshold', $1, true)`, strconv.FormatFloat(umbral, 'f', -1, 64)); err != nil {
+		return fmt.Errorf("error setting similarity threshold: %w", err)
 	}
+	return fn(tx)
+}
 
-	// Query for the data page
-	query := fmt.Sprintf(`SELECT idInvestigador, nombre, apellido, createdAt, updatedAt %s %s ORDER BY nombre, apellido LIMIT $%d OFFSET $%d`, baseQuery, whereClause, placeholderCount, placeholderCount+1)
-	finalArgs := append(args, limit, offset)
-	rows, err := db.Query(query, finalArgs...)
+// busquedaInvestigadores holds the conditions, scores and order of an investigator search
+// over the unaliased investigador table.
+type busquedaInvestigadores struct {
+	b          queryBuilder
+	orden      ordenLista
+	relevancia string // ts_rank of filter.Q, or 0
+	similitud  string // Word similarity to filter.Nombre, or 0
+	tsq        string // tsquery of filter.Q, or ""
+}
+
+// newBusquedaInvestigadores builds the search of filter: names containing or similar to
+// filter.Nombre, full-text matches of filter.Q, ordered by filter.Orden or, by default, by
+// relevance, similarity and name.
+func newBusquedaInvestigadores(filter InvestigadorFilter) (*busquedaInvestigadores, error) {
+	bq := &busquedaInvestigadores{relevancia: `0::REAL`, similitud: `0::REAL`}
+	b := &bq.b
+	var porDefecto ordenLista
+
+	if filter.Nombre != "" {
+		normalizado := fmt.Sprintf(`lower(unaccent(%s))`, b.arg(filter.Nombre))
+		patron := fmt.Sprintf(`lower(unaccent(%s))`, b.arg(escapeLike(filter.Nombre)))
+		b.where(fmt.Sprintf(`(nombreNormalizado LIKE '%%' || %s || '%%' OR %s <%% nombreNormalizado)`, patron, normalizado))
+		bq.similitud = fmt.Sprintf(`word_similarity(%s, nombreNormalizado)`, normalizado)
+		porDefecto = append(porDefecto, ordenCampo{expr: bq.similitud, desc: true})
+	}
+
+	if filter.Q != "" {
+		bq.tsq = tsQuery(b.arg(filter.Q))
+		b.where(fmt.Sprintf(`tsv @@ %s`, bq.tsq))
+		bq.relevancia = fmt.Sprintf(`ts_rank(tsv, %s)`, bq.tsq)
+		porDefecto = append(ordenLista{{expr: bq.relevancia, desc: true}}, porDefecto...)
+	}
+	porDefecto = append(porDefecto, ordenCampo{expr: "nombre"}, ordenCampo{expr: "apellido"})
+
+	campos := map[string]string{"relevancia": bq.relevancia, "similarity": bq.similitud}
+	for k, v := range camposOrdenInvestigador {
+		campos[k] = v
+	}
+	var err error
+	if bq.orden, err = parseOrden(filter.Orden, campos, porDefecto, "idInvestigador"); err != nil {
+		return nil, err
+	}
+	return bq, nil
+}
+
+// SearchInvestigadores searches for investigators with pagination. filter.Nombre matches
+// names containing it or similar enough to it (e.g. "Quipse" finds "Quispe"), most similar
+// first; with filter.Q results are ordered by relevance and carry the highlighted full name.
+// filter.Orden overrides the order; besides camposOrdenInvestigador it accepts "relevancia"
+// and "similarity". The total is -1 for cursor pages, which skip the count.
+func SearchInvestigadores(db *sql.DB, filter InvestigadorFilter, pag Pagina) ([]models.Investigador, int, Cursores, error) {
+	bq, err := newBusquedaInvestigadores(filter)
 	if err != nil {
-		return nil, 0, fmt.Errorf("error searching investigators page: %w", err)
+		return nil, 0, Cursores{}, err
 	}
-	defer rows.Close()
+	b, o := &bq.b, bq.orden
 
-	investigadores := []models.Investigador{}
-	for rows.Next() {
-		var inv models.Investigador
-		if err := rows.Scan(&inv.ID, &inv.Nombre, &inv.Apellido, &inv.CreatedAt, &inv.UpdatedAt); err != nil {
-			return nil, 0, fmt.Errorf("error scanning investigator row during search: %w", err)
-		}
-		investigadores = append(investigadores, inv)
+	// The count uses the search conditions only, not the cursor's keyset
+	countQuery := `SELECT COUNT(*) FROM investigador` + b.whereClause()
+	countArgs := append([]interface{}{}, b.args...)
+
+	paginacion, err := o.paginar(b, pag)
+	if err != nil {
+		return nil, 0, Cursores{}, err
 	}
-	if err := rows.Err(); err != nil {
-		return nil, 0, fmt.Errorf("error after iterating through investigator search rows: %w", err)
+	resaltadoNombre := `NULL::TEXT`
+	if filter.Q != "" {
+		resaltadoNombre = fmt.Sprintf(`ts_headline('spanish_unaccent', nombre || ' ' || apellido, %s, %s)`, bq.tsq, b.arg(headlineCampoOptions))
 	}
 
-	// Query for the total count with the same filters
-	var total int
-	countQuery := fmt.Sprintf(`SELECT COUNT(*) %s %s`, baseQuery, whereClause)
-	if err := db.QueryRow(countQuery, args...).Scan(&total); err != nil { // Use original args for count
-		return nil, 0, fmt.Errorf("error searching total investigator count: %w", err)
+	// Query for the data page
+	query := fmt.Sprintf(`SELECT idInvestigador, nombre, apellido, createdAt, updatedAt, %s, %s, %s, %s FROM investigador%s%s`,
+		bq.relevancia, resaltadoNombre, bq.similitud, o.claves(), b.whereClause(), paginacion)
+
+	investigadores := []models.Investigador{}
+	claves := [][]string{}
+	total := -1
+	err = conUmbralSimilitud(db, filter.Umbral, func(tx *sql.Tx) error {
+		rows, err := tx.Query(query, b.args...)
+		if err != nil {
+			return fmt.Errorf("error searching investigators page: %w", err)
+		}
+		defer rows.Close()
+
+		destClaves, valoresClaves := o.destinos()
+		for rows.Next() {
+			var inv models.Investigador
+			var hNombre sql.NullString
+			dest := append([]interface{}{&inv.ID, &inv.Nombre, &inv.Apellido, &inv.CreatedAt, &inv.UpdatedAt, &inv.Relevancia, &hNombre, &inv.Similitud}, destClaves...)
+			if err := rows.Scan(dest...); err != nil {
+				return fmt.Errorf("error scanning investigator row during search: %w", err)
+			}
+			inv.Resaltado = resaltado(hNombre)
+			investigadores = append(investigadores, inv)
+			claves = append(claves, valoresClaves())
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error after iterating through investigator search rows: %w", err)
+		}
+
+		// Query for the total count with the same filters, only for offset pages
+		if !pag.PorCursor() {
+			if err := tx.QueryRow(countQuery, countArgs...).Scan(&total); err != nil {
+				return fmt.Errorf("error searching total investigator count: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, Cursores{}, err
 	}
 
-	return investigadores, total, nil
+	investigadores, cursores := recortarPagina(o, pag, investigadores, claves)
+	return investigadores, total, cursores, nil
+}
+
+// GetSugerenciasInvestigador returns up to limit investigators whose name contains texto or is
+// similar to it, most similar first. It is meant for autocomplete, so it skips the count.
+func GetSugerenciasInvestigador(db *sql.DB, texto string, umbral float64, limit int) ([]models.SugerenciaInvestigador, error) {
+	query := `SELECT idInvestigador, nombre, apellido, word_similarity(q, nombreNormalizado) AS similitud
+		FROM investigador, lower(unaccent($1)) q, lower(unaccent($3)) patron
+		WHERE nombreNormalizado LIKE '%' || patron || '%' OR q <% nombreNormalizado
+		ORDER BY similitud DESC, nombre, apellido
+		LIMIT $2`
+
+	sugerencias := []models.SugerenciaInvestigador{}
+	err := conUmbralSimilitud(db, umbral, func(tx *sql.Tx) error {
+		rows, err := tx.Query(query, texto, limit, escapeLike(texto))
+		if err != nil {
+			return fmt.Errorf("error querying investigator suggestions: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var s models.SugerenciaInvestigador
+			if err := rows.Scan(&s.ID, &s.Nombre, &s.Apellido, &s.Similitud); err != nil {
+				return fmt.Errorf("error scanning investigator suggestion row: %w", err)
+			}
+			sugerencias = append(sugerencias, s)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error after iterating investigator suggestion rows: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sugerencias, nil
 }
 
 // GetAllInvestigadoresNoPagination retrieves ALL investigators without pagination.
@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// ErrCursorInvalido is returned for a pagination cursor that is malformed or was issued for
+// a different sort order.
+var ErrCursorInvalido = errors.New("invalid pagination cursor")
+
+// Pagina describes the requested page of a list: either Offset, or one of the opaque cursors
+// returned in Cursores. Cursor pages do not count the total (it is reported as -1).
+type Pagina struct {
+	Limit  int
+	Offset int    // Ignored when After or Before is set
+	After  string // The page starts right after the row this cursor points to
+	Before string // The page ends right before the row this cursor points to
+}
+
+// PorCursor reports whether the page is addressed by a cursor rather than an offset.
+func (p Pagina) PorCursor() bool {
+	return p.After != "" || p.Before != ""
+}
+
+// Cursores holds the cursors of the pages around the returned one; empty when there is none.
+type Cursores struct {
+	Next string
+	Prev string
+}
+
+// ordenCampo is one key of an ORDER BY.
+type ordenCampo struct {
+	expr string
+	desc bool
+}
+
+// ordenLista is a full ORDER BY. It must end with a unique column so it can be used for
+// keyset pagination.
+type ordenLista []ordenCampo
+
+// sql returns the ORDER BY list, reversed when invertir is set (to read a page backwards).
+func (o ordenLista) sql(invertir bool) string {
+	partes := make([]string, len(o))
+	for i, c := range o {
+		direccion := "ASC"
+		if c.desc != invertir {
+			direccion = "DESC"
+		}
+		partes[i] = c.expr + " " + direccion
+	}
+	return strings.Join(partes, ", ")
+}
+
+// claves returns the select list of the sort keys as text, as stored in cursors. The
+// columns are named clave0, clave1...
+func (o ordenLista) claves() string {
+	partes := make([]string, len(o))
+	for i, c := range o {
+		partes[i] = fmt.Sprintf("(%s)::TEXT AS clave%d", c.expr, i)
+	}
+	return strings.Join(partes, ", ")
+}
+
+// clavesDe returns the key columns selected by claves from the relation alias.
+func (o ordenLista) clavesDe(alias string) string {
+	partes := make([]string, len(o))
+	for i := range o {
+		partes[i] = fmt.Sprintf("%s.clave%d", alias, i)
+	}
+	return strings.Join(partes, ", ")
+}
+
+// destinos returns scan destinations for the columns of claves and a function returning
+// their values once a row has been scanned.
+func (o ordenLista) destinos() ([]interface{}, func() []string) {
+	valores := make([]sql.NullString, len(o))
+	dest := make([]interface{}, len(o))
+	for i := range valores {
+		dest[i] = &valores[i]
+	}
+	return dest, func() []string {
+		claves := make([]string, len(valores))
+		for i, v := range valores {
+			claves[i] = v.String
+		}
+		return claves
+	}
+}
+
+// firma identifies the order a cursor was issued for.
+func (o ordenLista) firma() string {
+	h := fnv.New32a()
+	h.Write([]byte(o.sql(false)))
+	return strconv.FormatUint(uint64(h.Sum32()), 36)
+}
+
+// keyset returns a condition matching the rows after valores in this order (before them
+// when invertir is set). The values are text; PostgreSQL casts them to each key's type.
+func (o ordenLista) keyset(b *queryBuilder, valores []string, invertir bool) string {
+	var alternativas []string
+	var iguales []string
+	for i, c := range o {
+		operador := ">"
+		if c.desc != invertir {
+			operador = "<"
+		}
+		param := b.arg(valores[i])
+		alternativas = append(alternativas, "("+strings.Join(append(iguales, fmt.Sprintf("%s %s %s", c.expr, operador, param)), " AND ")+")")
+		iguales = append(iguales, fmt.Sprintf("%s = %s", c.expr, param))
+	}
+	return "(" + strings.Join(alternativas, " OR ") + ")"
+}
+
+// cursor is the decoded form of a pagination token.
+type cursor struct {
+	Orden   string   `json:"o"`
+	Valores []string `json:"v"`
+}
+
+func (o ordenLista) encodeCursor(valores []string) string {
+	data, _ := json.Marshal(cursor{Orden: o.firma(), Valores: valores})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func (o ordenLista) decodeCursor(token string) ([]string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrCursorInvalido
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || len(c.Valores) != len(o) {
+		return nil, ErrCursorInvalido
+	}
+	if c.Orden != o.firma() {
+		return nil, fmt.Errorf("%w: it was issued for a different sort order", ErrCursorInvalido)
+	}
+	return c.Valores, nil
+}
+
+// paginar adds to b the keyset condition of p's cursor, if any, and returns the ORDER BY
+// and LIMIT/OFFSET clauses of the page query. One extra row is read to detect whether
+// there is a following page; recortarPagina drops it.
+func (o ordenLista) paginar(b *queryBuilder, p Pagina) (string, error) {
+	token, invertir := p.After, false
+	if p.Before != "" {
+		token, invertir = p.Before, true
+	}
+	if token != "" {
+		valores, err := o.decodeCursor(token)
+		if err != nil {
+			return "", err
+		}
+		b.where(o.keyset(b, valores, invertir))
+	}
+	clausula := fmt.Sprintf(" ORDER BY %s LIMIT %s", o.sql(invertir), b.arg(p.Limit+1))
+	if !p.PorCursor() {
+		clausula += " OFFSET " + b.arg(p.Offset)
+	}
+	return clausula, nil
+}
+
+// recortarPagina takes the rows read by a query built with paginar, with the text sort keys
+// of each row, and returns the page in display order together with its cursors.
+func recortarPagina[T any](o ordenLista, p Pagina, items []T, claves [][]string) ([]T, Cursores) {
+	hayMas := len(items) > p.Limit
+	if hayMas {
+		items, claves = items[:p.Limit], claves[:p.Limit]
+	}
+	if p.Before != "" {
+		// Read backwards: restore the display order
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+			claves[i], claves[j] = claves[j], claves[i]
+		}
+	}
+
+	var c Cursores
+	if len(items) == 0 {
+		return items, c
+	}
+	if (p.Before == "" && hayMas) || p.Before != "" {
+		c.Next = o.encodeCursor(claves[len(claves)-1])
+	}
+	if (p.Before != "" && hayMas) || p.After != "" || (!p.PorCursor() && p.Offset > 0) {
+		c.Prev = o.encodeCursor(claves[0])
+	}
+	return items, c
+}
@@ -0,0 +1,305 @@
+package repository
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// ordenNombre sorts by name, then by the unique id, as the group and investigator lists do.
+var ordenNombre = ordenLista{{expr: "g.nombre"}, {expr: "g.idGrupo"}}
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := [][]string{
+		{"Robótica", "12"},
+		{"", "1"},
+		{`Grupo "A", B/C`, "999999"},
+		{"2024-03-01 00:00:00+00", "7"},
+	}
+	for _, valores := range tests {
+		token := ordenNombre.encodeCursor(valores)
+		if strings.ContainsAny(token, "+/=") {
+			t.Errorf("cursor %q is not URL-safe", token)
+		}
+		got, err := ordenNombre.decodeCursor(token)
+		if err != nil {
+			t.Fatalf("decodeCursor(encodeCursor(%q)): %v", valores, err)
+		}
+		if !reflect.DeepEqual(got, valores) {
+			t.Errorf("round trip = %q, want %q", got, valores)
+		}
+	}
+}
+
+func TestDecodeCursorRejects(t *testing.T) {
+	encode := func(json string) string { return base64.RawURLEncoding.EncodeToString([]byte(json)) }
+	valido := ordenNombre.encodeCursor([]string{"Robótica", "12"})
+	desc := ordenLista{{expr: "g.nombre", desc: true}, {expr: "g.idGrupo"}}
+	otroCampo := ordenLista{{expr: "g.fechaRegistro"}, {expr: "g.idGrupo"}}
+
+	tests := []struct {
+		name  string
+		token string
+		orden ordenLista
+	}{
+		{"not base64", "%%%", ordenNombre},
+		{"padded base64", valido + "==", ordenNombre},
+		{"not JSON", encode("not json"), ordenNombre},
+		{"too few values", encode(fmt.Sprintf(`{"o":%q,"v":["Robótica"]}`, ordenNombre.firma())), ordenNombre},
+		{"too many values", encode(fmt.Sprintf(`{"o":%q,"v":["a","1","x"]}`, ordenNombre.firma())), ordenNombre},
+		{"tampered order", encode(`{"o":"abc","v":["Robótica","12"]}`), ordenNombre},
+		{"missing order", encode(`{"v":["Robótica","12"]}`), ordenNombre},
+		{"issued for the other direction", valido, desc},
+		{"issued for another field", valido, otroCampo},
+		{"truncated", valido[:len(valido)-3], ordenNombre},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.orden.decodeCursor(tt.token); !errors.Is(err, ErrCursorInvalido) {
+				t.Errorf("decodeCursor error = %v, want ErrCursorInvalido", err)
+			}
+		})
+	}
+}
+
+func TestKeyset(t *testing.T) {
+	orden := ordenLista{{expr: "g.fechaRegistro", desc: true}, {expr: "g.nombre"}, {expr: "g.idGrupo"}}
+	tests := []struct {
+		invertir bool
+		want     string
+	}{
+		{false, "((g.fechaRegistro < $1) OR (g.fechaRegistro = $1 AND g.nombre > $2) OR (g.fechaRegistro = $1 AND g.nombre = $2 AND g.idGrupo > $3))"},
+		{true, "((g.fechaRegistro > $1) OR (g.fechaRegistro = $1 AND g.nombre < $2) OR (g.fechaRegistro = $1 AND g.nombre = $2 AND g.idGrupo < $3))"},
+	}
+	for _, tt := range tests {
+		var b queryBuilder
+		if got := orden.keyset(&b, []string{"2024-01-01", "Robótica", "12"}, tt.invertir); got != tt.want {
+			t.Errorf("keyset(invertir=%v) =\n%s\nwant\n%s", tt.invertir, got, tt.want)
+		}
+		if want := []interface{}{"2024-01-01", "Robótica", "12"}; !reflect.DeepEqual(b.args, want) {
+			t.Errorf("args = %v, want %v", b.args, want)
+		}
+	}
+}
+
+func TestPaginar(t *testing.T) {
+	tests := []struct {
+		name      string
+		pagina    Pagina
+		wantWhere string
+		wantSQL   string
+		wantArgs  []interface{}
+	}{
+		{
+			name:     "offset",
+			pagina:   Pagina{Limit: 10, Offset: 20},
+			wantSQL:  " ORDER BY g.nombre ASC, g.idGrupo ASC LIMIT $1 OFFSET $2",
+			wantArgs: []interface{}{11, 20},
+		},
+		{
+			name:      "after",
+			pagina:    Pagina{Limit: 10, Offset: 20, After: ordenNombre.encodeCursor([]string{"B", "2"})},
+			wantWhere: " WHERE ((g.nombre > $1) OR (g.nombre = $1 AND g.idGrupo > $2))",
+			wantSQL:   " ORDER BY g.nombre ASC, g.idGrupo ASC LIMIT $3",
+			wantArgs:  []interface{}{"B", "2", 11},
+		},
+		{
+			name:      "before",
+			pagina:    Pagina{Limit: 5, Before: ordenNombre.encodeCursor([]string{"B", "2"})},
+			wantWhere: " WHERE ((g.nombre < $1) OR (g.nombre = $1 AND g.idGrupo < $2))",
+			wantSQL:   " ORDER BY g.nombre DESC, g.idGrupo DESC LIMIT $3",
+			wantArgs:  []interface{}{"B", "2", 6},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b queryBuilder
+			got, err := ordenNombre.paginar(&b, tt.pagina)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.wantSQL || b.whereClause() != tt.wantWhere || !reflect.DeepEqual(b.args, tt.wantArgs) {
+				t.Errorf("paginar = %q, where %q, args %v\nwant %q, where %q, args %v", got, b.whereClause(), b.args, tt.wantSQL, tt.wantWhere, tt.wantArgs)
+			}
+		})
+	}
+
+	var b queryBuilder
+	if _, err := ordenNombre.paginar(&b, Pagina{Limit: 5, After: "tampered"}); !errors.Is(err, ErrCursorInvalido) {
+		t.Errorf("paginar with an invalid cursor: error = %v", err)
+	}
+}
+
+// clavesFilas returns the text sort keys of rows "nombre:id".
+func clavesFilas(filas []string) [][]string {
+	claves := make([][]string, len(filas))
+	for i, f := range filas {
+		claves[i] = strings.Split(f, ":")
+	}
+	return claves
+}
+
+func TestRecortarPagina(t *testing.T) {
+	cursor := func(fila string) string { return ordenNombre.encodeCursor(strings.Split(fila, ":")) }
+	tests := []struct {
+		name     string
+		pagina   Pagina
+		filas    []string // As read by the query, limit+1 at most
+		want     []string
+		wantNext string // Row the cursor points to, "" for none
+		wantPrev string
+	}{
+		{name: "empty first page", pagina: Pagina{Limit: 2}, filas: nil, want: nil},
+		{name: "first page, exactly full", pagina: Pagina{Limit: 2}, filas: []string{"a:1", "b:2"}, want: []string{"a:1", "b:2"}},
+		{name: "first page with more", pagina: Pagina{Limit: 2}, filas: []string{"a:1", "b:2", "c:3"}, want: []string{"a:1", "b:2"}, wantNext: "b:2"},
+		{name: "offset page", pagina: Pagina{Limit: 2, Offset: 2}, filas: []string{"c:3", "d:4", "e:5"}, want: []string{"c:3", "d:4"}, wantNext: "d:4", wantPrev: "c:3"},
+		{name: "offset past the end", pagina: Pagina{Limit: 2, Offset: 10}, filas: nil, want: nil},
+		{name: "after, last page", pagina: Pagina{Limit: 2, After: "x"}, filas: []string{"c:3"}, want: []string{"c:3"}, wantPrev: "c:3"},
+		{name: "after with more", pagina: Pagina{Limit: 2, After: "x"}, filas: []string{"c:3", "d:4", "e:5"}, want: []string{"c:3", "d:4"}, wantNext: "d:4", wantPrev: "c:3"},
+		{name: "after, nothing left", pagina: Pagina{Limit: 2, After: "x"}, filas: nil, want: nil},
+		{name: "before, first page reached", pagina: Pagina{Limit: 2, Before: "x"}, filas: []string{"b:2", "a:1"}, want: []string{"a:1", "b:2"}, wantNext: "b:2"},
+		{name: "before with more", pagina: Pagina{Limit: 2, Before: "x"}, filas: []string{"d:4", "c:3", "b:2"}, want: []string{"c:3", "d:4"}, wantNext: "d:4", wantPrev: "c:3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, c := recortarPagina(ordenNombre, tt.pagina, append([]string(nil), tt.filas...), clavesFilas(tt.filas))
+			if len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+				t.Errorf("page = %q, want %q", got, tt.want)
+			}
+			wantNext, wantPrev := "", ""
+			if tt.wantNext != "" {
+				wantNext = cursor(tt.wantNext)
+			}
+			if tt.wantPrev != "" {
+				wantPrev = cursor(tt.wantPrev)
+			}
+			if c.Next != wantNext || c.Prev != wantPrev {
+				t.Errorf("cursors = %+v, want next at %q and prev at %q", c, tt.wantNext, tt.wantPrev)
+			}
+		})
+	}
+}
+
+// filaPrueba is a row sorted by ordenNombre: nombre, then id.
+type filaPrueba struct {
+	nombre string
+	id     int
+}
+
+// consultar runs in memory the query paginar builds: the rows after (or before) the cursor,
+// in the page's order, at most limit+1 of them.
+func consultar(t *testing.T, filas []filaPrueba, p Pagina) []filaPrueba {
+	t.Helper()
+	var b queryBuilder
+	if _, err := ordenNombre.paginar(&b, p); err != nil {
+		t.Fatal(err)
+	}
+	antes := func(x, y filaPrueba) bool {
+		if x.nombre != y.nombre {
+			return x.nombre < y.nombre
+		}
+		return x.id < y.id
+	}
+	ordenadas := append([]filaPrueba(nil), filas...)
+	sort.Slice(ordenadas, func(i, j int) bool { return antes(ordenadas[i], ordenadas[j]) })
+
+	var resultado []filaPrueba
+	switch {
+	case p.After != "":
+		valores, _ := ordenNombre.decodeCursor(p.After)
+		id, _ := strconv.Atoi(valores[1])
+		for _, f := range ordenadas {
+			if antes(filaPrueba{valores[0], id}, f) {
+				resultado = append(resultado, f)
+			}
+		}
+	case p.Before != "":
+		valores, _ := ordenNombre.decodeCursor(p.Before)
+		id, _ := strconv.Atoi(valores[1])
+		for i := len(ordenadas) - 1; i >= 0; i-- {
+			if antes(ordenadas[i], filaPrueba{valores[0], id}) {
+				resultado = append(resultado, ordenadas[i])
+			}
+		}
+	default:
+		resultado = ordenadas[min(p.Offset, len(ordenadas)):]
+	}
+	return resultado[:min(len(resultado), p.Limit+1)]
+}
+
+func pagina(t *testing.T, filas []filaPrueba, p Pagina) ([]filaPrueba, Cursores) {
+	leidas := consultar(t, filas, p)
+	claves := make([][]string, len(leidas))
+	for i, f := range leidas {
+		claves[i] = []string{f.nombre, strconv.Itoa(f.id)}
+	}
+	return recortarPagina(ordenNombre, p, leidas, claves)
+}
+
+// Rows sharing the sort key must neither repeat nor go missing across pages: the unique
+// id breaks the ties in the cursor.
+func TestPaginacionConEmpates(t *testing.T) {
+	filas := []filaPrueba{{"Robótica", 7}, {"Biología", 3}, {"Robótica", 2}, {"Robótica", 9}, {"Biología", 8}, {"Química", 1}, {"Robótica", 4}}
+	want := []string{"Biología:3", "Biología:8", "Química:1", "Robótica:2", "Robótica:4", "Robótica:7", "Robótica:9"}
+
+	for limit := 1; limit <= len(filas)+1; limit++ {
+		t.Run(fmt.Sprintf("limit %d", limit), func(t *testing.T) {
+			// Forwards with Next
+			var adelante []string
+			var ultima Cursores
+			enUltima := 0
+			p := Pagina{Limit: limit}
+			for paginas := 0; ; paginas++ {
+				if paginas > len(filas) {
+					t.Fatal("pagination does not end")
+				}
+				items, c := pagina(t, filas, p)
+				for _, f := range items {
+					adelante = append(adelante, fmt.Sprintf("%s:%d", f.nombre, f.id))
+				}
+				ultima, enUltima = c, len(items)
+				if c.Next == "" {
+					break
+				}
+				p = Pagina{Limit: limit, After: c.Next}
+			}
+			if !reflect.DeepEqual(adelante, want) {
+				t.Fatalf("forwards = %q, want %q", adelante, want)
+			}
+
+			// Backwards with Prev, from the last page
+			if ultima.Prev == "" {
+				if limit < len(filas) {
+					t.Fatal("last page has no Prev cursor")
+				}
+				return
+			}
+			var atras []string
+			p = Pagina{Limit: limit, Before: ultima.Prev}
+			for paginas := 0; ; paginas++ {
+				if paginas > len(filas) {
+					t.Fatal("pagination does not end")
+				}
+				items, c := pagina(t, filas, p)
+				var textos []string
+				for _, f := range items {
+					textos = append(textos, fmt.Sprintf("%s:%d", f.nombre, f.id))
+				}
+				atras = append(textos, atras...)
+				if c.Prev == "" {
+					break
+				}
+				p = Pagina{Limit: limit, Before: c.Prev}
+			}
+			// Every row before the last page, in display order
+			if wantAtras := want[:len(want)-enUltima]; !reflect.DeepEqual(atras, wantAtras) {
+				t.Errorf("backwards = %q, want %q", atras, wantAtras)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// ErrOrdenInvalido is returned when a sort parameter names a field the resource does not
+// allow sorting by.
+var ErrOrdenInvalido = errors.New("invalid sort field")
+
+// queryBuilder accumulates the WHERE conditions of a query and their positional arguments,
+// so conditions can be added in any order without tracking placeholder numbers by hand.
+type queryBuilder struct {
+	conditions []string
+	args       []interface{}
+}
+
+// arg adds an argument and returns its placeholder ($n).
+func (b *queryBuilder) arg(value interface{}) string {
+	b.args = append(b.args, value)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+// where adds a condition; conditions are joined with AND.
+func (b *queryBuilder) where(condition string) {
+	b.conditions = append(b.conditions, condition)
+}
+
+// escapeLike escapes the LIKE wildcards (% and _) and the escape character itself, so that
+// user input matches literally. PostgreSQL's default LIKE escape character is the backslash.
+func escapeLike(value string) string {
+	return likeEscaper.Replace(value)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// whereILike adds a condition matching column against any of values as accent- and
+// case-insensitive substrings. Nothing is added when values is empty.
+func (b *queryBuilder) whereILike(column string, values []string) {
+	patterns := make([]string, len(values))
+	for i, v := range values {
+		patterns[i] = escapeLike(v)
+	}
+	switch len(patterns) {
+	case 0:
+	case 1:
+		b.where(fmt.Sprintf(`unaccent(%s) ILIKE unaccent(%s)`, column, b.arg("%"+patterns[0]+"%")))
+	default:
+		b.where(fmt.Sprintf(`unaccent(%s) ILIKE ANY (SELECT unaccent('%%' || v || '%%') FROM unnest(%s::TEXT[]) v)`, column, b.arg(pq.Array(patterns))))
+	}
+}
+
+// whereIn adds a condition restricting column to values. Nothing is added when values is empty.
+func (b *queryBuilder) whereIn(column string, values []string) {
+	if len(values) > 0 {
+		b.where(fmt.Sprintf(`%s = ANY(%s)`, column, b.arg(pq.Array(values))))
+	}
+}
+
+// whereClause returns " WHERE <conditions>", or "" when there are none.
+func (b *queryBuilder) whereClause() string {
+	if len(b.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(b.conditions, " AND ")
+}
+
+// parseOrden turns a sort parameter such as "fechaRegistro,-nombre" into an ordenLista
+// using the column expressions in campos; a leading "-" sorts descending. An empty parameter
+// yields porDefecto, and unknown fields yield ErrOrdenInvalido. id, the unique tie-breaker,
+// is always appended.
+func parseOrden(param string, campos map[string]string, porDefecto ordenLista, id string) (ordenLista, error) {
+	var orden ordenLista
+	for _, campo := range strings.Split(param, ",") {
+		campo = strings.TrimSpace(campo)
+		if campo == "" {
+			continue
+		}
+		desc := false
+		if nombre, ok := strings.CutPrefix(campo, "-"); ok {
+			campo, desc = nombre, true
+		}
+		columna, ok := campos[campo]
+		if !ok {
+			permitidos := make([]string, 0, len(campos))
+			for c := range campos {
+				permitidos = append(permitidos, c)
+			}
+			sort.Strings(permitidos)
+			return nil, fmt.Errorf("%w '%s' (allowed: %s)", ErrOrdenInvalido, campo, strings.Join(permitidos, ", "))
+		}
+		orden = append(orden, ordenCampo{expr: columna, desc: desc})
+	}
+	if len(orden) == 0 {
+		orden = append(orden, porDefecto...)
+	}
+	return append(orden, ordenCampo{expr: id}), nil
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestEscapeLike(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"Robótica", "Robótica"},
+		{"100%", `100\%`},
+		{"a_b", `a\_b`},
+		{`C:\temp`, `C:\\temp`},
+		{`%_\`, `\%\_\\`},
+	}
+	for _, tt := range tests {
+		if got := escapeLike(tt.value); got != tt.want {
+			t.Errorf("escapeLike(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestWhereILikeEscapesWildcards(t *testing.T) {
+	var b queryBuilder
+	b.whereILike("g.nombre", []string{"50%"})
+	b.whereILike("g.facultad", []string{"a_b", "c"})
+	b.whereILike("g.lineaInvestigacion", nil)
+
+	wantWhere := ` WHERE unaccent(g.nombre) ILIKE unaccent($1) AND ` +
+		`unaccent(g.facultad) ILIKE ANY (SELECT unaccent('%' || v || '%') FROM unnest($2::TEXT[]) v)`
+	if got := b.whereClause(); got != wantWhere {
+		t.Errorf("whereClause =\n%s\nwant\n%s", got, wantWhere)
+	}
+	wantArgs := []interface{}{`%50\%%`, pq.Array([]string{`a\_b`, "c"})}
+	if !reflect.DeepEqual(b.args, wantArgs) {
+		t.Errorf("args = %#v, want %#v", b.args, wantArgs)
+	}
+}
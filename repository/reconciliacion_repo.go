@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/lib/pq"
+)
+
+// GetArchivoReferencias returns every row that references a stored file.
+func GetArchivoReferencias(db *sql.DB) ([]models.ArchivoReferencia, error) {
+	query := `SELECT 'grupo', idGrupo, archivo FROM grupo WHERE archivo IS NOT NULL AND archivo <> ''
+		UNION ALL
+		SELECT 'Resolucion', idResolucion, archivo FROM Resolucion WHERE archivo IS NOT NULL AND archivo <> ''
+		UNION ALL
+		SELECT 'Grupo_Archivo', idArchivo, ruta FROM Grupo_Archivo`
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("error querying file references: %w", err)
+	}
+	defer rows.Close()
+
+	referencias := []models.ArchivoReferencia{}
+	for rows.Next() {
+		var ref models.ArchivoReferencia
+		if err := rows.Scan(&ref.Tabla, &ref.ID, &ref.Ruta); err != nil {
+			return nil, fmt.Errorf("error scanning file reference row: %w", err)
+		}
+		referencias = append(referencias, ref)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating file reference rows: %w", err)
+	}
+	return referencias, nil
+}
+
+// SetArchivosFaltantes flags the given rows as pointing to a missing file and clears the
+// flag on every other row, so files restored since the last run are unflagged.
+func SetArchivosFaltantes(db *sql.DB, faltantes []models.ArchivoReferencia) error {
+	ids := map[string][]int64{
+		models.TablaGrupo:        {},
+		models.TablaResolucion:   {},
+		models.TablaGrupoArchivo: {},
+	}
+	for _, ref := range faltantes {
+		ids[ref.Tabla] = append(ids[ref.Tabla], int64(ref.ID))
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting missing file transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op after a successful commit
+
+	queries := map[string]string{
+		models.TablaGrupo:        `UPDATE grupo SET archivoFaltante = (idGrupo = ANY($1)) WHERE archivoFaltante <> (idGrupo = ANY($1))`,
+		models.TablaResolucion:   `UPDATE Resolucion SET archivoFaltante = (idResolucion = ANY($1)) WHERE archivoFaltante <> (idResolucion = ANY($1))`,
+		models.TablaGrupoArchivo: `UPDATE Grupo_Archivo SET archivoFaltante = (idArchivo = ANY($1)) WHERE archivoFaltante <> (idArchivo = ANY($1))`,
+	}
+	for tabla, query := range queries {
+		if _, err := tx.Exec(query, pq.Array(ids[tabla])); err != nil {
+			return fmt.Errorf("error flagging missing files in %s: %w", tabla, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing missing file flags: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+)
+
+// GetRedColaboracion builds the collaboration network of the groups matching filter: a node
+// per group and per member, a membership edge per investigator and group, and a
+// collaboration edge between every two investigators who share groups, weighted by how many.
+func GetRedColaboracion(db *sql.DB, filter GrupoFilter) (*models.RedColaboracion, error) {
+	cte, b := filteredGroupsCTE(filter)
+	query := cte + `
+		SELECT g.idGrupo, g.nombre, g.lineaInvestigacion, g.facultad, i.idInvestigador, i.nombre, i.apellido, gi.rol
+		FROM FilteredGroups f
+		JOIN grupo g ON g.idGrupo = f.idGrupo
+		LEFT JOIN Grupo_Investigador gi ON gi.idGrupo = g.idGrupo
+		LEFT JOIN investigador i ON i.idInvestigador = gi.idInvestigador
+		ORDER BY g.idGrupo, i.idInvestigador, gi.rol`
+
+	rows, err := db.Query(query, b.args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying collaboration network: %w", err)
+	}
+	defer rows.Close()
+
+	c := newConstructorRed()
+	for rows.Next() {
+		var g models.NodoRed
+		var idInvestigador sql.NullInt64
+		var nombre, apellido, rol sql.NullString
+		if err := rows.Scan(&g.IDRegistro, &g.Etiqueta, &g.LineaInvestigacion, &g.Facultad, &idInvestigador, &nombre, &apellido, &rol); err != nil {
+			return nil, fmt.Errorf("error scanning collaboration network row: %w", err)
+		}
+		c.grupo(g)
+		if idInvestigador.Valid {
+			c.miembro(g.IDRegistro, int(idInvestigador.Int64), nombre.String+" "+apellido.String, rol.String)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating collaboration network rows: %w", err)
+	}
+	return c.red(), nil
+}
+
+// parRed is a pair of record IDs: (investigator, group) for memberships and
+// (lower, higher investigator) for collaborations.
+type parRed struct{ a, b int }
+
+// constructorRed accumulates the rows of the collaboration network. An investigator listed
+// more than once in a group (e.g. with two roles) gets a single membership edge, with the
+// roles joined, and counts once towards the weight of their collaborations.
+type constructorRed struct {
+	nodos          []models.NodoRed
+	aristas        []models.AristaRed
+	grupos         map[int]bool
+	investigadores map[int]bool
+	miembros       map[int][]int  // Distinct members of each group, in order of appearance
+	membresias     map[parRed]int // Index in aristas of each membership edge
+}
+
+func newConstructorRed() *constructorRed {
+	return &constructorRed{
+		nodos:          []models.NodoRed{},
+		aristas:        []models.AristaRed{},
+		grupos:         map[int]bool{},
+		investigadores: map[int]bool{},
+		miembros:       map[int][]int{},
+		membresias:     map[parRed]int{},
+	}
+}
+
+// grupo adds the node of a group the first time it is seen.
+func (c *constructorRed) grupo(g models.NodoRed) {
+	if c.grupos[g.IDRegistro] {
+		return
+	}
+	c.grupos[g.IDRegistro] = true
+	g.ID, g.Tipo = nodoGrupo(g.IDRegistro), models.NodoGrupo
+	c.nodos = append(c.nodos, g)
+}
+
+// miembro records that an investigator belongs to a group with a role.
+func (c *constructorRed) miembro(idGrupo, idInvestigador int, etiqueta, rol string) {
+	clave := parRed{idInvestigador, idGrupo}
+	if i, ok := c.membresias[clave]; ok {
+		if a := &c.aristas[i]; rol != "" && !strings.Contains(", "+a.Rol+", ", ", "+rol+", ") {
+			a.Rol = strings.TrimPrefix(a.Rol+", "+rol, ", ")
+		}
+		return
+	}
+
+	if !c.investigadores[idInvestigador] {
+		c.investigadores[idInvestigador] = true
+		c.nodos = append(c.nodos, models.NodoRed{
+			ID:         nodoInvestigador(idInvestigador),
+			Tipo:       models.NodoInvestigador,
+			IDRegistro: idInvestigador,
+			Etiqueta:   etiqueta,
+		})
+	}
+	c.membresias[clave] = len(c.aristas)
+	c.aristas = append(c.aristas, models.AristaRed{
+		Origen: nodoInvestigador(idInvestigador), Destino: nodoGrupo(idGrupo), Tipo: models.AristaMembresia, Rol: rol, Peso: 1,
+	})
+	c.miembros[idGrupo] = append(c.miembros[idGrupo], idInvestigador)
+}
+
+// red returns the network, adding the collaboration edges sorted by investigator.
+func (c *constructorRed) red() *models.RedColaboracion {
+	pesos := map[parRed]int{}
+	for _, ids := range c.miembros {
+		for x := 0; x < len(ids); x++ {
+			for y := x + 1; y < len(ids); y++ {
+				a, b := ids[x], ids[y]
+				if a > b {
+					a, b = b, a
+				}
+				pesos[parRed{a, b}]++
+			}
+		}
+	}
+	pares := make([]parRed, 0, len(pesos))
+	for p := range pesos {
+		pares = append(pares, p)
+	}
+	sort.Slice(pares, func(x, y int) bool {
+		if pares[x].a != pares[y].a {
+			return pares[x].a < pares[y].a
+		}
+		return pares[x].b < pares[y].b
+	})
+	aristas := c.aristas
+	for _, p := range pares {
+		aristas = append(aristas, models.AristaRed{
+			Origen: nodoInvestigador(p.a), Destino: nodoInvestigador(p.b), Tipo: models.AristaColaboracion, Peso: pesos[p],
+		})
+	}
+	return &models.RedColaboracion{Nodos: c.nodos, Aristas: aristas}
+}
+
+func nodoGrupo(id int) string {
+	return fmt.Sprintf("g%d", id)
+}
+
+func nodoInvestigador(id int) string {
+	return fmt.Sprintf("i%d", id)
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+)
+
+// filaRed is a row of the collaboration network query; idInvestigador 0 is a group
+// without members.
+type filaRed struct {
+	idGrupo, idInvestigador int
+	rol                     string
+}
+
+func construirRed(filas []filaRed) *models.RedColaboracion {
+	c := newConstructorRed()
+	for _, f := range filas {
+		c.grupo(models.NodoRed{IDRegistro: f.idGrupo, Etiqueta: nodoGrupo(f.idGrupo)})
+		if f.idInvestigador != 0 {
+			c.miembro(f.idGrupo, f.idInvestigador, nodoInvestigador(f.idInvestigador), f.rol)
+		}
+	}
+	return c.red()
+}
+
+func TestConstructorRed(t *testing.T) {
+	membresia := func(inv, grupo int, rol string) models.AristaRed {
+		return models.AristaRed{Origen: nodoInvestigador(inv), Destino: nodoGrupo(grupo), Tipo: models.AristaMembresia, Rol: rol, Peso: 1}
+	}
+	colaboracion := func(a, b, peso int) models.AristaRed {
+		return models.AristaRed{Origen: nodoInvestigador(a), Destino: nodoInvestigador(b), Tipo: models.AristaColaboracion, Peso: peso}
+	}
+
+	tests := []struct {
+		name    string
+		filas   []filaRed
+		nodos   []string
+		aristas []models.AristaRed
+	}{
+		{
+			name:    "empty",
+			nodos:   []string{},
+			aristas: []models.AristaRed{},
+		},
+		{
+			name:    "group without members",
+			filas:   []filaRed{{1, 0, ""}},
+			nodos:   []string{"g1"},
+			aristas: []models.AristaRed{},
+		},
+		{
+			name:  "weights count shared groups",
+			filas: []filaRed{{1, 10, "Coordinador"}, {1, 20, "Miembro"}, {1, 30, "Miembro"}, {2, 10, "Miembro"}, {2, 20, "Coordinador"}},
+			nodos: []string{"g1", "i10", "i20", "i30", "g2"},
+			aristas: []models.AristaRed{
+				membresia(10, 1, "Coordinador"), membresia(20, 1, "Miembro"), membresia(30, 1, "Miembro"),
+				membresia(10, 2, "Miembro"), membresia(20, 2, "Coordinador"),
+				colaboracion(10, 20, 2), colaboracion(10, 30, 1), colaboracion(20, 30, 1),
+			},
+		},
+		{
+			name:  "investigator listed twice in a group",
+			filas: []filaRed{{1, 10, "Coordinador"}, {1, 10, "Miembro"}, {1, 10, "Miembro"}, {1, 20, "Miembro"}},
+			nodos: []string{"g1", "i10", "i20"},
+			aristas: []models.AristaRed{
+				membresia(10, 1, "Coordinador, Miembro"), membresia(20, 1, "Miembro"),
+				colaboracion(10, 20, 1),
+			},
+		},
+		{
+			name:  "pairs keyed lower-higher whatever the row order",
+			filas: []filaRed{{1, 30, ""}, {1, 10, ""}, {2, 10, ""}, {2, 30, ""}},
+			nodos: []string{"g1", "i30", "i10", "g2"},
+			aristas: []models.AristaRed{
+				membresia(30, 1, ""), membresia(10, 1, ""), membresia(10, 2, ""), membresia(30, 2, ""),
+				colaboracion(10, 30, 2),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			red := construirRed(tt.filas)
+			nodos := []string{}
+			for _, n := range red.Nodos {
+				nodos = append(nodos, n.ID)
+			}
+			if !reflect.DeepEqual(nodos, tt.nodos) {
+				t.Errorf("nodos = %v, want %v", nodos, tt.nodos)
+			}
+			if !reflect.DeepEqual(red.Aristas, tt.aristas) {
+				t.Errorf("aristas =\n%+v\nwant\n%+v", red.Aristas, tt.aristas)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+)
+
+const resolucionesByGrupoQuery = `SELECT idResolucion, idGrupo, numero, tipo, fechaEmision, fechaVencimiento, oficinaEmisora, archivo, createdAt, updatedAt FROM Resolucion WHERE idGrupo = $1 ORDER BY fechaEmision DESC, idResolucion DESC`
+
+// resolucionVigente returns the current recognition among a group's resolutions, listed
+// newest first: the most recent recognition or renewal issued on or before hoy and not
+// expired by then (it is still valid on its expiry date). It returns nil if there is none.
+func resolucionVigente(resoluciones []models.Resolucion, hoy time.Time) *models.Resolucion {
+	dia := hoy.Format(time.DateOnly)
+	for i, res := range resoluciones {
+		if res.Tipo != models.TipoResolucionReconocimiento && res.Tipo != models.TipoResolucionRenovacion {
+			continue
+		}
+		if res.FechaEmision.Format(time.DateOnly) > dia {
+			continue
+		}
+		if res.FechaVencimiento != nil && res.FechaVencimiento.Format(time.DateOnly) < dia {
+			continue
+		}
+		return &resoluciones[i]
+	}
+	return nil
+}
+
+// CreateResolucion inserts a resolution and keeps grupo.numeroResolucion in sync with the
+// group's current recognition.
+func CreateResolucion(db *sql.DB, res *models.Resolucion) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting resolution transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op after a successful commit
+
+	query := `INSERT INTO Resolucion (idGrupo, numero, tipo, fechaEmision, fechaVencimiento, oficinaEmisora, archivo) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING idResolucion, createdAt, updatedAt`
+	err = tx.QueryRow(query, res.IDGrupo, res.Numero, res.Tipo, res.FechaEmision, res.FechaVencimiento, res.OficinaEmisora, res.Archivo).Scan(&res.ID, &res.CreatedAt, &res.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("error inserting resolution: %w", err)
+	}
+
+	// Denormalized copy kept for clients that still read grupo.numeroResolucion
+	resoluciones, err := queryResoluciones(tx, res.IDGrupo)
+	if err != nil {
+		return err
+	}
+	if vigente := resolucionVigente(resoluciones, time.Now()); vigente != nil {
+		_, err = tx.Exec(`UPDATE grupo SET numeroResolucion = $1, updatedAt = CURRENT_TIMESTAMP
+			WHERE idGrupo = $2 AND numeroResolucion <> $1`, vigente.Numero, res.IDGrupo)
+		if err != nil {
+			return fmt.Errorf("error syncing group resolution number: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing resolution: %w", err)
+	}
+	return nil
+}
+
+// GetResolucionesByGrupoID retrieves all resolutions of a group, newest first.
+func GetResolucionesByGrupoID(db *sql.DB, idGrupo int) ([]models.Resolucion, error) {
+	return queryResoluciones(db, idGrupo)
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx.
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func queryResoluciones(q queryer, idGrupo int) ([]models.Resolucion, error) {
+	rows, err := q.Query(resolucionesByGrupoQuery, idGrupo)
+	if err != nil {
+		return nil, fmt.Errorf("error querying resolutions by group ID: %w", err)
+	}
+	defer rows.Close()
+
+	resoluciones := []models.Resolucion{}
+	for rows.Next() {
+		res, err := scanResolucion(rows)
+		if err != nil {
+			return nil, err
+		}
+		resoluciones = append(resoluciones, *res)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after iterating resolution rows: %w", err)
+	}
+	return resoluciones, nil
+}
+
+// GetResolucionVigente retrieves the current recognition of a group (see
+// resolucionVigente), or nil if it has none.
+func GetResolucionVigente(db *sql.DB, idGrupo int) (*models.Resolucion, error) {
+	resoluciones, err := queryResoluciones(db, idGrupo)
+	if err != nil {
+		return nil, err
+	}
+	return resolucionVigente(resoluciones, time.Now()), nil
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanResolucion(row rowScanner) (*models.Resolucion, error) {
+	var res models.Resolucion
+	var vencimiento sql.NullTime
+	err := row.Scan(&res.ID, &res.IDGrupo, &res.Numero, &res.Tipo, &res.FechaEmision, &vencimiento, &res.OficinaEmisora, &res.Archivo, &res.CreatedAt, &res.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error scanning resolution row: %w", err)
+	}
+	if vencimiento.Valid {
+		res.FechaVencimiento = &vencimiento.Time
+	}
+	return &res, nil
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+)
+
+func TestResolucionVigente(t *testing.T) {
+	fecha := func(s string) time.Time {
+		d, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	vence := func(s string) *time.Time {
+		d := fecha(s)
+		return &d
+	}
+	// Local noon, like time.Now() on the server
+	hoy := time.Date(2025, 6, 15, 12, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name         string
+		resoluciones []models.Resolucion // Newest first, as GetResolucionesByGrupoID lists them
+		want         int                 // idResolucion, 0 for none
+	}{
+		{name: "no resolutions"},
+		{
+			name: "latest valid recognition",
+			resoluciones: []models.Resolucion{
+				{ID: 3, Tipo: models.TipoResolucionRenovacion, FechaEmision: fecha("2025-01-10"), FechaVencimiento: vence("2027-01-10")},
+				{ID: 1, Tipo: models.TipoResolucionReconocimiento, FechaEmision: fecha("2023-01-10"), FechaVencimiento: vence("2027-01-10")},
+			},
+			want: 3,
+		},
+		{
+			name: "modifications do not count",
+			resoluciones: []models.Resolucion{
+				{ID: 4, Tipo: models.TipoResolucionModificacion, FechaEmision: fecha("2025-05-01")},
+				{ID: 2, Tipo: models.TipoResolucionReconocimiento, FechaEmision: fecha("2024-01-10")},
+			},
+			want: 2,
+		},
+		{
+			name: "expired renewal falls back to an older one without expiry",
+			resoluciones: []models.Resolucion{
+				{ID: 5, Tipo: models.TipoResolucionRenovacion, FechaEmision: fecha("2024-06-01"), FechaVencimiento: vence("2025-06-14")},
+				{ID: 1, Tipo: models.TipoResolucionReconocimiento, FechaEmision: fecha("2020-03-01")},
+			},
+			want: 1,
+		},
+		{
+			name: "every recognition expired",
+			resoluciones: []models.Resolucion{
+				{ID: 1, Tipo: models.TipoResolucionReconocimiento, FechaEmision: fecha("2020-03-01"), FechaVencimiento: vence("2024-03-01")},
+			},
+		},
+		{
+			name: "still valid on its expiry date",
+			resoluciones: []models.Resolucion{
+				{ID: 1, Tipo: models.TipoResolucionReconocimiento, FechaEmision: fecha("2021-06-15"), FechaVencimiento: vence("2025-06-15")},
+			},
+			want: 1,
+		},
+		{
+			name: "future-dated renewal is not current yet",
+			resoluciones: []models.Resolucion{
+				{ID: 6, Tipo: models.TipoResolucionRenovacion, FechaEmision: fecha("2025-07-01"), FechaVencimiento: vence("2029-07-01")},
+				{ID: 1, Tipo: models.TipoResolucionReconocimiento, FechaEmision: fecha("2021-07-01"), FechaVencimiento: vence("2025-07-01")},
+			},
+			want: 1,
+		},
+		{
+			name: "issued today",
+			resoluciones: []models.Resolucion{
+				{ID: 7, Tipo: models.TipoResolucionReconocimiento, FechaEmision: fecha("2025-06-15")},
+			},
+			want: 7,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resolucionVigente(tt.resoluciones, hoy)
+			gotID := 0
+			if got != nil {
+				gotID = got.ID
+			}
+			if gotID != tt.want {
+				t.Errorf("resolucionVigente = %d, want %d", gotID, tt.want)
+			}
+		})
+	}
+}
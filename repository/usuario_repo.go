@@ -16,9 +16,13 @@ func CreateUsuario(db *sql.DB, u *models.Usuario) error {
 		return fmt.Errorf("error hashing password: %w", err)
 	}
 
+	if u.Rol == "" {
+		u.Rol = models.RolUsuario
+	}
+
 	// Store the hashed password
-	query := `INSERT INTO usuario (email, password) VALUES ($1, $2) RETURNING idusuario, created_at, updated_at`
-	err = db.QueryRow(query, u.Email, string(hashedPassword)).Scan(&u.ID, &u.CreatedAt, &u.UpdatedAt)
+	query := `INSERT INTO usuario (email, password, rol) VALUES ($1, $2, $3) RETURNING idusuario, created_at, updated_at`
+	err = db.QueryRow(query, u.Email, string(hashedPassword), u.Rol).Scan(&u.ID, &u.CreatedAt, &u.UpdatedAt)
 	if err != nil {
 		// Consider checking for unique constraint violation on email
 		return fmt.Errorf("error inserting user: %w", err)
@@ -33,8 +37,8 @@ func CreateUsuario(db *sql.DB, u *models.Usuario) error {
 func GetUsuarioByEmail(db *sql.DB, email string) (*models.Usuario, error) {
 	var u models.Usuario
 	// Select all necessary fields, including the password hash
-	query := `SELECT idusuario, email, password, created_at, updated_at FROM usuario WHERE email = $1`
-	err := db.QueryRow(query, email).Scan(&u.ID, &u.Email, &u.Password, &u.CreatedAt, &u.UpdatedAt)
+	query := `SELECT idusuario, email, password, rol, created_at, updated_at FROM usuario WHERE email = $1`
+	err := db.QueryRow(query, email).Scan(&u.ID, &u.Email, &u.Password, &u.Rol, &u.CreatedAt, &u.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil // User not found, return nil error and nil user
@@ -44,6 +48,29 @@ func GetUsuarioByEmail(db *sql.DB, email string) (*models.Usuario, error) {
 	return &u, nil
 }
 
+// GetUsuarioByID retrieves a user by ID. The password hash is not loaded.
+func GetUsuarioByID(db *sql.DB, id int) (*models.Usuario, error) {
+	var u models.Usuario
+	query := `SELECT idusuario, email, rol, created_at, updated_at FROM usuario WHERE idusuario = $1`
+	err := db.QueryRow(query, id).Scan(&u.ID, &u.Email, &u.Rol, &u.CreatedAt, &u.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error getting user by ID: %w", err)
+	}
+	return &u, nil
+}
+
+// UpdateUsuarioRol changes the application role of a user.
+func UpdateUsuarioRol(db *sql.DB, id int, rol string) error {
+	_, err := db.Exec(`UPDATE usuario SET rol = $1 WHERE idusuario = $2`, rol, id)
+	if err != nil {
+		return fmt.Errorf("error updating user role: %w", err)
+	}
+	return nil
+}
+
 // CheckPasswordHash compares a plaintext password with a stored hash.
 func CheckPasswordHash(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/lib/pq"
+)
+
+// Visibilidad restricts group queries to the groups a caller may see and, among them, to
+// the states they asked for.
+type Visibilidad struct {
+	Estados []string // Requested states; any state when empty
+	// SoloPublicos hides the groups outside models.EstadosPublicos, except those registered
+	// by Propietario (nil for anonymous callers).
+	SoloPublicos bool
+	Propietario  *int
+}
+
+// NewVisibilidad returns the visibility of a caller with role rol and user ID idUsuario
+// (empty and nil for anonymous callers) asking for estados. Reviewers and admins see every
+// group; everybody else, the public ones and those they registered.
+func NewVisibilidad(estados []string, rol string, idUsuario *int) Visibilidad {
+	v := Visibilidad{Estados: estados}
+	if rol != models.RolRevisor && rol != models.RolAdmin {
+		v.SoloPublicos = true
+		v.Propietario = idUsuario
+	}
+	return v
+}
+
+// EsEstadoPublico reports whether groups in estado are visible to everybody.
+func EsEstadoPublico(estado string) bool {
+	for _, e := range models.EstadosPublicos {
+		if estado == e {
+			return true
+		}
+	}
+	return false
+}
+
+// visibleCondition returns the conditions restricting the groups aliased alias to those
+// visible with v, joined with AND, or "" when every group is.
+func (b *queryBuilder) visibleCondition(alias string, v Visibilidad) string {
+	var conditions []string
+	if len(v.Estados) > 0 {
+		conditions = append(conditions, fmt.Sprintf(`%s.estado = ANY(%s)`, alias, b.arg(pq.Array(v.Estados))))
+	}
+	if v.SoloPublicos {
+		publicos := fmt.Sprintf(`%s.estado = ANY(%s)`, alias, b.arg(pq.Array(models.EstadosPublicos)))
+		if v.Propietario != nil {
+			publicos = fmt.Sprintf(`(%s OR %s.idUsuario = %s)`, publicos, alias, b.arg(*v.Propietario))
+		}
+		conditions = append(conditions, publicos)
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// documentoVisibleCondition returns a condition restricting the group documents aliased
+// alias (rows of Grupo_Documento) to those visible with v, or "" when every document is:
+// internal documents are only for reviewers and the group's owner.
+func (b *queryBuilder) documentoVisibleCondition(alias string, v Visibilidad) string {
+	if !v.SoloPublicos {
+		return ""
+	}
+	cond := fmt.Sprintf(`%s.visibilidad = 'publico'`, alias)
+	if v.Propietario != nil {
+		cond = fmt.Sprintf(`(%s OR %s.idGrupo IN (SELECT idGrupo FROM grupo WHERE idUsuario = %s))`, cond, alias, b.arg(*v.Propietario))
+	}
+	return cond
+}
+
+// whereVisible restricts the groups aliased alias to those visible with v.
+func (b *queryBuilder) whereVisible(alias string, v Visibilidad) {
+	if cond := b.visibleCondition(alias, v); cond != "" {
+		b.where(cond)
+	}
+}
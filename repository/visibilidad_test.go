@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/lib/pq"
+)
+
+func TestVisibilidad(t *testing.T) {
+	usuario := 7
+	publicos := pq.Array(models.EstadosPublicos)
+
+	tests := []struct {
+		name      string
+		vis       Visibilidad
+		wantWhere string
+		wantArgs  []interface{}
+	}{
+		{
+			name:      "anonymous",
+			vis:       NewVisibilidad(nil, "", nil),
+			wantWhere: ` WHERE g.estado = ANY($1)`,
+			wantArgs:  []interface{}{publicos},
+		},
+		{
+			name:      "anonymous asking for drafts",
+			vis:       NewVisibilidad([]string{"borrador"}, "", nil),
+			wantWhere: ` WHERE g.estado = ANY($1) AND g.estado = ANY($2)`,
+			wantArgs:  []interface{}{pq.Array([]string{"borrador"}), publicos},
+		},
+		{
+			name:      "user sees their own groups",
+			vis:       NewVisibilidad(nil, models.RolUsuario, &usuario),
+			wantWhere: ` WHERE (g.estado = ANY($1) OR g.idUsuario = $2)`,
+			wantArgs:  []interface{}{publicos, usuario},
+		},
+		{
+			name:      "user asking for drafts",
+			vis:       NewVisibilidad([]string{"borrador", "enviado"}, models.RolUsuario, &usuario),
+			wantWhere: ` WHERE g.estado = ANY($1) AND (g.estado = ANY($2) OR g.idUsuario = $3)`,
+			wantArgs:  []interface{}{pq.Array([]string{"borrador", "enviado"}), publicos, usuario},
+		},
+		{
+			name:      "reviewer sees every state",
+			vis:       NewVisibilidad(nil, models.RolRevisor, &usuario),
+			wantWhere: ``,
+		},
+		{
+			name:      "admin filters by state",
+			vis:       NewVisibilidad([]string{"en_revision"}, models.RolAdmin, &usuario),
+			wantWhere: ` WHERE g.estado = ANY($1)`,
+			wantArgs:  []interface{}{pq.Array([]string{"en_revision"})},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b queryBuilder
+			b.whereVisible("g", tt.vis)
+			if got := b.whereClause(); got != tt.wantWhere {
+				t.Errorf("whereClause = %q, want %q", got, tt.wantWhere)
+			}
+			if !reflect.DeepEqual(b.args, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", b.args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestDocumentoVisibleCondition(t *testing.T) {
+	usuario := 7
+	tests := []struct {
+		name     string
+		vis      Visibilidad
+		want     string
+		wantArgs []interface{}
+	}{
+		{name: "anonymous", vis: NewVisibilidad(nil, "", nil), want: `d.visibilidad = 'publico'`},
+		{
+			name:     "user sees internal documents of their groups",
+			vis:      NewVisibilidad(nil, models.RolUsuario, &usuario),
+			want:     `(d.visibilidad = 'publico' OR d.idGrupo IN (SELECT idGrupo FROM grupo WHERE idUsuario = $1))`,
+			wantArgs: []interface{}{usuario},
+		},
+		{name: "reviewer sees every document", vis: NewVisibilidad(nil, models.RolRevisor, &usuario), want: ``},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b queryBuilder
+			if got := b.documentoVisibleCondition("d", tt.vis); got != tt.want {
+				t.Errorf("documentoVisibleCondition = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(b.args, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", b.args, tt.wantArgs)
+			}
+		})
+	}
+}
@@ -2,58 +2,132 @@ package routes
 
 import (
 	"database/sql"
-	"net/http"
 
 	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/controllers"
 	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/middleware"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/models"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/scanner"
+	"github.com/GoogleCloudPlatform/golang-samples/run/helloworld/storage"
 	"github.com/gorilla/mux"
 )
 
 // SetupRoutes configures the application routes.
-func SetupRoutes(db *sql.DB) *mux.Router {
+func SetupRoutes(db *sql.DB, store storage.Storage, sc scanner.Scanner) *mux.Router {
 	r := mux.NewRouter()
 
 	// --- Authentication Routes (Public) ---
 	r.HandleFunc("/register", controllers.RegisterHandler(db)).Methods("POST")
 	r.HandleFunc("/login", controllers.LoginHandler(db)).Methods("POST")
 
+	// tus discovery for resumable uploads
+	r.HandleFunc("/cargas", controllers.OpcionesCargaHandler()).Methods("OPTIONS")
+
 	// --- Public GET Routes (No Auth Required) ---
-	r.HandleFunc("/investigadores", controllers.GetInvestigadoresHandler(db)).Methods("GET")
-	r.HandleFunc("/investigadores/all", controllers.GetAllInvestigadoresNoPaginationHandler(db)).Methods("GET")
-	r.HandleFunc("/investigadores/{id}", controllers.GetInvestigadorHandler(db)).Methods("GET")
-	r.HandleFunc("/investigadores/{idInvestigador}/grupos", controllers.GetGruposByInvestigadorHandler(db)).Methods("GET")
-	r.HandleFunc("/grupos", controllers.GetGruposHandler(db)).Methods("GET")
-	r.HandleFunc("/grupos/{id}", controllers.GetGrupoHandler(db)).Methods("GET")
-	r.HandleFunc("/grupos/{id}/details", controllers.GetGrupoDetailsHandler(db)).Methods("GET")
-	r.HandleFunc("/grupos/with-details", controllers.GetAllGruposWithDetailsHandler(db)).Methods("GET")
-	r.HandleFunc("/detalles/{id}", controllers.GetDetalleGrupoInvestigadorHandler(db)).Methods("GET")
-	r.HandleFunc("/grupos/{grupoID}/detalles", controllers.GetDetallesByGrupoHandler(db)).Methods("GET")
-
-	// Static file server (public)
-	fs := http.FileServer(http.Dir("./uploads/"))
-	r.PathPrefix("/uploads/").Handler(http.StripPrefix("/uploads/", fs))
+	// A valid token is optional here: anonymous callers only see approved/active groups,
+	// users also their own groups, and reviewers every group.
+	publicRouter := r.PathPrefix("").Subrouter()
+	publicRouter.Use(middleware.OptionalJWTMiddleware)
+	publicRouter.Use(middleware.OptionalCurrentRoleMiddleware(db))
+
+	publicRouter.HandleFunc("/investigadores", controllers.GetInvestigadoresHandler(db)).Methods("GET")
+	publicRouter.HandleFunc("/investigadores/all", controllers.GetAllInvestigadoresNoPaginationHandler(db)).Methods("GET")
+	publicRouter.HandleFunc("/investigadores/sugerencias", controllers.GetSugerenciasInvestigadorHandler(db)).Methods("GET")
+	publicRouter.HandleFunc("/investigadores/export", controllers.ExportInvestigadoresHandler(db)).Methods("GET")
+	publicRouter.HandleFunc("/investigadores/{id:[0-9]+}", controllers.GetInvestigadorHandler(db)).Methods("GET") // Numeric, so admin paths such as /investigadores/duplicados fall through
+	publicRouter.HandleFunc("/investigadores/{idInvestigador}/grupos", controllers.GetGruposByInvestigadorHandler(db)).Methods("GET")
+	publicRouter.HandleFunc("/grupos", controllers.GetGruposHandler(db)).Methods("GET")
+	publicRouter.HandleFunc("/grupos/with-details", controllers.GetAllGruposWithDetailsHandler(db)).Methods("GET")
+	publicRouter.HandleFunc("/grupos/export", controllers.ExportGruposHandler(db)).Methods("GET")
+	publicRouter.HandleFunc("/grupos/{id}", controllers.GetGrupoHandler(db)).Methods("GET")
+	publicRouter.HandleFunc("/grupos/{id}/details", controllers.GetGrupoDetailsHandler(db)).Methods("GET")
+	publicRouter.HandleFunc("/grupos/{id}/reporte.pdf", controllers.GetReporteGrupoHandler(db)).Methods("GET")
+	publicRouter.HandleFunc("/grupos/{id}/resoluciones", controllers.GetResolucionesByGrupoHandler(db)).Methods("GET")
+	publicRouter.HandleFunc("/grupos/{id}/resoluciones/vigente", controllers.GetResolucionVigenteHandler(db)).Methods("GET")
+	publicRouter.HandleFunc("/grupos/{id}/archivos", controllers.GetArchivosByGrupoHandler(db)).Methods("GET")
+	publicRouter.HandleFunc("/grupos/{id}/archivos/{idArchivo}", controllers.DownloadGrupoArchivoHandler(db, store)).Methods("GET")
+	publicRouter.HandleFunc("/detalles/{id}", controllers.GetDetalleGrupoInvestigadorHandler(db)).Methods("GET")
+	publicRouter.HandleFunc("/grupos/{grupoID}/detalles", controllers.GetDetallesByGrupoHandler(db)).Methods("GET")
+	publicRouter.HandleFunc("/buscar", controllers.BuscarHandler(db)).Methods("GET")
+	publicRouter.HandleFunc("/verificar/{codigo}", controllers.VerificarConstanciaHandler(db)).Methods("GET")
+
+	// Statistics for the dashboard, over the groups visible to the caller
+	publicRouter.HandleFunc("/estadisticas/grupos/{dimension}", controllers.GetEstadisticaGruposHandler(db)).Methods("GET")
+	publicRouter.HandleFunc("/estadisticas/integrantes", controllers.GetEstadisticaIntegrantesHandler(db)).Methods("GET")
+	publicRouter.HandleFunc("/estadisticas/investigadores/multigrupo", controllers.GetInvestigadoresMultigrupoHandler(db)).Methods("GET")
+	publicRouter.HandleFunc("/estadisticas/grupos-sin-coordinador", controllers.GetGruposSinCoordinadorHandler(db)).Methods("GET")
+	publicRouter.HandleFunc("/red/colaboracion", controllers.GetRedColaboracionHandler(db)).Methods("GET")
+
+	// Uploaded files, streamed from the configured storage backend. Anonymous clients only
+	// get public documents; internal ones are reached through signed URLs.
+	publicRouter.HandleFunc("/uploads/{key:.+}", controllers.ServeUploadHandler(db, store)).Methods("GET")
+	publicRouter.HandleFunc("/descargas/{idArchivo}", controllers.DownloadFirmadoHandler(db, store)).Methods("GET")
 
 	// --- Protected Routes (Auth Required) ---
 
 	// Create a subrouter for authenticated routes
 	authRouter := r.PathPrefix("").Subrouter()
-	authRouter.Use(middleware.JWTMiddleware) // Apply JWT middleware to this subrouter
+	authRouter.Use(middleware.JWTMiddleware)             // Apply JWT middleware to this subrouter
+	authRouter.Use(middleware.CurrentRoleMiddleware(db)) // Roles are read from Usuario, not from the token
 
 	// Investigador (Create, Update, Delete)
 	authRouter.HandleFunc("/investigadores", controllers.CreateInvestigadorHandler(db)).Methods("POST")
 	authRouter.HandleFunc("/investigadores/{id}", controllers.UpdateInvestigadorHandler(db)).Methods("PUT")
 	authRouter.HandleFunc("/investigadores/{id}", controllers.DeleteInvestigadorHandler(db)).Methods("DELETE")
+	authRouter.HandleFunc("/investigadores/{id}/constancias", controllers.CreateConstanciaHandler(db)).Methods("POST") // Issues a signed PDF certificate
+	authRouter.HandleFunc("/investigadores/{id:[0-9]+}/constancia.pdf", controllers.GetConstanciaInvestigadorHandler(db)).Methods("GET")
 
 	// Grupo (Create, Update, Delete, Create with Details)
-	authRouter.HandleFunc("/grupos", controllers.CreateGrupoHandler(db)).Methods("POST") // Handles file upload
+	authRouter.HandleFunc("/grupos", controllers.CreateGrupoHandler(db, store, sc)).Methods("POST") // Handles file upload
 	authRouter.HandleFunc("/grupos/with-details", controllers.CreateGrupoWithDetailsHandler(db)).Methods("POST")
-	authRouter.HandleFunc("/grupos/{id}", controllers.UpdateGrupoHandler(db)).Methods("PUT") // Handles file upload
+	authRouter.HandleFunc("/grupos/{id}", controllers.UpdateGrupoHandler(db, store, sc)).Methods("PUT") // Handles file upload
 	authRouter.HandleFunc("/grupos/{id}", controllers.DeleteGrupoHandler(db)).Methods("DELETE")
 
+	// Grupo attachments
+	authRouter.HandleFunc("/grupos/{id}/archivos", controllers.CreateGrupoArchivoHandler(db, store, sc)).Methods("POST") // Handles file upload
+	authRouter.HandleFunc("/grupos/{id}/archivos/{idArchivo}", controllers.DeleteGrupoArchivoHandler(db, store)).Methods("DELETE")
+	authRouter.HandleFunc("/grupos/{id}/archivos/{idArchivo}/enlace", controllers.GetEnlaceDescargaHandler(db)).Methods("GET")
+
+	// Resumable (tus) uploads of group attachments
+	authRouter.HandleFunc("/cargas", controllers.CreateCargaHandler(db)).Methods("POST")
+	authRouter.HandleFunc("/cargas/{idCarga}", controllers.HeadCargaHandler(db)).Methods("HEAD")
+	authRouter.HandleFunc("/cargas/{idCarga}", controllers.GetCargaHandler(db)).Methods("GET")
+	authRouter.HandleFunc("/cargas/{idCarga}", controllers.PatchCargaHandler(db, store, sc)).Methods("PATCH")
+	authRouter.HandleFunc("/cargas/{idCarga}", controllers.DeleteCargaHandler(db, store)).Methods("DELETE")
+
+	// Grupo lifecycle (role checks per transition are done in the handler)
+	authRouter.HandleFunc("/grupos/{id}/estado", controllers.CambiarEstadoGrupoHandler(db)).Methods("POST")
+	authRouter.HandleFunc("/grupos/{id}/historial", controllers.GetHistorialEstadosGrupoHandler(db)).Methods("GET")
+
 	// DetalleGrupoInvestigador (Create, Update, Delete)
 	authRouter.HandleFunc("/detalles", controllers.CreateDetalleGrupoInvestigadorHandler(db)).Methods("POST")
 	authRouter.HandleFunc("/detalles/{id}", controllers.UpdateDetalleGrupoInvestigadorHandler(db)).Methods("PUT")
 	authRouter.HandleFunc("/detalles/{id}", controllers.DeleteDetalleGrupoInvestigadorHandler(db)).Methods("DELETE")
 
+	// Saved group searches of the current user and their alerts
+	authRouter.HandleFunc("/busquedas", controllers.CreateBusquedaGuardadaHandler(db)).Methods("POST")
+	authRouter.HandleFunc("/busquedas", controllers.GetBusquedasGuardadasHandler(db)).Methods("GET")
+	authRouter.HandleFunc("/busquedas/{id}", controllers.GetBusquedaGuardadaHandler(db)).Methods("GET")
+	authRouter.HandleFunc("/busquedas/{id}", controllers.UpdateBusquedaGuardadaHandler(db)).Methods("PUT")
+	authRouter.HandleFunc("/busquedas/{id}", controllers.DeleteBusquedaGuardadaHandler(db)).Methods("DELETE")
+	authRouter.HandleFunc("/busquedas/{id}/resultados", controllers.GetResultadosBusquedaGuardadaHandler(db)).Methods("GET")
+	authRouter.HandleFunc("/alertas", controllers.GetAlertasHandler(db)).Methods("GET")
+	authRouter.HandleFunc("/alertas/leidas", controllers.MarcarAlertasLeidasHandler(db)).Methods("POST")
+
+	// Resolucion upload (issued by the research office)
+	revisorRouter := authRouter.PathPrefix("").Subrouter()
+	revisorRouter.Use(middleware.RequireRole(models.RolRevisor, models.RolAdmin))
+	revisorRouter.HandleFunc("/grupos/{id}/resoluciones", controllers.CreateResolucionHandler(db, store, sc)).Methods("POST") // Handles file upload
+	revisorRouter.HandleFunc("/importar", controllers.ImportarHandler(db)).Methods("POST")                                    // Bulk import of groups and investigators
+
+	// Usuario administration (admin only)
+	adminRouter := authRouter.PathPrefix("").Subrouter()
+	adminRouter.Use(middleware.RequireRole(models.RolAdmin))
+	adminRouter.HandleFunc("/usuarios/{id}/rol", controllers.UpdateUsuarioRolHandler(db)).Methods("PUT")
+
+	// Duplicate investigator records
+	adminRouter.HandleFunc("/investigadores/duplicados", controllers.GetDuplicadosInvestigadoresHandler(db)).Methods("GET")
+	adminRouter.HandleFunc("/investigadores/fusiones", controllers.GetFusionesInvestigadoresHandler(db)).Methods("GET")
+	adminRouter.HandleFunc("/investigadores/{id}/fusionar", controllers.FusionarInvestigadoresHandler(db)).Methods("POST")
+
 	return r
 }
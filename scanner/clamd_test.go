@@ -0,0 +1,160 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeSession is what a fake clamd received on its connection.
+type fakeSession struct {
+	command string
+	chunks  []int
+	data    []byte
+	err     error
+}
+
+// fakeClamd accepts one connection on a local port, reads an INSTREAM command and answers
+// reply. The command, the length of each chunk and the streamed bytes are sent to the
+// returned channel once the zero-length chunk arrives.
+func fakeClamd(t *testing.T, reply string) (string, <-chan fakeSession) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	done := make(chan fakeSession, 1)
+	go func() {
+		var s fakeSession
+		defer func() { done <- s }()
+		conn, err := ln.Accept()
+		if err != nil {
+			s.err = err
+			return
+		}
+		defer conn.Close()
+
+		command := make([]byte, len("zINSTREAM\x00"))
+		if _, s.err = io.ReadFull(conn, command); s.err != nil {
+			return
+		}
+		s.command = string(command)
+		size := make([]byte, 4)
+		for {
+			if _, s.err = io.ReadFull(conn, size); s.err != nil {
+				return
+			}
+			n := binary.BigEndian.Uint32(size)
+			s.chunks = append(s.chunks, int(n))
+			if n == 0 {
+				break
+			}
+			chunk := make([]byte, n)
+			if _, s.err = io.ReadFull(conn, chunk); s.err != nil {
+				return
+			}
+			s.data = append(s.data, chunk...)
+		}
+		_, s.err = conn.Write([]byte(reply))
+	}()
+	return ln.Addr().String(), done
+}
+
+func TestClamdScannerInstream(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789"), clamdChunkSize/10+1) // Two chunks
+
+	tests := []struct {
+		name    string
+		reply   string
+		want    Result
+		wantErr bool
+	}{
+		{name: "clean", reply: "stream: OK\x00", want: Result{}},
+		{
+			name:  "infected",
+			reply: "stream: Eicar-Test-Signature FOUND\x00",
+			want:  Result{Infected: true, Signature: "Eicar-Test-Signature"},
+		},
+		{name: "error", reply: "INSTREAM size limit exceeded. ERROR\x00", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, done := fakeClamd(t, tt.reply)
+			s := &ClamdScanner{Address: addr, Timeout: 5 * time.Second}
+
+			got, err := s.Scan(context.Background(), bytes.NewReader(payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Scan error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Scan = %+v, want %+v", got, tt.want)
+			}
+
+			session := <-done
+			if session.err != nil {
+				t.Fatalf("fake clamd: %v", session.err)
+			}
+			if session.command != "zINSTREAM\x00" {
+				t.Errorf("command = %q, want %q", session.command, "zINSTREAM\x00")
+			}
+			wantChunks := []int{clamdChunkSize, len(payload) - clamdChunkSize, 0}
+			if !reflect.DeepEqual(session.chunks, wantChunks) {
+				t.Errorf("chunk lengths = %v, want %v", session.chunks, wantChunks)
+			}
+			if !bytes.Equal(session.data, payload) {
+				t.Errorf("streamed %d bytes, want the %d bytes of the payload", len(session.data), len(payload))
+			}
+		})
+	}
+}
+
+func TestClamdScannerUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	s := &ClamdScanner{Address: addr, Timeout: time.Second}
+	got, err := s.Scan(context.Background(), bytes.NewReader([]byte("data")))
+	if err == nil {
+		t.Fatal("Scan with clamd down succeeded, want an error so the file stays pending")
+	}
+	if got.Infected {
+		t.Errorf("Scan = %+v, want an empty result", got)
+	}
+}
+
+func TestParseClamdReply(t *testing.T) {
+	tests := []struct {
+		reply   string
+		want    Result
+		wantErr bool
+	}{
+		{reply: "stream: OK\x00", want: Result{}},
+		{reply: "stream: OK\n", want: Result{}},
+		{reply: "stream: Win.Test.EICAR_HDB-1 FOUND\x00", want: Result{Infected: true, Signature: "Win.Test.EICAR_HDB-1"}},
+		{reply: "INSTREAM size limit exceeded. ERROR\x00", wantErr: true},
+		{reply: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseClamdReply(tt.reply)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseClamdReply(%q) error = %v, wantErr %v", tt.reply, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseClamdReply(%q) = %+v, want %+v", tt.reply, got, tt.want)
+		}
+	}
+}
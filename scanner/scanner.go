@@ -0,0 +1,73 @@
+// Package scanner checks uploaded files for malware before they are served.
+package scanner
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// CuarentenaDir is the storage prefix infected files are moved under. They are never served.
+const CuarentenaDir = "cuarentena"
+
+// Result is the outcome of scanning one file.
+type Result struct {
+	Infected  bool
+	Signature string // Name of the detected malware, if any
+}
+
+// Scanner scans a stream for malware.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
+
+// ErrNotConfigured is returned by Unconfigured for every scan.
+var ErrNotConfigured = errors.New("no malware scanner configured")
+
+// NewFromEnv returns a clamd scanner when CLAMD_ADDRESS is set (e.g. "localhost:3310" or
+// "unix:/var/run/clamav/clamd.ctl"). Otherwise it fails closed: uploads stay pending and are
+// not served until a scanner is configured, unless ESCANEO_DISABLED=true explicitly turns
+// scanning off. CLAMD_TIMEOUT (default 60s) bounds each scan.
+func NewFromEnv() Scanner {
+	address := os.Getenv("CLAMD_ADDRESS")
+	if address == "" {
+		if os.Getenv("ESCANEO_DISABLED") == "true" {
+			log.Print("Warning: ESCANEO_DISABLED=true, uploaded files will NOT be scanned for malware")
+			return NoopScanner{}
+		}
+		log.Print("Warning: CLAMD_ADDRESS not set, uploaded files will stay pending until a scanner is configured")
+		return Unconfigured{}
+	}
+	timeout := 60 * time.Second
+	if timeoutStr := os.Getenv("CLAMD_TIMEOUT"); timeoutStr != "" {
+		parsed, err := time.ParseDuration(timeoutStr)
+		if err != nil || parsed <= 0 {
+			log.Printf("Warning: invalid CLAMD_TIMEOUT %q, using %s", timeoutStr, timeout)
+		} else {
+			timeout = parsed
+		}
+	}
+	log.Printf("scanning uploaded files with clamd at %s", address)
+	return &ClamdScanner{Address: address, Timeout: timeout}
+}
+
+// NoopScanner reports every file as clean. It is only used when scanning is explicitly
+// disabled with ESCANEO_DISABLED=true.
+type NoopScanner struct{}
+
+// Scan consumes nothing and reports the file as clean.
+func (NoopScanner) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	return Result{}, nil
+}
+
+// Unconfigured fails every scan with ErrNotConfigured, so files are kept pending instead
+// of being served unscanned. It is used when CLAMD_ADDRESS is not set.
+type Unconfigured struct{}
+
+// Scan always returns ErrNotConfigured.
+func (Unconfigured) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	return Result{}, ErrNotConfigured
+}
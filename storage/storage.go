@@ -0,0 +1,97 @@
+// Package storage abstracts where uploaded files are kept. The backend is chosen by
+// configuration: the local filesystem for development, or an S3-compatible object store
+// (AWS S3, MinIO, Cloud Storage interoperability) where the local disk is ephemeral.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when the requested key does not exist.
+var ErrNotFound = errors.New("storage: object not found")
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// Storage stores and retrieves files by key. Keys are slash-separated relative paths
+// such as "uploads/1700000000_plan.pdf".
+type Storage interface {
+	// Save writes the content of r under key. size is the content length, or -1 if unknown.
+	Save(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Open returns a reader for key and its metadata. The caller must close the reader. The
+	// reader also implements io.Seeker when the backend can read from any offset.
+	Open(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error)
+	// Delete removes key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+	// List returns every object whose key starts with prefix (e.g. "uploads/").
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+}
+
+// NewFromEnv builds the storage backend selected by STORAGE_DRIVER ("local" by default, or "s3").
+//
+// Local: STORAGE_LOCAL_ROOT (default ".").
+// S3: S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY and S3_REGION (default us-east-1).
+func NewFromEnv() (Storage, error) {
+	driver := os.Getenv("STORAGE_DRIVER")
+	switch driver {
+	case "", "local":
+		root := os.Getenv("STORAGE_LOCAL_ROOT")
+		if root == "" {
+			root = "."
+		}
+		log.Printf("using local file storage at %s", root)
+		return NewLocalStorage(root), nil
+	case "s3":
+		cfg := S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			Region:          os.Getenv("S3_REGION"),
+		}
+		if cfg.Endpoint == "" || cfg.Bucket == "" || cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+			return nil, fmt.Errorf("S3 storage requires S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY")
+		}
+		log.Printf("using S3 file storage at %s/%s", cfg.Endpoint, cfg.Bucket)
+		return NewS3Storage(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_DRIVER %q (use 'local' or 's3')", driver)
+	}
+}
+
+// cleanKey normalizes a key and rejects keys that would escape the storage root.
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean("/" + strings.ReplaceAll(key, "\\", "/"))
+	cleaned = strings.TrimPrefix(cleaned, "/")
+	if cleaned == "" || cleaned == "." {
+		return "", fmt.Errorf("storage: invalid key %q", key)
+	}
+	return cleaned, nil
+}
+
+// DeletePrefix removes every object whose key starts with prefix.
+func DeletePrefix(ctx context.Context, s Storage, prefix string) error {
+	objects, err := s.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		if err := s.Delete(ctx, obj.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// SignResource returns a hex HMAC-SHA256 signature binding resource to an expiry time.
+// It is used for time-limited download URLs.
+func SignResource(secret []byte, resource string, expires time.Time) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(resource + "\n" + strconv.FormatInt(expires.Unix(), 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyResourceSignature checks a signature produced by SignResource and that it has not expired.
+// expiresStr is the Unix timestamp sent along with the signature.
+func VerifyResourceSignature(secret []byte, resource, expiresStr, signature string) bool {
+	expiresUnix, err := strconv.ParseInt(expiresStr, 10, 64)
+	if err != nil {
+		return false
+	}
+	expires := time.Unix(expiresUnix, 0)
+	if time.Now().After(expires) {
+		return false
+	}
+	expected := SignResource(secret, resource, expires)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// SignContent returns a hex HMAC-SHA256 signature of a document identified by codigo.
+// It is used for issued certificates, which never expire.
+func SignContent(secret []byte, codigo, contenido string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(codigo + "\n" + contenido))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyContentSignature checks a signature produced by SignContent.
+func VerifyContentSignature(secret []byte, codigo, contenido, signature string) bool {
+	expected := SignContent(secret, codigo, contenido)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// QuitarTildes removes the accents of s by decomposing it (NFD) and dropping the combining
+// marks, which covers any accented letter, as PostgreSQL's unaccent does, and not only
+// those of Spanish.
+func QuitarTildes(s string) string {
+	sinTildes, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), s)
+	if err != nil {
+		return s
+	}
+	return sinTildes
+}
+
+// NormalizarNombre returns the comparison key of a name: lower case, without accents and
+// with single spaces, so "José  QUISPE" and "jose quispe" are the same person.
+func NormalizarNombre(nombre string) string {
+	return strings.Join(strings.Fields(strings.ToLower(QuitarTildes(nombre))), " ")
+}
@@ -0,0 +1,25 @@
+package utils
+
+import "testing"
+
+func TestNormalizarNombre(t *testing.T) {
+	tests := []struct {
+		nombre string
+		want   string
+	}{
+		{"", ""},
+		{"   ", ""},
+		{"José  QUISPE", "jose quispe"},
+		{" María\tÑahui\nCcori ", "maria nahui ccori"},
+		{"ÁÉÍÓÚ Üü", "aeiou uu"},
+		{"Çelik Ångström", "celik angstrom"},
+		{"José", "jose"}, // Already decomposed: e + combining acute accent
+		{"Grupo de I+D (Robótica)", "grupo de i+d (robotica)"},
+		{"Łukasz", "łukasz"}, // Letters without a decomposition are kept
+	}
+	for _, tt := range tests {
+		if got := NormalizarNombre(tt.nombre); got != tt.want {
+			t.Errorf("NormalizarNombre(%q) = %q, want %q", tt.nombre, got, tt.want)
+		}
+	}
+}